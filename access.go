@@ -0,0 +1,329 @@
+package rest
+
+import (
+	"fmt"
+	"net/http"
+	"reflect"
+	"strings"
+	"sync"
+)
+
+// Redactor - optional Authorizer extension removing what the caller may not read from the response before it is
+// encoded
+type Redactor interface {
+	Redact(model *Model)
+}
+
+// authorizers - an Authorizer requiring several
+type authorizers []Authorizer
+
+// Authorizers - an Authorizer requiring all of the authorizers, in order, to allow the request
+func Authorizers(list ...Authorizer) Authorizer {
+	return authorizers(list)
+}
+
+// Authorize -
+func (list authorizers) Authorize(model *Model) error {
+	for _, a := range list {
+		if err := a.Authorize(model); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// Redact -
+func (list authorizers) Redact(model *Model) {
+	for _, a := range list {
+		if r, ok := a.(Redactor); ok {
+			r.Redact(model)
+		}
+	}
+}
+
+// Ownership - an Authorizer letting callers see and change their own documents only, those whose Field holds the
+// subject of the caller. Inserted documents are stamped with the caller as their owner. Callers with any of the
+// Bypass roles are not restricted.
+type Ownership struct {
+	Field  string
+	Bypass []string
+}
+
+// Authorize -
+func (o *Ownership) Authorize(model *Model) error {
+	action, _ := model.Get(ACTION).(string)
+	principal := model.GetPrincipal()
+	if principal.hasAny(o.Bypass) {
+		return nil
+	}
+	if principal == nil {
+		return forbidden(model, action)
+	}
+	return model.scope(o.Field, principal.Subject)
+}
+
+// scope restricts the request to the documents whose field holds value, stamping it on inserted documents
+func (model *Model) scope(name, value string) error {
+	action, _ := model.Get(ACTION).(string)
+	t := model.Get(DATATYPE).(reflect.Type)
+	f, ok := lookupField(t, name)
+	if !ok {
+		model.SetResponseStatus(http.StatusInternalServerError)
+		model.SetResponseBody(http.StatusText(http.StatusInternalServerError))
+		return fmt.Errorf("The field %q is not a field of %s", name, t)
+	}
+	v, err := parseValue(value, f.Type)
+	if err != nil {
+		return forbidden(model, action)
+	}
+	switch action {
+	case INSERTONE, INSERTMANY, UPDATE, UPSERT:
+		eachDocument(model.Get(REQUESTBODY), func(doc reflect.Value) {
+			setField(settableField(doc, f.Index), v)
+		})
+	}
+	switch action {
+	case FINDONE, FINDMANY, UPDATE, UPSERT, REMOVE:
+		q := model.GetQuery()
+		if q == nil {
+			q = &Query{}
+			model.Set(QUERY, q)
+		}
+		q.Filters = append(q.Filters, Filter{Field: f.Name, Operator: EQ, Value: v})
+	}
+	return nil
+}
+
+// eachDocument calls fn with the addressable documents of a request body, a document or a list of them
+func eachDocument(body interface{}, fn func(doc reflect.Value)) {
+	v := reflect.ValueOf(body)
+	for v.Kind() == reflect.Ptr || v.Kind() == reflect.Interface {
+		if v.IsNil() {
+			return
+		}
+		v = v.Elem()
+	}
+	switch v.Kind() {
+	case reflect.Struct:
+		if v.CanAddr() {
+			fn(v)
+		}
+	case reflect.Slice:
+		for i := 0; i < v.Len(); i++ {
+			if item := v.Index(i); item.Kind() == reflect.Struct && item.CanAddr() {
+				fn(item)
+			} else {
+				eachDocument(item.Interface(), fn)
+			}
+		}
+	}
+}
+
+// setField sets a field to a value of its type or of the type it points to
+func setField(f reflect.Value, v interface{}) {
+	value := reflect.ValueOf(v)
+	if f.Kind() == reflect.Ptr {
+		p := reflect.New(f.Type().Elem())
+		p.Elem().Set(value.Convert(f.Type().Elem()))
+		f.Set(p)
+		return
+	}
+	f.Set(value.Convert(f.Type()))
+}
+
+// fieldAccess - the roles allowed to read and write a field, anyone when there are none
+type fieldAccess struct {
+	Read  []string
+	Write []string
+}
+
+var accessCache = struct {
+	sync.RWMutex
+	m map[reflect.Type]map[string]fieldAccess
+}{m: make(map[reflect.Type]map[string]fieldAccess)}
+
+// accessTags returns the access rules of the fields of a type keyed by their JSON names, from tags such as
+// `access:"read=admin|hr,write=admin"`
+func accessTags(t reflect.Type) (map[string]fieldAccess, error) {
+	accessCache.RLock()
+	rules, ok := accessCache.m[t]
+	accessCache.RUnlock()
+	if ok {
+		return rules, nil
+	}
+	rules = make(map[string]fieldAccess)
+	for _, f := range typeFields(t) {
+		tag := f.Tag.Get("access")
+		if tag == "" {
+			continue
+		}
+		var access fieldAccess
+		for _, directive := range strings.Split(tag, ",") {
+			parts := strings.SplitN(strings.TrimSpace(directive), "=", 2)
+			if len(parts) != 2 || parts[1] == "" {
+				return nil, fmt.Errorf("The access tag of %s is malformed: %q", f.Name, tag)
+			}
+			roles := strings.Split(parts[1], "|")
+			switch parts[0] {
+			case "read":
+				access.Read = roles
+			case "write":
+				access.Write = roles
+			default:
+				return nil, fmt.Errorf("The access tag of %s has an unknown directive %q", f.Name, parts[0])
+			}
+		}
+		rules[f.Name] = access
+	}
+	accessCache.Lock()
+	accessCache.m[t] = rules
+	accessCache.Unlock()
+	return rules, nil
+}
+
+// FieldAccess - an Authorizer enforcing the access struct tags of the resource type, e.g.
+// `access:"read=admin|hr,write=admin"`. Requests changing fields the caller may not write are answered with 403,
+// such fields left out of update and upsert bodies, or zero, keep their stored value. Fields the caller may not
+// read are removed from responses.
+type FieldAccess struct{}
+
+// Authorize -
+func (a *FieldAccess) Authorize(model *Model) error {
+	action, _ := model.Get(ACTION).(string)
+	switch action {
+	case INSERTONE, INSERTMANY, UPDATE, UPSERT:
+	default:
+		return nil
+	}
+	t := model.Get(DATATYPE).(reflect.Type)
+	rules, err := accessTags(t)
+	if err != nil {
+		model.SetResponseStatus(http.StatusInternalServerError)
+		model.SetResponseBody(http.StatusText(http.StatusInternalServerError))
+		return err
+	}
+	principal := model.GetPrincipal()
+	var denied []field
+	for _, f := range typeFields(t) {
+		if access := rules[f.Name]; len(access.Write) > 0 && !principal.hasAny(access.Write) {
+			denied = append(denied, f)
+		}
+	}
+	if len(denied) == 0 {
+		return nil
+	}
+	// Fields the caller may not write must keep their stored value, the zero value of new documents
+	current := reflect.New(t).Elem()
+	if action == UPDATE || action == UPSERT {
+		existing, err := model.existing()
+		if err != nil {
+			return err
+		}
+		if v := reflect.ValueOf(existing); v.IsValid() {
+			current = reflect.Indirect(v)
+		}
+	}
+	for _, f := range denied {
+		stored := fieldValue(current, f.Index)
+		var changed bool
+		eachDocument(model.Get(REQUESTBODY), func(doc reflect.Value) {
+			value := fieldValue(doc, f.Index)
+			// Omitted fields, which the caller may not have been able to read, keep their stored value
+			if isZero(value) {
+				settableField(doc, f.Index).Set(stored)
+				return
+			}
+			changed = changed || !reflect.DeepEqual(value.Interface(), stored.Interface())
+		})
+		if changed {
+			err := fmt.Errorf("The caller is not allowed to write %s", f.Name)
+			model.SetResponseStatus(http.StatusForbidden)
+			model.SetResponseBody(err.Error())
+			return err
+		}
+	}
+	return nil
+}
+
+// Redact -
+func (a *FieldAccess) Redact(model *Model) {
+	response := model.GetResponse()
+	if response.Status >= http.StatusBadRequest {
+		return
+	}
+	t := model.Get(DATATYPE).(reflect.Type)
+	rules, err := accessTags(t)
+	if err != nil {
+		return
+	}
+	principal := model.GetPrincipal()
+	hidden := make(map[string]bool)
+	for name, access := range rules {
+		if len(access.Read) > 0 && !principal.hasAny(access.Read) {
+			hidden[name] = true
+		}
+	}
+	if len(hidden) == 0 {
+		return
+	}
+	model.SetResponseBody(redact(t, response.Body, hidden))
+}
+
+// redact removes hidden fields from documents of type t, a document, a list or a stream of them or a page envelope.
+// Documents become maps of their visible fields.
+func redact(t reflect.Type, body interface{}, hidden map[string]bool) interface{} {
+	switch body := body.(type) {
+	case nil:
+		return nil
+	case Iterator:
+		return &redactedIterator{Iterator: body, t: t, hidden: hidden}
+	case Envelope:
+		body.Data = redact(t, body.Data, hidden)
+		return body
+	case *Envelope:
+		return redact(t, *body, hidden)
+	case map[string]interface{}:
+		visible := make(map[string]interface{}, len(body))
+		for k, v := range body {
+			if !hidden[k] {
+				visible[k] = v
+			}
+		}
+		return visible
+	}
+	v := reflect.ValueOf(body)
+	if v.Kind() == reflect.Ptr && !v.IsNil() && v.Elem().Type() == t || v.Type() == t {
+		var visible []string
+		for _, f := range typeFields(t) {
+			if !hidden[f.Name] {
+				visible = append(visible, f.Name)
+			}
+		}
+		if len(visible) == 0 {
+			return map[string]interface{}{}
+		}
+		return project(t, v, visible)
+	}
+	if v.Kind() == reflect.Ptr && !v.IsNil() {
+		v = v.Elem()
+	}
+	if v.Kind() != reflect.Slice {
+		return body
+	}
+	items := make([]interface{}, v.Len())
+	for i := range items {
+		items[i] = redact(t, v.Index(i).Interface(), hidden)
+	}
+	return items
+}
+
+// redactedIterator removes hidden fields from streamed documents
+type redactedIterator struct {
+	Iterator
+	t      reflect.Type
+	hidden map[string]bool
+}
+
+func (it *redactedIterator) Value() interface{} {
+	return redact(it.t, it.Iterator.Value(), it.hidden)
+}
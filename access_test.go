@@ -0,0 +1,126 @@
+package rest
+
+import (
+	"net/http"
+	"net/http/httptest"
+	"reflect"
+	"strings"
+	"testing"
+)
+
+type FakeNote struct {
+	ID     string `json:"id" rest:"id"`
+	Owner  string `json:"owner"`
+	Text   string `json:"text"`
+	Rating int    `json:"rating" access:"read=admin|hr,write=admin"`
+}
+
+func TestOwnership(t *testing.T) {
+	service := NewFakeService(FakeScenario{})
+	basic := NewBasic(map[string]string{"otieno": "terces", "wanjiru": "terces", "amina": "terces"}, fakeCompare)
+	basic.Roles = map[string][]string{"wanjiru": {"admin"}, "amina": {"hr"}}
+	resource := NewResource("notes").
+		UseType(reflect.TypeOf(FakeNote{})).
+		UseStorage(NewMemory(reflect.TypeOf(FakeNote{}))).
+		UseValidator(&FakeNoopValidator{}).
+		UseSerializer(&JSON{}).
+		UseBatchSize(10).
+		UseAuthenticator(Optional(basic)).
+		UseAuthorizer(Authorizers(&Ownership{Field: "owner", Bypass: []string{"admin"}}, &FieldAccess{}))
+	url := "http://foo.bar/notes"
+	tests := []struct {
+		handler  func(http.ResponseWriter, *http.Request)
+		verb     string
+		url      string
+		body     string
+		user     string
+		status   int
+		contains string
+		excludes string
+	}{
+		{service.InsertOne(resource), "POST", url, `{"id": "o", "text": "Milk", "owner": "wanjiru"}`, "otieno", http.StatusCreated, `"owner":"otieno"`, `"rating"`},
+		{service.InsertOne(resource), "POST", url, `{"text": "Bread", "rating": 5}`, "otieno", http.StatusForbidden, `"The caller is not allowed to write rating"`, ""},
+		{service.InsertOne(resource), "POST", url, `{"text": "Bread"}`, "", http.StatusForbidden, `"The caller is not allowed to insertOne notes"`, ""},
+		{service.InsertOne(resource), "POST", url, `{"id": "w", "text": "Taxes", "owner": "wanjiru", "rating": 5}`, "wanjiru", http.StatusCreated, `"rating":5`, ""},
+		{service.InsertMany(resource), "POST", url, `[{"id": "a1", "text": "Eggs", "owner": "otieno"}, {"id": "a2", "text": "Rent", "rating": 2}]`, "amina", http.StatusMultiStatus, `"status":403`, ""},
+		{service.FindMany(resource), "GET", url, "", "otieno", http.StatusOK, `"text":"Milk"`, `"Taxes"`},
+		{service.FindMany(resource), "GET", url, "", "amina", http.StatusOK, `"owner":"amina","text":"Eggs","rating":0`, `"Milk"`},
+		{service.FindMany(resource), "GET", url, "", "wanjiru", http.StatusOK, `"rating":5`, ""},
+		{service.FindOne(resource), "GET", url + "/w", "", "otieno", http.StatusNotFound, "", ""},
+		{service.FindOne(resource), "GET", url + "/o", "", "otieno", http.StatusOK, `"text":"Milk"`, `"rating"`},
+		{service.Update(resource), "PUT", url + "/w", `{"text": "Mine"}`, "otieno", http.StatusNotFound, "", ""},
+		{service.Upsert(resource), "PUT", url + "/w", `{"text": "Mine"}`, "otieno", http.StatusNotFound, "", ""},
+		{service.Remove(resource), "DELETE", url + "/w", "", "otieno", http.StatusNotFound, "", ""},
+		{service.Update(resource), "PUT", url + "/o", `{"text": "Oat milk"}`, "otieno", http.StatusNoContent, "", ""},
+		{service.Update(resource), "PUT", url + "/o", `{"text": "Oat milk", "owner": "otieno", "rating": 3}`, "wanjiru", http.StatusNoContent, "", ""},
+		{service.Update(resource), "PUT", url + "/o", `{"text": "Soy milk"}`, "otieno", http.StatusNoContent, "", ""},
+		{service.Update(resource), "PUT", url + "/o", `{"text": "Soy milk", "rating": 4}`, "otieno", http.StatusForbidden, `"The caller is not allowed to write rating"`, ""},
+		{service.Update(resource), "PUT", url + "/o", `{"text": "Rice milk", "rating": 3}`, "otieno", http.StatusNoContent, "", ""},
+		{service.Upsert(resource), "PUT", url + "/o", `{"text": "Almond milk"}`, "otieno", http.StatusOK, "", ""},
+		{service.FindOne(resource), "GET", url + "/o", "", "wanjiru", http.StatusOK, `"text":"Almond milk","rating":3`, ""},
+		{service.Remove(resource), "DELETE", url + "/w", "", "wanjiru", http.StatusNoContent, "", ""},
+	}
+	for i, test := range tests {
+		r := NewTestRequest(test.verb, test.url, test.body)
+		if test.user != "" {
+			r.SetBasicAuth(test.user, "secret")
+		}
+		w := httptest.NewRecorder()
+		test.handler(w, r)
+		if w.Code != test.status {
+			t.Errorf("#%d Error, expected %d, got %d %s", i, test.status, w.Code, w.Body.String())
+		}
+		if !strings.Contains(w.Body.String(), test.contains) || test.excludes != "" && strings.Contains(w.Body.String(), test.excludes) {
+			t.Errorf("#%d Error, expected %s without %s, got %s", i, test.contains, test.excludes, w.Body.String())
+		}
+	}
+}
+
+func TestRedact(t *testing.T) {
+	note := FakeNote{ID: "o", Owner: "otieno", Text: "Milk", Rating: 3}
+	hidden := map[string]bool{"rating": true, "owner": true}
+	visible := map[string]interface{}{"id": "o", "text": "Milk"}
+	tests := []struct {
+		body     interface{}
+		expected interface{}
+	}{
+		{nil, nil},
+		{"Created", "Created"},
+		{note, visible},
+		{&note, visible},
+		{[]FakeNote{note}, []interface{}{visible}},
+		{&[]*FakeNote{&note}, []interface{}{visible}},
+		{[]map[string]interface{}{{"id": "o", "rating": 3}}, []interface{}{map[string]interface{}{"id": "o"}}},
+		{Envelope{Data: []FakeNote{note}}, Envelope{Data: []interface{}{visible}}},
+		{[]ItemResult{{Index: 0, Status: http.StatusCreated}}, []interface{}{ItemResult{Index: 0, Status: http.StatusCreated}}},
+	}
+	for i, test := range tests {
+		if redacted := redact(reflect.TypeOf(note), test.body, hidden); !reflect.DeepEqual(redacted, test.expected) {
+			t.Errorf("#%d Error, expected %#v, got %#v", i, test.expected, redacted)
+		}
+	}
+	it := redact(reflect.TypeOf(note), NewSliceIterator([]FakeNote{note}), hidden).(Iterator)
+	if !it.Next() || !reflect.DeepEqual(it.Value(), visible) {
+		t.Errorf("Error, expected the streamed documents to be redacted")
+	}
+}
+
+func TestAccessTags(t *testing.T) {
+	tests := []struct {
+		v     interface{}
+		valid bool
+	}{
+		{FakeNote{}, true},
+		{struct {
+			A string `access:"read"`
+		}{}, false},
+		{struct {
+			A string `access:"read=admin,delete=admin"`
+		}{}, false},
+	}
+	for i, test := range tests {
+		if _, err := accessTags(reflect.TypeOf(test.v)); (err == nil) != test.valid {
+			t.Errorf("#%d Error, expected valid %v, got %v", i, test.valid, err)
+		}
+	}
+}
@@ -0,0 +1,473 @@
+package rest
+
+import (
+	"crypto"
+	"crypto/ecdsa"
+	"crypto/elliptic"
+	"crypto/hmac"
+	"crypto/rsa"
+	"crypto/sha256"
+	"crypto/subtle"
+	"encoding/base64"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io/ioutil"
+	"math/big"
+	"net/http"
+	"strings"
+	"time"
+)
+
+// Authenticator - identifies the caller of a request, setting its Principal on the context. It answers 401 with
+// a WWW-Authenticate challenge, and returns ErrNoCredentials when the request carries none of its credentials.
+// Authenticators are shared by concurrent requests and keep no state of their own between calls.
+type Authenticator interface {
+	Authenticate(c *Context) error
+}
+
+// Principal - the authenticated caller of a request
+type Principal struct {
+	// Subject - who the caller is, the sub claim of a JWT, the user name or the owner of an API key
+	Subject string
+	// Scheme - how the caller was authenticated: Bearer, APIKey or Basic
+	Scheme string
+	// Roles - the roles of the caller, the roles claim of a JWT
+	Roles []string
+	// Scopes - the scopes granted the caller, the scope or scp claim of a JWT
+	Scopes []string
+	// Claims - the claims of a JWT or what an API key lookup returned
+	Claims map[string]interface{}
+}
+
+// ErrNoCredentials - the request carries no credentials an Authenticator accepts
+var ErrNoCredentials = errors.New("The request has no credentials")
+
+// GetPrincipal - returns the authenticated caller or nil when the request is anonymous
+func (c *Context) GetPrincipal() (p *Principal) {
+	p, _ = c.data[PRINCIPAL].(*Principal)
+	return p
+}
+
+// UseAuthenticator - authenticate the callers of every resource that has no Authenticator of its own
+func (s *Service) UseAuthenticator(a Authenticator) {
+	s.Authenticator = a
+}
+
+// UseAuthenticator - authenticate the callers of the resource
+func (r *Resource) UseAuthenticator(a Authenticator) *Resource {
+	r.Authenticator = a
+	return r
+}
+
+// authenticate identifies the caller with the Authenticator of the resource or else of the service
+func (s *Service) authenticate(resource *Resource, model *Model) error {
+	a := resource.Authenticator
+	if a == nil {
+		a = s.Authenticator
+	}
+	if a == nil {
+		return nil
+	}
+	return a.Authenticate(&model.Context)
+}
+
+// unauthorized answers 401 with a challenge
+func unauthorized(c *Context, challenge string, err error) error {
+	c.SetResponseStatus(http.StatusUnauthorized)
+	c.SetResponseBody(err.Error())
+	c.AddResponseHeader("WWW-Authenticate", challenge)
+	return err
+}
+
+// challenge formats a WWW-Authenticate challenge with its parameters, skipping empty ones
+func challenge(scheme string, params ...string) string {
+	var quoted []string
+	for i := 0; i+1 < len(params); i += 2 {
+		if params[i+1] != "" {
+			quoted = append(quoted, fmt.Sprintf("%s=%q", params[i], params[i+1]))
+		}
+	}
+	if len(quoted) == 0 {
+		return scheme
+	}
+	return scheme + " " + strings.Join(quoted, ", ")
+}
+
+// authenticators - an Authenticator trying several
+type authenticators struct {
+	list     []Authenticator
+	optional bool
+}
+
+// Authenticators - an Authenticator accepting the credentials of any of the authenticators, tried in order. When
+// the request carries none it answers 401 with the challenges of all of them.
+func Authenticators(list ...Authenticator) Authenticator {
+	return &authenticators{list: list}
+}
+
+// Optional - an Authenticator letting anonymous requests through, requests with bad credentials are still answered
+// with 401
+func Optional(list ...Authenticator) Authenticator {
+	return &authenticators{list: list, optional: true}
+}
+
+// Authenticate -
+func (a *authenticators) Authenticate(c *Context) error {
+	response := c.GetResponse()
+	var challenges []string
+	for _, auth := range a.list {
+		err := auth.Authenticate(c)
+		if err != ErrNoCredentials {
+			if err == nil {
+				c.SetResponse(response)
+			}
+			return err
+		}
+		challenges = append(challenges, c.GetResponse().Headers["WWW-Authenticate"]...)
+		c.SetResponse(response)
+	}
+	if a.optional {
+		return nil
+	}
+	for _, challenge := range challenges {
+		c.AddResponseHeader("WWW-Authenticate", challenge)
+	}
+	c.SetResponseStatus(http.StatusUnauthorized)
+	c.SetResponseBody(ErrNoCredentials.Error())
+	return ErrNoCredentials
+}
+
+// JWT - an Authenticator of HS256, RS256 and ES256 signed JSON Web Tokens sent as Authorization: Bearer <token>.
+// The exp and nbf claims are checked, with Leeway for clock skew, and iss and aud when Issuer and Audience are set.
+type JWT struct {
+	// Keys - the verification keys by key id, the empty id for tokens without a kid: []byte for HS256,
+	// *rsa.PublicKey for RS256 and *ecdsa.PublicKey for ES256
+	Keys     map[string]interface{}
+	Issuer   string
+	Audience string
+	Leeway   time.Duration
+	Realm    string
+}
+
+// AddKey - adds a verification key
+func (j *JWT) AddKey(kid string, key interface{}) *JWT {
+	if j.Keys == nil {
+		j.Keys = make(map[string]interface{})
+	}
+	j.Keys[kid] = key
+	return j
+}
+
+// jwk - a JSON Web Key
+type jwk struct {
+	Kty string `json:"kty"`
+	Kid string `json:"kid"`
+	Use string `json:"use"`
+	Crv string `json:"crv"`
+	N   string `json:"n"`
+	E   string `json:"e"`
+	X   string `json:"x"`
+	Y   string `json:"y"`
+	K   string `json:"k"`
+}
+
+// LoadJWKS - adds the signing keys of a JSON Web Key Set file, RSA, P-256 EC and oct keys are supported
+func (j *JWT) LoadJWKS(path string) error {
+	b, err := ioutil.ReadFile(path)
+	if err != nil {
+		return err
+	}
+	var set struct {
+		Keys []jwk `json:"keys"`
+	}
+	if err = json.Unmarshal(b, &set); err != nil {
+		return fmt.Errorf("%s: %s", path, err)
+	}
+	for _, k := range set.Keys {
+		if k.Use == "enc" {
+			continue
+		}
+		key, err := k.publicKey()
+		if err != nil {
+			return fmt.Errorf("%s: key %q: %s", path, k.Kid, err)
+		}
+		j.AddKey(k.Kid, key)
+	}
+	return nil
+}
+
+// publicKey decodes the key of a JWK
+func (k jwk) publicKey() (interface{}, error) {
+	decode := func(s string) (*big.Int, error) {
+		b, err := base64.RawURLEncoding.DecodeString(s)
+		if err != nil || len(b) == 0 {
+			return nil, errors.New("malformed key parameter")
+		}
+		return new(big.Int).SetBytes(b), nil
+	}
+	switch k.Kty {
+	case "RSA":
+		n, err := decode(k.N)
+		if err != nil {
+			return nil, err
+		}
+		e, err := decode(k.E)
+		if err != nil || !e.IsInt64() {
+			return nil, errors.New("malformed exponent")
+		}
+		return &rsa.PublicKey{N: n, E: int(e.Int64())}, nil
+	case "EC":
+		if k.Crv != "P-256" {
+			return nil, fmt.Errorf("unsupported curve %s", k.Crv)
+		}
+		x, err := decode(k.X)
+		if err != nil {
+			return nil, err
+		}
+		y, err := decode(k.Y)
+		if err != nil {
+			return nil, err
+		}
+		if !elliptic.P256().IsOnCurve(x, y) {
+			return nil, errors.New("the point is not on the curve")
+		}
+		return &ecdsa.PublicKey{Curve: elliptic.P256(), X: x, Y: y}, nil
+	case "oct":
+		b, err := base64.RawURLEncoding.DecodeString(k.K)
+		if err != nil || len(b) == 0 {
+			return nil, errors.New("malformed key")
+		}
+		return b, nil
+	}
+	return nil, fmt.Errorf("unsupported key type %q", k.Kty)
+}
+
+// Authenticate -
+func (j *JWT) Authenticate(c *Context) error {
+	header := c.GetRequest().Header.Get("Authorization")
+	if len(header) < 7 || !strings.EqualFold(header[:7], "bearer ") {
+		return unauthorized(c, challenge("Bearer", "realm", j.Realm), ErrNoCredentials)
+	}
+	claims, err := j.verify(strings.TrimSpace(header[7:]), time.Now())
+	if err != nil {
+		return unauthorized(c, challenge("Bearer", "realm", j.Realm, "error", "invalid_token", "error_description", err.Error()), err)
+	}
+	subject, _ := claims["sub"].(string)
+	principal := &Principal{Subject: subject, Scheme: "Bearer", Roles: stringsClaim(claims["roles"]), Claims: claims}
+	if scope, ok := claims["scope"].(string); ok {
+		principal.Scopes = strings.Fields(scope)
+	} else {
+		principal.Scopes = stringsClaim(claims["scp"])
+	}
+	c.Set(PRINCIPAL, principal)
+	return nil
+}
+
+// stringsClaim returns the strings of an array claim
+func stringsClaim(claim interface{}) (values []string) {
+	list, _ := claim.([]interface{})
+	for _, v := range list {
+		if s, ok := v.(string); ok {
+			values = append(values, s)
+		}
+	}
+	return values
+}
+
+// verify checks the signature and claims of a token and returns its claims
+func (j *JWT) verify(token string, now time.Time) (map[string]interface{}, error) {
+	parts := strings.Split(token, ".")
+	if len(parts) != 3 {
+		return nil, errors.New("The token is malformed")
+	}
+	var header struct {
+		Alg string `json:"alg"`
+		Kid string `json:"kid"`
+	}
+	if err := decodeSegment(parts[0], &header); err != nil {
+		return nil, errors.New("The token header is malformed")
+	}
+	signature, err := base64.RawURLEncoding.DecodeString(parts[2])
+	if err != nil {
+		return nil, errors.New("The token signature is malformed")
+	}
+	key, ok := j.Keys[header.Kid]
+	if !ok {
+		return nil, fmt.Errorf("The token key %q is unknown", header.Kid)
+	}
+	if !verifySignature(header.Alg, key, parts[0]+"."+parts[1], signature) {
+		return nil, errors.New("The token signature is invalid")
+	}
+	var claims map[string]interface{}
+	if err = decodeSegment(parts[1], &claims); err != nil {
+		return nil, errors.New("The token claims are malformed")
+	}
+	if exp, ok := claims["exp"].(float64); ok && now.After(time.Unix(int64(exp), 0).Add(j.Leeway)) {
+		return nil, errors.New("The token expired")
+	}
+	if nbf, ok := claims["nbf"].(float64); ok && now.Add(j.Leeway).Before(time.Unix(int64(nbf), 0)) {
+		return nil, errors.New("The token is not valid yet")
+	}
+	if j.Issuer != "" && claims["iss"] != j.Issuer {
+		return nil, errors.New("The token issuer is not accepted")
+	}
+	if j.Audience != "" && !hasAudience(claims["aud"], j.Audience) {
+		return nil, errors.New("The token audience is not accepted")
+	}
+	return claims, nil
+}
+
+func decodeSegment(segment string, v interface{}) error {
+	b, err := base64.RawURLEncoding.DecodeString(segment)
+	if err != nil {
+		return err
+	}
+	return json.Unmarshal(b, v)
+}
+
+// hasAudience reports whether the aud claim, a string or an array of them, names the audience
+func hasAudience(aud interface{}, audience string) bool {
+	switch aud := aud.(type) {
+	case string:
+		return aud == audience
+	case []interface{}:
+		for _, a := range aud {
+			if a == audience {
+				return true
+			}
+		}
+	}
+	return false
+}
+
+// verifySignature checks a signature with a key of the type the algorithm needs, so that e.g. an RSA public key
+// can not be used as an HMAC secret
+func verifySignature(alg string, key interface{}, signed string, signature []byte) bool {
+	digest := sha256.Sum256([]byte(signed))
+	switch alg {
+	case "HS256":
+		secret, ok := key.([]byte)
+		if !ok {
+			return false
+		}
+		mac := hmac.New(sha256.New, secret)
+		mac.Write([]byte(signed))
+		return hmac.Equal(signature, mac.Sum(nil))
+	case "RS256":
+		pub, ok := key.(*rsa.PublicKey)
+		return ok && rsa.VerifyPKCS1v15(pub, crypto.SHA256, digest[:], signature) == nil
+	case "ES256":
+		pub, ok := key.(*ecdsa.PublicKey)
+		if !ok || pub.Curve != elliptic.P256() || len(signature) != 64 {
+			return false
+		}
+		r, s := new(big.Int).SetBytes(signature[:32]), new(big.Int).SetBytes(signature[32:])
+		return ecdsa.Verify(pub, digest[:], r, s)
+	}
+	return false
+}
+
+// APIKey - an Authenticator of API keys sent in a header, such as X-API-Key, or a query parameter, which is
+// removed from the request URL so that it does not end up in links
+type APIKey struct {
+	Header string
+	Query  string
+	Realm  string
+	// Keys - the subjects of static keys by key
+	Keys map[string]string
+	// Lookup - returns the principal of a key that is not one of Keys, nil when it is unknown
+	Lookup func(key string) (*Principal, error)
+}
+
+// Authenticate -
+func (a *APIKey) Authenticate(c *Context) error {
+	r := c.GetRequest()
+	key := ""
+	if a.Header != "" {
+		key = r.Header.Get(a.Header)
+	}
+	if a.Query != "" {
+		query := r.URL.Query()
+		if key == "" {
+			key = query.Get(a.Query)
+		}
+		if _, ok := query[a.Query]; ok {
+			query.Del(a.Query)
+			r.URL.RawQuery = query.Encode()
+		}
+	}
+	scheme := challenge("APIKey", "realm", a.Realm, "header", a.Header, "query", a.Query)
+	if key == "" {
+		return unauthorized(c, scheme, ErrNoCredentials)
+	}
+	var principal *Principal
+	// Compare every key in constant time so that the time taken does not tell how much of a key matched
+	for k, subject := range a.Keys {
+		if subtle.ConstantTimeCompare([]byte(k), []byte(key)) == 1 {
+			principal = &Principal{Subject: subject, Scheme: "APIKey"}
+		}
+	}
+	if principal == nil && a.Lookup != nil {
+		var err error
+		if principal, err = a.Lookup(key); err != nil {
+			c.SetResponseStatus(http.StatusInternalServerError)
+			c.SetResponseBody(http.StatusText(http.StatusInternalServerError))
+			return err
+		}
+		if principal != nil && principal.Scheme == "" {
+			principal.Scheme = "APIKey"
+		}
+	}
+	if principal == nil {
+		return unauthorized(c, scheme, errors.New("The API key is invalid"))
+	}
+	c.Set(PRINCIPAL, principal)
+	return nil
+}
+
+// Basic - an Authenticator of HTTP Basic credentials checked against bcrypt hashes of the passwords, see NewBasic
+type Basic struct {
+	Realm string
+	// Users - the password hashes by user name
+	Users map[string]string
+	// Roles - the roles by user name
+	Roles   map[string][]string
+	Compare func(hash, password []byte) error
+}
+
+// NewBasic - a Basic authenticator of the password hashes of users by user name, compare being
+// bcrypt.CompareHashAndPassword of golang.org/x/crypto/bcrypt or an equivalent. It panics without compare.
+func NewBasic(users map[string]string, compare func(hash, password []byte) error) *Basic {
+	if compare == nil {
+		panic("NewBasic needs a compare func such as bcrypt.CompareHashAndPassword")
+	}
+	return &Basic{Users: users, Roles: make(map[string][]string), Compare: compare}
+}
+
+// Authenticate -
+func (b *Basic) Authenticate(c *Context) error {
+	scheme := challenge("Basic", "realm", b.Realm, "charset", "UTF-8")
+	user, password, ok := c.GetRequest().BasicAuth()
+	if !ok {
+		return unauthorized(c, scheme, ErrNoCredentials)
+	}
+	if b.Compare == nil {
+		c.SetResponseStatus(http.StatusInternalServerError)
+		c.SetResponseBody(http.StatusText(http.StatusInternalServerError))
+		return errors.New("Basic needs a Compare func such as bcrypt.CompareHashAndPassword")
+	}
+	hash, known := b.Users[user]
+	if !known {
+		// Compare anyway so that unknown users take as long as wrong passwords
+		for _, h := range b.Users {
+			hash = h
+			break
+		}
+	}
+	if err := b.Compare([]byte(hash), []byte(password)); err != nil || !known {
+		return unauthorized(c, scheme, errors.New("The user name or password is invalid"))
+	}
+	c.Set(PRINCIPAL, &Principal{Subject: user, Scheme: "Basic", Roles: b.Roles[user]})
+	return nil
+}
@@ -0,0 +1,342 @@
+package rest
+
+import (
+	"crypto"
+	"crypto/ecdsa"
+	"crypto/elliptic"
+	"crypto/hmac"
+	"crypto/rand"
+	"crypto/rsa"
+	"crypto/sha256"
+	"encoding/base64"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"math/big"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"path/filepath"
+	"reflect"
+	"strings"
+	"sync"
+	"testing"
+	"time"
+)
+
+var (
+	fakeSecret = []byte("the fake secret")
+	fakeRSA, _ = rsa.GenerateKey(rand.Reader, 1024)
+	fakeEC, _  = ecdsa.GenerateKey(elliptic.P256(), rand.Reader)
+)
+
+// fakeToken signs claims with the fake key of the algorithm
+func fakeToken(alg, kid string, claims map[string]interface{}) string {
+	header, _ := json.Marshal(map[string]string{"alg": alg, "kid": kid, "typ": "JWT"})
+	payload, _ := json.Marshal(claims)
+	signed := base64.RawURLEncoding.EncodeToString(header) + "." + base64.RawURLEncoding.EncodeToString(payload)
+	digest := sha256.Sum256([]byte(signed))
+	var signature []byte
+	switch alg {
+	case "HS256":
+		mac := hmac.New(sha256.New, fakeSecret)
+		mac.Write([]byte(signed))
+		signature = mac.Sum(nil)
+	case "RS256":
+		signature, _ = rsa.SignPKCS1v15(rand.Reader, fakeRSA, crypto.SHA256, digest[:])
+	case "ES256":
+		r, s, _ := ecdsa.Sign(rand.Reader, fakeEC, digest[:])
+		signature = make([]byte, 64)
+		rb, sb := r.Bytes(), s.Bytes()
+		copy(signature[32-len(rb):], rb)
+		copy(signature[64-len(sb):], sb)
+	}
+	return signed + "." + base64.RawURLEncoding.EncodeToString(signature)
+}
+
+func encodeInt(i *big.Int) string {
+	return base64.RawURLEncoding.EncodeToString(i.Bytes())
+}
+
+func NewFakeJWT(t *testing.T) *JWT {
+	jwks := fmt.Sprintf(`{"keys": [
+		{"kty": "RSA", "kid": "rsa", "use": "sig", "n": %q, "e": %q},
+		{"kty": "EC", "kid": "ec", "crv": "P-256", "x": %q, "y": %q},
+		{"kty": "oct", "kid": "enc", "use": "enc", "k": "bm9wZQ"}
+	]}`, encodeInt(fakeRSA.N), encodeInt(big.NewInt(int64(fakeRSA.E))), encodeInt(fakeEC.X), encodeInt(fakeEC.Y))
+	dir := writeSchemas(t, map[string]string{"jwks.json": jwks})
+	defer os.RemoveAll(dir)
+	j := (&JWT{Issuer: "https://auth.foo.bar", Audience: "todos", Leeway: time.Minute, Realm: "todos"}).AddKey("hmac", fakeSecret)
+	if err := j.LoadJWKS(filepath.Join(dir, "jwks.json")); err != nil {
+		t.Fatal(err)
+	}
+	return j
+}
+
+func TestJWT(t *testing.T) {
+	now := time.Now().Unix()
+	claims := func(overrides map[string]interface{}) map[string]interface{} {
+		c := map[string]interface{}{"sub": "otieno", "iss": "https://auth.foo.bar", "aud": "todos", "exp": now + 60, "roles": []string{"editor"}, "scope": "todos:read todos:write"}
+		for k, v := range overrides {
+			if v == nil {
+				delete(c, k)
+				continue
+			}
+			c[k] = v
+		}
+		return c
+	}
+	tests := []struct {
+		authorization string
+		status        int
+		challenge     string
+	}{
+		{"Bearer " + fakeToken("HS256", "hmac", claims(nil)), http.StatusOK, ""},
+		{"bearer " + fakeToken("RS256", "rsa", claims(nil)), http.StatusOK, ""},
+		{"Bearer " + fakeToken("ES256", "ec", claims(map[string]interface{}{"aud": []string{"billing", "todos"}})), http.StatusOK, ""},
+		{"Bearer " + fakeToken("HS256", "hmac", claims(map[string]interface{}{"exp": now - 30, "nbf": now + 30})), http.StatusOK, ""},
+		{"", http.StatusUnauthorized, `Bearer realm="todos"`},
+		{"Basic b3RpZW5vOnNlY3JldA==", http.StatusUnauthorized, `Bearer realm="todos"`},
+		{"Bearer nope", http.StatusUnauthorized, `error_description="The token is malformed"`},
+		{"Bearer " + fakeToken("HS256", "rsa", claims(nil)), http.StatusUnauthorized, `error_description="The token signature is invalid"`},
+		{"Bearer " + fakeToken("RS256", "ec", claims(nil)), http.StatusUnauthorized, `error_description="The token signature is invalid"`},
+		{"Bearer " + fakeToken("none", "hmac", claims(nil)), http.StatusUnauthorized, `error_description="The token signature is invalid"`},
+		{"Bearer " + fakeToken("HS256", "enc", claims(nil)), http.StatusUnauthorized, `error_description="The token key \"enc\" is unknown"`},
+		{"Bearer " + fakeToken("HS256", "hmac", claims(map[string]interface{}{"exp": now - 120})), http.StatusUnauthorized, `error_description="The token expired"`},
+		{"Bearer " + fakeToken("HS256", "hmac", claims(map[string]interface{}{"nbf": now + 120})), http.StatusUnauthorized, `error_description="The token is not valid yet"`},
+		{"Bearer " + fakeToken("HS256", "hmac", claims(map[string]interface{}{"iss": nil})), http.StatusUnauthorized, `error_description="The token issuer is not accepted"`},
+		{"Bearer " + fakeToken("ES256", "ec", claims(map[string]interface{}{"aud": "billing"})), http.StatusUnauthorized, `error_description="The token audience is not accepted"`},
+	}
+	service := NewFakeService(FakeScenario{})
+	service.UseAuthenticator(NewFakeJWT(t))
+	var principal *Principal
+	resource := NewFakeTodoResource(NewMemory(reflect.TypeOf(FakeTodo{}))).AddHook(BEFOREEXECUTE, func(model *Model) error {
+		principal = model.GetPrincipal()
+		return nil
+	})
+	for i, test := range tests {
+		principal = nil
+		r := NewTestRequest("GET", "http://foo.bar/todos", "")
+		r.Header.Set("Authorization", test.authorization)
+		w := httptest.NewRecorder()
+		service.FindMany(resource)(w, r)
+		if w.Code != test.status {
+			t.Errorf("#%d Error, expected %d, got %d %s", i, test.status, w.Code, w.Body.String())
+		}
+		if challenge := w.Header().Get("WWW-Authenticate"); !strings.Contains(challenge, test.challenge) || (test.challenge == "") != (challenge == "") {
+			t.Errorf("#%d Error, expected the challenge %s, got %s", i, test.challenge, challenge)
+		}
+		if test.status == http.StatusOK && (principal == nil || principal.Subject != "otieno" || principal.Scheme != "Bearer" || !principal.Has("editor") || !principal.Has("todos:write")) {
+			t.Errorf("#%d Error, expected the principal otieno, got %+v", i, principal)
+		}
+	}
+}
+
+func TestLoadJWKS(t *testing.T) {
+	tests := []string{
+		`{"keys": [`,
+		`{"keys": [{"kty": "OKP", "kid": "ed", "crv": "Ed25519", "x": "AAAA"}]}`,
+		`{"keys": [{"kty": "EC", "kid": "ec", "crv": "P-384", "x": "AAAA", "y": "AAAA"}]}`,
+		`{"keys": [{"kty": "EC", "kid": "ec", "crv": "P-256", "x": "AQ", "y": "AQ"}]}`,
+		`{"keys": [{"kty": "RSA", "kid": "rsa", "n": "!", "e": "AQAB"}]}`,
+		`{"keys": [{"kty": "oct", "kid": "hmac"}]}`,
+	}
+	for i, test := range tests {
+		dir := writeSchemas(t, map[string]string{"jwks.json": test})
+		if err := (&JWT{}).LoadJWKS(filepath.Join(dir, "jwks.json")); err == nil {
+			t.Errorf("#%d Error, expected loading %s to fail", i, test)
+		}
+		os.RemoveAll(dir)
+	}
+	if err := (&JWT{}).LoadJWKS("nope.json"); err == nil {
+		t.Errorf("Error, expected loading a missing file to fail")
+	}
+}
+
+func TestAPIKey(t *testing.T) {
+	tests := []struct {
+		url      string
+		key      string
+		status   int
+		subject  string
+		expected string
+	}{
+		{"http://foo.bar/todos", "k1", http.StatusOK, "otieno", ""},
+		{"http://foo.bar/todos?api_key=k2&limit=1", "", http.StatusOK, "wanjiru", `rel="next"`},
+		{"http://foo.bar/todos", "dynamic", http.StatusOK, "robot", ""},
+		{"http://foo.bar/todos", "", http.StatusUnauthorized, "", `"The request has no credentials"`},
+		{"http://foo.bar/todos?api_key=k3", "", http.StatusUnauthorized, "", `"The API key is invalid"`},
+		{"http://foo.bar/todos", "broken", http.StatusInternalServerError, "", `"Internal Server Error"`},
+	}
+	service := NewFakeService(FakeScenario{})
+	var principal *Principal
+	storage := NewMemory(reflect.TypeOf(FakeTodo{}))
+	resource := NewFakeTodoResource(storage).
+		UsePagination(&Pagination{DefaultLimit: 10}).
+		AddHook(BEFOREEXECUTE, func(model *Model) error {
+			principal = model.GetPrincipal()
+			return nil
+		}).
+		UseAuthenticator(&APIKey{
+			Header: "X-API-Key",
+			Query:  "api_key",
+			Realm:  "todos",
+			Keys:   map[string]string{"k1": "otieno", "k2": "wanjiru"},
+			Lookup: func(key string) (*Principal, error) {
+				switch key {
+				case "dynamic":
+					return &Principal{Subject: "robot"}, nil
+				case "broken":
+					return nil, errors.New("The key store is down")
+				}
+				return nil, nil
+			},
+		})
+	for _, title := range []string{"Milk", "Bread"} {
+		r := NewTestRequest("POST", "http://foo.bar/todos", fmt.Sprintf(`{"title": %q}`, title))
+		r.Header.Set("X-API-Key", "k1")
+		service.InsertOne(resource)(httptest.NewRecorder(), r)
+	}
+	for i, test := range tests {
+		principal = nil
+		r := NewTestRequest("GET", test.url, "")
+		r.Header.Set("X-API-Key", test.key)
+		w := httptest.NewRecorder()
+		service.FindMany(resource)(w, r)
+		if w.Code != test.status {
+			t.Errorf("#%d Error, expected %d, got %d %s", i, test.status, w.Code, w.Body.String())
+		}
+		if !strings.Contains(w.Body.String()+w.Header().Get("Link"), test.expected) {
+			t.Errorf("#%d Error, expected %s, got %s %s", i, test.expected, w.Header().Get("Link"), w.Body.String())
+		}
+		if strings.Contains(w.Header().Get("Link"), "api_key") {
+			t.Errorf("#%d Error, expected the API key to be left out of links, got %s", i, w.Header().Get("Link"))
+		}
+		if w.Code == http.StatusUnauthorized && w.Header().Get("WWW-Authenticate") != `APIKey realm="todos", header="X-API-Key", query="api_key"` {
+			t.Errorf("#%d Error, unexpected challenge %s", i, w.Header().Get("WWW-Authenticate"))
+		}
+		if test.subject != "" && (principal == nil || principal.Subject != test.subject || principal.Scheme != "APIKey") {
+			t.Errorf("#%d Error, expected the principal %s, got %+v", i, test.subject, principal)
+		}
+	}
+}
+
+// fakeCompare stands in for bcrypt.CompareHashAndPassword, the fake hash of a password being it reversed
+func fakeCompare(hash, password []byte) error {
+	for i := range password {
+		if len(hash) != len(password) || hash[len(hash)-1-i] != password[i] {
+			return errors.New("The password does not match")
+		}
+	}
+	return nil
+}
+
+func TestBasic(t *testing.T) {
+	tests := []struct {
+		user     string
+		password string
+		status   int
+	}{
+		{"otieno", "secret", http.StatusOK},
+		{"otieno", "terces", http.StatusUnauthorized},
+		{"wanjiru", "secret", http.StatusUnauthorized},
+		{"", "", http.StatusUnauthorized},
+	}
+	service := NewFakeService(FakeScenario{})
+	basic := NewBasic(map[string]string{"otieno": "terces"}, fakeCompare)
+	basic.Realm = "todos"
+	resource := NewFakeTodoResource(NewMemory(reflect.TypeOf(FakeTodo{}))).UseAuthenticator(basic)
+	for i, test := range tests {
+		r := NewTestRequest("GET", "http://foo.bar/todos", "")
+		if test.user != "" {
+			r.SetBasicAuth(test.user, test.password)
+		}
+		w := httptest.NewRecorder()
+		service.FindMany(resource)(w, r)
+		if w.Code != test.status {
+			t.Errorf("#%d Error, expected %d, got %d %s", i, test.status, w.Code, w.Body.String())
+		}
+		if challenge := w.Header().Get("WWW-Authenticate"); w.Code == http.StatusUnauthorized && challenge != `Basic realm="todos", charset="UTF-8"` {
+			t.Errorf("#%d Error, unexpected challenge %s", i, challenge)
+		}
+	}
+	basic.Compare = nil
+	r := NewTestRequest("GET", "http://foo.bar/todos", "")
+	r.SetBasicAuth("otieno", "secret")
+	w := httptest.NewRecorder()
+	service.FindMany(resource)(w, r)
+	if w.Code != http.StatusInternalServerError {
+		t.Errorf("Error, expected 500 without a Compare func, got %d", w.Code)
+	}
+	defer func() {
+		if r := recover(); r == nil || !strings.Contains(r.(string), "compare func") {
+			t.Errorf("Error, expected NewBasic to panic without a compare func, got %v", r)
+		}
+	}()
+	NewBasic(map[string]string{"otieno": "terces"}, nil)
+}
+
+func TestAuthenticators(t *testing.T) {
+	basic := NewBasic(map[string]string{"otieno": "terces"}, fakeCompare)
+	basic.Realm = "todos"
+	apiKey := &APIKey{Header: "X-API-Key", Keys: map[string]string{"k1": "wanjiru"}}
+	tests := []struct {
+		authenticator Authenticator
+		user          string
+		key           string
+		status        int
+		challenges    []string
+	}{
+		{Authenticators(apiKey, basic), "otieno", "secret", http.StatusOK, nil},
+		{Authenticators(apiKey, basic), "", "k1", http.StatusOK, nil},
+		{Authenticators(apiKey, basic), "otieno", "nope", http.StatusUnauthorized, []string{`Basic realm="todos", charset="UTF-8"`}},
+		{Authenticators(apiKey, basic), "", "", http.StatusUnauthorized, []string{`APIKey header="X-API-Key"`, `Basic realm="todos", charset="UTF-8"`}},
+		{Optional(apiKey, basic), "", "", http.StatusOK, nil},
+		{Optional(apiKey, basic), "", "k2", http.StatusUnauthorized, []string{`APIKey header="X-API-Key"`}},
+	}
+	service := NewFakeService(FakeScenario{})
+	for i, test := range tests {
+		resource := NewFakeTodoResource(NewMemory(reflect.TypeOf(FakeTodo{}))).UseAuthenticator(test.authenticator)
+		r := NewTestRequest("GET", "http://foo.bar/todos", "")
+		if test.user != "" {
+			r.SetBasicAuth(test.user, test.key)
+		} else if test.key != "" {
+			r.Header.Set("X-API-Key", test.key)
+		}
+		w := httptest.NewRecorder()
+		service.FindMany(resource)(w, r)
+		if w.Code != test.status {
+			t.Errorf("#%d Error, expected %d, got %d %s", i, test.status, w.Code, w.Body.String())
+		}
+		if challenges := w.Header()["Www-Authenticate"]; !reflect.DeepEqual(challenges, test.challenges) {
+			t.Errorf("#%d Error, expected the challenges %v, got %v", i, test.challenges, challenges)
+		}
+	}
+}
+
+func TestAuthenticatorConcurrentRequests(t *testing.T) {
+	keys := map[string]string{}
+	for i := 0; i < 16; i++ {
+		keys[fmt.Sprintf("k%d", i)] = fmt.Sprintf("caller%d", i)
+	}
+	authenticator := Authenticators(&APIKey{Header: "X-API-Key", Keys: keys})
+	var wg sync.WaitGroup
+	for key, subject := range keys {
+		wg.Add(1)
+		go func(key, subject string) {
+			defer wg.Done()
+			for i := 0; i < 20; i++ {
+				c := NewContext()
+				r := NewTestRequest("GET", "http://foo.bar/todos", "")
+				r.Header.Set("X-API-Key", key)
+				c.Set(REQUEST, r)
+				c.SetResponse(Response{Headers: map[string][]string{}})
+				if err := authenticator.Authenticate(&c); err != nil || c.GetPrincipal().Subject != subject {
+					t.Errorf("Error, expected %s, got %+v %v", subject, c.GetPrincipal(), err)
+					return
+				}
+			}
+		}(key, subject)
+	}
+	wg.Wait()
+}
@@ -0,0 +1,168 @@
+package rest
+
+import (
+	"fmt"
+	"net/http"
+)
+
+const (
+	// ANYONE - the role of every caller, anonymous ones included
+	ANYONE = "anyone"
+	// AUTHENTICATED - the role of every authenticated caller
+	AUTHENTICATED = "authenticated"
+)
+
+// Authorizer - decides whether the caller may perform the action of a request, after it is validated and before it
+// is executed. It answers 403 when the caller may not. insertMany records ingested in batches, see UseBatchSize, are
+// authorized one at a time as one document bodies.
+type Authorizer interface {
+	Authorize(model *Model) error
+}
+
+// PolicyRule - an attribute based rule given the caller, the decoded request body and the stored document an update,
+// upsert, remove or findOne request addresses, nil when there is none
+type PolicyRule func(principal *Principal, body, existing interface{}) (bool, error)
+
+// Policy - an Authorizer allowing actions to roles and scopes and checking attribute based rules. Actions no role
+// is allowed are denied.
+type Policy struct {
+	// Roles - the roles and scopes allowed each action
+	Roles map[string][]string
+	// Rules - the rules each action must pass
+	Rules map[string][]PolicyRule
+}
+
+// NewPolicy -
+func NewPolicy() *Policy {
+	return &Policy{Roles: make(map[string][]string), Rules: make(map[string][]PolicyRule)}
+}
+
+// Allow - allows callers with any of the roles or scopes the action, ANYONE and AUTHENTICATED being the roles of all
+// callers and of authenticated ones
+func (p *Policy) Allow(action string, roles ...string) *Policy {
+	p.Roles[action] = append(p.Roles[action], roles...)
+	return p
+}
+
+// Require - requires the rule to pass for the actions given or all of them
+func (p *Policy) Require(rule PolicyRule, actions ...string) *Policy {
+	if len(actions) == 0 {
+		actions = []string{INSERTONE, INSERTMANY, UPDATE, UPSERT, FINDONE, FINDMANY, REMOVE}
+	}
+	for _, action := range actions {
+		p.Rules[action] = append(p.Rules[action], rule)
+	}
+	return p
+}
+
+// Authorize -
+func (p *Policy) Authorize(model *Model) error {
+	action, _ := model.Get(ACTION).(string)
+	principal := model.GetPrincipal()
+	if !principal.hasAny(p.Roles[action]) {
+		return forbidden(model, action)
+	}
+	if len(p.Rules[action]) == 0 {
+		return nil
+	}
+	existing, err := model.existing()
+	if err != nil {
+		return err
+	}
+	body := model.Get(REQUESTBODY)
+	for _, rule := range p.Rules[action] {
+		ok, err := rule(principal, body, existing)
+		if err != nil {
+			model.SetResponseStatus(http.StatusInternalServerError)
+			model.SetResponseBody(http.StatusText(http.StatusInternalServerError))
+			return err
+		}
+		if !ok {
+			return forbidden(model, action)
+		}
+	}
+	return nil
+}
+
+func forbidden(model *Model, action string) error {
+	err := fmt.Errorf("The caller is not allowed to %s %s", action, model.Name)
+	model.SetResponseStatus(http.StatusForbidden)
+	model.SetResponseBody(err.Error())
+	return err
+}
+
+// Has - reports whether the caller has the role or scope
+func (p *Principal) Has(role string) bool {
+	if role == ANYONE {
+		return true
+	}
+	if p == nil {
+		return false
+	}
+	if role == AUTHENTICATED {
+		return true
+	}
+	for _, r := range p.Roles {
+		if r == role {
+			return true
+		}
+	}
+	for _, s := range p.Scopes {
+		if s == role {
+			return true
+		}
+	}
+	return false
+}
+
+// hasAny reports whether the caller has any of the roles or scopes
+func (p *Principal) hasAny(roles []string) bool {
+	for _, role := range roles {
+		if p.Has(role) {
+			return true
+		}
+	}
+	return false
+}
+
+// UseAuthorizer - authorize the actions of the resource's callers
+func (r *Resource) UseAuthorizer(a Authorizer) *Resource {
+	r.Authorizer = a
+	return r
+}
+
+// Authorize - scopes the request to its tenant and lets the Authorizer of the resource decide whether the caller may
+// perform the action
+func (model *Model) Authorize() error {
+	if err := model.scopeTenant(); err != nil {
+		return err
+	}
+	if model.Authorizer == nil {
+		return nil
+	}
+	return model.Authorizer.Authorize(model)
+}
+
+// existing loads the stored document an update, upsert, remove or findOne request addresses, nil when there is none
+func (model *Model) existing() (interface{}, error) {
+	switch model.Get(ACTION) {
+	case UPDATE, UPSERT, REMOVE, FINDONE:
+	default:
+		return nil, nil
+	}
+	if _, err := model.GetID(); err != nil {
+		return nil, nil
+	}
+	response := model.GetResponse()
+	err := model.FindOne()
+	found := model.GetResponse()
+	if err != nil && found.Status != http.StatusNotFound {
+		// Answer with the error of the storage
+		return nil, err
+	}
+	model.SetResponse(response)
+	if err != nil {
+		return nil, nil
+	}
+	return found.Body, nil
+}
@@ -0,0 +1,103 @@
+package rest
+
+import (
+	"errors"
+	"net/http"
+	"net/http/httptest"
+	"reflect"
+	"strings"
+	"testing"
+)
+
+func NewFakePolicy() *Policy {
+	return NewPolicy().
+		Allow(FINDMANY, ANYONE).
+		Allow(INSERTONE, AUTHENTICATED).
+		Allow(UPDATE, "editor", "todos:write").
+		Allow(REMOVE, "admin").
+		Require(func(principal *Principal, body, existing interface{}) (bool, error) {
+			// Only admins may file urgent todos
+			return body.(*FakeTodo).Priority < 5 || principal.Has("admin"), nil
+		}, INSERTONE, UPDATE).
+		Require(func(principal *Principal, body, existing interface{}) (bool, error) {
+			// Locked todos can not be changed
+			todo, ok := existing.(*FakeTodo)
+			if ok && todo.Title == "Broken" {
+				return false, errors.New("The lock store is down")
+			}
+			return !ok || todo.Priority < 9, nil
+		}, UPDATE, REMOVE)
+}
+
+func TestPolicy(t *testing.T) {
+	service := NewFakeService(FakeScenario{})
+	storage := NewMemory(reflect.TypeOf(FakeTodo{}))
+	url := "http://foo.bar/todos"
+	serve(service.InsertMany(NewFakeTodoResource(storage)), "POST", url, `[{"id": "a", "title": "Milk", "priority": 1}, {"id": "b", "title": "Taxes", "priority": 9}, {"id": "c", "title": "Broken"}]`)
+	basic := NewBasic(map[string]string{"otieno": "terces", "wanjiru": "terces", "amina": "terces"}, fakeCompare)
+	basic.Roles = map[string][]string{"otieno": {"editor"}, "wanjiru": {"admin"}}
+	resource := NewFakeTodoResource(storage).UseAuthenticator(Optional(basic)).UseAuthorizer(NewFakePolicy())
+	tests := []struct {
+		handler func(http.ResponseWriter, *http.Request)
+		verb    string
+		url     string
+		body    string
+		user    string
+		status  int
+	}{
+		{service.FindMany(resource), "GET", url, "", "", http.StatusOK},
+		{service.FindOne(resource), "GET", url + "/a", "", "wanjiru", http.StatusForbidden},
+		{service.InsertOne(resource), "POST", url, `{"title": "Eggs"}`, "", http.StatusForbidden},
+		{service.InsertOne(resource), "POST", url, `{"title": "Eggs"}`, "amina", http.StatusCreated},
+		{service.InsertOne(resource), "POST", url, `{"title": "Rent", "priority": 7}`, "amina", http.StatusForbidden},
+		{service.InsertOne(resource), "POST", url, `{"title": "Rent", "priority": 7}`, "wanjiru", http.StatusCreated},
+		{service.Update(resource), "PUT", url + "/a", `{"title": "Oat milk"}`, "amina", http.StatusForbidden},
+		{service.Update(resource), "PUT", url + "/a", `{"title": "Oat milk"}`, "otieno", http.StatusNoContent},
+		{service.Update(resource), "PUT", url + "/b", `{"title": "Taxes"}`, "otieno", http.StatusForbidden},
+		{service.Update(resource), "PUT", url + "/c", `{"title": "Fixed"}`, "otieno", http.StatusInternalServerError},
+		{service.Update(resource), "PUT", url + "/z", `{"title": "Zucchini"}`, "otieno", http.StatusNotFound},
+		{service.Remove(resource), "DELETE", url + "/a", "", "otieno", http.StatusForbidden},
+		{service.Remove(resource), "DELETE", url + "/b", "", "wanjiru", http.StatusForbidden},
+		{service.Remove(resource), "DELETE", url + "/a", "", "wanjiru", http.StatusNoContent},
+		{service.InsertMany(resource), "POST", url, `[{"title": "Bread"}]`, "wanjiru", http.StatusForbidden},
+	}
+	for i, test := range tests {
+		r := NewTestRequest(test.verb, test.url, test.body)
+		if test.user != "" {
+			r.SetBasicAuth(test.user, "secret")
+		}
+		w := httptest.NewRecorder()
+		test.handler(w, r)
+		if w.Code != test.status {
+			t.Errorf("#%d Error, expected %d, got %d %s", i, test.status, w.Code, w.Body.String())
+		}
+		if w.Code == http.StatusForbidden && !strings.Contains(w.Body.String(), `"The caller is not allowed to `) {
+			t.Errorf("#%d Error, unexpected body %s", i, w.Body.String())
+		}
+	}
+	w := serve(service.FindMany(resource), "GET", url, "")
+	if strings.Contains(w.Body.String(), "milk") || strings.Count(w.Body.String(), "Rent") != 1 || !strings.Contains(w.Body.String(), "Taxes") {
+		t.Errorf("Error, unexpected documents %s", w.Body.String())
+	}
+}
+
+func TestPrincipalHas(t *testing.T) {
+	tests := []struct {
+		principal *Principal
+		role      string
+		expected  bool
+	}{
+		{nil, ANYONE, true},
+		{nil, AUTHENTICATED, false},
+		{nil, "admin", false},
+		{&Principal{}, AUTHENTICATED, true},
+		{&Principal{Roles: []string{"admin"}}, "admin", true},
+		{&Principal{Scopes: []string{"todos:read"}}, "todos:read", true},
+		{&Principal{Roles: []string{"editor"}, Scopes: []string{"todos:read"}}, "admin", false},
+	}
+	for i, test := range tests {
+		if has := test.principal.Has(test.role); has != test.expected {
+			t.Errorf("#%d Error, expected %v, got %v", i, test.expected, has)
+		}
+	}
+}
@@ -0,0 +1,387 @@
+package rest
+
+import (
+	"bufio"
+	"bytes"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"io/ioutil"
+	"net/http"
+	"reflect"
+)
+
+// ItemResult - the outcome of one record of a batched insertMany, Index is the position of the record in the request body
+type ItemResult struct {
+	Index  int    `json:"index" xml:"index"`
+	Status int    `json:"status" xml:"status"`
+	ID     string `json:"id,omitempty" xml:"id,omitempty"`
+	Error  string `json:"error,omitempty" xml:"error,omitempty"`
+}
+
+// BulkStorage - optional Storage extension for insertMany requests ingested in batches.
+// InsertBatch receives a slice of the resource type and returns a result per document in the same order,
+// an error fails every document of the batch and ends the request.
+type BulkStorage interface {
+	InsertBatch(docs interface{}) ([]ItemResult, error)
+}
+
+// RecordDecoder - optional Serializer extension reading the records of an insertMany body one at a time
+type RecordDecoder interface {
+	DecodeStream(r io.Reader) (RecordReader, error)
+}
+
+// RecordReader - ReadRecord decodes the next record into v and returns io.EOF after the last one.
+// A malformed record is reported as a RecordError and the following records are still read, other errors end the body.
+type RecordReader interface {
+	ReadRecord(v interface{}) error
+}
+
+// RecordError - a record that could not be decoded
+type RecordError struct {
+	Err error
+}
+
+func (e *RecordError) Error() string {
+	return e.Err.Error()
+}
+
+// bulk reports whether an insertMany request is ingested in batches
+func (model *Model) bulk() bool {
+	size, _ := model.Get(BATCHSIZE).(int)
+	_, storage := model.Storage.(BulkStorage)
+	_, decoder := model.Serializer.(RecordDecoder)
+	return model.Get(ACTION) == INSERTMANY && size > 0 && storage && decoder
+}
+
+// ingest decodes, validates and stores the records of an insertMany request one batch at a time and
+// responds with a result per record, 201 when every record was created and 207 otherwise. hook runs the hooks of a
+// stage of the pipeline.
+func (model *Model) ingest(hook func(stage string) error) error {
+	reader, err := model.Serializer.(RecordDecoder).DecodeStream(model.GetRequest().Body)
+	if err != nil {
+		status := http.StatusBadRequest
+		if _, ok := err.(*BodyTooLargeError); ok {
+			status = http.StatusRequestEntityTooLarge
+		}
+		model.SetResponseStatus(status)
+		model.SetResponseBody(errorBody(err))
+		return err
+	}
+	size := model.Get(BATCHSIZE).(int)
+	t := model.Get(DATATYPE).(reflect.Type)
+	report := []ItemResult{}
+	batch := reflect.MakeSlice(reflect.SliceOf(t), 0, size)
+	// pending holds the positions in report of the documents of the batch
+	pending := make([]int, 0, size)
+	flush := func() error {
+		if batch.Len() == 0 {
+			return nil
+		}
+		// The hooks see the batch as the request body
+		records := reflect.New(batch.Type())
+		records.Elem().Set(batch)
+		response := model.GetResponse()
+		model.Set(REQUESTBODY, records.Interface())
+		if err := hook(BEFOREEXECUTE); err != nil {
+			result := rejection(model.GetResponse(), err)
+			model.SetResponse(response)
+			for _, pos := range pending {
+				result.Index = pos
+				report[pos] = result
+			}
+			batch = reflect.MakeSlice(reflect.SliceOf(t), 0, size)
+			pending = pending[:0]
+			return nil
+		}
+		results, err := model.Storage.(BulkStorage).InsertBatch(records.Elem().Interface())
+		if err == nil && len(results) != len(pending) {
+			err = fmt.Errorf("InsertBatch returned %d results for %d documents", len(results), len(pending))
+		}
+		for i, pos := range pending {
+			if err != nil {
+				report[pos].Status = http.StatusInternalServerError
+				report[pos].Error = http.StatusText(http.StatusInternalServerError)
+				continue
+			}
+			results[i].Index = pos
+			report[pos] = results[i]
+		}
+		batch = reflect.MakeSlice(reflect.SliceOf(t), 0, size)
+		pending = pending[:0]
+		return err
+	}
+	for {
+		doc := reflect.New(t)
+		err = reader.ReadRecord(doc.Interface())
+		if err == io.EOF {
+			err = nil
+			break
+		}
+		pos := len(report)
+		report = append(report, ItemResult{Index: pos, Status: http.StatusBadRequest})
+		if err != nil {
+			report[pos].Error = err.Error()
+			if _, ok := err.(*RecordError); ok {
+				continue
+			}
+			// The rest of the body can not be read, store what was read before.
+			break
+		}
+		validated, result := model.validateRecord(doc.Elem(), hook)
+		if result != nil {
+			result.Index = pos
+			report[pos] = *result
+			continue
+		}
+		batch = reflect.Append(batch, validated)
+		pending = append(pending, pos)
+		if batch.Len() >= size {
+			if err = flush(); err != nil {
+				break
+			}
+		}
+	}
+	if err == nil || len(pending) > 0 {
+		if ferr := flush(); ferr != nil {
+			err = ferr
+		}
+	}
+	if len(report) == 0 {
+		model.SetResponseStatus(http.StatusBadRequest)
+		model.SetResponseBody(errEmptyBody.Error())
+		return errEmptyBody
+	}
+	status := http.StatusCreated
+	for _, result := range report {
+		if result.Status != http.StatusCreated {
+			status = http.StatusMultiStatus
+		}
+	}
+	model.SetResponseStatus(status)
+	model.SetResponseBody(report)
+	return err
+}
+
+// validateRecord runs the afterDecode and beforeValidate hooks, the validator and the authorizer on a single record
+// presented as a one document insertMany body, it returns the validated document or the result of a rejected record
+func (model *Model) validateRecord(doc reflect.Value, hook func(stage string) error) (reflect.Value, *ItemResult) {
+	response := model.GetResponse()
+	list := reflect.New(reflect.SliceOf(doc.Type()))
+	list.Elem().Set(reflect.Append(list.Elem(), doc))
+	model.Set(REQUESTBODY, list.Interface())
+	err := hook(AFTERDECODE)
+	if err == nil {
+		err = hook(BEFOREVALIDATE)
+	}
+	if err == nil {
+		err = model.Validate()
+	}
+	if err == nil {
+		err = model.Authorize()
+	}
+	rejected := model.GetResponse()
+	model.SetResponse(response)
+	if err == nil {
+		return list.Elem().Index(0), nil
+	}
+	result := rejection(rejected, err)
+	return doc, &result
+}
+
+// rejection returns the result of a record rejected with err and the response set for it
+func rejection(rejected Response, err error) ItemResult {
+	result := ItemResult{Status: rejected.Status, Error: err.Error()}
+	if msg, ok := rejected.Body.(string); ok {
+		result.Error = msg
+	}
+	if result.Status < http.StatusBadRequest {
+		result.Status = http.StatusBadRequest
+	}
+	return result
+}
+
+// jsonRecords reads the elements of a JSON array
+type jsonRecords struct {
+	decoder *json.Decoder
+	body    *countingReader
+	options *DecodeOptions
+	action  string
+}
+
+// countingReader counts the bytes read from a reader
+type countingReader struct {
+	io.Reader
+	n int64
+}
+
+func (c *countingReader) Read(p []byte) (int, error) {
+	n, err := c.Reader.Read(p)
+	c.n += int64(n)
+	return n, err
+}
+
+// DecodeStream - reads the elements of a JSON array one at a time applying the DecodeOptions of the resource to each,
+// a body bounded by MaxBodySize is read as a whole first so that one too large is refused before any record is stored
+func (j *JSON) DecodeStream(r io.Reader) (RecordReader, error) {
+	options, _ := j.Get(DECODEOPTIONS).(*DecodeOptions)
+	if options != nil && options.MaxBodySize > 0 {
+		b, err := ioutil.ReadAll(io.LimitReader(r, options.MaxBodySize+1))
+		if err != nil {
+			return nil, err
+		}
+		if int64(len(b)) > options.MaxBodySize {
+			return nil, &BodyTooLargeError{Limit: options.MaxBodySize}
+		}
+		r = bytes.NewReader(b)
+	}
+	body := &countingReader{Reader: r}
+	decoder := json.NewDecoder(body)
+	if options != nil && options.UseNumber {
+		decoder.UseNumber()
+	}
+	token, err := decoder.Token()
+	if err == io.EOF {
+		return nil, errEmptyBody
+	}
+	if err != nil {
+		return nil, err
+	}
+	if delim, ok := token.(json.Delim); !ok || delim != '[' {
+		return nil, errors.New("The request body must be a JSON array")
+	}
+	action, _ := j.Get(ACTION).(string)
+	return &jsonRecords{decoder: decoder, body: body, options: options, action: action}, nil
+}
+
+func (s *jsonRecords) ReadRecord(v interface{}) error {
+	if !s.decoder.More() {
+		// Expect the closing bracket, a body that ends before it is truncated.
+		if _, err := s.decoder.Token(); err == io.EOF {
+			return io.ErrUnexpectedEOF
+		} else if err != nil {
+			return err
+		}
+		if s.options != nil && s.options.DisallowTrailingData {
+			offset, err := s.trailing()
+			if err != nil {
+				return err
+			}
+			if offset >= 0 {
+				return &DecodeError{Offset: offset, Msg: "unexpected data after the document", Code: "trailingData"}
+			}
+		}
+		return io.EOF
+	}
+	if s.options == nil {
+		err := s.decoder.Decode(v)
+		if _, ok := err.(*json.UnmarshalTypeError); ok {
+			// The decoder has consumed the element, carry on with the next one.
+			return &RecordError{Err: err}
+		}
+		return err
+	}
+	var raw json.RawMessage
+	if err := s.decoder.Decode(&raw); err != nil {
+		return err
+	}
+	record := *s.options
+	record.MaxBodySize, record.DisallowTrailingData = 0, false
+	if err := record.decode(bytes.NewReader(raw), v, s.action); err != nil {
+		if e, ok := err.(*DecodeError); ok {
+			// Report offsets in the body rather than in the record
+			e.Offset += s.offset() - int64(len(raw))
+		}
+		return &RecordError{Err: err}
+	}
+	return nil
+}
+
+// offset returns the number of bytes of the body the decoder has consumed
+func (s *jsonRecords) offset() int64 {
+	offset := s.body.n
+	if b, ok := s.decoder.Buffered().(interface {
+		Len() int
+	}); ok {
+		offset -= int64(b.Len())
+	}
+	return offset
+}
+
+// trailing returns the offset of the first byte after the array that is not white space, -1 when there is none
+func (s *jsonRecords) trailing() (int64, error) {
+	offset := s.offset()
+	r := bufio.NewReader(io.MultiReader(s.decoder.Buffered(), s.body))
+	for {
+		c, err := r.ReadByte()
+		if err == io.EOF {
+			return -1, nil
+		}
+		if err != nil {
+			return 0, err
+		}
+		if c != ' ' && c != '\t' && c != '\r' && c != '\n' {
+			return offset, nil
+		}
+		offset++
+	}
+}
+
+// ndjsonRecords reads one JSON document per line, skipping blank lines
+type ndjsonRecords struct {
+	reader  *bufio.Reader
+	options DecodeOptions
+	action  string
+	// offset is the number of bytes of the body read before the current line
+	offset int64
+}
+
+// DecodeStream - reads one document per line applying the DecodeOptions of the resource to each, a malformed line
+// does not affect the others. A body bounded by MaxBodySize is read as a whole first so that one too large is refused
+// before any record is stored.
+func (n *NDJSON) DecodeStream(r io.Reader) (RecordReader, error) {
+	records := &ndjsonRecords{}
+	if options, ok := n.Get(DECODEOPTIONS).(*DecodeOptions); ok {
+		if options.MaxBodySize > 0 {
+			b, err := ioutil.ReadAll(io.LimitReader(r, options.MaxBodySize+1))
+			if err != nil {
+				return nil, err
+			}
+			if int64(len(b)) > options.MaxBodySize {
+				return nil, &BodyTooLargeError{Limit: options.MaxBodySize}
+			}
+			r = bytes.NewReader(b)
+		}
+		records.options = *options
+	}
+	// Every line holds one document
+	records.options.MaxBodySize, records.options.DisallowTrailingData = 0, true
+	records.reader = bufio.NewReader(r)
+	records.action, _ = n.Get(ACTION).(string)
+	return records, nil
+}
+
+func (s *ndjsonRecords) ReadRecord(v interface{}) error {
+	for {
+		line, err := s.reader.ReadBytes('\n')
+		if err != nil && err != io.EOF {
+			return err
+		}
+		start := s.offset
+		s.offset += int64(len(line))
+		if doc := bytes.TrimLeft(line, " \t\r\n"); len(doc) > 0 {
+			if derr := s.options.decode(bytes.NewReader(doc), v, s.action); derr != nil {
+				if e, ok := derr.(*DecodeError); ok {
+					// Report offsets in the body rather than in the line
+					e.Offset += start + int64(len(line)-len(doc))
+				}
+				return &RecordError{Err: derr}
+			}
+			return nil
+		}
+		if err == io.EOF {
+			return io.EOF
+		}
+	}
+}
@@ -0,0 +1,200 @@
+package rest
+
+import (
+	"database/sql"
+	"errors"
+	"net/http"
+	"reflect"
+	"strings"
+	"testing"
+)
+
+// FakeTitleValidator rejects todos without a title
+type FakeTitleValidator struct {
+	*Context
+}
+
+func (v *FakeTitleValidator) UseContext(c *Context) {
+	v.Context = c
+}
+
+func (v *FakeTitleValidator) Validate() error {
+	todos, ok := v.Get(REQUESTBODY).(*[]FakeTodo)
+	if !ok {
+		return nil
+	}
+	for _, todo := range *todos {
+		if todo.Title == "" {
+			v.SetResponseStatus(http.StatusUnprocessableEntity)
+			v.SetResponseBody("The title is required")
+			return errors.New("The title is required")
+		}
+	}
+	return nil
+}
+
+func TestBulkInsert(t *testing.T) {
+	tests := []struct {
+		serializer Serializer
+		body       string
+		status     int
+		expected   string
+		stored     int
+	}{
+		{&JSON{}, `[{"id": "a", "title": "Milk"}, {"id": "b", "title": "Eggs"}, {"id": "c", "title": "Tea"}]`, http.StatusCreated,
+			`[{"index":0,"status":201,"id":"a"},{"index":1,"status":201,"id":"b"},{"index":2,"status":201,"id":"c"}]`, 3},
+		{&JSON{}, `[{"id": "a", "title": "Milk"}, {"id": "b"}, {"id": "a", "title": "Tea"}, {"title": 7}, {"id": "x", "title": "Bread"}]`, http.StatusMultiStatus,
+			`[{"index":0,"status":201,"id":"a"},{"index":1,"status":422,"error":"The title is required"},{"index":2,"status":409,"id":"a","error":"Document \"a\" already exists"},` +
+				`{"index":3,"status":400,"error":"json: cannot unmarshal number into Go struct field FakeTodo.title of type string"},{"index":4,"status":201,"id":"x"}]`, 2},
+		{&JSON{}, `[{"id": "a", "title": "Milk"}, {"id": "b", "title": "Eggs"}, {"id": "c", "ti`, http.StatusMultiStatus,
+			`[{"index":0,"status":201,"id":"a"},{"index":1,"status":201,"id":"b"},{"index":2,"status":400,"error":"unexpected EOF"}]`, 2},
+		{&JSON{}, `[{"id": "a", "title": "Milk"}`, http.StatusMultiStatus,
+			`[{"index":0,"status":201,"id":"a"},{"index":1,"status":400,"error":"unexpected end of JSON input"}]`, 1},
+		{&JSON{}, `{"id": "a", "title": "Milk"}`, http.StatusBadRequest, `"The request body must be a JSON array"`, 0},
+		{&JSON{}, ``, http.StatusBadRequest, `"The request body is empty"`, 0},
+		{&JSON{}, `[]`, http.StatusBadRequest, `"The request body is empty"`, 0},
+		{&NDJSON{}, "{\"id\": \"a\", \"title\": \"Milk\"}\n{\"id\": \n\n{\"id\": \"c\", \"title\": \"Tea\"}", http.StatusMultiStatus,
+			"{\"index\":0,\"status\":201,\"id\":\"a\"}\n{\"index\":1,\"status\":400,\"error\":\"unexpected EOF at byte offset 37\"}\n{\"index\":2,\"status\":201,\"id\":\"c\"}\n", 2},
+	}
+	service := NewFakeService(FakeScenario{})
+	for i, test := range tests {
+		storage := NewMemory(reflect.TypeOf(FakeTodo{}))
+		resource := NewFakeTodoResource(storage).
+			UseValidator(&FakeTitleValidator{}).
+			UseSerializer(test.serializer).
+			UseBatchSize(2)
+		w := serve(service.InsertMany(resource), "POST", "http://foo.bar/todos", test.body)
+		if w.Code != test.status || w.Body.String() != test.expected {
+			t.Errorf("#%d Error, expected %d %s, got %d %s", i, test.status, test.expected, w.Code, w.Body.String())
+		}
+		if storage.Len() != test.stored {
+			t.Errorf("#%d Error, expected %d documents, got %d", i, test.stored, storage.Len())
+		}
+	}
+}
+
+func TestBulkInsertDisabled(t *testing.T) {
+	// Serializers that can not read records one at a time fall back to decoding the whole body.
+	storage := NewMemory(reflect.TypeOf(FakeTodo{}))
+	resource := NewFakeTodoResource(storage).UseSerializer(&CSV{}).UseBatchSize(2)
+	w := serve(NewFakeService(FakeScenario{}).InsertMany(resource), "POST", "http://foo.bar/todos", "id,title\na,Milk\n")
+	if w.Code != http.StatusCreated || storage.Len() != 1 {
+		t.Errorf("Error, expected %d and 1 document, got %d and %d", http.StatusCreated, w.Code, storage.Len())
+	}
+}
+
+func TestBulkInsertHooks(t *testing.T) {
+	var batches []int
+	storage := NewMemory(reflect.TypeOf(FakeTodo{}))
+	resource := NewFakeTodoResource(storage).
+		UseBatchSize(2).
+		AddHook(AFTERDECODE, func(model *Model) error {
+			todo := &(*model.Get(REQUESTBODY).(*[]FakeTodo))[0]
+			todo.Title = strings.ToUpper(todo.Title)
+			return nil
+		}, INSERTMANY).
+		AddHook(BEFOREVALIDATE, func(model *Model) error {
+			if (*model.Get(REQUESTBODY).(*[]FakeTodo))[0].Title == "EGGS" {
+				model.SetResponseStatus(http.StatusForbidden)
+				model.SetResponseBody("Eggs are sold out")
+				return errors.New("Eggs are sold out")
+			}
+			return nil
+		}, INSERTMANY).
+		AddHook(BEFOREEXECUTE, func(model *Model) error {
+			todos := *model.Get(REQUESTBODY).(*[]FakeTodo)
+			batches = append(batches, len(todos))
+			for _, todo := range todos {
+				if todo.Title == "RYE" {
+					return errors.New("Rye is not stocked")
+				}
+			}
+			return nil
+		}, INSERTMANY)
+	body := `[{"id": "a", "title": "Milk"}, {"id": "b", "title": "Eggs"}, {"id": "c", "title": "Tea"}, {"id": "d", "title": "Rye"}]`
+	w := serve(NewFakeService(FakeScenario{}).InsertMany(resource), "POST", "http://foo.bar/todos", body)
+	expected := `[{"index":0,"status":201,"id":"a"},{"index":1,"status":403,"error":"Eggs are sold out"},{"index":2,"status":201,"id":"c"},{"index":3,"status":500,"error":"Internal Server Error"}]`
+	if w.Code != http.StatusMultiStatus || w.Body.String() != expected {
+		t.Errorf("Error, expected %d %s, got %d %s", http.StatusMultiStatus, expected, w.Code, w.Body.String())
+	}
+	if !reflect.DeepEqual(batches, []int{2, 1}) {
+		t.Errorf("Error, expected beforeExecute to run for batches of 2 and 1 records, got %v", batches)
+	}
+	w = serve(NewFakeService(FakeScenario{}).FindMany(resource), "GET", "http://foo.bar/todos", "")
+	if storage.Len() != 2 || !strings.Contains(w.Body.String(), `"MILK"`) || !strings.Contains(w.Body.String(), `"TEA"`) {
+		t.Errorf("Error, expected MILK and TEA to be stored, got %s", w.Body.String())
+	}
+}
+
+func TestSQLInsertBatch(t *testing.T) {
+	db, _ := sql.Open("restfake", "")
+	fakeSQLDriver.queries = nil
+	inserts := 0
+	fakeSQLDriver.respond = func(query string) FakeSQLResponse {
+		if !strings.HasPrefix(query, "INSERT") {
+			return FakeSQLResponse{}
+		}
+		inserts++
+		// The second document conflicts both in the transaction and when it is retried alone.
+		if inserts == 2 || inserts == 4 {
+			return FakeSQLResponse{err: errors.New("UNIQUE constraint failed: todos.id")}
+		}
+		return FakeSQLResponse{affected: 1, lastID: int64(inserts)}
+	}
+	resource := NewResource("todo").
+		UseType(reflect.TypeOf(FakeRow{})).
+		UseStorage(NewSQL(db, SQLite, "todos", reflect.TypeOf(FakeRow{}))).
+		UseValidator(&FakeNoopValidator{}).
+		UseSerializer(&JSON{}).
+		UseBatchSize(10)
+	w := serve(NewFakeService(FakeScenario{}).InsertMany(resource), "POST", "http://foo.bar/todos", `[{"id": 1, "title": "Milk"}, {"id": 2, "title": "Eggs"}, {"id": 3, "title": "Tea"}]`)
+	expected := `[{"index":0,"status":201,"id":"1"},{"index":1,"status":409,"id":"2","error":"Document \"2\" already exists"},{"index":2,"status":201,"id":"3"}]`
+	if w.Code != http.StatusMultiStatus || w.Body.String() != expected {
+		t.Errorf("Error, expected %d %s, got %d %s", http.StatusMultiStatus, expected, w.Code, w.Body.String())
+	}
+	if inserts != 5 {
+		t.Errorf("Error, expected 5 inserts, got %d: %s", inserts, strings.Join(fakeSQLDriver.queries, "; "))
+	}
+}
+
+func TestBulkInsertDecodeOptions(t *testing.T) {
+	strict := &DecodeOptions{DisallowUnknownFields: true, DisallowTrailingData: true, MaxBodySize: 128, RequireFields: true}
+	tests := []struct {
+		serializer Serializer
+		body       string
+		status     int
+		expected   string
+		stored     int
+	}{
+		{&JSON{}, `[{"id": "a", "items": [{"sku": "x"}]}, {"id": "b", "items": [{"sku": "y"}], "colour": "red"}, {"id": "c"}]`, http.StatusMultiStatus,
+			`[{"index":0,"status":201,"id":"a"},{"index":1,"status":400,"error":"colour: unknown field at byte offset 76"},{"index":2,"status":400,"error":"items: missing required field at byte offset 94"}]`, 1},
+		{&JSON{}, `[{"id": "a", "items": [{"sku": "x"}]}] x`, http.StatusMultiStatus,
+			`[{"index":0,"status":201,"id":"a"},{"index":1,"status":400,"error":"unexpected data after the document at byte offset 39"}]`, 1},
+		{&JSON{}, `[{"id": "a", "items": [{"sku": "x"}]}]` + strings.Repeat(" ", 100), http.StatusRequestEntityTooLarge, `"The request body is larger than 128 bytes"`, 0},
+		{&NDJSON{}, "{\"id\": \"a\", \"items\": [{\"sku\": \"x\"}]}\n{\"id\": \"b\", \"items\": [{\"sku\": \"y\"}], \"colour\": \"red\"}\n{\"id\": \"c\"}\n", http.StatusMultiStatus,
+			"{\"index\":0,\"status\":201,\"id\":\"a\"}\n{\"index\":1,\"status\":400,\"error\":\"colour: unknown field at byte offset 74\"}\n" +
+				"{\"index\":2,\"status\":400,\"error\":\"items: missing required field at byte offset 91\"}\n", 1},
+		{&NDJSON{}, "{\"id\": \"a\", \"items\": [{\"sku\": \"x\"}]} x\n", http.StatusMultiStatus,
+			"{\"index\":0,\"status\":400,\"error\":\"unexpected data after the document at byte offset 37\"}\n", 0},
+		{&NDJSON{}, "{\"id\": \"a\", \"items\": [{\"sku\": \"x\"}]}\n" + strings.Repeat("\n", 100), http.StatusRequestEntityTooLarge,
+			"\"The request body is larger than 128 bytes\"\n", 0},
+	}
+	service := NewFakeService(FakeScenario{})
+	for i, test := range tests {
+		storage := NewMemory(reflect.TypeOf(FakeOrder{}))
+		resource := NewResource("order").
+			UseType(reflect.TypeOf(FakeOrder{})).
+			UseStorage(storage).
+			UseValidator(&FakeNoopValidator{}).
+			UseSerializer(test.serializer).
+			UseDecodeOptions(strict).
+			UseBatchSize(2)
+		w := serve(service.InsertMany(resource), "POST", "http://foo.bar/orders", test.body)
+		if w.Code != test.status || w.Body.String() != test.expected {
+			t.Errorf("#%d Error, expected %d %s, got %d %s", i, test.status, test.expected, w.Code, w.Body.String())
+		}
+		if storage.Len() != test.stored {
+			t.Errorf("#%d Error, expected %d documents, got %d", i, test.stored, storage.Len())
+		}
+	}
+}
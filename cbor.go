@@ -0,0 +1,373 @@
+package rest
+
+import (
+	"encoding/binary"
+	"errors"
+	"math"
+	"reflect"
+	"time"
+)
+
+// CBOR - a Serializer for application/cbor (RFC 8949), field names follow the `json` struct tags
+// and times are encoded as RFC 3339 strings with tag 0
+type CBOR struct {
+	*Context
+}
+
+// UseContext -
+func (c *CBOR) UseContext(ctx *Context) {
+	c.Context = ctx
+}
+
+// Clone - returns a CBOR serializer for another request
+func (c *CBOR) Clone() Serializer {
+	return &CBOR{}
+}
+
+// Decode -
+func (c *CBOR) Decode() error {
+	return decodeBody(c.Context, UnmarshalCBOR)
+}
+
+// Encode -
+func (c *CBOR) Encode(v interface{}) ([]byte, error) {
+	return MarshalCBOR(v)
+}
+
+// MarshalCBOR - returns the CBOR encoding of v
+func MarshalCBOR(v interface{}) ([]byte, error) {
+	w := &cborWriter{}
+	err := encodeValue(w, reflect.ValueOf(v))
+	return w.b, err
+}
+
+// UnmarshalCBOR - decodes CBOR data into the value pointed to by v
+func UnmarshalCBOR(data []byte, v interface{}) error {
+	rv, err := unmarshalInto(v)
+	if err != nil {
+		return err
+	}
+	r := &cborReader{b: data}
+	if err = r.readValue(rv); err != nil {
+		return err
+	}
+	if r.off != len(r.b) {
+		return errTrailing
+	}
+	return nil
+}
+
+// CBOR major types
+const (
+	cborUint = iota << 5
+	cborNegint
+	cborBytes
+	cborText
+	cborArray
+	cborMap
+	cborTag
+	cborSimple
+)
+
+const (
+	cborFalse      = cborSimple | 20
+	cborTrue       = cborSimple | 21
+	cborNull       = cborSimple | 22
+	cborUndefined  = cborSimple | 23
+	cborIndefinite = 31
+	cborBreak      = cborSimple | cborIndefinite
+	// cborDateTime and cborEpoch tag RFC 3339 strings and seconds since the epoch
+	cborDateTime = 0
+	cborEpoch    = 1
+)
+
+var errMalformedCBOR = errors.New("Malformed CBOR data")
+
+type cborWriter struct {
+	b []byte
+}
+
+// head writes the initial byte of an item and its argument in the shortest form
+func (w *cborWriter) head(major byte, n uint64) {
+	switch {
+	case n < 24:
+		w.b = append(w.b, major|byte(n))
+	case n <= math.MaxUint8:
+		w.b = append(w.b, major|24, byte(n))
+	case n <= math.MaxUint16:
+		w.b = append(w.b, major|25, 0, 0)
+		binary.BigEndian.PutUint16(w.b[len(w.b)-2:], uint16(n))
+	case n <= math.MaxUint32:
+		w.b = append(w.b, major|26, 0, 0, 0, 0)
+		binary.BigEndian.PutUint32(w.b[len(w.b)-4:], uint32(n))
+	default:
+		w.b = append(w.b, major|27, 0, 0, 0, 0, 0, 0, 0, 0)
+		binary.BigEndian.PutUint64(w.b[len(w.b)-8:], n)
+	}
+}
+
+func (w *cborWriter) writeNil() {
+	w.b = append(w.b, cborNull)
+}
+
+func (w *cborWriter) writeBool(b bool) {
+	if b {
+		w.b = append(w.b, cborTrue)
+		return
+	}
+	w.b = append(w.b, cborFalse)
+}
+
+func (w *cborWriter) writeInt(n int64) {
+	if n >= 0 {
+		w.head(cborUint, uint64(n))
+		return
+	}
+	w.head(cborNegint, uint64(-1-n))
+}
+
+func (w *cborWriter) writeUint(n uint64) {
+	w.head(cborUint, n)
+}
+
+func (w *cborWriter) writeFloat(f float64, bits int) {
+	if bits == 32 {
+		w.b = append(w.b, cborSimple|26, 0, 0, 0, 0)
+		binary.BigEndian.PutUint32(w.b[len(w.b)-4:], math.Float32bits(float32(f)))
+		return
+	}
+	w.b = append(w.b, cborSimple|27, 0, 0, 0, 0, 0, 0, 0, 0)
+	binary.BigEndian.PutUint64(w.b[len(w.b)-8:], math.Float64bits(f))
+}
+
+func (w *cborWriter) writeString(s string) {
+	w.head(cborText, uint64(len(s)))
+	w.b = append(w.b, s...)
+}
+
+func (w *cborWriter) writeBytes(b []byte) {
+	w.head(cborBytes, uint64(len(b)))
+	w.b = append(w.b, b...)
+}
+
+// writeTime keeps the nanoseconds and the zone offset of t
+func (w *cborWriter) writeTime(t time.Time) {
+	w.head(cborTag, cborDateTime)
+	w.writeString(t.Format(time.RFC3339Nano))
+}
+
+func (w *cborWriter) writeArrayHeader(n int) {
+	w.head(cborArray, uint64(n))
+}
+
+func (w *cborWriter) writeMapHeader(n int) {
+	w.head(cborMap, uint64(n))
+}
+
+type cborReader struct {
+	b     []byte
+	off   int
+	depth int
+}
+
+// more also consumes the break that ends a container of unknown length
+func (r *cborReader) more(i, n int) bool {
+	if n >= 0 {
+		return i < n
+	}
+	if r.off < len(r.b) && r.b[r.off] == cborBreak {
+		r.off++
+		return false
+	}
+	// Without a break the next item is read, failing when the input ends.
+	return true
+}
+
+// head reads the initial byte of an item, returning its major type, additional information and argument
+func (r *cborReader) head() (major, info byte, n uint64, err error) {
+	if r.off >= len(r.b) {
+		return 0, 0, 0, errTruncated
+	}
+	c := r.b[r.off]
+	r.off++
+	major, info = c&0xe0, c&0x1f
+	switch {
+	case info < 24:
+		return major, info, uint64(info), nil
+	case info == cborIndefinite:
+		return major, info, 0, nil
+	case info > 27:
+		return major, info, 0, errMalformedCBOR
+	}
+	size := 1 << (info - 24)
+	if len(r.b)-r.off < size {
+		return major, info, 0, errTruncated
+	}
+	for _, b := range r.b[r.off : r.off+size] {
+		n = n<<8 | uint64(b)
+	}
+	r.off += size
+	return major, info, n, nil
+}
+
+// length checks that at least min bytes per item remain for a container or string of n items
+func (r *cborReader) length(n uint64, min int) (int, error) {
+	if n > uint64(len(r.b)-r.off)/uint64(min) {
+		return 0, errTruncated
+	}
+	return int(n), nil
+}
+
+func (r *cborReader) readValue(v reflect.Value) error {
+	if r.off >= len(r.b) {
+		return errTruncated
+	}
+	if c := r.b[r.off]; c == cborNull || c == cborUndefined {
+		r.off++
+		return setNil(v)
+	}
+	if v.Kind() == reflect.Ptr {
+		if v.IsNil() {
+			v.Set(reflect.New(v.Type().Elem()))
+		}
+		return r.readValue(v.Elem())
+	}
+	major, info, n, err := r.head()
+	if err != nil {
+		return err
+	}
+	if info == cborIndefinite && (major < cborBytes || major > cborMap) {
+		return errMalformedCBOR
+	}
+	switch major {
+	case cborUint:
+		return setUint(v, n)
+	case cborNegint:
+		if n > math.MaxInt64 {
+			return typeError("an integer below the int64 range", v)
+		}
+		return setInt(v, -1-int64(n))
+	case cborBytes, cborText:
+		b, err := r.readString(major, info, n)
+		if err != nil {
+			return err
+		}
+		if major == cborBytes {
+			return setBytes(v, b)
+		}
+		return setString(v, string(b))
+	case cborArray, cborMap:
+		if r.depth++; r.depth > maxDepth {
+			return errTooDeep
+		}
+		defer func() { r.depth-- }()
+		count := -1
+		if info != cborIndefinite {
+			min := 1
+			if major == cborMap {
+				min = 2
+			}
+			if count, err = r.length(n, min); err != nil {
+				return err
+			}
+		}
+		if major == cborArray {
+			return readArray(r, v, count)
+		}
+		return readMap(r, v, count)
+	case cborTag:
+		return r.readTag(v, n)
+	}
+	switch info {
+	case 20, 21:
+		return setBool(v, info == 21)
+	case 25:
+		return setFloat(v, halfFloat(uint16(n)))
+	case 26:
+		return setFloat(v, float64(math.Float32frombits(uint32(n))))
+	case 27:
+		return setFloat(v, math.Float64frombits(n))
+	}
+	return typeError("a CBOR simple value", v)
+}
+
+// readString reads a byte or text string, joining the chunks of strings of unknown length
+func (r *cborReader) readString(major, info byte, n uint64) ([]byte, error) {
+	if info != cborIndefinite {
+		size, err := r.length(n, 1)
+		if err != nil {
+			return nil, err
+		}
+		b := r.b[r.off : r.off+size]
+		r.off += size
+		return b, nil
+	}
+	var b []byte
+	for {
+		if r.off < len(r.b) && r.b[r.off] == cborBreak {
+			r.off++
+			return b, nil
+		}
+		chunkMajor, chunkInfo, chunkLen, err := r.head()
+		if err != nil {
+			return nil, err
+		}
+		if chunkMajor != major || chunkInfo == cborIndefinite {
+			return nil, errMalformedCBOR
+		}
+		chunk, err := r.readString(major, chunkInfo, chunkLen)
+		if err != nil {
+			return nil, err
+		}
+		b = append(b, chunk...)
+	}
+}
+
+// readTag decodes the times of tags 0 and 1, the content of other tags is decoded as if untagged
+func (r *cborReader) readTag(v reflect.Value, tag uint64) error {
+	if tag != cborDateTime && tag != cborEpoch {
+		return r.readValue(v)
+	}
+	if v.Type() != timeType && !emptyInterface(v) {
+		return r.readValue(v)
+	}
+	if tag == cborDateTime {
+		var s string
+		if err := r.readValue(reflect.ValueOf(&s).Elem()); err != nil {
+			return err
+		}
+		t, err := time.Parse(time.RFC3339Nano, s)
+		if err != nil {
+			return err
+		}
+		return setTime(v, t)
+	}
+	var seconds float64
+	if err := r.readValue(reflect.ValueOf(&seconds).Elem()); err != nil {
+		return err
+	}
+	sec, frac := math.Modf(seconds)
+	return setTime(v, time.Unix(int64(sec), int64(frac*1e9)).UTC())
+}
+
+// halfFloat converts an IEEE 754 half precision float
+func halfFloat(h uint16) float64 {
+	exp, mant := int(h>>10)&0x1f, float64(h&0x3ff)
+	var f float64
+	switch exp {
+	case 0:
+		f = math.Ldexp(mant, -24)
+	case 31:
+		if mant == 0 {
+			f = math.Inf(1)
+		} else {
+			f = math.NaN()
+		}
+	default:
+		f = math.Ldexp(mant+1024, exp-25)
+	}
+	if h&0x8000 != 0 {
+		return -f
+	}
+	return f
+}
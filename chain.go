@@ -0,0 +1,325 @@
+package rest
+
+import (
+	"bytes"
+	"fmt"
+	"io"
+	"io/ioutil"
+	"net/http"
+	"strings"
+	"sync"
+)
+
+// ValidatorChain - a Validator composed of others with All, Any, Parallel and When. Every validator checks the
+// request with its own copy of the context, the violations they answer with 422 are merged into one ValidationErrors
+// response and any other failure, such as 400 or 500, is answered as is.
+type ValidatorChain struct {
+	*Context
+	validators []Validator
+	any        bool
+	parallel   bool
+	actions    []string
+}
+
+// All - a Validator passing when every validator passes, checked in order
+func All(validators ...Validator) *ValidatorChain {
+	return &ValidatorChain{validators: validators}
+}
+
+// Any - a Validator passing when one of the validators passes
+func Any(validators ...Validator) *ValidatorChain {
+	return &ValidatorChain{validators: validators, any: true}
+}
+
+// Parallel - a Validator passing when every validator passes, checked concurrently, e.g. for rules querying a database
+func Parallel(validators ...Validator) *ValidatorChain {
+	return &ValidatorChain{validators: validators, parallel: true}
+}
+
+// When - a Validator running v for the actions given only
+func When(v Validator, actions ...string) *ValidatorChain {
+	return &ValidatorChain{validators: []Validator{v}, actions: actions}
+}
+
+// UseContext -
+func (v *ValidatorChain) UseContext(c *Context) {
+	v.Context = c
+}
+
+// Clone - returns a chain of copies of the validators for another request
+func (v *ValidatorChain) Clone() Validator {
+	c := *v
+	c.Context = nil
+	c.validators = make([]Validator, len(v.validators))
+	for i, validator := range v.validators {
+		c.validators[i] = cloneValidator(validator)
+	}
+	return &c
+}
+
+// outcome - the result of one validator of a chain
+type outcome struct {
+	err      error
+	response Response
+}
+
+// fork returns a copy of the context for one validator of the chain
+func (v *ValidatorChain) fork() *Context {
+	c := NewContext()
+	for key, value := range v.data {
+		c.data[key] = value
+	}
+	return &c
+}
+
+// applies reports whether the chain checks the current action
+func (v *ValidatorChain) applies() bool {
+	if len(v.actions) == 0 {
+		return true
+	}
+	action, _ := v.Get(ACTION).(string)
+	for _, a := range v.actions {
+		if a == action {
+			return true
+		}
+	}
+	return false
+}
+
+// check runs one phase of every validator, the raw body check when body is set, with the contexts fork returns and
+// returns their outcomes
+func (v *ValidatorChain) check(body bool, fork func() *Context) []outcome {
+	outcomes := make([]outcome, len(v.validators))
+	run := func(i int, c *Context) {
+		validator := v.validators[i]
+		var err error
+		if body {
+			bv, ok := validator.(BodyValidator)
+			if !ok {
+				return
+			}
+			validator.UseContext(c)
+			err = bv.ValidateBody()
+		} else {
+			validator.UseContext(c)
+			err = validator.Validate()
+		}
+		outcomes[i] = outcome{err: err, response: c.GetResponse()}
+	}
+	if !v.parallel {
+		for i := range v.validators {
+			run(i, fork())
+		}
+		return outcomes
+	}
+	var wg sync.WaitGroup
+	for i := range v.validators {
+		wg.Add(1)
+		go func(i int, c *Context) {
+			defer wg.Done()
+			run(i, c)
+		}(i, fork())
+	}
+	wg.Wait()
+	return outcomes
+}
+
+// bodyChecks - the outcomes of the raw body checks of Any chains, which Validate needs since validators whose
+// body check failed can not pass anymore
+type bodyChecks struct {
+	sync.Mutex
+	m map[*ValidatorChain][]outcome
+}
+
+// ValidateBody - runs the raw body checks of the validators that have one
+func (v *ValidatorChain) ValidateBody() error {
+	if !v.applies() {
+		return nil
+	}
+	// Set before forking so that nested chains share it
+	checks, _ := v.Get(BODYCHECKS).(*bodyChecks)
+	if checks == nil {
+		checks = &bodyChecks{m: make(map[*ValidatorChain][]outcome)}
+		v.Set(BODYCHECKS, checks)
+	}
+	fork := v.fork
+	if v.parallel && v.bodyValidators() > 1 {
+		// Read the body once, body checks running concurrently can not share the reader
+		b, err := v.readBody()
+		if err != nil {
+			v.SetResponseStatus(http.StatusBadRequest)
+			v.SetResponseBody(err.Error())
+			return err
+		}
+		fork = func() *Context {
+			c := v.fork()
+			r := *v.GetRequest()
+			r.Body = ioutil.NopCloser(bytes.NewReader(b))
+			c.Set(REQUEST, &r)
+			return c
+		}
+	}
+	outcomes := v.check(true, fork)
+	if v.any {
+		checks.Lock()
+		checks.m[v] = outcomes
+		checks.Unlock()
+	}
+	return v.merge(outcomes)
+}
+
+// bodyValidators counts the validators with a raw body check
+func (v *ValidatorChain) bodyValidators() int {
+	n := 0
+	for _, validator := range v.validators {
+		if _, ok := validator.(BodyValidator); ok {
+			n++
+		}
+	}
+	return n
+}
+
+// readBody reads the request body and puts it back for the Serializer to decode, reading one byte past the
+// MaxBodySize of the DecodeOptions so that the checks and the Serializer still answer 413
+func (v *ValidatorChain) readBody() ([]byte, error) {
+	r := v.GetRequest()
+	if r.Body == nil {
+		return nil, nil
+	}
+	var body io.Reader = r.Body
+	if options, ok := v.Get(DECODEOPTIONS).(*DecodeOptions); ok && options.MaxBodySize > 0 {
+		body = io.LimitReader(body, options.MaxBodySize+1)
+	}
+	b, err := ioutil.ReadAll(body)
+	if err != nil {
+		return nil, err
+	}
+	r.Body = ioutil.NopCloser(bytes.NewReader(b))
+	return b, nil
+}
+
+// Validate -
+func (v *ValidatorChain) Validate() error {
+	if !v.applies() {
+		return nil
+	}
+	outcomes := v.check(false, v.fork)
+	if checks, ok := v.Get(BODYCHECKS).(*bodyChecks); ok && v.any {
+		checks.Lock()
+		for i, o := range checks.m[v] {
+			if o.err != nil {
+				outcomes[i] = o
+			}
+		}
+		checks.Unlock()
+	}
+	return v.merge(outcomes)
+}
+
+// merge answers the failures of the outcomes
+func (v *ValidatorChain) merge(outcomes []outcome) error {
+	var failed []outcome
+	for _, o := range outcomes {
+		if o.err != nil {
+			failed = append(failed, o)
+		}
+	}
+	if len(failed) == 0 || (v.any && len(failed) < len(outcomes)) {
+		return nil
+	}
+	for _, o := range failed {
+		if o.response.Status != http.StatusUnprocessableEntity {
+			v.SetResponseStatus(o.response.Status)
+			v.SetResponseBody(o.response.Body)
+			return o.err
+		}
+	}
+	errs := ValidationErrors{}
+	for _, o := range failed {
+		errs = append(errs, violations(o.response.Body)...)
+	}
+	v.SetResponseStatus(http.StatusUnprocessableEntity)
+	v.SetResponseBody(errs)
+	return errs
+}
+
+// violations converts the body of a 422 response to ValidationErrors
+func violations(body interface{}) ValidationErrors {
+	if errs, ok := body.(Violations); ok {
+		return ValidationErrors(errs.Errors())
+	}
+	return ValidationErrors{{Message: fmt.Sprint(body)}}
+}
+
+// checkValidator - a Validator calling a func
+type checkValidator struct {
+	*Context
+	fn func(c *Context) error
+}
+
+// Check - a Validator calling fn, Violations such as ValidationErrors, SchemaErrors and FieldErrors are answered
+// with 422 and any other error with 500
+func Check(fn func(c *Context) error) Validator {
+	return &checkValidator{fn: fn}
+}
+
+// UseContext -
+func (v *checkValidator) UseContext(c *Context) {
+	v.Context = c
+}
+
+// Clone - returns a Validator calling the same func for another request
+func (v *checkValidator) Clone() Validator {
+	return &checkValidator{fn: v.fn}
+}
+
+// Validate -
+func (v *checkValidator) Validate() error {
+	err := v.fn(v.Context)
+	switch err.(type) {
+	case nil:
+		return nil
+	case Violations:
+		v.SetResponseStatus(http.StatusUnprocessableEntity)
+		v.SetResponseBody(err)
+	default:
+		v.SetResponseStatus(http.StatusInternalServerError)
+		v.SetResponseBody(http.StatusText(http.StatusInternalServerError))
+	}
+	return err
+}
+
+// RuleFunc - a custom rule of TagValidator, returning the message of a violation, or an error when the rule does
+// not apply to the value. Absent values, nil pointers, are not checked.
+type RuleFunc func(c *Context, value interface{}, param string) (string, error)
+
+// ruleRegistry holds the custom rules of TagValidator
+var ruleRegistry = struct {
+	sync.RWMutex
+	m map[string]RuleFunc
+}{m: make(map[string]RuleFunc)}
+
+// builtinRules - the rules of TagValidator custom rules can not replace
+var builtinRules = []string{"required", "omitempty", "dive", "min", "max", "len", "email", "url", "uuid", "oneof", "regex"}
+
+// RegisterRule - makes a custom rule available to the validate tags of every resource, e.g. a `unique` rule
+// querying the database for `validate:"unique"`. It panics when the name is taken by a built-in rule.
+func RegisterRule(name string, fn RuleFunc) {
+	_, taken := fieldComparisons[name]
+	for _, builtin := range builtinRules {
+		taken = taken || builtin == name
+	}
+	if taken || name == "" || strings.ContainsAny(name, ",=") {
+		panic("rest: can not register the validation rule " + name)
+	}
+	ruleRegistry.Lock()
+	ruleRegistry.m[name] = fn
+	ruleRegistry.Unlock()
+}
+
+func lookupRule(name string) (RuleFunc, bool) {
+	ruleRegistry.RLock()
+	defer ruleRegistry.RUnlock()
+	fn, ok := ruleRegistry.m[name]
+	return fn, ok
+}
@@ -0,0 +1,197 @@
+package rest
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"net/http"
+	"reflect"
+	"strings"
+	"sync"
+	"testing"
+	"time"
+)
+
+type FakeAccount struct {
+	ID    string `json:"id" rest:"id"`
+	Email string `json:"email" validate:"required,email,unique"`
+	Name  string `json:"name" validate:"min=2"`
+}
+
+func init() {
+	RegisterRule("unique", func(c *Context, value interface{}, param string) (string, error) {
+		if value == "taken@example.com" {
+			return "is taken", nil
+		}
+		return "", nil
+	})
+}
+
+func fakeCheck(field, msg string, delay time.Duration) Validator {
+	return Check(func(c *Context) error {
+		time.Sleep(delay)
+		if msg == "" {
+			return nil
+		}
+		return ValidationErrors{{Field: field, Rule: "check", Message: msg}}
+	})
+}
+
+func TestValidatorChain(t *testing.T) {
+	named, _ := ParseSchema([]byte(`{"required": ["name"]}`))
+	short, _ := ParseSchema([]byte(`{"properties": {"name": {"maxLength": 3}}}`))
+	fails := Check(func(c *Context) error { return errors.New("The database is down") })
+	tests := []struct {
+		validator Validator
+		body      string
+		status    int
+		expected  []FieldError
+	}{
+		{All(&TagValidator{}, fakeCheck("", "", 0)), `{"email": "otieno@example.com", "name": "Oti"}`, http.StatusCreated, nil},
+		{All(&TagValidator{}, fakeCheck("name", "must not be reserved", 0)), `{"email": "taken@example.com", "name": "O"}`,
+			http.StatusUnprocessableEntity, []FieldError{
+				{"email", "unique", "", "is taken", "unique"},
+				{"name", "min", "2", "must be at least 2 characters long", "min.string"},
+				{"name", "check", "", "must not be reserved", ""},
+			}},
+		{All(fakeCheck("name", "must not be reserved", 0)), `{"email": "otieno@example.com"}`,
+			http.StatusUnprocessableEntity, []FieldError{{"name", "check", "", "must not be reserved", ""}}},
+		{All(NewSchemaValidator().UseSchema(INSERTONE, named), &TagValidator{}), `{"email": "taken@example.com"}`,
+			http.StatusUnprocessableEntity, []FieldError{{"/name", "required", "", "is required", "required"}}},
+		{All(NewSchemaValidator().UseSchema(INSERTONE, named), &TagValidator{}), `{"email": `, http.StatusBadRequest, nil},
+		{All(fails, fakeCheck("name", "must not be reserved", 0)), `{}`, http.StatusInternalServerError, nil},
+		{Any(fakeCheck("name", "must be short", 0), fakeCheck("", "", 0)), `{}`, http.StatusCreated, nil},
+		{Any(fakeCheck("name", "must be short", 0), fakeCheck("name", "must be long", 0)), `{}`,
+			http.StatusUnprocessableEntity, []FieldError{
+				{"name", "check", "", "must be short", ""},
+				{"name", "check", "", "must be long", ""},
+			}},
+		{Any(NewSchemaValidator().UseSchema(INSERTONE, named), NewSchemaValidator().UseSchema(INSERTONE, short)), `{"name": "Otieno"}`, http.StatusCreated, nil},
+		{Any(NewSchemaValidator().UseSchema(INSERTONE, short), &TagValidator{}), `{"email": "otieno@example.com", "name": "Otieno"}`, http.StatusCreated, nil},
+		{Any(NewSchemaValidator().UseSchema(INSERTONE, short), &TagValidator{}), `{"email": "otieno", "name": "Otieno"}`,
+			http.StatusUnprocessableEntity, []FieldError{
+				{"/name", "maxLength", "3", "must be at most 3 characters long", "maxLength"},
+				{"email", "email", "", "must be an email address", "email"},
+			}},
+		{All(Any(NewSchemaValidator().UseSchema(INSERTONE, short), fakeCheck("name", "must be long", 0))), `{"name": "Otieno"}`,
+			http.StatusUnprocessableEntity, []FieldError{
+				{"/name", "maxLength", "3", "must be at most 3 characters long", "maxLength"},
+				{"name", "check", "", "must be long", ""},
+			}},
+		{When(fakeCheck("name", "must not change", 0), UPDATE), `{"email": "taken@example.com"}`, http.StatusCreated, nil},
+		{When(&TagValidator{}, INSERTONE, UPDATE), `{"email": "taken@example.com", "name": "Oti"}`,
+			http.StatusUnprocessableEntity, []FieldError{{"email", "unique", "", "is taken", "unique"}}},
+		{Parallel(fakeCheck("email", "is taken", 20*time.Millisecond), fakeCheck("name", "is taken", 0)), `{}`,
+			http.StatusUnprocessableEntity, []FieldError{
+				{"email", "check", "", "is taken", ""},
+				{"name", "check", "", "is taken", ""},
+			}},
+	}
+	service := NewFakeService(FakeScenario{})
+	for i, test := range tests {
+		resource := NewResource("accounts").
+			UseType(reflect.TypeOf(FakeAccount{})).
+			UseStorage(NewMemory(reflect.TypeOf(FakeAccount{}))).
+			UseValidator(test.validator).
+			UseSerializer(&JSON{})
+		w := serve(service.InsertOne(resource), "POST", "http://foo.bar/accounts", test.body)
+		if w.Code != test.status {
+			t.Errorf("#%d Error, expected %d, got %d: %s", i, test.status, w.Code, w.Body.String())
+			continue
+		}
+		if test.expected == nil {
+			continue
+		}
+		var errs []FieldError
+		json.Unmarshal(w.Body.Bytes(), &errs)
+		if !reflect.DeepEqual(errs, test.expected) {
+			t.Errorf("#%d Error, expected %+v, got %+v", i, test.expected, errs)
+		}
+	}
+}
+
+func TestParallelValidators(t *testing.T) {
+	named, _ := ParseSchema([]byte(`{"required": ["name"]}`))
+	short, _ := ParseSchema([]byte(`{"properties": {"name": {"maxLength": 3}}}`))
+	validator := Parallel(NewSchemaValidator().UseSchema(INSERTONE, named), NewSchemaValidator().UseSchema(INSERTONE, short), &TagValidator{})
+	tests := []struct {
+		body     string
+		status   int
+		expected string
+	}{
+		{`{"email": "otieno@example.com", "name": "Oti"}`, http.StatusCreated, ""},
+		{`{"email": "otieno", "name": "Otieno"}`, http.StatusUnprocessableEntity,
+			`[{"field":"/name","rule":"maxLength","param":"3","message":"must be at most 3 characters long","code":"maxLength"}]`},
+		{`{"email": `, http.StatusBadRequest, ""},
+	}
+	service := NewFakeService(FakeScenario{})
+	for i, test := range tests {
+		resource := NewResource("accounts").
+			UseType(reflect.TypeOf(FakeAccount{})).
+			UseStorage(NewMemory(reflect.TypeOf(FakeAccount{}))).
+			UseValidator(validator).
+			UseSerializer(&JSON{})
+		w := serve(service.InsertOne(resource), "POST", "http://foo.bar/accounts", test.body)
+		if w.Code != test.status || test.expected != "" && w.Body.String() != test.expected {
+			t.Errorf("#%d Error, expected %d %s, got %d %s", i, test.status, test.expected, w.Code, w.Body.String())
+		}
+	}
+}
+
+func TestValidatorChainConcurrentRequests(t *testing.T) {
+	short, _ := ParseSchema([]byte(`{"properties": {"name": {"maxLength": 3}}}`))
+	validators := []Validator{
+		All(NewSchemaValidator().UseSchema(INSERTONE, short), &TagValidator{}, fakeCheck("", "", time.Millisecond)),
+		Parallel(NewSchemaValidator().UseSchema(INSERTONE, short), When(&TagValidator{}, INSERTONE)),
+		Any(NewSchemaValidator().UseSchema(INSERTONE, short), fakeCheck("name", "is too long", 0)),
+	}
+	service := NewFakeService(FakeScenario{})
+	for i, validator := range validators {
+		resource := NewResource("accounts").
+			UseType(reflect.TypeOf(FakeAccount{})).
+			UseStorage(NewMemory(reflect.TypeOf(FakeAccount{}))).
+			UseValidator(validator).
+			UseSerializer(&JSON{}).
+			AddHook(BEFOREDECODE, func(model *Model) error {
+				// Keep requests validating at the same time
+				time.Sleep(5 * time.Millisecond)
+				return nil
+			})
+		codes := make([]int, 50)
+		var wg sync.WaitGroup
+		for j := range codes {
+			wg.Add(1)
+			go func(j int) {
+				defer wg.Done()
+				body := fmt.Sprintf(`{"email": "otieno%d@example.com", "name": "Oti"}`, j)
+				if j%2 == 1 {
+					body = `{"email": "otieno@example.com", "name": "Otieno"}`
+				}
+				codes[j] = serve(service.InsertOne(resource), "POST", "http://foo.bar/accounts", body).Code
+			}(j)
+		}
+		wg.Wait()
+		for j, code := range codes {
+			expected := http.StatusCreated
+			if j%2 == 1 {
+				expected = http.StatusUnprocessableEntity
+			}
+			if code != expected {
+				t.Errorf("#%d.%d Error, expected %d, got %d", i, j, expected, code)
+			}
+		}
+	}
+}
+
+func TestRegisterRule(t *testing.T) {
+	for _, name := range []string{"min", "eqfield", "", "a,b"} {
+		func() {
+			defer func() {
+				if r := recover(); r == nil || !strings.Contains(r.(string), "can not register") {
+					t.Errorf("Error, expected registering %q to panic", name)
+				}
+			}()
+			RegisterRule(name, nil)
+		}()
+	}
+}
@@ -0,0 +1,427 @@
+package rest
+
+import (
+	"errors"
+	"fmt"
+	"io/ioutil"
+	"math"
+	"net/http"
+	"reflect"
+	"sort"
+	"time"
+)
+
+// valueWriter is implemented by the binary formats, encodeValue walks a value and calls it for every item
+type valueWriter interface {
+	writeNil()
+	writeBool(b bool)
+	writeInt(n int64)
+	writeUint(n uint64)
+	writeFloat(f float64, bits int)
+	writeString(s string)
+	writeBytes(b []byte)
+	writeTime(t time.Time)
+	writeArrayHeader(n int)
+	writeMapHeader(n int)
+}
+
+// encodeValue writes v naming struct fields after their `json` tags and honouring omitempty
+func encodeValue(w valueWriter, v reflect.Value) error {
+	if !v.IsValid() {
+		w.writeNil()
+		return nil
+	}
+	if v.Type() == timeType {
+		w.writeTime(v.Interface().(time.Time))
+		return nil
+	}
+	switch v.Kind() {
+	case reflect.Ptr, reflect.Interface:
+		if v.IsNil() {
+			w.writeNil()
+			return nil
+		}
+		return encodeValue(w, v.Elem())
+	case reflect.Bool:
+		w.writeBool(v.Bool())
+	case reflect.Int, reflect.Int8, reflect.Int16, reflect.Int32, reflect.Int64:
+		w.writeInt(v.Int())
+	case reflect.Uint, reflect.Uint8, reflect.Uint16, reflect.Uint32, reflect.Uint64, reflect.Uintptr:
+		w.writeUint(v.Uint())
+	case reflect.Float32:
+		w.writeFloat(v.Float(), 32)
+	case reflect.Float64:
+		w.writeFloat(v.Float(), 64)
+	case reflect.String:
+		w.writeString(v.String())
+	case reflect.Slice:
+		if v.IsNil() {
+			w.writeNil()
+			return nil
+		}
+		if v.Type().Elem().Kind() == reflect.Uint8 {
+			w.writeBytes(v.Bytes())
+			return nil
+		}
+		fallthrough
+	case reflect.Array:
+		w.writeArrayHeader(v.Len())
+		for i := 0; i < v.Len(); i++ {
+			if err := encodeValue(w, v.Index(i)); err != nil {
+				return err
+			}
+		}
+	case reflect.Map:
+		if v.IsNil() {
+			w.writeNil()
+			return nil
+		}
+		keys := v.MapKeys()
+		sort.Sort(byKey(keys))
+		w.writeMapHeader(len(keys))
+		for _, k := range keys {
+			if err := encodeValue(w, k); err != nil {
+				return err
+			}
+			if err := encodeValue(w, v.MapIndex(k)); err != nil {
+				return err
+			}
+		}
+	case reflect.Struct:
+		var fields []field
+		var values []reflect.Value
+		for _, f := range typeFields(v.Type()) {
+			fv := fieldValue(v, f.Index)
+			if f.OmitEmpty && isEmptyValue(fv) {
+				continue
+			}
+			fields = append(fields, f)
+			values = append(values, fv)
+		}
+		w.writeMapHeader(len(fields))
+		for i, f := range fields {
+			w.writeString(f.Name)
+			if err := encodeValue(w, values[i]); err != nil {
+				return err
+			}
+		}
+	default:
+		return fmt.Errorf("%s values can not be encoded", v.Type())
+	}
+	return nil
+}
+
+// byKey sorts map keys so that encodings are deterministic
+type byKey []reflect.Value
+
+func (k byKey) Len() int      { return len(k) }
+func (k byKey) Swap(i, j int) { k[i], k[j] = k[j], k[i] }
+func (k byKey) Less(i, j int) bool {
+	return fmt.Sprint(k[i].Interface()) < fmt.Sprint(k[j].Interface())
+}
+
+// isEmptyValue reports whether omitempty drops v, following encoding/json
+func isEmptyValue(v reflect.Value) bool {
+	switch v.Kind() {
+	case reflect.Array, reflect.Map, reflect.Slice, reflect.String:
+		return v.Len() == 0
+	case reflect.Bool:
+		return !v.Bool()
+	case reflect.Int, reflect.Int8, reflect.Int16, reflect.Int32, reflect.Int64:
+		return v.Int() == 0
+	case reflect.Uint, reflect.Uint8, reflect.Uint16, reflect.Uint32, reflect.Uint64, reflect.Uintptr:
+		return v.Uint() == 0
+	case reflect.Float32, reflect.Float64:
+		return v.Float() == 0
+	case reflect.Interface, reflect.Ptr:
+		return v.IsNil()
+	}
+	return false
+}
+
+// valueReader is implemented by the binary formats, readValue calls it to decode into a Go value
+type valueReader interface {
+	readValue(v reflect.Value) error
+	// more reports whether the i-th item of a container of n items, or of unknown length when n < 0, follows
+	more(i, n int) bool
+}
+
+var (
+	errTruncated = errors.New("Unexpected end of input")
+	errTooDeep   = errors.New("The input is nested too deeply")
+	errTrailing  = errors.New("Unexpected data after the top level value")
+)
+
+// maxDepth limits the nesting of decoded containers
+const maxDepth = 512
+
+func typeError(value string, v reflect.Value) error {
+	return fmt.Errorf("Can not decode %s into a value of type %s", value, v.Type())
+}
+
+// emptyInterface reports whether v is an interface{} that takes any decoded value
+func emptyInterface(v reflect.Value) bool {
+	return v.Kind() == reflect.Interface && v.NumMethod() == 0
+}
+
+func setNil(v reflect.Value) error {
+	v.Set(reflect.Zero(v.Type()))
+	return nil
+}
+
+func setBool(v reflect.Value, b bool) error {
+	switch {
+	case v.Kind() == reflect.Bool:
+		v.SetBool(b)
+	case emptyInterface(v):
+		v.Set(reflect.ValueOf(b))
+	default:
+		return typeError("a boolean", v)
+	}
+	return nil
+}
+
+func setInt(v reflect.Value, n int64) error {
+	if n >= 0 {
+		return setUint(v, uint64(n))
+	}
+	switch v.Kind() {
+	case reflect.Int, reflect.Int8, reflect.Int16, reflect.Int32, reflect.Int64:
+		if v.OverflowInt(n) {
+			return fmt.Errorf("%d overflows %s", n, v.Type())
+		}
+		v.SetInt(n)
+	case reflect.Float32, reflect.Float64:
+		v.SetFloat(float64(n))
+	case reflect.Interface:
+		if !emptyInterface(v) {
+			return typeError("an integer", v)
+		}
+		v.Set(reflect.ValueOf(n))
+	default:
+		return typeError("a negative integer", v)
+	}
+	return nil
+}
+
+func setUint(v reflect.Value, n uint64) error {
+	switch v.Kind() {
+	case reflect.Int, reflect.Int8, reflect.Int16, reflect.Int32, reflect.Int64:
+		if n > math.MaxInt64 || v.OverflowInt(int64(n)) {
+			return fmt.Errorf("%d overflows %s", n, v.Type())
+		}
+		v.SetInt(int64(n))
+	case reflect.Uint, reflect.Uint8, reflect.Uint16, reflect.Uint32, reflect.Uint64, reflect.Uintptr:
+		if v.OverflowUint(n) {
+			return fmt.Errorf("%d overflows %s", n, v.Type())
+		}
+		v.SetUint(n)
+	case reflect.Float32, reflect.Float64:
+		v.SetFloat(float64(n))
+	case reflect.Interface:
+		if !emptyInterface(v) {
+			return typeError("an integer", v)
+		}
+		if n <= math.MaxInt64 {
+			v.Set(reflect.ValueOf(int64(n)))
+		} else {
+			v.Set(reflect.ValueOf(n))
+		}
+	default:
+		return typeError("an integer", v)
+	}
+	return nil
+}
+
+func setFloat(v reflect.Value, f float64) error {
+	switch {
+	case v.Kind() == reflect.Float32 || v.Kind() == reflect.Float64:
+		v.SetFloat(f)
+	case emptyInterface(v):
+		v.Set(reflect.ValueOf(f))
+	default:
+		return typeError("a float", v)
+	}
+	return nil
+}
+
+func setString(v reflect.Value, s string) error {
+	switch {
+	case v.Kind() == reflect.String:
+		v.SetString(s)
+	case v.Type() == timeType:
+		t, err := time.Parse(time.RFC3339Nano, s)
+		if err != nil {
+			return err
+		}
+		v.Set(reflect.ValueOf(t))
+	case v.Kind() == reflect.Slice && v.Type().Elem().Kind() == reflect.Uint8:
+		v.SetBytes([]byte(s))
+	case emptyInterface(v):
+		v.Set(reflect.ValueOf(s))
+	default:
+		return typeError("a string", v)
+	}
+	return nil
+}
+
+func setBytes(v reflect.Value, b []byte) error {
+	switch {
+	case v.Kind() == reflect.Slice && v.Type().Elem().Kind() == reflect.Uint8:
+		v.SetBytes(append([]byte{}, b...))
+	case v.Kind() == reflect.Array && v.Type().Elem().Kind() == reflect.Uint8:
+		if v.Len() != len(b) {
+			return fmt.Errorf("Can not decode %d bytes into %s", len(b), v.Type())
+		}
+		reflect.Copy(v, reflect.ValueOf(b))
+	case v.Kind() == reflect.String:
+		v.SetString(string(b))
+	case emptyInterface(v):
+		v.Set(reflect.ValueOf(append([]byte{}, b...)))
+	default:
+		return typeError("binary data", v)
+	}
+	return nil
+}
+
+func setTime(v reflect.Value, t time.Time) error {
+	switch {
+	case v.Type() == timeType:
+		v.Set(reflect.ValueOf(t))
+	case emptyInterface(v):
+		v.Set(reflect.ValueOf(t))
+	default:
+		return typeError("a time", v)
+	}
+	return nil
+}
+
+// readArray decodes n items, or items up to a break when n < 0, into a slice, an array or an interface{}
+func readArray(r valueReader, v reflect.Value, n int) error {
+	if emptyInterface(v) {
+		var items []interface{}
+		list := reflect.ValueOf(&items).Elem()
+		if err := readArray(r, list, n); err != nil {
+			return err
+		}
+		v.Set(list)
+		return nil
+	}
+	switch v.Kind() {
+	case reflect.Slice:
+		size := n
+		if size < 0 {
+			size = 0
+		}
+		v.Set(reflect.MakeSlice(v.Type(), 0, size))
+		for i := 0; r.more(i, n); i++ {
+			item := reflect.New(v.Type().Elem()).Elem()
+			if err := r.readValue(item); err != nil {
+				return err
+			}
+			v.Set(reflect.Append(v, item))
+		}
+	case reflect.Array:
+		for i := 0; r.more(i, n); i++ {
+			item := reflect.New(v.Type().Elem()).Elem()
+			if err := r.readValue(item); err != nil {
+				return err
+			}
+			if i < v.Len() {
+				v.Index(i).Set(item)
+			}
+		}
+	default:
+		return typeError("an array", v)
+	}
+	return nil
+}
+
+// readMap decodes n pairs, or pairs up to a break when n < 0, into a struct by the `json` names
+// of its fields, a map or an interface{} holding a map[string]interface{}
+func readMap(r valueReader, v reflect.Value, n int) error {
+	if emptyInterface(v) {
+		m := make(map[string]interface{})
+		mv := reflect.ValueOf(m)
+		if err := readMap(r, mv, n); err != nil {
+			return err
+		}
+		v.Set(mv)
+		return nil
+	}
+	switch v.Kind() {
+	case reflect.Map:
+		if v.IsNil() {
+			v.Set(reflect.MakeMap(v.Type()))
+		}
+		for i := 0; r.more(i, n); i++ {
+			key := reflect.New(v.Type().Key()).Elem()
+			if err := r.readValue(key); err != nil {
+				return err
+			}
+			value := reflect.New(v.Type().Elem()).Elem()
+			if err := r.readValue(value); err != nil {
+				return err
+			}
+			v.SetMapIndex(key, value)
+		}
+	case reflect.Struct:
+		for i := 0; r.more(i, n); i++ {
+			var name string
+			if err := r.readValue(reflect.ValueOf(&name).Elem()); err != nil {
+				return err
+			}
+			f, ok := lookupField(v.Type(), name)
+			if !ok {
+				// Skip fields the type does not have, as encoding/json does.
+				var discard interface{}
+				if err := r.readValue(reflect.ValueOf(&discard).Elem()); err != nil {
+					return err
+				}
+				continue
+			}
+			if err := r.readValue(settableField(v, f.Index)); err != nil {
+				return err
+			}
+		}
+	default:
+		return typeError("a map", v)
+	}
+	return nil
+}
+
+// decodeBody decodes the request body of insert, update and upsert transactions into
+// the resource type, or into a slice of it for insertMany, answering 400 when it is malformed
+func decodeBody(c *Context, unmarshal func([]byte, interface{}) error) error {
+	r := c.GetRequest()
+	if r.Method != "POST" && r.Method != "PUT" && r.Method != "PATCH" {
+		return nil
+	}
+	t := c.Get(DATATYPE).(reflect.Type)
+	v := reflect.New(t)
+	if c.Get(ACTION) == INSERTMANY {
+		v = reflect.New(reflect.SliceOf(t))
+	}
+	err := errTruncated
+	if r.Body != nil {
+		var b []byte
+		if b, err = ioutil.ReadAll(r.Body); err == nil {
+			err = unmarshal(b, v.Interface())
+		}
+	}
+	c.Set(REQUESTBODY, v.Interface())
+	if err != nil {
+		c.SetResponseStatus(http.StatusBadRequest)
+		c.SetResponseBody(err.Error())
+	}
+	return err
+}
+
+// unmarshalInto checks that v is a non nil pointer and returns the value it points to
+func unmarshalInto(v interface{}) (reflect.Value, error) {
+	rv := reflect.ValueOf(v)
+	if rv.Kind() != reflect.Ptr || rv.IsNil() {
+		return rv, fmt.Errorf("Can not decode into a %T, pass a non nil pointer", v)
+	}
+	return rv.Elem(), nil
+}
@@ -0,0 +1,241 @@
+package rest
+
+import (
+	"bytes"
+	"encoding/hex"
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"reflect"
+	"testing"
+	"time"
+)
+
+type FakeBinary struct {
+	ID     int64                  `json:"id"`
+	Name   string                 `json:"name"`
+	Score  float64                `json:"score,omitempty"`
+	Ratio  float32                `json:"ratio"`
+	Tags   []string               `json:"tags"`
+	Data   []byte                 `json:"data"`
+	At     time.Time              `json:"at"`
+	Next   *FakeBinary            `json:"next,omitempty"`
+	Meta   map[string]interface{} `json:"meta"`
+	Count  uint32                 `json:"count"`
+	Small  int8
+	Hidden string `json:"-"`
+}
+
+type fakeCodec struct {
+	name      string
+	marshal   func(interface{}) ([]byte, error)
+	unmarshal func([]byte, interface{}) error
+}
+
+var fakeCodecs = []fakeCodec{
+	{"MessagePack", MarshalMsgPack, UnmarshalMsgPack},
+	{"CBOR", MarshalCBOR, UnmarshalCBOR},
+	{"JSON", json.Marshal, json.Unmarshal},
+}
+
+func NewFakeBinary() FakeBinary {
+	at := time.Date(2017, 1, 2, 15, 4, 5, 123456789, time.UTC)
+	return FakeBinary{
+		ID:     -1 << 40,
+		Name:   "Otieno Kamau",
+		Ratio:  0.5,
+		Tags:   []string{"a", "b"},
+		Data:   []byte{0, 1, 2, 255},
+		At:     at,
+		Next:   &FakeBinary{ID: 300, Name: "Bernie Burst", Count: 70000},
+		Meta:   map[string]interface{}{"age": int64(21), "nested": []interface{}{"x", true, nil}},
+		Count:  4294967295,
+		Small:  -100,
+		Hidden: "secret",
+	}
+}
+
+func TestCodecRoundTrip(t *testing.T) {
+	for _, codec := range fakeCodecs[:2] {
+		in := NewFakeBinary()
+		b, err := codec.marshal(in)
+		if err != nil {
+			t.Fatalf("%s Error, unexpected error %s", codec.name, err)
+		}
+		var out FakeBinary
+		if err = codec.unmarshal(b, &out); err != nil {
+			t.Fatalf("%s Error, unexpected error %s", codec.name, err)
+		}
+		in.Hidden = ""
+		if !out.At.Equal(in.At) {
+			t.Errorf("%s Error, expected the time %s, got %s", codec.name, in.At, out.At)
+		}
+		out.At = in.At
+		if !reflect.DeepEqual(in, out) {
+			t.Errorf("%s Error, expected %+v, got %+v", codec.name, in, out)
+		}
+		var generic map[string]interface{}
+		if err = codec.unmarshal(b, &generic); err != nil {
+			t.Fatalf("%s Error, unexpected error %s", codec.name, err)
+		}
+		if _, ok := generic["score"]; ok {
+			t.Errorf("%s Error, expected omitempty to drop score", codec.name)
+		}
+		if _, ok := generic["Small"]; !ok {
+			t.Errorf("%s Error, expected untagged fields under their Go name", codec.name)
+		}
+		for i := range b {
+			if err = codec.unmarshal(b[:i], &out); err == nil {
+				t.Errorf("%s Error, expected an error decoding %d of %d bytes", codec.name, i, len(b))
+			}
+		}
+	}
+}
+
+func TestMsgPackVectors(t *testing.T) {
+	tests := []struct {
+		value    interface{}
+		expected string
+	}{
+		{nil, "c0"},
+		{true, "c3"},
+		{127, "7f"},
+		{-32, "e0"},
+		{-33, "d0df"},
+		{256, "cd0100"},
+		{uint64(1) << 32, "cf0000000100000000"},
+		{1.5, "cb3ff8000000000000"},
+		{"abc", "a3616263"},
+		{[]byte{1}, "c40101"},
+		{[]int{1, 2}, "920102"},
+		{map[string]int{"a": 1}, "81a16101"},
+		{time.Unix(1, 2).UTC(), "c70cff000000020000000000000001"},
+	}
+	for _, test := range tests {
+		b, _ := MarshalMsgPack(test.value)
+		if hex.EncodeToString(b) != test.expected {
+			t.Errorf("Error, expected %v to encode as %s, got %x", test.value, test.expected, b)
+		}
+	}
+	var at time.Time
+	// The 32 bit timestamp format.
+	if UnmarshalMsgPack([]byte{0xd6, 0xff, 0, 0, 0, 1}, &at); !at.Equal(time.Unix(1, 0)) {
+		t.Errorf("Error, expected a 32 bit timestamp to decode to %s, got %s", time.Unix(1, 0), at)
+	}
+}
+
+func TestCBORVectors(t *testing.T) {
+	// Examples from RFC 8949 appendix A.
+	tests := []struct {
+		value    interface{}
+		expected string
+	}{
+		{0, "00"},
+		{23, "17"},
+		{24, "1818"},
+		{1000000, "1a000f4240"},
+		{uint64(18446744073709551615), "1bffffffffffffffff"},
+		{-1, "20"},
+		{-1000, "3903e7"},
+		{1.1, "fb3ff199999999999a"},
+		{false, "f4"},
+		{nil, "f6"},
+		{[]byte{1, 2, 3, 4}, "4401020304"},
+		{"IETF", "6449455446"},
+		{[]interface{}{1, []int{2, 3}}, "8201820203"},
+		{map[string]string{"a": "A", "b": "B"}, "a26161614161626142"},
+		{time.Date(2013, 3, 21, 20, 4, 0, 0, time.UTC), "c074323031332d30332d32315432303a30343a30305a"},
+	}
+	for _, test := range tests {
+		b, _ := MarshalCBOR(test.value)
+		if hex.EncodeToString(b) != test.expected {
+			t.Errorf("Error, expected %v to encode as %s, got %x", test.value, test.expected, b)
+		}
+	}
+	decodes := []struct {
+		input    string
+		expected interface{}
+	}{
+		{"f93c00", 1.0},
+		{"f97bff", 65504.0},
+		{"c11a514b67b0", time.Unix(1363896240, 0).UTC()},
+		{"9f018202039f0405ffff", []interface{}{int64(1), []interface{}{int64(2), int64(3)}, []interface{}{int64(4), int64(5)}}},
+		{"bf61610161629f0203ffff", map[string]interface{}{"a": int64(1), "b": []interface{}{int64(2), int64(3)}}},
+		{"7f657374726561646d696e67ff", "streaming"},
+	}
+	for _, test := range decodes {
+		b, _ := hex.DecodeString(test.input)
+		var v interface{}
+		if err := UnmarshalCBOR(b, &v); err != nil || !reflect.DeepEqual(v, test.expected) {
+			t.Errorf("Error, expected %s to decode to %#v, got %#v (%v)", test.input, test.expected, v, err)
+		}
+	}
+	for _, input := range []string{"9f01", "5f41", "1c", "ff", "0000"} {
+		b, _ := hex.DecodeString(input)
+		var v interface{}
+		if err := UnmarshalCBOR(b, &v); err == nil {
+			t.Errorf("Error, expected %s to be rejected", input)
+		}
+	}
+}
+
+func TestBinarySerializers(t *testing.T) {
+	service := NewFakeService(FakeScenario{})
+	for _, serializer := range []Serializer{&MsgPack{}, &CBOR{}} {
+		storage := NewMemory(reflect.TypeOf(FakeTodo{}))
+		resource := NewFakeTodoResource(storage).UseSerializer(serializer)
+		var marshal func(interface{}) ([]byte, error)
+		var unmarshal func([]byte, interface{}) error
+		if _, ok := serializer.(*MsgPack); ok {
+			marshal, unmarshal = MarshalMsgPack, UnmarshalMsgPack
+		} else {
+			marshal, unmarshal = MarshalCBOR, UnmarshalCBOR
+		}
+		body, _ := marshal([]FakeTodo{{ID: "a", Title: "Milk"}, {ID: "b", Title: "Eggs"}})
+		w := httptest.NewRecorder()
+		service.InsertMany(resource)(w, httptest.NewRequest("POST", "http://foo.bar/todos", bytes.NewReader(body)))
+		if w.Code != http.StatusCreated {
+			t.Fatalf("%T Error, expected %d, got %d", serializer, http.StatusCreated, w.Code)
+		}
+		w = httptest.NewRecorder()
+		service.FindMany(resource)(w, httptest.NewRequest("GET", "http://foo.bar/todos", nil))
+		var todos []FakeTodo
+		if err := unmarshal(w.Body.Bytes(), &todos); err != nil || len(todos) != 2 || todos[0].Title != "Milk" {
+			t.Errorf("%T Error, unexpected findMany result %v (%v)", serializer, todos, err)
+		}
+		w = httptest.NewRecorder()
+		service.InsertOne(resource)(w, httptest.NewRequest("POST", "http://foo.bar/todos", bytes.NewReader([]byte{0x81})))
+		if w.Code != http.StatusBadRequest {
+			t.Errorf("%T Error, expected %d for a truncated body, got %d", serializer, http.StatusBadRequest, w.Code)
+		}
+	}
+}
+
+func BenchmarkEncode(b *testing.B) {
+	in := []FakeBinary{NewFakeBinary(), NewFakeBinary(), NewFakeBinary()}
+	for _, codec := range fakeCodecs {
+		b.Run(codec.name, func(b *testing.B) {
+			data, _ := codec.marshal(in)
+			b.SetBytes(int64(len(data)))
+			b.Logf("%d bytes", len(data))
+			for i := 0; i < b.N; i++ {
+				codec.marshal(in)
+			}
+		})
+	}
+}
+
+func BenchmarkDecode(b *testing.B) {
+	in := []FakeBinary{NewFakeBinary(), NewFakeBinary(), NewFakeBinary()}
+	for _, codec := range fakeCodecs {
+		b.Run(codec.name, func(b *testing.B) {
+			data, _ := codec.marshal(in)
+			b.SetBytes(int64(len(data)))
+			b.Logf("%d bytes", len(data))
+			for i := 0; i < b.N; i++ {
+				var out []FakeBinary
+				codec.unmarshal(data, &out)
+			}
+		})
+	}
+}
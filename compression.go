@@ -0,0 +1,270 @@
+package rest
+
+import (
+	"bytes"
+	"compress/flate"
+	"compress/gzip"
+	"compress/zlib"
+	"fmt"
+	"io"
+	"io/ioutil"
+	"mime"
+	"net/http"
+	"strconv"
+	"strings"
+)
+
+// Compression - compresses responses with the encoding of the Accept-Encoding header the client prefers and
+// decompresses gzip and deflate request bodies. gzip and deflate are built in, others such as brotli are
+// registered with AddEncoding for responses only, request bodies in other codings are answered with 415.
+type Compression struct {
+	// MinSize - responses smaller than this many bytes are sent as they are, 1024 when zero
+	MinSize int
+	// ContentTypes - the media types worth compressing, entries ending in "/" match a major type and entries
+	// starting with "+" a structured syntax suffix. Text, JSON, XML and NDJSON when empty.
+	ContentTypes []string
+	// Level - the gzip and deflate compression level, flate.DefaultCompression when zero
+	Level int
+	// MaxDecompressedSize - request bodies decompressing to more than this many bytes are answered with 413, the
+	// MaxBodySize of the resource's DecodeOptions or 10 MB when zero
+	MaxDecompressedSize int64
+	encodings           []contentEncoding
+}
+
+// contentEncoding - a named encoding and the constructor of its writer
+type contentEncoding struct {
+	Name      string
+	NewWriter func(w io.Writer) (io.WriteCloser, error)
+}
+
+const (
+	defaultMinCompressSize     = 1024
+	defaultMaxDecompressedSize = 10 << 20
+)
+
+var defaultCompressTypes = []string{"text/", "application/json", "application/xml", "application/x-ndjson", "application/javascript", "+json", "+xml"}
+
+// NewCompression - creates a Compression with gzip and deflate
+func NewCompression() *Compression {
+	c := &Compression{}
+	c.encodings = []contentEncoding{
+		{"gzip", func(w io.Writer) (io.WriteCloser, error) { return gzip.NewWriterLevel(w, c.level()) }},
+		{"deflate", func(w io.Writer) (io.WriteCloser, error) { return zlib.NewWriterLevel(w, c.level()) }},
+	}
+	return c
+}
+
+// AddEncoding - registers a content coding such as "br", it is preferred over the ones registered
+// before it when the client accepts them equally
+func (c *Compression) AddEncoding(name string, newWriter func(w io.Writer) (io.WriteCloser, error)) *Compression {
+	c.encodings = append([]contentEncoding{{strings.ToLower(name), newWriter}}, c.encodings...)
+	return c
+}
+
+func (c *Compression) level() int {
+	if c.Level == 0 {
+		return flate.DefaultCompression
+	}
+	return c.Level
+}
+
+// compressible reports whether a response of this status and media type may be compressed
+func (c *Compression) compressible(status int, header http.Header) bool {
+	if status < http.StatusOK || status == http.StatusNoContent || status == http.StatusNotModified || header.Get("Content-Encoding") != "" {
+		return false
+	}
+	mediaType, _, err := mime.ParseMediaType(header.Get("Content-Type"))
+	if err != nil {
+		return false
+	}
+	types := c.ContentTypes
+	if len(types) == 0 {
+		types = defaultCompressTypes
+	}
+	for _, t := range types {
+		switch {
+		case strings.HasSuffix(t, "/") && strings.HasPrefix(mediaType, t),
+			strings.HasPrefix(t, "+") && strings.HasSuffix(mediaType, t),
+			mediaType == t:
+			return true
+		}
+	}
+	return false
+}
+
+// negotiate returns the registered encoding the Accept-Encoding header prefers, nil when the client accepts none
+func (c *Compression) negotiate(header string) *contentEncoding {
+	qs := map[string]float64{}
+	for _, part := range strings.Split(header, ",") {
+		params := strings.Split(part, ";")
+		name := strings.ToLower(strings.TrimSpace(params[0]))
+		if name == "" {
+			continue
+		}
+		q := 1.0
+		for _, param := range params[1:] {
+			kv := strings.SplitN(strings.TrimSpace(param), "=", 2)
+			if len(kv) == 2 && strings.ToLower(kv[0]) == "q" {
+				if v, err := strconv.ParseFloat(kv[1], 64); err == nil {
+					q = v
+				}
+			}
+		}
+		qs[name] = q
+	}
+	var best *contentEncoding
+	bestQ := 0.0
+	for i, e := range c.encodings {
+		q, ok := qs[e.Name]
+		if !ok {
+			q = qs["*"]
+		}
+		if q > bestQ {
+			best, bestQ = &c.encodings[i], q
+		}
+	}
+	return best
+}
+
+// encode sets the headers of a response compressed with e, strong ETags are made specific to the encoding
+// since the compressed representation differs byte for byte
+func (e *contentEncoding) encode(header http.Header) {
+	header.Set("Content-Encoding", e.Name)
+	header.Del("Content-Length")
+	if etag := header.Get("ETag"); strings.HasPrefix(etag, `"`) && strings.HasSuffix(etag, `"`) && len(etag) > 1 {
+		header.Set("ETag", etag[:len(etag)-1]+"-"+e.Name+`"`)
+	}
+}
+
+// compress returns the body compressed with the encoding the request prefers and sets the response headers,
+// or the body unchanged when it is too small, of another media type or not accepted compressed
+func (c *Compression) compress(header http.Header, r *http.Request, status int, body []byte) ([]byte, error) {
+	if header.Get("Content-Type") == "" && len(body) > 0 {
+		header.Set("Content-Type", http.DetectContentType(body))
+	}
+	minSize := c.MinSize
+	if minSize <= 0 {
+		minSize = defaultMinCompressSize
+	}
+	if len(body) < minSize || !c.compressible(status, header) {
+		return body, nil
+	}
+	// Caches must keep a response per encoding from here on, whether or not this client gets it compressed.
+	header.Add("Vary", "Accept-Encoding")
+	e := c.negotiate(r.Header.Get("Accept-Encoding"))
+	if e == nil {
+		return body, nil
+	}
+	var b bytes.Buffer
+	w, err := e.NewWriter(&b)
+	if err != nil {
+		return body, err
+	}
+	if _, err = w.Write(body); err == nil {
+		err = w.Close()
+	}
+	if err != nil {
+		return body, err
+	}
+	e.encode(header)
+	return b.Bytes(), nil
+}
+
+// compressWriter compresses a streamed response, flushing the encoder whenever the response is flushed
+type compressWriter struct {
+	http.ResponseWriter
+	encoder io.WriteCloser
+}
+
+func (cw *compressWriter) Write(b []byte) (int, error) {
+	return cw.encoder.Write(b)
+}
+
+func (cw *compressWriter) Flush() {
+	if f, ok := cw.encoder.(interface {
+		Flush() error
+	}); ok {
+		f.Flush()
+	}
+	if f, ok := cw.ResponseWriter.(http.Flusher); ok {
+		f.Flush()
+	}
+}
+
+// compressStream wraps the writer of a streamed response, its size is unknown so only the media type is checked.
+// The returned function completes the compressed stream.
+func (c *Compression) compressStream(w http.ResponseWriter, r *http.Request, status int) (http.ResponseWriter, func() error) {
+	if !c.compressible(status, w.Header()) {
+		return w, func() error { return nil }
+	}
+	w.Header().Add("Vary", "Accept-Encoding")
+	e := c.negotiate(r.Header.Get("Accept-Encoding"))
+	if e == nil {
+		return w, func() error { return nil }
+	}
+	encoder, err := e.NewWriter(w)
+	if err != nil {
+		return w, func() error { return err }
+	}
+	e.encode(w.Header())
+	return &compressWriter{ResponseWriter: w, encoder: encoder}, encoder.Close
+}
+
+// decompress replaces a gzip or deflate request body with its decompressed content, other content
+// codings are answered with 415, corrupt bodies with 400 and bodies decompressing past the limit with 413
+func (c *Compression) decompress(model *Model) error {
+	r := model.GetRequest()
+	coding := strings.ToLower(strings.TrimSpace(r.Header.Get("Content-Encoding")))
+	if coding == "" || coding == "identity" || r.Body == nil {
+		return nil
+	}
+	var body io.ReadCloser
+	var err error
+	switch coding {
+	case "gzip", "x-gzip":
+		body, err = gzip.NewReader(r.Body)
+	case "deflate":
+		body, err = zlib.NewReader(r.Body)
+	default:
+		err = fmt.Errorf("The content coding %q is not supported", coding)
+		model.SetResponseStatus(http.StatusUnsupportedMediaType)
+		model.SetResponseBody(err.Error())
+		model.SetResponseHeader("Accept-Encoding", "gzip, deflate")
+		return err
+	}
+	if err != nil {
+		model.SetResponseStatus(http.StatusBadRequest)
+		model.SetResponseBody(fmt.Sprintf("The %s request body is corrupt: %s", coding, err))
+		return err
+	}
+	defer body.Close()
+	// Read the content whole, up to the limit, so that small compressed bodies can not expand without bound
+	limit := c.maxDecompressedSize(model)
+	b, err := ioutil.ReadAll(io.LimitReader(body, limit+1))
+	if err != nil {
+		model.SetResponseStatus(http.StatusBadRequest)
+		model.SetResponseBody(fmt.Sprintf("The %s request body is corrupt: %s", coding, err))
+		return err
+	}
+	if int64(len(b)) > limit {
+		err = &BodyTooLargeError{Limit: limit}
+		model.SetResponseStatus(http.StatusRequestEntityTooLarge)
+		model.SetResponseBody(err)
+		return err
+	}
+	r.Body = ioutil.NopCloser(bytes.NewReader(b))
+	r.ContentLength = int64(len(b))
+	r.Header.Del("Content-Encoding")
+	r.Header.Del("Content-Length")
+	return nil
+}
+
+func (c *Compression) maxDecompressedSize(model *Model) int64 {
+	if c.MaxDecompressedSize > 0 {
+		return c.MaxDecompressedSize
+	}
+	if options, ok := model.Get(DECODEOPTIONS).(*DecodeOptions); ok && options.MaxBodySize > 0 {
+		return options.MaxBodySize
+	}
+	return defaultMaxDecompressedSize
+}
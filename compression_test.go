@@ -0,0 +1,183 @@
+package rest
+
+import (
+	"bytes"
+	"compress/flate"
+	"compress/gzip"
+	"compress/zlib"
+	"fmt"
+	"io"
+	"io/ioutil"
+	"net/http"
+	"net/http/httptest"
+	"reflect"
+	"strings"
+	"testing"
+)
+
+func NewFakeCompressedService() *Service {
+	service := NewFakeService(FakeScenario{})
+	service.UseCompression(NewCompression())
+	return service
+}
+
+func NewFakeTodos(n int) *Resource {
+	storage := NewMemory(reflect.TypeOf(FakeTodo{}))
+	resource := NewFakeTodoResource(storage)
+	var todos []string
+	for i := 0; i < n; i++ {
+		todos = append(todos, fmt.Sprintf(`{"id": "%03d", "title": "Buy milk"}`, i))
+	}
+	serve(NewFakeService(FakeScenario{}).InsertMany(resource), "POST", "http://foo.bar/todos", "["+strings.Join(todos, ",")+"]")
+	return resource
+}
+
+func uncompress(encoding string, b []byte) (string, error) {
+	var r io.Reader = bytes.NewReader(b)
+	var err error
+	switch encoding {
+	case "gzip":
+		r, err = gzip.NewReader(r)
+	case "deflate":
+		r, err = zlib.NewReader(r)
+	case "br":
+		r = flate.NewReader(r)
+	}
+	if err != nil {
+		return "", err
+	}
+	out, err := ioutil.ReadAll(r)
+	return string(out), err
+}
+
+func TestCompression(t *testing.T) {
+	large := NewFakeTodos(50)
+	small := NewFakeTodos(1)
+	plain := serve(NewFakeService(FakeScenario{}).FindMany(large), "GET", "http://foo.bar/todos", "").Body.String()
+	service := NewFakeCompressedService()
+	tests := []struct {
+		resource       *Resource
+		acceptEncoding string
+		encoding       string
+		vary           bool
+	}{
+		{large, "gzip, deflate", "gzip", true},
+		{large, "gzip;q=0.5, deflate", "deflate", true},
+		{large, "gzip;q=0, deflate;q=0", "", true},
+		{large, "*", "gzip", true},
+		{large, "", "", true},
+		{small, "gzip", "", false},
+	}
+	for i, test := range tests {
+		r := httptest.NewRequest("GET", "http://foo.bar/todos", nil)
+		r.Header.Set("Accept-Encoding", test.acceptEncoding)
+		w := httptest.NewRecorder()
+		service.FindMany(test.resource)(w, r)
+		if encoding := w.Header().Get("Content-Encoding"); encoding != test.encoding {
+			t.Errorf("#%d Error, expected the encoding %q, got %q", i, test.encoding, encoding)
+		}
+		if vary := w.Header().Get("Vary") == "Accept-Encoding"; vary != test.vary {
+			t.Errorf("#%d Error, expected Vary %v, got %v", i, test.vary, vary)
+		}
+		if test.resource != large {
+			continue
+		}
+		if body, err := uncompress(test.encoding, w.Body.Bytes()); err != nil || body != plain {
+			t.Errorf("#%d Error, expected %d bytes, got %d (%v)", i, len(plain), len(body), err)
+		}
+		if test.encoding != "" && w.Body.Len() >= len(plain) {
+			t.Errorf("#%d Error, expected the body to shrink from %d bytes, got %d", i, len(plain), w.Body.Len())
+		}
+	}
+}
+
+func TestCompressionOptions(t *testing.T) {
+	tests := []struct {
+		compression *Compression
+		headers     map[string][]string
+		encoding    string
+		etag        string
+	}{
+		{NewCompression(), map[string][]string{"ETag": {`"v1"`}}, "gzip", `"v1-gzip"`},
+		{NewCompression(), map[string][]string{"ETag": {`W/"v1"`}}, "gzip", `W/"v1"`},
+		{NewCompression(), map[string][]string{"Content-Type": {"application/msgpack"}}, "", ""},
+		{NewCompression(), map[string][]string{"Content-Type": {"application/vnd.api+json"}}, "gzip", ""},
+		{&Compression{ContentTypes: []string{"application/xml"}}, nil, "", ""},
+		{NewCompression().AddEncoding("br", func(w io.Writer) (io.WriteCloser, error) { return flate.NewWriter(w, flate.BestSpeed) }), nil, "br", ""},
+	}
+	for i, test := range tests {
+		service := NewFakeService(FakeScenario{})
+		service.UseCompression(test.compression)
+		resource := NewFakeTodos(50).UseHeaders(test.headers)
+		r := httptest.NewRequest("GET", "http://foo.bar/todos", nil)
+		r.Header.Set("Accept-Encoding", "gzip, br")
+		w := httptest.NewRecorder()
+		service.FindMany(resource)(w, r)
+		if encoding := w.Header().Get("Content-Encoding"); encoding != test.encoding {
+			t.Errorf("#%d Error, expected the encoding %q, got %q", i, test.encoding, encoding)
+		}
+		if etag := w.Header().Get("ETag"); etag != test.etag {
+			t.Errorf("#%d Error, expected the ETag %s, got %s", i, test.etag, etag)
+		}
+		if _, err := uncompress(test.encoding, w.Body.Bytes()); err != nil {
+			t.Errorf("#%d Error, unexpected error %s", i, err)
+		}
+	}
+}
+
+func TestCompressionStream(t *testing.T) {
+	resource := NewFakeTodos(3).UseStreaming(true).UseSerializer(&NDJSON{})
+	r := httptest.NewRequest("GET", "http://foo.bar/todos?fields=id", nil)
+	r.Header.Set("Accept-Encoding", "gzip")
+	w := httptest.NewRecorder()
+	service := NewFakeCompressedService()
+	resource.UseHeaders(map[string][]string{"Content-Type": {"application/x-ndjson"}})
+	service.FindMany(resource)(w, r)
+	body, err := uncompress(w.Header().Get("Content-Encoding"), w.Body.Bytes())
+	if err != nil || body != "{\"id\":\"000\"}\n{\"id\":\"001\"}\n{\"id\":\"002\"}\n" {
+		t.Errorf("Error, unexpected stream %q (%v)", body, err)
+	}
+}
+
+func TestDecompression(t *testing.T) {
+	var gz bytes.Buffer
+	zw := gzip.NewWriter(&gz)
+	zw.Write([]byte(`{"title": "Milk"}`))
+	zw.Close()
+	var bomb bytes.Buffer
+	zw = gzip.NewWriter(&bomb)
+	zw.Write([]byte(`{"title": "Milk"}` + strings.Repeat(" ", 4096)))
+	zw.Close()
+	tests := []struct {
+		encoding string
+		body     []byte
+		options  *DecodeOptions
+		maxSize  int64
+		expected int
+	}{
+		{"gzip", gz.Bytes(), nil, 0, http.StatusCreated},
+		{"", []byte(`{"title": "Milk"}`), nil, 0, http.StatusCreated},
+		{"gzip", []byte(`{"title": "Milk"}`), nil, 0, http.StatusBadRequest},
+		{"gzip", gz.Bytes()[:gz.Len()-12], nil, 0, http.StatusBadRequest},
+		{"br", gz.Bytes(), nil, 0, http.StatusUnsupportedMediaType},
+		{"gzip", bomb.Bytes(), nil, 0, http.StatusCreated},
+		{"gzip", bomb.Bytes(), nil, 1024, http.StatusRequestEntityTooLarge},
+		{"gzip", bomb.Bytes(), &DecodeOptions{MaxBodySize: 1024}, 0, http.StatusRequestEntityTooLarge},
+		{"gzip", gz.Bytes(), &DecodeOptions{MaxBodySize: 1024}, 0, http.StatusCreated},
+	}
+	for i, test := range tests {
+		service := NewFakeCompressedService()
+		service.Compression.MaxDecompressedSize = test.maxSize
+		resource := NewFakeTodoResource(NewMemory(reflect.TypeOf(FakeTodo{})))
+		if test.options != nil {
+			resource.UseDecodeOptions(test.options)
+		}
+		r := httptest.NewRequest("POST", "http://foo.bar/todos", bytes.NewReader(test.body))
+		r.Header.Set("Content-Encoding", test.encoding)
+		w := httptest.NewRecorder()
+		service.InsertOne(resource)(w, r)
+		if w.Code != test.expected {
+			t.Errorf("#%d Error, expected %d, got %d: %s", i, test.expected, w.Code, w.Body.String())
+		}
+	}
+}
@@ -7,12 +7,44 @@ const (
 	REQUEST = "request"
 	// RESPONSE - the key for Response object in the context
 	RESPONSE = "response"
+	// NAME - the name of the resource in the transaction
+	NAME = "name"
 	// ACTION - the data operation being carried out in the transaction
 	ACTION = "action"
 	// DATATYPE - the reflect.Type of the resource in the transaction
 	DATATYPE = "type"
 	// REQUESTBODY - the data sent from the client
 	REQUESTBODY = "requestBody"
+	// ID - the document id of findOne, update, upsert and remove transactions when set by the router
+	ID = "id"
+	// QUERY - the parsed query string of a findMany transaction
+	QUERY = "query"
+	// PAGINATION - the page size limits and response format of the resource
+	PAGINATION = "pagination"
+	// SERIALIZERS - the serializers of the resource keyed by the media type they read and write
+	SERIALIZERS = "serializers"
+	// FILES - the files uploaded with a multipart/form-data request body
+	FILES = "files"
+	// STREAMING - whether findMany results are streamed from storage that supports it
+	STREAMING = "streaming"
+	// BATCHSIZE - the number of insertMany records handed to storage that implements BulkStorage at a time
+	BATCHSIZE = "batchSize"
+	// LINKS - the link templates of the resource keyed by relation
+	LINKS = "links"
+	// DECODEOPTIONS - the strict decoding options of the resource's JSON request bodies
+	DECODEOPTIONS = "decodeOptions"
+	// BODYCHECKS - the outcomes of the raw request body checks of Any validator chains
+	BODYCHECKS = "bodyChecks"
+	// ITERATOR - the Iterator of a streamed findMany response, closed once the response is written
+	ITERATOR = "iterator"
+	// PRINCIPAL - the authenticated caller of the request
+	PRINCIPAL = "principal"
+	// TENANT - the tenant of the request
+	TENANT = "tenant"
+	// TENANTFIELD - the field holding the tenant of the resource's documents
+	TENANTFIELD = "tenantField"
+	// TENANTCLAIM - set when the tenant of the request is taken from a claim of the authenticated caller
+	TENANTCLAIM = "tenantClaim"
 )
 
 // Context -
@@ -43,6 +75,12 @@ func (c *Context) GetRequest() (r *http.Request) {
 	return c.data[REQUEST].(*http.Request)
 }
 
+// GetQuery - returns the parsed query string or nil when the transaction has none
+func (c *Context) GetQuery() (q *Query) {
+	q, _ = c.data[QUERY].(*Query)
+	return q
+}
+
 // GetResponse -
 func (c *Context) GetResponse() (r Response) {
 	return c.data[RESPONSE].(Response)
@@ -67,6 +105,30 @@ func (c *Context) SetResponseHeaders(h map[string][]string) {
 	c.SetResponse(response)
 }
 
+// AddResponseHeader - adds a header value without modifying the header map shared with the resource
+func (c *Context) AddResponseHeader(key, value string) {
+	response := c.GetResponse()
+	headers := make(map[string][]string, len(response.Headers)+1)
+	for k, v := range response.Headers {
+		headers[k] = v
+	}
+	headers[key] = append(append([]string{}, headers[key]...), value)
+	response.Headers = headers
+	c.SetResponse(response)
+}
+
+// SetResponseHeader - replaces the values of a header without modifying the header map shared with the resource
+func (c *Context) SetResponseHeader(key, value string) {
+	response := c.GetResponse()
+	headers := make(map[string][]string, len(response.Headers)+1)
+	for k, v := range response.Headers {
+		headers[k] = v
+	}
+	headers[key] = []string{value}
+	response.Headers = headers
+	c.SetResponse(response)
+}
+
 // SetResponseStatus -
 func (c *Context) SetResponseStatus(s int) {
 	response := c.GetResponse()
@@ -0,0 +1,225 @@
+package rest
+
+import (
+	"bufio"
+	"encoding/json"
+	"fmt"
+	"io"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"reflect"
+	"sort"
+)
+
+// File - a Memory storage persisted to an append-only log file, every write is synced to disk before it is acknowledged
+type File struct {
+	Memory
+	log *fileLog
+}
+
+// fileLog journals the changes of a memoryStore, one JSON array of records per line and transaction
+type fileLog struct {
+	path         string
+	file         *os.File
+	size         int64
+	records      int
+	compactAfter int
+}
+
+// record is the journaled form of a change
+type record struct {
+	ID     string          `json:"id"`
+	Doc    json.RawMessage `json:"doc,omitempty"`
+	Remove bool            `json:"remove,omitempty"`
+}
+
+// NewFile - opens, or creates, the log file at path and replays it into memory.
+// A transaction torn by a crash is discarded, the log is compacted once it holds 1000 records
+// and more than twice as many records as documents.
+func NewFile(path string, t reflect.Type) (*File, error) {
+	s, err := newMemoryStore(t)
+	if err != nil {
+		return nil, err
+	}
+	file, err := os.OpenFile(path, os.O_RDWR|os.O_CREATE, 0644)
+	if err != nil {
+		return nil, err
+	}
+	l := &fileLog{path: path, file: file, compactAfter: 1000}
+	if err = l.replay(s); err != nil {
+		file.Close()
+		return nil, err
+	}
+	s.journal = l
+	return &File{Memory: Memory{store: s}, log: l}, nil
+}
+
+// Clone - returns a File sharing the documents and the log of f
+func (f *File) Clone() Storage {
+	return &File{Memory: Memory{store: f.store}, log: f.log}
+}
+
+// UseCompaction - compacts the log once it holds n records and more than twice as many records as documents, 0 disables compaction
+func (f *File) UseCompaction(n int) *File {
+	f.store.Lock()
+	f.log.compactAfter = n
+	f.store.Unlock()
+	return f
+}
+
+// Compact - rewrites the log with a single record per document
+func (f *File) Compact() error {
+	f.store.Lock()
+	defer f.store.Unlock()
+	return f.log.compact(f.store)
+}
+
+// Close - closes the log file, later writes fail
+func (f *File) Close() error {
+	f.store.Lock()
+	defer f.store.Unlock()
+	return f.log.file.Close()
+}
+
+// replay applies every complete transaction of the log and truncates a torn trailing one
+func (l *fileLog) replay(s *memoryStore) error {
+	r := bufio.NewReader(l.file)
+	for {
+		line, err := r.ReadBytes('\n')
+		if err == io.EOF {
+			// Anything after the last newline is a transaction that was never acknowledged.
+			return l.truncate()
+		}
+		if err != nil {
+			return err
+		}
+		var records []record
+		if err = json.Unmarshal(line, &records); err != nil {
+			if _, perr := r.Peek(1); perr == io.EOF {
+				return l.truncate()
+			}
+			return fmt.Errorf("%s is corrupt at offset %d: %s", l.path, l.size, err)
+		}
+		for _, rec := range records {
+			if rec.Remove {
+				s.remove(rec.ID)
+				continue
+			}
+			doc := reflect.New(s.t)
+			if err = json.Unmarshal(rec.Doc, doc.Interface()); err != nil {
+				return fmt.Errorf("%s is corrupt at offset %d: %s", l.path, l.size, err)
+			}
+			s.assign(doc.Elem())
+			s.put(rec.ID, doc.Elem())
+		}
+		l.size += int64(len(line))
+		l.records += len(records)
+	}
+}
+
+// truncate drops everything after the last complete transaction
+func (l *fileLog) truncate() error {
+	if err := l.file.Truncate(l.size); err != nil {
+		return err
+	}
+	_, err := l.file.Seek(l.size, io.SeekStart)
+	return err
+}
+
+// write appends changes as one transaction and syncs it, compacting the log first when it is due
+func (l *fileLog) write(s *memoryStore, changes []change) error {
+	if l.compactAfter > 0 && l.records >= l.compactAfter && l.records > 2*len(s.docs) {
+		if err := l.compact(s); err != nil {
+			return err
+		}
+	}
+	line, err := marshalRecords(changes)
+	if err != nil {
+		return err
+	}
+	if _, err = l.file.Write(line); err == nil {
+		err = l.file.Sync()
+	}
+	if err != nil {
+		l.truncate()
+		return err
+	}
+	l.size += int64(len(line))
+	l.records += len(changes)
+	return nil
+}
+
+func marshalRecords(changes []change) ([]byte, error) {
+	records := make([]record, len(changes))
+	for i, c := range changes {
+		records[i] = record{ID: c.ID, Remove: c.Remove}
+		if c.Remove {
+			continue
+		}
+		doc, err := json.Marshal(c.Doc.Interface())
+		if err != nil {
+			return nil, err
+		}
+		records[i].Doc = doc
+	}
+	line, err := json.Marshal(records)
+	return append(line, '\n'), err
+}
+
+// compact replaces the log with one holding a record per document, the caller must hold the write lock
+func (l *fileLog) compact(s *memoryStore) error {
+	tmp, err := ioutil.TempFile(filepath.Dir(l.path), filepath.Base(l.path))
+	if err != nil {
+		return err
+	}
+	ids := make([]string, 0, len(s.docs))
+	for id := range s.docs {
+		ids = append(ids, id)
+	}
+	sort.Strings(ids)
+	w := bufio.NewWriter(tmp)
+	var size int64
+	for _, id := range ids {
+		var line []byte
+		if line, err = marshalRecords([]change{{ID: id, Doc: s.docs[id]}}); err != nil {
+			break
+		}
+		if _, err = w.Write(line); err != nil {
+			break
+		}
+		size += int64(len(line))
+	}
+	if err == nil {
+		err = w.Flush()
+	}
+	if err == nil {
+		err = tmp.Sync()
+	}
+	if cerr := tmp.Close(); err == nil {
+		err = cerr
+	}
+	if err == nil {
+		err = os.Rename(tmp.Name(), l.path)
+	}
+	if err != nil {
+		os.Remove(tmp.Name())
+		return err
+	}
+	syncDir(filepath.Dir(l.path))
+	file, err := os.OpenFile(l.path, os.O_RDWR, 0644)
+	if err != nil {
+		return err
+	}
+	l.file.Close()
+	l.file, l.size, l.records = file, size, len(ids)
+	return l.truncate()
+}
+
+// syncDir makes a rename durable, it is best effort as not every platform can sync directories
+func syncDir(dir string) {
+	if d, err := os.Open(dir); err == nil {
+		d.Sync()
+		d.Close()
+	}
+}
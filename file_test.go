@@ -0,0 +1,96 @@
+package rest
+
+import (
+	"bytes"
+	"encoding/json"
+	"io/ioutil"
+	"net/http"
+	"os"
+	"path/filepath"
+	"reflect"
+	"testing"
+)
+
+func TestFile(t *testing.T) {
+	dir, err := ioutil.TempDir("", "rest")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.RemoveAll(dir)
+	path := filepath.Join(dir, "todos.log")
+	storage, err := NewFile(path, reflect.TypeOf(FakeTodo{}))
+	if err != nil {
+		t.Fatalf("Error, unexpected error %s", err)
+	}
+	service := NewFakeService(FakeScenario{})
+	resource := NewFakeTodoResource(storage)
+	url := "http://foo.bar/todos"
+	serve(service.InsertMany(resource), "POST", url, `[{"id": "a", "title": "Milk", "priority": 1}, {"id": "b", "title": "Eggs", "priority": 2}]`)
+	serve(service.Update(resource), "PUT", url+"/a", `{"title": "Oat milk", "priority": 2}`)
+	serve(service.Upsert(resource), "PUT", url+"/c", `{"title": "Tea", "priority": 3}`)
+	serve(service.Remove(resource), "DELETE", url+"/b", "")
+	storage.Close()
+	// A transaction torn by a crash must be discarded on replay.
+	f, _ := os.OpenFile(path, os.O_WRONLY|os.O_APPEND, 0644)
+	f.WriteString(`[{"id":"d","doc":{"id":"d","ti`)
+	f.Close()
+	reopened, err := NewFile(path, reflect.TypeOf(FakeTodo{}))
+	if err != nil {
+		t.Fatalf("Error, unexpected error %s", err)
+	}
+	defer reopened.Close()
+	resource = NewFakeTodoResource(reopened)
+	w := serve(service.FindMany(resource), "GET", url+"?priority[in]=2,3", "")
+	if w.Body.String() != `[{"id":"a","title":"Oat milk","priority":2,"due":"0001-01-01T00:00:00Z"},{"id":"c","title":"Tea","priority":3,"due":"0001-01-01T00:00:00Z"}]` {
+		t.Errorf("Error, unexpected documents after replay %s", w.Body.String())
+	}
+	if w = serve(service.InsertOne(resource), "POST", url, `{"id": "d", "title": "Dates"}`); w.Code != http.StatusCreated {
+		t.Errorf("Error, expected %d, got %d: %s", http.StatusCreated, w.Code, w.Body.String())
+	}
+	if err = reopened.Compact(); err != nil {
+		t.Fatalf("Error, unexpected error %s", err)
+	}
+	if reopened.log.records != 3 {
+		t.Errorf("Error, expected 3 records after compaction, got %d", reopened.log.records)
+	}
+	var backup bytes.Buffer
+	if err = reopened.Backup(&backup); err != nil {
+		t.Fatalf("Error, unexpected error %s", err)
+	}
+	var todos []FakeTodo
+	json.Unmarshal(backup.Bytes(), &todos)
+	if len(todos) != 3 || todos[0].ID != "a" || todos[2].Title != "Dates" {
+		t.Errorf("Error, unexpected backup %s", backup.String())
+	}
+}
+
+func TestFileCompaction(t *testing.T) {
+	dir, err := ioutil.TempDir("", "rest")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.RemoveAll(dir)
+	path := filepath.Join(dir, "todos.log")
+	storage, err := NewFile(path, reflect.TypeOf(FakeTodo{}))
+	if err != nil {
+		t.Fatalf("Error, unexpected error %s", err)
+	}
+	storage.UseCompaction(10)
+	service := NewFakeService(FakeScenario{})
+	resource := NewFakeTodoResource(storage)
+	for i := 0; i < 25; i++ {
+		serve(service.Upsert(resource), "PUT", "http://foo.bar/todos/a", `{"title": "Milk"}`)
+	}
+	if storage.log.records > 10 {
+		t.Errorf("Error, expected the log to be compacted, it holds %d records", storage.log.records)
+	}
+	storage.Close()
+	reopened, err := NewFile(path, reflect.TypeOf(FakeTodo{}))
+	if err != nil {
+		t.Fatalf("Error, unexpected error %s", err)
+	}
+	defer reopened.Close()
+	if reopened.Len() != 1 {
+		t.Errorf("Error, expected 1 document, got %d", reopened.Len())
+	}
+}
@@ -0,0 +1,305 @@
+package rest
+
+import (
+	"encoding/json"
+	"fmt"
+	"mime"
+	"mime/multipart"
+	"net/http"
+	"net/url"
+	"reflect"
+	"sort"
+	"strconv"
+	"strings"
+	"time"
+)
+
+// Form - a Serializer decoding application/x-www-form-urlencoded and multipart/form-data bodies.
+// Keys name fields by their `json` names, nested fields and slice items are addressed as
+// address.city, address[city], items[0].name or repeated keys such as tags=a&tags=b.
+// Uploaded files are available from Context.GetFiles, responses are encoded as JSON.
+type Form struct {
+	*Context
+	// MaxMemory is the number of bytes of a multipart body kept in memory, the rest is stored in temporary files
+	MaxMemory int64
+	// MaxFileSize rejects uploads larger than this many bytes with 413
+	MaxFileSize int64
+	// MaxBodySize rejects bodies larger than this many bytes with 413 before they are parsed, MaxMemory plus
+	// MaxFileSize when it is not set
+	MaxBodySize int64
+}
+
+const (
+	defaultMaxMemory   = 32 << 20
+	defaultMaxFileSize = 10 << 20
+	// maxFormIndex bounds slice indexes so that a key such as items[100000000] can not exhaust memory
+	maxFormIndex = 1000
+)
+
+// FieldErrors - conversion errors keyed by the name of the offending field
+type FieldErrors map[string]string
+
+// Errors - the conversion errors sorted by field
+func (e FieldErrors) Errors() []FieldError {
+	keys := make([]string, 0, len(e))
+	for k := range e {
+		keys = append(keys, k)
+	}
+	sort.Strings(keys)
+	errs := make([]FieldError, len(keys))
+	for i, k := range keys {
+		errs[i] = FieldError{Field: k, Message: e[k]}
+	}
+	return errs
+}
+
+func (e FieldErrors) Error() string {
+	keys := make([]string, 0, len(e))
+	for k := range e {
+		keys = append(keys, k)
+	}
+	sort.Strings(keys)
+	msgs := make([]string, len(keys))
+	for i, k := range keys {
+		msgs[i] = k + ": " + e[k]
+	}
+	return strings.Join(msgs, "; ")
+}
+
+// UseContext -
+func (f *Form) UseContext(c *Context) {
+	f.Context = c
+}
+
+// Clone - returns a form serializer with the same limits for another request
+func (f *Form) Clone() Serializer {
+	c := *f
+	c.Context = nil
+	return &c
+}
+
+// Decode -
+func (f *Form) Decode() error {
+	r := f.GetRequest()
+	if r.Method != "POST" && r.Method != "PUT" && r.Method != "PATCH" {
+		return nil
+	}
+	values, err := f.parse(r)
+	if err != nil {
+		return err
+	}
+	t := f.Get(DATATYPE).(reflect.Type)
+	v := reflect.New(t)
+	if f.Get(ACTION) == INSERTMANY {
+		v = reflect.New(reflect.SliceOf(t))
+	}
+	errs := FieldErrors{}
+	for key, raws := range values {
+		if err := setFormValue(v.Elem(), formPath(key), raws); err != nil {
+			errs[key] = err.Error()
+		}
+	}
+	f.Set(REQUESTBODY, v.Interface())
+	if len(errs) > 0 {
+		f.SetResponseStatus(http.StatusBadRequest)
+		f.SetResponseBody(errs)
+		return errs
+	}
+	return nil
+}
+
+// parse reads the form values of the body and stores uploaded files on the context
+func (f *Form) parse(r *http.Request) (url.Values, error) {
+	mediaType, _, _ := mime.ParseMediaType(r.Header.Get("Content-Type"))
+	maxMemory := f.MaxMemory
+	if maxMemory <= 0 {
+		maxMemory = defaultMaxMemory
+	}
+	maxFileSize := f.MaxFileSize
+	if maxFileSize <= 0 {
+		maxFileSize = defaultMaxFileSize
+	}
+	maxBodySize := f.MaxBodySize
+	if maxBodySize <= 0 {
+		maxBodySize = maxMemory + maxFileSize
+	}
+	// Bound the body before it is parsed, the parsers read all of it into memory and temporary files
+	var body *limitedBody
+	if r.Body != nil {
+		body = &limitedBody{ReadCloser: r.Body, limit: maxBodySize}
+		r.Body = body
+	}
+	failParse := func(err error) error {
+		if body != nil && body.exceeded {
+			return f.fail(http.StatusRequestEntityTooLarge, &BodyTooLargeError{Limit: maxBodySize})
+		}
+		return f.fail(http.StatusBadRequest, err)
+	}
+	switch mediaType {
+	case "application/x-www-form-urlencoded":
+		if err := r.ParseForm(); err != nil {
+			return nil, failParse(err)
+		}
+		return r.PostForm, nil
+	case "multipart/form-data":
+		if err := r.ParseMultipartForm(maxMemory); err != nil {
+			return nil, failParse(err)
+		}
+		for name, files := range r.MultipartForm.File {
+			for _, file := range files {
+				if file.Size > maxFileSize {
+					return nil, f.fail(http.StatusRequestEntityTooLarge, fmt.Errorf("The file %q of %s is larger than %d bytes", file.Filename, name, maxFileSize))
+				}
+			}
+		}
+		f.Set(FILES, r.MultipartForm.File)
+		return url.Values(r.MultipartForm.Value), nil
+	}
+	return nil, f.fail(http.StatusUnsupportedMediaType, fmt.Errorf("The media type %q is not a form", r.Header.Get("Content-Type")))
+}
+
+func (f *Form) fail(status int, err error) error {
+	f.SetResponseStatus(status)
+	f.SetResponseBody(errorBody(err))
+	return err
+}
+
+// Encode -
+func (f *Form) Encode(v interface{}) ([]byte, error) {
+	return json.Marshal(v)
+}
+
+// GetFiles - returns the files uploaded with a multipart/form-data body keyed by their form field
+func (c *Context) GetFiles() map[string][]*multipart.FileHeader {
+	files, _ := c.Get(FILES).(map[string][]*multipart.FileHeader)
+	return files
+}
+
+// formPath splits a form key such as items[0][name] or items.0.name into its segments
+func formPath(key string) []string {
+	key = strings.Replace(key, "]", "", -1)
+	key = strings.Replace(key, "[", ".", -1)
+	return strings.Split(strings.TrimPrefix(key, "."), ".")
+}
+
+// setFormValue stores the values of a form key in the field of v addressed by path
+func setFormValue(v reflect.Value, path []string, values []string) error {
+	if v.Kind() == reflect.Ptr {
+		if v.IsNil() {
+			v.Set(reflect.New(v.Type().Elem()))
+		}
+		return setFormValue(v.Elem(), path, values)
+	}
+	if len(path) == 0 || (len(path) == 1 && path[0] == "" && v.Kind() == reflect.Slice) {
+		return setFormScalar(v, values)
+	}
+	switch v.Kind() {
+	case reflect.Struct:
+		if v.Type() == timeType {
+			break
+		}
+		f, ok := lookupField(v.Type(), path[0])
+		if !ok {
+			// Forms carry fields such as submit buttons and CSRF tokens, ignore what the type lacks.
+			return nil
+		}
+		return setFormValue(settableField(v, f.Index), path[1:], values)
+	case reflect.Slice:
+		i, err := strconv.Atoi(path[0])
+		if err != nil || i < 0 || i >= maxFormIndex {
+			return fmt.Errorf("%q is not a valid index", path[0])
+		}
+		if i >= v.Len() {
+			grown := reflect.MakeSlice(v.Type(), i+1, i+1)
+			reflect.Copy(grown, v)
+			v.Set(grown)
+		}
+		return setFormValue(v.Index(i), path[1:], values)
+	case reflect.Map:
+		if v.Type().Key().Kind() != reflect.String {
+			break
+		}
+		if v.IsNil() {
+			v.Set(reflect.MakeMap(v.Type()))
+		}
+		key := reflect.New(v.Type().Key()).Elem()
+		key.SetString(path[0])
+		item := reflect.New(v.Type().Elem()).Elem()
+		if current := v.MapIndex(key); current.IsValid() {
+			item.Set(current)
+		}
+		if err := setFormValue(item, path[1:], values); err != nil {
+			return err
+		}
+		v.SetMapIndex(key, item)
+		return nil
+	}
+	return fmt.Errorf("%s has no field %q", v.Type(), path[0])
+}
+
+// setFormScalar converts the values of a form key, slices take every value and other types the first
+func setFormScalar(v reflect.Value, values []string) error {
+	if v.Kind() == reflect.Slice && v.Type().Elem().Kind() != reflect.Uint8 {
+		list := reflect.MakeSlice(v.Type(), 0, len(values))
+		for _, raw := range values {
+			item := reflect.New(v.Type().Elem()).Elem()
+			if err := setFormScalar(item, []string{raw}); err != nil {
+				return err
+			}
+			list = reflect.Append(list, item)
+		}
+		v.Set(list)
+		return nil
+	}
+	if len(values) == 0 {
+		return nil
+	}
+	raw := values[0]
+	if v.Kind() == reflect.Ptr {
+		if raw == "" {
+			return nil
+		}
+		v.Set(reflect.New(v.Type().Elem()))
+		v = v.Elem()
+	}
+	switch {
+	case v.Kind() == reflect.String:
+		v.SetString(raw)
+		return nil
+	case v.Kind() == reflect.Slice:
+		v.SetBytes([]byte(raw))
+		return nil
+	case raw == "":
+		// An empty input leaves the zero value.
+		return nil
+	case v.Kind() == reflect.Bool && raw == "on":
+		// Checked checkboxes without a value attribute send "on".
+		v.SetBool(true)
+		return nil
+	case v.Type() == timeType:
+		t, err := parseFormTime(raw)
+		if err != nil {
+			return err
+		}
+		v.Set(reflect.ValueOf(t))
+		return nil
+	}
+	parsed, err := parseValue(raw, v.Type())
+	if err != nil {
+		return err
+	}
+	v.Set(reflect.ValueOf(parsed))
+	return nil
+}
+
+// formTimeLayouts - RFC 3339 and the formats of HTML date, datetime-local and month inputs
+var formTimeLayouts = []string{time.RFC3339Nano, "2006-01-02T15:04:05", "2006-01-02T15:04", "2006-01-02", "2006-01"}
+
+func parseFormTime(raw string) (time.Time, error) {
+	for _, layout := range formTimeLayouts {
+		if t, err := time.Parse(layout, raw); err == nil {
+			return t, nil
+		}
+	}
+	return time.Time{}, fmt.Errorf("%q is not a date or time", raw)
+}
@@ -0,0 +1,188 @@
+package rest
+
+import (
+	"bytes"
+	"encoding/json"
+	"io/ioutil"
+	"mime/multipart"
+	"net/http"
+	"net/http/httptest"
+	"reflect"
+	"strings"
+	"testing"
+	"time"
+)
+
+type FakeAddress struct {
+	City   string `json:"city"`
+	Street string `json:"street"`
+}
+
+type FakeProfile struct {
+	Name      string            `json:"name"`
+	Age       int               `json:"age"`
+	Height    *float64          `json:"height"`
+	Active    bool              `json:"active"`
+	Born      time.Time         `json:"born"`
+	Tags      []string          `json:"tags"`
+	Scores    []int             `json:"scores"`
+	Address   FakeAddress       `json:"address"`
+	Addresses []FakeAddress     `json:"addresses"`
+	Labels    map[string]string `json:"labels"`
+}
+
+// FakeFormStorage echoes the decoded request body and the names of the uploaded files
+type FakeFormStorage struct {
+	FakeStorage
+}
+
+func (s *FakeFormStorage) InsertOne() error {
+	files := []string{}
+	for name := range s.GetFiles() {
+		files = append(files, name)
+	}
+	s.SetResponseBody(map[string]interface{}{"body": s.Get(REQUESTBODY), "files": files})
+	return s.FakeAction(http.StatusCreated, http.StatusInternalServerError)
+}
+
+func NewFakeFormResource(form *Form) *Resource {
+	return NewResource("profile").
+		UseType(reflect.TypeOf(FakeProfile{})).
+		UseStorage(&FakeFormStorage{}).
+		UseValidator(&FakeNoopValidator{}).
+		UseSerializer(form)
+}
+
+func TestFormURLEncoded(t *testing.T) {
+	service := NewFakeService(FakeScenario{})
+	body := "name=Otieno+Kamau&age=21&height=1.8&active=on&born=2017-01-02&tags=a&tags=b&scores[]=1&scores[]=2" +
+		"&address.city=Nairobi&address[street]=Moi+Avenue&addresses[1][city]=Mombasa&addresses[0].city=Kisumu&labels[team]=blue&submit=Save"
+	r := httptest.NewRequest("POST", "http://foo.bar/profiles", strings.NewReader(body))
+	r.Header.Set("Content-Type", "application/x-www-form-urlencoded")
+	w := httptest.NewRecorder()
+	service.InsertOne(NewFakeFormResource(&Form{}))(w, r)
+	if w.Code != http.StatusCreated {
+		t.Fatalf("Error, expected %d, got %d: %s", http.StatusCreated, w.Code, w.Body.String())
+	}
+	var response struct {
+		Body FakeProfile `json:"body"`
+	}
+	json.Unmarshal(w.Body.Bytes(), &response)
+	height := 1.8
+	expected := FakeProfile{
+		Name:      "Otieno Kamau",
+		Age:       21,
+		Height:    &height,
+		Active:    true,
+		Born:      time.Date(2017, 1, 2, 0, 0, 0, 0, time.UTC),
+		Tags:      []string{"a", "b"},
+		Scores:    []int{1, 2},
+		Address:   FakeAddress{City: "Nairobi", Street: "Moi Avenue"},
+		Addresses: []FakeAddress{{City: "Kisumu"}, {City: "Mombasa"}},
+		Labels:    map[string]string{"team": "blue"},
+	}
+	if !reflect.DeepEqual(response.Body, expected) {
+		t.Errorf("Error, expected %+v, got %+v", expected, response.Body)
+	}
+}
+
+func TestFormErrors(t *testing.T) {
+	service := NewFakeService(FakeScenario{})
+	tests := []struct {
+		contentType string
+		body        string
+		expected    int
+		errors      string
+	}{
+		{"application/x-www-form-urlencoded", "age=old&born=yesterday&name=Otieno", http.StatusBadRequest,
+			`{"age":"\"old\" is not an integer","born":"\"yesterday\" is not a date or time"}`},
+		{"application/x-www-form-urlencoded", "addresses[x].city=Nairobi", http.StatusBadRequest, `{"addresses[x].city":"\"x\" is not a valid index"}`},
+		{"application/x-www-form-urlencoded", "addresses[5000].city=Nairobi", http.StatusBadRequest, `{"addresses[5000].city":"\"5000\" is not a valid index"}`},
+		{"application/x-www-form-urlencoded", "age=&height=", http.StatusCreated, ""},
+		{"text/plain", "age=21", http.StatusUnsupportedMediaType, ""},
+	}
+	for i, test := range tests {
+		r := httptest.NewRequest("POST", "http://foo.bar/profiles", strings.NewReader(test.body))
+		r.Header.Set("Content-Type", test.contentType)
+		w := httptest.NewRecorder()
+		service.InsertOne(NewFakeFormResource(&Form{}))(w, r)
+		if w.Code != test.expected {
+			t.Errorf("#%d Error, expected %d, got %d: %s", i, test.expected, w.Code, w.Body.String())
+		}
+		if test.errors != "" && w.Body.String() != test.errors {
+			t.Errorf("#%d Error, expected %s, got %s", i, test.errors, w.Body.String())
+		}
+	}
+}
+
+func NewFakeMultipart(fields map[string]string, file []byte) (string, *bytes.Buffer) {
+	var b bytes.Buffer
+	mw := multipart.NewWriter(&b)
+	for k, v := range fields {
+		mw.WriteField(k, v)
+	}
+	fw, _ := mw.CreateFormFile("avatar", "avatar.png")
+	fw.Write(file)
+	mw.Close()
+	return mw.FormDataContentType(), &b
+}
+
+func TestFormMultipart(t *testing.T) {
+	service := NewFakeService(FakeScenario{})
+	contentType, body := NewFakeMultipart(map[string]string{"name": "Otieno Kamau", "age": "21"}, []byte("png"))
+	r := httptest.NewRequest("POST", "http://foo.bar/profiles", body)
+	r.Header.Set("Content-Type", contentType)
+	w := httptest.NewRecorder()
+	service.InsertOne(NewFakeFormResource(&Form{}))(w, r)
+	if w.Body.String() != `{"body":{"name":"Otieno Kamau","age":21,"height":null,"active":false,"born":"0001-01-01T00:00:00Z","tags":null,"scores":null,"address":{"city":"","street":""},"addresses":null,"labels":null},"files":["avatar"]}` {
+		t.Errorf("Error, unexpected response %d %s", w.Code, w.Body.String())
+	}
+	contentType, body = NewFakeMultipart(map[string]string{"name": "Otieno Kamau"}, make([]byte, 2048))
+	r = httptest.NewRequest("POST", "http://foo.bar/profiles", body)
+	r.Header.Set("Content-Type", contentType)
+	w = httptest.NewRecorder()
+	service.InsertOne(NewFakeFormResource(&Form{MaxFileSize: 1024}))(w, r)
+	if w.Code != http.StatusRequestEntityTooLarge {
+		t.Errorf("Error, expected %d, got %d", http.StatusRequestEntityTooLarge, w.Code)
+	}
+	contentType, body = NewFakeMultipart(map[string]string{"name": "Otieno Kamau"}, make([]byte, 2048))
+	r = httptest.NewRequest("POST", "http://foo.bar/profiles", body)
+	r.Header.Set("Content-Type", contentType)
+	w = httptest.NewRecorder()
+	service.InsertOne(NewFakeFormResource(&Form{MaxBodySize: 1024}))(w, r)
+	if w.Code != http.StatusRequestEntityTooLarge || w.Body.String() != `"The request body is larger than 1024 bytes"` {
+		t.Errorf("Error, expected %d, got %d %s", http.StatusRequestEntityTooLarge, w.Code, w.Body.String())
+	}
+	r = httptest.NewRequest("POST", "http://foo.bar/profiles", strings.NewReader("name="+strings.Repeat("a", 2048)))
+	r.Header.Set("Content-Type", "application/x-www-form-urlencoded")
+	w = httptest.NewRecorder()
+	service.InsertOne(NewFakeFormResource(&Form{MaxBodySize: 1024}))(w, r)
+	if w.Code != http.StatusRequestEntityTooLarge {
+		t.Errorf("Error, expected %d for a url-encoded body, got %d", http.StatusRequestEntityTooLarge, w.Code)
+	}
+}
+
+func TestContextGetFiles(t *testing.T) {
+	contentType, body := NewFakeMultipart(nil, []byte("png"))
+	r := httptest.NewRequest("POST", "http://foo.bar/profiles", body)
+	r.Header.Set("Content-Type", contentType)
+	c := NewContext()
+	c.Set(REQUEST, r)
+	c.Set(ACTION, INSERTONE)
+	c.Set(DATATYPE, reflect.TypeOf(FakeProfile{}))
+	c.Set(RESPONSE, Response{})
+	form := &Form{}
+	form.UseContext(&c)
+	if err := form.Decode(); err != nil {
+		t.Fatalf("Error, unexpected error %s", err)
+	}
+	files := c.GetFiles()["avatar"]
+	if len(files) != 1 || files[0].Filename != "avatar.png" {
+		t.Fatalf("Error, expected the uploaded avatar, got %v", files)
+	}
+	f, _ := files[0].Open()
+	defer f.Close()
+	if b, _ := ioutil.ReadAll(f); string(b) != "png" {
+		t.Errorf("Error, unexpected file contents %q", b)
+	}
+}
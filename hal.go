@@ -0,0 +1,145 @@
+package rest
+
+import (
+	"encoding/json"
+	"net/url"
+	"path"
+	"reflect"
+	"regexp"
+	"strings"
+)
+
+// HAL - a Serializer for application/hal+json, encoding documents with `_links` to themselves, their collection
+// and the related resources declared with Resource.AddLink, and findMany results as an `_embedded` collection
+// with links to itself and its next and previous pages. Request bodies are decoded as JSON.
+type HAL struct {
+	JSON
+}
+
+// Clone - returns a HAL serializer for another request
+func (h *HAL) Clone() Serializer {
+	return &HAL{}
+}
+
+// halLink - a HAL link object
+type halLink struct {
+	Href string `json:"href"`
+}
+
+// linkParam matches the {field} placeholders of a link template
+var linkParam = regexp.MustCompile(`\{([^{}]+)\}`)
+
+// collectionPath returns the path of the collection the request addresses, the request path of collection
+// actions and its parent for actions on one document
+func (c *Context) collectionPath() string {
+	p := c.GetRequest().URL.Path
+	if action := c.Get(ACTION); action != FINDMANY && action != INSERTMANY && action != INSERTONE {
+		return path.Dir(strings.TrimRight(p, "/"))
+	}
+	return p
+}
+
+// expandLink replaces the {field} placeholders of a template with the values of a document, nested fields are
+// named as {author.id}. It fails when a value is missing.
+func expandLink(template string, doc map[string]json.RawMessage) (string, bool) {
+	ok := true
+	href := linkParam.ReplaceAllStringFunc(template, func(param string) string {
+		value := rawID(lookupRaw(doc, strings.Split(param[1:len(param)-1], ".")))
+		if value == "" {
+			ok = false
+		}
+		return (&url.URL{Path: value}).EscapedPath()
+	})
+	return href, ok
+}
+
+// lookupRaw returns the value of a document at a path of field names such as author.id
+func lookupRaw(doc map[string]json.RawMessage, names []string) json.RawMessage {
+	raw := doc[names[0]]
+	if len(names) == 1 {
+		return raw
+	}
+	var nested map[string]json.RawMessage
+	if json.Unmarshal(raw, &nested) != nil {
+		return nil
+	}
+	return lookupRaw(nested, names[1:])
+}
+
+// links returns the links of a document
+func (h *HAL) links(doc map[string]json.RawMessage, key, collection string) map[string]halLink {
+	links := map[string]halLink{"collection": {collection}}
+	if id := rawID(doc[key]); id != "" {
+		links["self"] = halLink{strings.TrimRight(collection, "/") + "/" + (&url.URL{Path: id}).EscapedPath()}
+	}
+	templates, _ := h.Get(LINKS).(map[string]string)
+	for rel, template := range templates {
+		if href, ok := expandLink(template, doc); ok {
+			links[rel] = halLink{href}
+		}
+	}
+	return links
+}
+
+// Encode - error messages, Violations and bulk reports are encoded as plain JSON
+func (h *HAL) Encode(v interface{}) ([]byte, error) {
+	switch v.(type) {
+	case nil, string, Violations, []ItemResult:
+		return json.Marshal(v)
+	}
+	key := ""
+	if t, ok := h.Get(DATATYPE).(reflect.Type); ok {
+		if id, err := resolveIdentity(t); err == nil {
+			key = id.Name
+		}
+	}
+	collection := h.collectionPath()
+	self := map[string]halLink{"self": {h.GetRequest().URL.RequestURI()}}
+	body := map[string]interface{}{}
+	if envelope, ok := v.(Envelope); ok {
+		v = envelope.Data
+		if envelope.Page.Next != "" {
+			self["next"] = halLink{h.pageURL(envelope.Page.Next)}
+		}
+		if envelope.Page.Prev != "" {
+			self["prev"] = halLink{h.pageURL(envelope.Page.Prev)}
+		}
+		if envelope.Page.Total != nil {
+			body["total"] = *envelope.Page.Total
+		}
+	}
+	b, err := json.Marshal(v)
+	if err != nil {
+		return nil, err
+	}
+	rv, _ := indirectValue(reflect.ValueOf(v))
+	if rv.Kind() != reflect.Slice && rv.Kind() != reflect.Array {
+		var doc map[string]json.RawMessage
+		if err = json.Unmarshal(b, &doc); err != nil {
+			return nil, err
+		}
+		return marshalLinks(withLinks(doc, h.links(doc, key, collection)))
+	}
+	var docs []map[string]json.RawMessage
+	if err = json.Unmarshal(b, &docs); err != nil {
+		return nil, err
+	}
+	items := make([]map[string]interface{}, len(docs))
+	for i, doc := range docs {
+		items[i] = withLinks(doc, h.links(doc, key, collection))
+	}
+	name, _ := h.Get(NAME).(string)
+	body["_links"] = self
+	body["_embedded"] = map[string]interface{}{name: items}
+	return marshalLinks(body)
+}
+
+// withLinks returns a document with its links
+func withLinks(doc map[string]json.RawMessage, links map[string]halLink) map[string]interface{} {
+	m := make(map[string]interface{}, len(doc)+1)
+	for k, v := range doc {
+		m[k] = v
+	}
+	m["_links"] = links
+	return m
+}
@@ -0,0 +1,78 @@
+package rest
+
+import (
+	"net/http"
+	"net/http/httptest"
+	"reflect"
+	"testing"
+)
+
+func TestHAL(t *testing.T) {
+	resource := NewResource("articles").
+		UseType(reflect.TypeOf(FakeArticle{})).
+		UseStorage(NewMemory(reflect.TypeOf(FakeArticle{}))).
+		UseValidator(&FakeNoopValidator{}).
+		AddSerializer("application/json", &JSON{}).
+		AddSerializer("application/hal+json", &HAL{}).
+		AddLink("tags", "/tags?article={id}").
+		AddLink("author", "/people/{author.id}")
+	service := NewFakeService(FakeScenario{})
+	tests := []struct {
+		action   string
+		verb     string
+		url      string
+		body     string
+		status   int
+		expected string
+	}{
+		{INSERTONE, "POST", "/articles", `{"id": "a 1", "title": "Rails is Omakase"}`, http.StatusCreated,
+			`{"_links":{"collection":{"href":"/articles"},"self":{"href":"/articles/a%201"},"tags":{"href":"/tags?article=a%201"}},"author":null,"id":"a 1","tags":null,"title":"Rails is Omakase"}`},
+		{FINDONE, "GET", "/articles/a%201", "", http.StatusOK,
+			`{"_links":{"collection":{"href":"/articles"},"self":{"href":"/articles/a%201"},"tags":{"href":"/tags?article=a%201"}},"author":null,"id":"a 1","tags":null,"title":"Rails is Omakase"}`},
+		{FINDMANY, "GET", "/articles?sort=title", "", http.StatusOK,
+			`{"_embedded":{"articles":[{"_links":{"collection":{"href":"/articles"},"self":{"href":"/articles/a%201"},"tags":{"href":"/tags?article=a%201"}},"author":null,"id":"a 1","tags":null,"title":"Rails is Omakase"}]},"_links":{"self":{"href":"/articles?sort=title"}}}`},
+		{FINDMANY, "GET", "/articles?title=none", "", http.StatusOK, `{"_embedded":{"articles":[]},"_links":{"self":{"href":"/articles?title=none"}}}`},
+		{INSERTONE, "POST", "/articles", `{"id": "b", "author": {"id": 9}}`, http.StatusCreated,
+			`{"_links":{"author":{"href":"/people/9"},"collection":{"href":"/articles"},"self":{"href":"/articles/b"},"tags":{"href":"/tags?article=b"}},"author":{"id":9,"name":""},"id":"b","tags":null,"title":""}`},
+		{FINDONE, "GET", "/articles/c", "", http.StatusNotFound, `"Document \"c\" was not found"`},
+	}
+	for i, test := range tests {
+		r := httptest.NewRequest(test.verb, "http://foo.bar"+test.url, nil)
+		if test.body != "" {
+			r = NewTestRequest(test.verb, "http://foo.bar"+test.url, test.body)
+		}
+		r.Header.Set("Accept", "application/hal+json")
+		w := httptest.NewRecorder()
+		service.process(resource, test.action)(w, r)
+		if w.Code != test.status || w.Body.String() != test.expected {
+			t.Errorf("#%d Error, expected %d %s, got %d %s", i, test.status, test.expected, w.Code, w.Body.String())
+		}
+		if w.Header().Get("Content-Type") != "application/hal+json" {
+			t.Errorf("#%d Error, expected a HAL response, got %s", i, w.Header().Get("Content-Type"))
+		}
+	}
+}
+
+func TestHALPages(t *testing.T) {
+	resource := NewFakeTodos(3).
+		UseSerializer(&HAL{}).
+		UsePagination(NewPagination(2, 10).UseEnvelope(true).UseSecret([]byte("secret")))
+	w := serve(NewFakeService(FakeScenario{}).FindMany(resource), "GET", "http://foo.bar/todos?fields=id", "")
+	expected := `{"_embedded":{"todo":[{"_links":{"collection":{"href":"/todos"},"self":{"href":"/todos/000"}},"id":"000"},{"_links":{"collection":{"href":"/todos"},"self":{"href":"/todos/001"}},"id":"001"}]},` +
+		`"_links":{"next":{"href":"/todos?cursor=eyJzIjpbImlkIl0sInYiOlsiMDAxIl19.L4Aq3dUgDurtTuChVQjZRmn4zbRLC84Kk4RqF2UZf2w&fields=id"},"self":{"href":"/todos?fields=id"}},"total":3}`
+	if w.Body.String() != expected {
+		t.Errorf("Error, expected %s, got %s", expected, w.Body.String())
+	}
+}
+
+func TestHALViolations(t *testing.T) {
+	resource := NewResource("articles").
+		UseType(reflect.TypeOf(FakeArticle{})).
+		UseStorage(NewMemory(reflect.TypeOf(FakeArticle{}))).
+		UseValidator(Check(func(c *Context) error { return FakeViolations{"title"} })).
+		AddSerializer("application/hal+json", &HAL{})
+	w := serve(NewFakeService(FakeScenario{}).InsertOne(resource), "POST", "http://foo.bar/articles", `{"title": "Go"}`)
+	if expected := `["title"]`; w.Code != http.StatusUnprocessableEntity || w.Body.String() != expected {
+		t.Errorf("Error, expected 422 %s, got %d %s", expected, w.Code, w.Body.String())
+	}
+}
@@ -8,6 +8,8 @@ import (
 // rovided
 func (s *Service) process(resource *Resource, action string) router.Handler {
 	return func(w http.ResponseWriter, r *http.Request) {
+		// s is replaced by a copy tagging logs and metrics once the tenant of the request is known
+		s := s
 		var response Response
 		// When a new request comes in we want a new model instance created to handle that request.
 		model := resource.NewModel(r, action)
@@ -17,18 +19,70 @@ func (s *Service) process(resource *Resource, action string) router.Handler {
 		stop := s.Metrics.NewTimer(event)
 		// Send response back to client when this function returns
 		defer func() {
+			// Release the storage of a streamed response however the response ends
+			if it, ok := model.Get(ITERATOR).(Iterator); ok {
+				defer it.Close()
+			}
+			// Run the hooks of the response, whether the request was answered early or not
+			s.hook(resource, BEFOREENCODE, model)
+			// Remove what the caller may not read
+			if redactor, ok := model.Authorizer.(Redactor); ok {
+				redactor.Redact(model)
+			}
+			// Translate the messages of error responses to the language the client prefers
+			if s.Catalog != nil {
+				s.Catalog.translate(model)
+			}
 			// Get a pointer to the response struct
 			response = model.GetResponse()
 			status := response.Status
-			body, err := model.Encode(response.Body)
+			var body []byte
+			var err error
+			// The results of a failed request are not sent
+			if it, ok := response.Body.(Iterator); ok && status >= http.StatusBadRequest {
+				it.Close()
+				response.Body = http.StatusText(status)
+			}
+			// Decode errors the Catalog did not translate are sent as their messages
+			switch e := response.Body.(type) {
+			case *DecodeError, *BodyTooLargeError:
+				response.Body = e.(error).Error()
+			}
+			// Streamed findMany results are written as they are read when the encoder supports it
+			if it, ok := response.Body.(Iterator); ok {
+				if encoder, ok := model.Encoder.(StreamEncoder); ok {
+					writeHeaders(w, response.Headers)
+					out, finish := http.ResponseWriter(w), func() error { return nil }
+					if s.Compression != nil {
+						out, finish = s.Compression.compressStream(w, r, status)
+					}
+					w.WriteHeader(status)
+					// An interrupted stream is left without its compression trailer so that it stays incomplete
+					if err = stream(out, r, it, encoder); err == nil {
+						err = finish()
+					}
+					if err != nil {
+						s.Logger.Error(err)
+					}
+					return
+				}
+				response.Body, err = drain(it)
+			}
+			if err == nil {
+				body, err = model.Encoder.Encode(response.Body)
+			}
 			if err != nil {
 				status = http.StatusInternalServerError
 				body = []byte(http.StatusText(http.StatusInternalServerError))
 				s.Logger.Error(err)
 			}
 			// Set response headers
-			for key, value := range response.Headers {
-				w.Header().Set(key, value[0])
+			writeHeaders(w, response.Headers)
+			// Compress the body when the client accepts it
+			if s.Compression != nil {
+				if body, err = s.Compression.compress(w.Header(), r, status, body); err != nil {
+					s.Logger.Error(err)
+				}
 			}
 			// Write the response status code
 			w.WriteHeader(status)
@@ -36,29 +90,114 @@ func (s *Service) process(resource *Resource, action string) router.Handler {
 			w.Write(body)
 		}()
 		var err error
-		err = model.Decode()
+		// Choose the serializers of the request and response media types
+		err = model.Negotiate()
 		if err != nil {
 			s.Logger.Error(err)
 			return
 		}
-		// Validate user input
-		err = model.Validate()
+		// Identify the caller before anything else is read from the request
+		err = s.authenticate(resource, model)
 		if err != nil {
 			s.Logger.Error(err)
+			// Count failed attempts against the rate limits too, so that guessing credentials is limited
+			if err = s.limit(resource, model); err != nil {
+				s.Logger.Error(err)
+			}
 			return
 		}
-		// Execute database operation
-		err = model.Execute(action)
+		// Resolve the tenant of the request and route it to the tenant's storage
+		err = s.resolveTenant(resource, model)
+		if err != nil {
+			s.Logger.Error(err)
+			return
+		}
+		if tenant := model.GetTenant(); tenant != "" {
+			s = s.forTenant(tenant)
+			stop = s.Metrics.NewTimer(event)
+		}
+		// Refuse requests over their rate limits
+		err = s.limit(resource, model)
+		if err != nil {
+			s.Logger.Error(err)
+			return
+		}
+		// Parse and validate the query string of findMany requests
+		err = model.ParseQuery()
+		if err != nil {
+			s.Logger.Error(err)
+			return
+		}
+		// Decompress gzip and deflate request bodies before they are decoded
+		if s.Compression != nil {
+			err = s.Compression.decompress(model)
+			if err != nil {
+				s.Logger.Error(err)
+				return
+			}
+		}
+		err = s.hook(resource, BEFOREDECODE, model)
+		if err != nil {
+			return
+		}
+		// Validate the raw request body before it is decoded
+		if v, ok := model.Validator.(BodyValidator); ok {
+			err = v.ValidateBody()
+			if err != nil {
+				s.Logger.Error(err)
+				return
+			}
+		}
+		if model.bulk() {
+			// Decode, validate and store insertMany records in batches
+			err = model.ingest(func(stage string) error {
+				return s.hook(resource, stage, model)
+			})
+		} else {
+			err = model.Decode()
+			if err != nil {
+				s.Logger.Error(err)
+				return
+			}
+			err = s.hook(resource, AFTERDECODE, model)
+			if err != nil {
+				return
+			}
+			err = s.hook(resource, BEFOREVALIDATE, model)
+			if err != nil {
+				return
+			}
+			// Validate user input
+			err = model.Validate()
+			if err != nil {
+				s.Logger.Error(err)
+				return
+			}
+			// Authorize the caller given the validated request body
+			err = model.Authorize()
+			if err != nil {
+				s.Logger.Error(err)
+				return
+			}
+			err = s.hook(resource, BEFOREEXECUTE, model)
+			if err != nil {
+				return
+			}
+			// Execute database operation
+			err = model.Execute(action)
+		}
 		// Handle failed database operation
 		if err != nil {
 			s.Logger.Error(err)
 		}
+		s.hook(resource, AFTEREXECUTE, model)
 		// If event broker is defined send the event to through the stream
-		err = s.Broker.Publish(event, &Event{Request: r, Response: &response})
+		err = s.Broker.Publish(event, &Event{Request: r, Response: &response, Tenant: model.GetTenant()})
 		if err != nil {
 			model.SetResponseStatus(http.StatusInternalServerError)
 			s.Logger.Error(err)
 		}
+		s.hook(resource, AFTERPUBLISH, model)
 		err = s.Metrics.Incr(event, 1)
 		if err != nil {
 			model.SetResponseStatus(http.StatusInternalServerError)
@@ -68,6 +207,15 @@ func (s *Service) process(resource *Resource, action string) router.Handler {
 	}
 }
 
+func writeHeaders(w http.ResponseWriter, headers map[string][]string) {
+	for key, values := range headers {
+		w.Header().Del(key)
+		for _, value := range values {
+			w.Header().Add(key, value)
+		}
+	}
+}
+
 // InsertOne creates a http handler that will create a document in model's database.
 func (s *Service) InsertOne(resource *Resource) router.Handler {
 	return s.process(resource, "insertOne")
@@ -0,0 +1,99 @@
+package rest
+
+import (
+	"errors"
+	"net/http"
+	"strings"
+)
+
+const (
+	// BEFOREDECODE - hooks run before the request body is decoded
+	BEFOREDECODE = "beforeDecode"
+	// AFTERDECODE - hooks run after the request body is decoded
+	AFTERDECODE = "afterDecode"
+	// BEFOREVALIDATE - hooks run before the request body is validated
+	BEFOREVALIDATE = "beforeValidate"
+	// BEFOREEXECUTE - hooks run before the storage operation
+	BEFOREEXECUTE = "beforeExecute"
+	// AFTEREXECUTE - hooks run after the storage operation, whether it failed or not
+	AFTEREXECUTE = "afterExecute"
+	// BEFOREENCODE - hooks run before the response is encoded, for every request including those stopped early
+	BEFOREENCODE = "beforeEncode"
+	// AFTERPUBLISH - hooks run after the event is published
+	AFTERPUBLISH = "afterPublish"
+)
+
+// Hook - code run at a stage of the pipeline. Returning an error stops the request, ErrStop to answer with the
+// response the hook set and any other error with 500 unless the hook set an error status. afterExecute and
+// afterPublish hooks run once the storage operation is done, their errors are logged and the request goes on.
+// insertMany requests ingested in batches, see UseBatchSize, run afterDecode and beforeValidate once per record, with
+// the record as a one document body, and beforeExecute once per batch, an error rejecting the record or the batch.
+type Hook func(model *Model) error
+
+// ErrStop - returned by a hook that answered the request itself
+var ErrStop = errors.New("The request was answered by a hook")
+
+// actionHook runs a hook for some actions only, all of them when none are given
+func actionHook(h Hook, actions []string) Hook {
+	if len(actions) == 0 {
+		return h
+	}
+	return func(model *Model) error {
+		action := model.Get(ACTION)
+		for _, a := range actions {
+			if a == action {
+				return h(model)
+			}
+		}
+		return nil
+	}
+}
+
+// AddHook - runs h at a stage of the pipeline of every resource, for the actions given or all of them
+func (s *Service) AddHook(stage string, h Hook, actions ...string) {
+	if s.Hooks == nil {
+		s.Hooks = make(map[string][]Hook)
+	}
+	s.Hooks[stage] = append(s.Hooks[stage], actionHook(h, actions))
+}
+
+// AddHook - runs h at a stage of the pipeline of the resource, for the actions given or all of them
+func (r *Resource) AddHook(stage string, h Hook, actions ...string) *Resource {
+	if r.Hooks == nil {
+		r.Hooks = make(map[string][]Hook)
+	}
+	r.Hooks[stage] = append(r.Hooks[stage], actionHook(h, actions))
+	return r
+}
+
+// hook runs the hooks of a stage, those of the service around those of the resource: first before a stage and
+// last after it
+func (s *Service) hook(resource *Resource, stage string, model *Model) error {
+	hooks := append(append([]Hook{}, s.Hooks[stage]...), resource.Hooks[stage]...)
+	if strings.HasPrefix(stage, "after") {
+		hooks = append(append([]Hook{}, resource.Hooks[stage]...), s.Hooks[stage]...)
+	}
+	done := stage == AFTEREXECUTE || stage == AFTERPUBLISH
+	for _, h := range hooks {
+		err := h(model)
+		if err == nil {
+			continue
+		}
+		if done {
+			// The storage operation is done, the request can not be stopped anymore
+			if err != ErrStop {
+				s.Logger.Error(err)
+			}
+			continue
+		}
+		if err != ErrStop {
+			s.Logger.Error(err)
+			if model.GetResponse().Status < http.StatusBadRequest {
+				model.SetResponseStatus(http.StatusInternalServerError)
+				model.SetResponseBody(http.StatusText(http.StatusInternalServerError))
+			}
+		}
+		return err
+	}
+	return nil
+}
@@ -0,0 +1,126 @@
+package rest
+
+import (
+	"errors"
+	"net/http"
+	"reflect"
+	"strings"
+	"testing"
+)
+
+func fakeHook(trace *[]string, name string) Hook {
+	return func(model *Model) error {
+		*trace = append(*trace, name)
+		return nil
+	}
+}
+
+func TestHooks(t *testing.T) {
+	var trace []string
+	service := NewFakeService(FakeScenario{})
+	resource := NewFakeTodoResource(NewMemory(reflect.TypeOf(FakeTodo{})))
+	for _, stage := range []string{BEFOREDECODE, AFTERDECODE, BEFOREVALIDATE, BEFOREEXECUTE, AFTEREXECUTE, AFTERPUBLISH, BEFOREENCODE} {
+		service.AddHook(stage, fakeHook(&trace, "service."+stage))
+		resource.AddHook(stage, fakeHook(&trace, "resource."+stage))
+	}
+	resource.AddHook(BEFOREEXECUTE, fakeHook(&trace, "resource.findMany"), FINDMANY)
+	tests := []struct {
+		verb     string
+		body     string
+		status   int
+		expected string
+	}{
+		{"POST", `{"title": "Milk"}`, http.StatusCreated,
+			"service.beforeDecode resource.beforeDecode resource.afterDecode service.afterDecode service.beforeValidate resource.beforeValidate " +
+				"service.beforeExecute resource.beforeExecute resource.afterExecute service.afterExecute resource.afterPublish service.afterPublish " +
+				"service.beforeEncode resource.beforeEncode"},
+		{"POST", `{"title": `, http.StatusBadRequest, "service.beforeDecode resource.beforeDecode service.beforeEncode resource.beforeEncode"},
+		{"GET", "", http.StatusOK,
+			"service.beforeDecode resource.beforeDecode resource.afterDecode service.afterDecode service.beforeValidate resource.beforeValidate " +
+				"service.beforeExecute resource.beforeExecute resource.findMany resource.afterExecute service.afterExecute resource.afterPublish service.afterPublish " +
+				"service.beforeEncode resource.beforeEncode"},
+	}
+	for i, test := range tests {
+		trace = nil
+		handler := service.InsertOne(resource)
+		if test.verb == "GET" {
+			handler = service.FindMany(resource)
+		}
+		w := serve(handler, test.verb, "http://foo.bar/todos", test.body)
+		if w.Code != test.status {
+			t.Errorf("#%d Error, expected %d, got %d", i, test.status, w.Code)
+		}
+		if stages := strings.Join(trace, " "); stages != test.expected {
+			t.Errorf("#%d Error, expected the stages\n%s\ngot\n%s", i, test.expected, stages)
+		}
+	}
+}
+
+func TestHooksStop(t *testing.T) {
+	tests := []struct {
+		hook     Hook
+		status   int
+		expected string
+		stored   int
+	}{
+		{func(model *Model) error {
+			model.SetResponseStatus(http.StatusOK)
+			model.SetResponseBody("Cached")
+			return ErrStop
+		}, http.StatusOK, `"Cached"`, 0},
+		{func(model *Model) error {
+			model.SetResponseStatus(http.StatusForbidden)
+			model.SetResponseBody("Read only")
+			return errors.New("Read only")
+		}, http.StatusForbidden, `"Read only"`, 0},
+		{func(model *Model) error {
+			return errors.New("The audit log is down")
+		}, http.StatusInternalServerError, `"Internal Server Error"`, 0},
+		{func(model *Model) error {
+			model.Get(REQUESTBODY).(*FakeTodo).Title = "Oat milk"
+			return nil
+		}, http.StatusCreated, ``, 1},
+	}
+	service := NewFakeService(FakeScenario{})
+	for i, test := range tests {
+		storage := NewMemory(reflect.TypeOf(FakeTodo{}))
+		resource := NewFakeTodoResource(storage).AddHook(BEFOREEXECUTE, test.hook, INSERTONE)
+		w := serve(service.InsertOne(resource), "POST", "http://foo.bar/todos", `{"title": "Milk"}`)
+		if w.Code != test.status || !strings.Contains(w.Body.String(), test.expected) {
+			t.Errorf("#%d Error, expected %d %s, got %d %s", i, test.status, test.expected, w.Code, w.Body.String())
+		}
+		w = serve(service.FindMany(resource), "GET", "http://foo.bar/todos", "")
+		if n := strings.Count(w.Body.String(), "Oat milk"); n != test.stored {
+			t.Errorf("#%d Error, expected %d stored documents, got %s", i, test.stored, w.Body.String())
+		}
+	}
+}
+
+func TestHooksAfterExecute(t *testing.T) {
+	var trace []string
+	broker, logger := &FakeEventBroker{}, &FakeErrorLogger{}
+	service := NewFakeService(FakeScenario{})
+	service.UseBroker(broker)
+	service.UseLogger(logger)
+	failing := func(model *Model) error {
+		return errors.New("The audit log is down")
+	}
+	resource := NewFakeTodoResource(NewMemory(reflect.TypeOf(FakeTodo{}))).
+		AddHook(AFTEREXECUTE, failing).
+		AddHook(AFTEREXECUTE, fakeHook(&trace, "afterExecute")).
+		AddHook(AFTERPUBLISH, failing).
+		AddHook(AFTERPUBLISH, fakeHook(&trace, "afterPublish"))
+	w := serve(service.InsertOne(resource), "POST", "http://foo.bar/todos", `{"title": "Milk"}`)
+	if w.Code != http.StatusCreated {
+		t.Errorf("Error, expected %d, got %d %s", http.StatusCreated, w.Code, w.Body.String())
+	}
+	if len(broker.events) != 1 || broker.events[0].Response.Status != http.StatusCreated {
+		t.Errorf("Error, expected the event to be published, got %v", broker.events)
+	}
+	if stages := strings.Join(trace, " "); stages != "afterExecute afterPublish" {
+		t.Errorf("Error, expected the remaining hooks to run, got %s", stages)
+	}
+	if len(logger.errs) != 2 {
+		t.Errorf("Error, expected the hook errors to be logged, got %v", logger.errs)
+	}
+}
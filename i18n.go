@@ -0,0 +1,190 @@
+package rest
+
+import (
+	"encoding/json"
+	"fmt"
+	"io/ioutil"
+	"path/filepath"
+	"strconv"
+	"strings"
+)
+
+// Catalog - translations of the messages of error responses, chosen by the Accept-Language header. Field errors
+// are looked up by code, rule and message, other messages by themselves and then by status code, e.g. "404".
+// Templates name their parameters as {field}, {param} and, for oneof, {values}. DecodeErrors are looked up by code
+// with {field}, {offset} and {param}, and BodyTooLargeErrors by bodyTooLarge with the limit as {param}. A language
+// falls back to its parents, fr-CA to fr, then to the next language the client accepts, the default language and
+// finally the untranslated message.
+type Catalog struct {
+	// Default - the language of the untranslated messages
+	Default  string
+	messages map[string]map[string]string
+	tags     map[string]string
+}
+
+// NewCatalog -
+func NewCatalog(language string) *Catalog {
+	return &Catalog{Default: language, messages: map[string]map[string]string{}, tags: map[string]string{}}
+}
+
+// Add - sets the template of a message code in a language
+func (c *Catalog) Add(language, code, template string) *Catalog {
+	key := strings.ToLower(language)
+	if c.messages[key] == nil {
+		c.messages[key] = map[string]string{}
+		c.tags[key] = language
+	}
+	c.messages[key][code] = template
+	return c
+}
+
+// Load - reads the translation files matching a pattern such as locales/*.json, each a JSON object of templates
+// keyed by code named after its language, e.g. locales/pt-BR.json
+func (c *Catalog) Load(pattern string) error {
+	paths, err := filepath.Glob(pattern)
+	if err != nil {
+		return err
+	}
+	if len(paths) == 0 {
+		return fmt.Errorf("No translation files match %s", pattern)
+	}
+	for _, path := range paths {
+		b, err := ioutil.ReadFile(path)
+		if err != nil {
+			return err
+		}
+		var templates map[string]string
+		if err = json.Unmarshal(b, &templates); err != nil {
+			return fmt.Errorf("%s: %s", path, err)
+		}
+		language := strings.TrimSuffix(filepath.Base(path), filepath.Ext(path))
+		for code, template := range templates {
+			c.Add(language, code, template)
+		}
+	}
+	return nil
+}
+
+// languages returns the languages to look messages up in, those of an Accept-Language header by preference each
+// followed by its parents, then the default language
+func (c *Catalog) languages(header string) []string {
+	var tags []string
+	var qs []float64
+	for _, part := range strings.Split(header, ",") {
+		params := strings.Split(part, ";")
+		tag := strings.ToLower(strings.TrimSpace(params[0]))
+		q := 1.0
+		for _, param := range params[1:] {
+			if param = strings.TrimSpace(param); strings.HasPrefix(param, "q=") {
+				var err error
+				if q, err = strconv.ParseFloat(param[2:], 64); err != nil {
+					q = 0
+				}
+			}
+		}
+		if tag == "" || tag == "*" || q <= 0 {
+			continue
+		}
+		// Insert in order of preference, keeping the order of equal q-values
+		i := len(qs)
+		for i > 0 && qs[i-1] < q {
+			i--
+		}
+		tags = append(tags[:i], append([]string{tag}, tags[i:]...)...)
+		qs = append(qs[:i], append([]float64{q}, qs[i:]...)...)
+	}
+	tags = append(tags, strings.ToLower(c.Default))
+	var chain []string
+	seen := map[string]bool{}
+	for _, tag := range tags {
+		for tag != "" && !seen[tag] {
+			seen[tag] = true
+			chain = append(chain, tag)
+			i := strings.LastIndex(tag, "-")
+			if i < 0 {
+				break
+			}
+			tag = tag[:i]
+		}
+	}
+	return chain
+}
+
+// lookup returns the template of the first key found in the first language of the chain that has one
+func (c *Catalog) lookup(chain []string, keys ...string) (string, bool) {
+	for _, language := range chain {
+		for _, key := range keys {
+			if template, ok := c.messages[language][key]; ok && key != "" {
+				return template, true
+			}
+		}
+	}
+	return "", false
+}
+
+// message returns the translation of a message, or the message when there is none
+func (c *Catalog) message(chain []string, msg string, params map[string]string, keys ...string) string {
+	template, ok := c.lookup(chain, keys...)
+	if !ok {
+		return msg
+	}
+	return linkParam.ReplaceAllStringFunc(template, func(param string) string {
+		if value, ok := params[param[1:len(param)-1]]; ok {
+			return value
+		}
+		return param
+	})
+}
+
+// translate replaces the messages of an error response with their translations
+func (c *Catalog) translate(model *Model) {
+	response := model.GetResponse()
+	if response.Status < 400 {
+		return
+	}
+	chain := c.languages(model.GetRequest().Header.Get("Accept-Language"))
+	switch body := response.Body.(type) {
+	case string:
+		model.SetResponseBody(c.message(chain, body, nil, body, strconv.Itoa(response.Status)))
+	case ValidationErrors:
+		errs := make(ValidationErrors, len(body))
+		for i, fe := range body {
+			params := map[string]string{"field": fe.Field, "param": fe.Param, "values": strings.Join(strings.Fields(fe.Param), ", ")}
+			fe.Message = c.message(chain, fe.Message, params, fe.Code, fe.Rule, fe.Message)
+			errs[i] = fe
+		}
+		model.SetResponseBody(errs)
+	case SchemaErrors:
+		errs := make(SchemaErrors, len(body))
+		for i, se := range body {
+			params := map[string]string{"field": se.Pointer, "param": se.Param}
+			se.Message = c.message(chain, se.Message, params, se.Keyword[strings.LastIndex(se.Keyword, "/")+1:], se.Message)
+			errs[i] = se
+		}
+		model.SetResponseBody(errs)
+	case FieldErrors:
+		errs := make(FieldErrors, len(body))
+		for field, msg := range body {
+			errs[field] = c.message(chain, msg, map[string]string{"field": field}, msg)
+		}
+		model.SetResponseBody(errs)
+	case *DecodeError:
+		params := map[string]string{"field": body.Path, "offset": strconv.FormatInt(body.Offset, 10), "param": body.Param}
+		model.SetResponseBody(c.message(chain, body.Error(), params, body.Code, body.Msg, strconv.Itoa(response.Status)))
+	case *BodyTooLargeError:
+		params := map[string]string{"param": strconv.FormatInt(body.Limit, 10)}
+		model.SetResponseBody(c.message(chain, body.Error(), params, "bodyTooLarge", strconv.Itoa(response.Status)))
+	default:
+		return
+	}
+	model.AddResponseHeader("Vary", "Accept-Language")
+	for _, language := range chain {
+		if _, ok := c.messages[language]; ok {
+			model.SetResponseHeader("Content-Language", c.tags[language])
+			return
+		}
+	}
+	if c.Default != "" {
+		model.SetResponseHeader("Content-Language", c.Default)
+	}
+}
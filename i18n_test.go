@@ -0,0 +1,154 @@
+package rest
+
+import (
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"path/filepath"
+	"reflect"
+	"strings"
+	"testing"
+)
+
+func NewFakeCatalog(t *testing.T) *Catalog {
+	dir := writeSchemas(t, map[string]string{
+		"fr.json": `{
+			"required": "est obligatoire",
+			"min.string": "doit contenir au moins {param} caractères",
+			"email": "{field} doit être une adresse e-mail",
+			"404": "Introuvable",
+			"400": "Requête invalide",
+			"unknownField": "{field} : champ inconnu à l'octet {offset}",
+			"bodyTooLarge": "Le corps dépasse {param} octets",
+			"Document \"nope\" was not found": "Le document nope est introuvable"
+		}`,
+		"fr-CA.json": `{"required": "est requis"}`,
+	})
+	defer os.RemoveAll(dir)
+	catalog := NewCatalog("en").Add("en", "unique", "is already registered")
+	if err := catalog.Load(filepath.Join(dir, "*.json")); err != nil {
+		t.Fatal(err)
+	}
+	return catalog
+}
+
+func TestCatalog(t *testing.T) {
+	service := NewFakeService(FakeScenario{})
+	service.UseCatalog(NewFakeCatalog(t))
+	tests := []struct {
+		language string
+		body     string
+		expected []FieldError
+		content  string
+	}{
+		{"fr-CA, en;q=0.5", `{"name": "O"}`, []FieldError{
+			{"email", "required", "", "est requis", "required"},
+			{"name", "min", "2", "doit contenir au moins 2 caractères", "min.string"},
+		}, "fr-CA"},
+		{"de, fr;q=0.8", `{"email": "otieno", "name": "O"}`, []FieldError{
+			{"email", "email", "", "email doit être une adresse e-mail", "email"},
+			{"name", "min", "2", "doit contenir au moins 2 caractères", "min.string"},
+		}, "fr"},
+		{"fr;q=0.2, sw", `{"email": "taken@example.com", "name": "Oti"}`, []FieldError{
+			{"email", "unique", "", "n'est pas unique", "unique"},
+		}, "fr"},
+		{"sw", `{"email": "taken@example.com", "name": "Oti"}`, []FieldError{
+			{"email", "unique", "", "is already registered", "unique"},
+		}, "en"},
+		{"", `{"name": "O"}`, []FieldError{
+			{"email", "required", "", "is required", "required"},
+			{"name", "min", "2", "must be at least 2 characters long", "min.string"},
+		}, "en"},
+	}
+	// The fr catalogue has no translation of unique, it falls back to the accepted languages before the default
+	service.Catalog.Add("fr", "unique", "n'est pas unique")
+	for i, test := range tests {
+		resource := NewResource("accounts").
+			UseType(reflect.TypeOf(FakeAccount{})).
+			UseStorage(NewMemory(reflect.TypeOf(FakeAccount{}))).
+			UseValidator(&TagValidator{}).
+			UseSerializer(&JSON{})
+		r := NewTestRequest("POST", "http://foo.bar/accounts", test.body)
+		r.Header.Set("Accept-Language", test.language)
+		w := httptest.NewRecorder()
+		service.InsertOne(resource)(w, r)
+		var errs []FieldError
+		json.Unmarshal(w.Body.Bytes(), &errs)
+		if !reflect.DeepEqual(errs, test.expected) {
+			t.Errorf("#%d Error, expected %+v, got %+v", i, test.expected, errs)
+		}
+		if language := w.Header().Get("Content-Language"); language != test.content {
+			t.Errorf("#%d Error, expected Content-Language %s, got %s", i, test.content, language)
+		}
+		if vary := w.Header().Get("Vary"); vary != "Accept-Language" {
+			t.Errorf("#%d Error, expected Vary Accept-Language, got %s", i, vary)
+		}
+	}
+}
+
+func TestCatalogMessages(t *testing.T) {
+	service := NewFakeService(FakeScenario{})
+	service.UseCatalog(NewFakeCatalog(t))
+	resource := NewFakeTodoResource(NewMemory(reflect.TypeOf(FakeTodo{})))
+	strict := NewFakeTodoResource(NewMemory(reflect.TypeOf(FakeTodo{}))).
+		UseDecodeOptions(&DecodeOptions{DisallowUnknownFields: true, MaxBodySize: 64})
+	tests := []struct {
+		handler  func(http.ResponseWriter, *http.Request)
+		verb     string
+		url      string
+		body     string
+		status   int
+		expected string
+	}{
+		{service.FindOne(resource), "GET", "http://foo.bar/todos/nope", "", http.StatusNotFound, `"Le document nope est introuvable"`},
+		{service.FindOne(resource), "GET", "http://foo.bar/todos/gone", "", http.StatusNotFound, `"Introuvable"`},
+		{service.InsertOne(resource), "POST", "http://foo.bar/todos", "", http.StatusBadRequest, `"Requête invalide"`},
+		{service.InsertOne(resource), "POST", "http://foo.bar/todos", `{"title": 1}`, http.StatusBadRequest, `"Requête invalide"`},
+		{service.InsertOne(resource), "POST", "http://foo.bar/todos", `{"title": "Milk"}`, http.StatusCreated, ``},
+		{service.InsertOne(strict), "POST", "http://foo.bar/todos", `{"title": "Milk", "colour": "red"}`, http.StatusBadRequest, `"colour : champ inconnu à l'octet 18"`},
+		{service.InsertOne(strict), "POST", "http://foo.bar/todos", `{"title": 1}`, http.StatusBadRequest, `"Requête invalide"`},
+		{service.InsertOne(strict), "POST", "http://foo.bar/todos", `{"title": "` + strings.Repeat("a", 64) + `"}`, http.StatusRequestEntityTooLarge, `"Le corps dépasse 64 octets"`},
+	}
+	for i, test := range tests {
+		r := NewTestRequest(test.verb, test.url, test.body)
+		r.Header.Set("Accept-Language", "fr")
+		w := httptest.NewRecorder()
+		test.handler(w, r)
+		if w.Code != test.status || !strings.Contains(w.Body.String(), test.expected) {
+			t.Errorf("#%d Error, expected %d %s, got %d %s", i, test.status, test.expected, w.Code, w.Body.String())
+		}
+		if translated := w.Header().Get("Content-Language") != ""; translated != (test.status >= 400) {
+			t.Errorf("#%d Error, unexpected Content-Language %q", i, w.Header().Get("Content-Language"))
+		}
+	}
+}
+
+func TestCatalogLanguages(t *testing.T) {
+	tests := []struct {
+		header   string
+		expected []string
+	}{
+		{"", []string{"en"}},
+		{"fr-CA", []string{"fr-ca", "fr", "en"}},
+		{"de;q=0.5, fr-CA;q=0.9, *", []string{"fr-ca", "fr", "de", "en"}},
+		{"en-GB, fr;q=0, sw;q=x", []string{"en-gb", "en"}},
+		{"zh-Hant-TW, zh", []string{"zh-hant-tw", "zh-hant", "zh", "en"}},
+	}
+	catalog := NewCatalog("en")
+	for i, test := range tests {
+		if languages := catalog.languages(test.header); !reflect.DeepEqual(languages, test.expected) {
+			t.Errorf("#%d Error, expected %v, got %v", i, test.expected, languages)
+		}
+	}
+}
+
+func TestCatalogLoad(t *testing.T) {
+	dir := writeSchemas(t, map[string]string{"fr.json": `{"required": 1}`})
+	defer os.RemoveAll(dir)
+	for _, pattern := range []string{filepath.Join(dir, "*.json"), filepath.Join(dir, "*.yaml"), "["} {
+		if err := NewCatalog("en").Load(pattern); err == nil {
+			t.Errorf("Error, expected loading %s to fail", pattern)
+		}
+	}
+}
@@ -0,0 +1,171 @@
+package rest
+
+import (
+	"crypto/rand"
+	"encoding/binary"
+	"encoding/hex"
+	"errors"
+	"fmt"
+	"reflect"
+	"strconv"
+	"strings"
+	"time"
+)
+
+const (
+	// UUID - generate random RFC 4122 version 4 ids
+	UUID = "uuid"
+	// ULID - generate lexicographically sortable ids
+	ULID = "ulid"
+	// SEQUENCE - generate incrementing ids
+	SEQUENCE = "sequence"
+)
+
+// identity - the id field of a resource type and how new ids are generated
+type identity struct {
+	field
+	Generator string
+}
+
+// resolveIdentity finds the field tagged `rest:"id"`, optionally with a generator as in `rest:"id,ulid"`,
+// falling back to the field named "id" in JSON
+func resolveIdentity(t reflect.Type) (identity, error) {
+	for _, f := range typeFields(t) {
+		opts := strings.Split(f.Tag.Get("rest"), ",")
+		if opts[0] != "id" {
+			continue
+		}
+		id := identity{field: f}
+		if len(opts) > 1 {
+			id.Generator = opts[1]
+		}
+		return id.withDefaults()
+	}
+	if f, ok := lookupField(t, "id"); ok {
+		return identity{field: f}.withDefaults()
+	}
+	return identity{}, fmt.Errorf("%s has no id field, tag one with `rest:\"id\"`", t)
+}
+
+func (id identity) withDefaults() (identity, error) {
+	kind := indirectKind(id.Type)
+	switch {
+	case id.Generator == "" && kind == reflect.String:
+		id.Generator = UUID
+	case id.Generator == "":
+		id.Generator = SEQUENCE
+	}
+	switch id.Generator {
+	case UUID, ULID:
+		if kind != reflect.String {
+			return id, fmt.Errorf("%s ids must be strings", id.Generator)
+		}
+	case SEQUENCE:
+	default:
+		return id, fmt.Errorf("Unknown id generator %q", id.Generator)
+	}
+	if _, err := parseValue("0", id.Type); err != nil && kind != reflect.String {
+		return id, fmt.Errorf("%s is not a supported id type", id.Type)
+	}
+	return id, nil
+}
+
+// value returns the id of a document as a string
+func (id identity) value(doc reflect.Value) string {
+	v := reflect.Indirect(doc).FieldByIndex(id.Index)
+	for v.Kind() == reflect.Ptr {
+		if v.IsNil() {
+			return ""
+		}
+		v = v.Elem()
+	}
+	if isZero(v) {
+		return ""
+	}
+	return fmt.Sprint(v.Interface())
+}
+
+// set stores a string id in a document, converting it to the type of the id field
+func (id identity) set(doc reflect.Value, s string) error {
+	parsed, err := parseValue(s, id.Type)
+	if err != nil {
+		return err
+	}
+	v := reflect.Indirect(doc).FieldByIndex(id.Index)
+	pv := reflect.ValueOf(parsed)
+	if v.Kind() == reflect.Ptr {
+		p := reflect.New(v.Type().Elem())
+		p.Elem().Set(pv)
+		pv = p
+	}
+	v.Set(pv)
+	return nil
+}
+
+// generate creates a new id, sequence receives the next number in the sequence
+func (id identity) generate(sequence int64) string {
+	switch id.Generator {
+	case UUID:
+		return NewUUID()
+	case ULID:
+		return NewULID()
+	}
+	return strconv.FormatInt(sequence, 10)
+}
+
+// NewUUID - returns a random version 4 UUID
+func NewUUID() string {
+	b := make([]byte, 16)
+	rand.Read(b)
+	b[6] = (b[6] & 0x0f) | 0x40
+	b[8] = (b[8] & 0x3f) | 0x80
+	s := hex.EncodeToString(b)
+	return s[:8] + "-" + s[8:12] + "-" + s[12:16] + "-" + s[16:20] + "-" + s[20:]
+}
+
+const crockford = "0123456789ABCDEFGHJKMNPQRSTVWXYZ"
+
+// NewULID - returns a ULID, 48 bits of millisecond timestamp followed by 80 random bits in Crockford base32
+func NewULID() string {
+	b := make([]byte, 16)
+	ms := uint64(time.Now().UnixNano() / int64(time.Millisecond))
+	binary.BigEndian.PutUint64(b[:8], ms<<16)
+	rand.Read(b[6:])
+	// 128 bits as 26 base32 characters, the first character holds the top 3 bits.
+	hi := binary.BigEndian.Uint64(b[:8])
+	lo := binary.BigEndian.Uint64(b[8:])
+	out := make([]byte, 26)
+	for i := 25; i >= 0; i-- {
+		out[i] = crockford[lo&0x1f]
+		lo = lo>>5 | hi<<59
+		hi >>= 5
+	}
+	return string(out)
+}
+
+// isZero reports whether v holds the zero value of its type
+func isZero(v reflect.Value) bool {
+	switch v.Kind() {
+	case reflect.Ptr, reflect.Interface, reflect.Map, reflect.Slice:
+		return v.IsNil()
+	case reflect.String:
+		return v.Len() == 0
+	}
+	return reflect.DeepEqual(v.Interface(), reflect.Zero(v.Type()).Interface())
+}
+
+var errNoID = errors.New("The request has no document id")
+
+// GetID - returns the document id of the transaction, either set by the router
+// under the ID key or taken from the last segment of the request path
+func (c *Context) GetID() (string, error) {
+	if id, ok := c.data[ID].(string); ok && id != "" {
+		return id, nil
+	}
+	path := strings.TrimRight(c.GetRequest().URL.Path, "/")
+	i := strings.LastIndex(path, "/")
+	if i < 0 || i == len(path)-1 {
+		return "", errNoID
+	}
+	return path[i+1:], nil
+}
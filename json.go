@@ -1,9 +1,15 @@
 package rest
 
 import (
+	"bytes"
+	"encoding"
 	"encoding/json"
+	"fmt"
+	"io"
+	"io/ioutil"
 	"net/http"
 	"reflect"
+	"strings"
 )
 
 // JSON -
@@ -16,6 +22,11 @@ func (j *JSON) UseContext(c *Context) {
 	j.Context = c
 }
 
+// Clone - returns a JSON serializer for another request
+func (j *JSON) Clone() Serializer {
+	return &JSON{}
+}
+
 // Decode -
 func (j *JSON) Decode() (err error) {
 	r := j.Context.GetRequest()
@@ -27,6 +38,20 @@ func (j *JSON) Decode() (err error) {
 	if j.Context.Get(ACTION) == INSERTMANY {
 		v = reflect.New(reflect.SliceOf(t)).Interface()
 	}
+	if options, ok := j.Context.Get(DECODEOPTIONS).(*DecodeOptions); ok {
+		action, _ := j.Context.Get(ACTION).(string)
+		err = options.decode(r.Body, v, action)
+		j.Context.Set(REQUESTBODY, v)
+		if err != nil {
+			status := http.StatusBadRequest
+			if _, ok := err.(*BodyTooLargeError); ok {
+				status = http.StatusRequestEntityTooLarge
+			}
+			j.Context.SetResponseStatus(status)
+			j.Context.SetResponseBody(errorBody(err))
+		}
+		return err
+	}
 	decoder := json.NewDecoder(r.Body)
 	err = decoder.Decode(&v)
 	j.Context.Set(REQUESTBODY, v)
@@ -41,3 +66,313 @@ func (j *JSON) Decode() (err error) {
 func (j *JSON) Encode(v interface{}) ([]byte, error) {
 	return json.Marshal(v)
 }
+
+// DecodeOptions - stricter decoding of JSON request bodies, set per resource with UseDecodeOptions
+type DecodeOptions struct {
+	// DisallowUnknownFields rejects object keys that match no field of the target type
+	DisallowUnknownFields bool
+	// DisallowTrailingData rejects anything but white space after the document
+	DisallowTrailingData bool
+	// MaxBodySize rejects bodies larger than this many bytes with 413
+	MaxBodySize int64
+	// UseNumber decodes numbers into interface{} values as json.Number instead of float64
+	UseNumber bool
+	// RequireFields rejects objects missing a key for a field the validate tags require for the action, e.g.
+	// `validate:"required"` or `validate.insertOne:"required"`, see TagValidator
+	RequireFields bool
+}
+
+// DecodeError - a request body that does not fit the resource type, Path names the offending field
+// as in items[0].title and Offset is the byte offset in the body. Code identifies the message for a Catalog,
+// one of syntax, eof, type, trailingData, unknownField and missingField, and Param is the type a type error
+// expected.
+type DecodeError struct {
+	Path   string
+	Offset int64
+	Msg    string
+	Code   string
+	Param  string
+}
+
+func (e *DecodeError) Error() string {
+	if e.Path == "" {
+		return fmt.Sprintf("%s at byte offset %d", e.Msg, e.Offset)
+	}
+	return fmt.Sprintf("%s: %s at byte offset %d", e.Path, e.Msg, e.Offset)
+}
+
+// BodyTooLargeError - a request body larger than a limit such as DecodeOptions.MaxBodySize
+type BodyTooLargeError struct {
+	Limit int64
+}
+
+func (e *BodyTooLargeError) Error() string {
+	return fmt.Sprintf("The request body is larger than %d bytes", e.Limit)
+}
+
+// errorBody returns the body of an error response, decode errors are kept for a Catalog to translate by their code
+// and sent as their messages
+func errorBody(err error) interface{} {
+	switch err.(type) {
+	case *DecodeError, *BodyTooLargeError:
+		return err
+	}
+	return err.Error()
+}
+
+// limitedBody fails reads past limit bytes with a BodyTooLargeError, like http.MaxBytesReader, and remembers that it
+// did for readers such as mime/multipart that wrap the errors of the body
+type limitedBody struct {
+	io.ReadCloser
+	limit    int64
+	read     int64
+	exceeded bool
+}
+
+func (l *limitedBody) Read(p []byte) (int, error) {
+	if l.exceeded {
+		return 0, &BodyTooLargeError{Limit: l.limit}
+	}
+	if remaining := l.limit - l.read + 1; int64(len(p)) > remaining {
+		p = p[:remaining]
+	}
+	n, err := l.ReadCloser.Read(p)
+	l.read += int64(n)
+	if l.read > l.limit {
+		l.exceeded = true
+		return n - int(l.read-l.limit), &BodyTooLargeError{Limit: l.limit}
+	}
+	return n, err
+}
+
+// decode reads a body into v applying the options, fields are required as they are for the action
+func (o *DecodeOptions) decode(body io.Reader, v interface{}, action string) error {
+	if body == nil {
+		return errEmptyBody
+	}
+	if o.MaxBodySize > 0 {
+		body = io.LimitReader(body, o.MaxBodySize+1)
+	}
+	b, err := ioutil.ReadAll(body)
+	if err != nil {
+		return err
+	}
+	if o.MaxBodySize > 0 && int64(len(b)) > o.MaxBodySize {
+		return &BodyTooLargeError{Limit: o.MaxBodySize}
+	}
+	if len(bytes.TrimSpace(b)) == 0 {
+		return errEmptyBody
+	}
+	r := bytes.NewReader(b)
+	decoder := json.NewDecoder(r)
+	if o.UseNumber {
+		decoder.UseNumber()
+	}
+	err = decoder.Decode(v)
+	// The document ends where the unread input starts.
+	buffered, _ := ioutil.ReadAll(decoder.Buffered())
+	end := len(b) - r.Len() - len(buffered)
+	switch e := err.(type) {
+	case nil:
+	case *json.SyntaxError:
+		return &DecodeError{Offset: e.Offset, Msg: e.Error(), Code: "syntax"}
+	case *json.UnmarshalTypeError:
+		c := &jsonChecker{b: b[:end], target: int(e.Offset)}
+		c.value(reflect.TypeOf(v), "")
+		return &DecodeError{Path: c.located, Offset: e.Offset, Msg: "expected " + e.Type.String() + ", got " + e.Value, Code: "type", Param: e.Type.String()}
+	default:
+		if err == io.ErrUnexpectedEOF {
+			return &DecodeError{Offset: int64(len(b)), Msg: err.Error(), Code: "eof"}
+		}
+		return err
+	}
+	if o.DisallowTrailingData {
+		if rest := bytes.TrimLeft(b[end:], " \t\r\n"); len(rest) > 0 {
+			return &DecodeError{Offset: int64(len(b) - len(rest)), Msg: "unexpected data after the document", Code: "trailingData"}
+		}
+	}
+	if o.DisallowUnknownFields || o.RequireFields {
+		c := &jsonChecker{b: b[:end], target: -1, unknown: o.DisallowUnknownFields, required: o.RequireFields, action: action}
+		return c.value(reflect.TypeOf(v), "")
+	}
+	return nil
+}
+
+var (
+	jsonUnmarshalerType = reflect.TypeOf((*json.Unmarshaler)(nil)).Elem()
+	textUnmarshalerType = reflect.TypeOf((*encoding.TextUnmarshaler)(nil)).Elem()
+)
+
+// jsonChecker walks a valid JSON document alongside the type it was decoded into, reporting unknown and
+// missing fields, or locating the path of the value that ends at target
+type jsonChecker struct {
+	b        []byte
+	i        int
+	target   int
+	located  string
+	found    bool
+	unknown  bool
+	required bool
+	action   string
+}
+
+func (c *jsonChecker) space() {
+	for c.i < len(c.b) && strings.IndexByte(" \t\r\n", c.b[c.i]) >= 0 {
+		c.i++
+	}
+}
+
+// value checks the value at the current offset against t, a nil t accepts anything
+func (c *jsonChecker) value(t reflect.Type, path string) error {
+	for t != nil && t.Kind() == reflect.Ptr {
+		t = t.Elem()
+	}
+	// Types that decode themselves and interface{} take any document.
+	if t != nil && (t.Kind() == reflect.Interface || reflect.PtrTo(t).Implements(jsonUnmarshalerType) || reflect.PtrTo(t).Implements(textUnmarshalerType)) {
+		t = nil
+	}
+	c.space()
+	var err error
+	switch c.b[c.i] {
+	case '{':
+		err = c.object(t, path)
+	case '[':
+		err = c.array(t, path)
+	case '"':
+		c.str()
+	default:
+		for c.i < len(c.b) && strings.IndexByte(",]} \t\r\n", c.b[c.i]) < 0 {
+			c.i++
+		}
+	}
+	if c.i == c.target && !c.found {
+		c.located, c.found = path, true
+	}
+	return err
+}
+
+func (c *jsonChecker) str() {
+	for c.i++; c.i < len(c.b) && c.b[c.i] != '"'; c.i++ {
+		if c.b[c.i] == '\\' {
+			c.i++
+		}
+	}
+	c.i++
+}
+
+func (c *jsonChecker) object(t reflect.Type, path string) error {
+	start := c.i
+	var fields []field
+	if t != nil && t.Kind() == reflect.Struct {
+		fields = typeFields(t)
+	}
+	seen := make(map[string]bool)
+	c.i++
+	for {
+		c.space()
+		if c.b[c.i] == '}' {
+			c.i++
+			break
+		}
+		keyStart := c.i
+		c.str()
+		var key string
+		json.Unmarshal(c.b[keyStart:c.i], &key)
+		c.space()
+		c.i++ // :
+		name := key
+		var elem reflect.Type
+		switch {
+		case fields != nil:
+			f, ok := foldField(fields, key)
+			if !ok && c.unknown {
+				return &DecodeError{Path: joinPath(path, key), Offset: int64(keyStart), Msg: "unknown field", Code: "unknownField"}
+			}
+			if ok {
+				name, elem = f.Name, f.Type
+				seen[f.Name] = true
+			}
+		case t != nil && t.Kind() == reflect.Map:
+			elem = t.Elem()
+		}
+		if err := c.value(elem, joinPath(path, name)); err != nil {
+			return err
+		}
+		c.space()
+		if c.b[c.i] == ',' {
+			c.i++
+		}
+	}
+	if !c.required {
+		return nil
+	}
+	for _, f := range fields {
+		if !seen[f.Name] && requiredKey(f, c.action) {
+			return &DecodeError{Path: joinPath(path, f.Name), Offset: int64(start), Msg: "missing required field", Code: "missingField"}
+		}
+	}
+	return nil
+}
+
+func (c *jsonChecker) array(t reflect.Type, path string) error {
+	var elem reflect.Type
+	if t != nil && (t.Kind() == reflect.Slice || t.Kind() == reflect.Array) {
+		elem = t.Elem()
+	}
+	c.i++
+	for n := 0; ; n++ {
+		c.space()
+		if c.b[c.i] == ']' {
+			c.i++
+			return nil
+		}
+		if err := c.value(elem, fmt.Sprintf("%s[%d]", path, n)); err != nil {
+			return err
+		}
+		c.space()
+		if c.b[c.i] == ',' {
+			c.i++
+		}
+	}
+}
+
+// requiredKey reports whether an object must hold a key for the field, which is when the rules the field has for the
+// action require it
+func requiredKey(f field, action string) bool {
+	rules, skip := fieldRules(f, action)
+	if skip {
+		return false
+	}
+	for _, r := range rules {
+		switch r.Name {
+		case "required":
+			return true
+		case "dive":
+			// The rules that follow apply to the items
+			return false
+		}
+	}
+	return false
+}
+
+// foldField finds a field by its JSON name, falling back to a case insensitive match like encoding/json
+func foldField(fields []field, key string) (field, bool) {
+	for _, f := range fields {
+		if f.Name == key {
+			return f, true
+		}
+	}
+	for _, f := range fields {
+		if strings.EqualFold(f.Name, key) {
+			return f, true
+		}
+	}
+	return field{}, false
+}
+
+func joinPath(path, name string) string {
+	if path == "" {
+		return name
+	}
+	return path + "." + name
+}
@@ -0,0 +1,64 @@
+package rest
+
+import (
+	"net/http"
+	"reflect"
+	"strings"
+	"testing"
+)
+
+type FakeOrder struct {
+	ID    string                 `json:"id"`
+	Items []FakeOrderItem        `json:"items" validate:"required"`
+	Note  string                 `json:"note"`
+	Meta  map[string]interface{} `json:"meta"`
+}
+
+type FakeOrderItem struct {
+	SKU      string `json:"sku" validate:"required"`
+	Quantity int    `json:"quantity"`
+}
+
+func TestDecodeOptions(t *testing.T) {
+	strict := &DecodeOptions{DisallowUnknownFields: true, DisallowTrailingData: true, MaxBodySize: 128, RequireFields: true}
+	tests := []struct {
+		options  *DecodeOptions
+		body     string
+		status   int
+		expected string
+	}{
+		{strict, `{"items": [{"sku": "a", "quantity": 2}], "meta": {"anything": {"goes": 1}}}`, http.StatusCreated, ""},
+		{strict, `{"items": [{"SKU": "a"}]}`, http.StatusCreated, ""},
+		{strict, `{"items": [{"sku": "a"}, {"sku": "b", "colour": "red"}]}`, http.StatusBadRequest, `"items[1].colour: unknown field at byte offset 38"`},
+		{strict, `{"items": [{"sku": "a"}, {"quantity": 1}]}`, http.StatusBadRequest, `"items[1].sku: missing required field at byte offset 25"`},
+		{strict, `{"note": "x"}`, http.StatusBadRequest, `"items: missing required field at byte offset 0"`},
+		{strict, `{"items": [{"sku": "a", "quantity": "2"}]}`, http.StatusBadRequest, `"items[0].quantity: expected int, got string at byte offset 39"`},
+		{strict, `{"items": [{"sku": "a"}]} {"items": []}`, http.StatusBadRequest, `"unexpected data after the document at byte offset 26"`},
+		{strict, `{"items": [{"sku": "a"}]`, http.StatusBadRequest, `"unexpected EOF at byte offset 24"`},
+		{strict, `{"items": [{"sku": "a"}],}`, http.StatusBadRequest, `"invalid character '}' looking for beginning of object key string at byte offset 26"`},
+		{strict, `{"note": "` + strings.Repeat("x", 128) + `"}`, http.StatusRequestEntityTooLarge, `"The request body is larger than 128 bytes"`},
+		{strict, ` `, http.StatusBadRequest, `"The request body is empty"`},
+		{&DecodeOptions{}, `{"colour": "red"} trailing`, http.StatusCreated, ""},
+		{&DecodeOptions{UseNumber: true}, `{"meta": {"n": 12345678901234567890}}`, http.StatusCreated, `"meta":{"n":12345678901234567890}`},
+		{&DecodeOptions{}, `{"meta": {"n": 12345678901234567890}}`, http.StatusCreated, `"meta":{"n":12345678901234567000}`},
+	}
+	service := NewFakeService(FakeScenario{})
+	for i, test := range tests {
+		resource := NewResource("order").
+			UseType(reflect.TypeOf(FakeOrder{})).
+			UseStorage(NewMemory(reflect.TypeOf(FakeOrder{}))).
+			UseValidator(&FakeNoopValidator{}).
+			UseSerializer(&JSON{}).
+			UseDecodeOptions(test.options)
+		w := serve(service.InsertOne(resource), "POST", "http://foo.bar/orders", test.body)
+		if w.Code != test.status {
+			t.Errorf("#%d Error, expected %d, got %d: %s", i, test.status, w.Code, w.Body.String())
+		}
+		if test.status != http.StatusCreated && w.Body.String() != test.expected {
+			t.Errorf("#%d Error, expected %s, got %s", i, test.expected, w.Body.String())
+		}
+		if test.status == http.StatusCreated && !strings.Contains(w.Body.String(), test.expected) {
+			t.Errorf("#%d Error, expected %s in %s", i, test.expected, w.Body.String())
+		}
+	}
+}
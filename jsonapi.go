@@ -0,0 +1,476 @@
+package rest
+
+import (
+	"bytes"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"net/http"
+	"reflect"
+	"strings"
+)
+
+// INCLUDEPARAM - the query parameter naming the relationships whose resources a JSON:API document includes
+const INCLUDEPARAM = "include"
+
+// JSONAPI - a Serializer for JSON:API documents (application/vnd.api+json). The resource name is the type of
+// its documents and the id field their id. Fields tagged `jsonapi:"<type>"` are relationships to resources of
+// that type, holding either ids or the related documents, which are included when the include parameter names them.
+// Sparse fieldsets are requested as fields[<type>]=a,b.
+type JSONAPI struct {
+	*Context
+}
+
+type jsonapiIdentifier struct {
+	Type string `json:"type"`
+	ID   string `json:"id"`
+}
+
+type jsonapiRelationship struct {
+	Data interface{} `json:"data"`
+}
+
+type jsonapiResource struct {
+	Type          string                         `json:"type"`
+	ID            string                         `json:"id,omitempty"`
+	Attributes    map[string]json.RawMessage     `json:"attributes,omitempty"`
+	Relationships map[string]jsonapiRelationship `json:"relationships,omitempty"`
+	Links         map[string]string              `json:"links,omitempty"`
+}
+
+type jsonapiDocument struct {
+	Data     interface{}            `json:"data"`
+	Included []*jsonapiResource     `json:"included,omitempty"`
+	Links    map[string]string      `json:"links,omitempty"`
+	Meta     map[string]interface{} `json:"meta,omitempty"`
+}
+
+type jsonapiSource struct {
+	Pointer string `json:"pointer"`
+}
+
+type jsonapiError struct {
+	Status string         `json:"status"`
+	Title  string         `json:"title"`
+	Detail string         `json:"detail,omitempty"`
+	Source *jsonapiSource `json:"source,omitempty"`
+}
+
+// jsonapiInput - a resource object of a request document
+type jsonapiInput struct {
+	Type          string                                `json:"type"`
+	ID            json.RawMessage                       `json:"id"`
+	Attributes    map[string]json.RawMessage            `json:"attributes"`
+	Relationships map[string]struct{ Data interface{} } `json:"relationships"`
+}
+
+// jsonapiRelation - a relationship field, Key is the id field of the related documents when the field holds them
+type jsonapiRelation struct {
+	field
+	Type string
+	Key  string
+	Many bool
+}
+
+// jsonapiType - the type, id field and relationships of the documents of a resource
+type jsonapiType struct {
+	Name      string
+	Key       string
+	Relations map[string]jsonapiRelation
+}
+
+func newJSONAPIType(name string, t reflect.Type) jsonapiType {
+	jt := jsonapiType{Name: name, Relations: map[string]jsonapiRelation{}}
+	if id, err := resolveIdentity(t); err == nil {
+		jt.Key = id.Name
+	}
+	for _, f := range typeFields(t) {
+		related := f.Tag.Get("jsonapi")
+		if related == "" {
+			continue
+		}
+		r := jsonapiRelation{field: f, Type: related}
+		elem := f.Type
+		for elem.Kind() == reflect.Ptr {
+			elem = elem.Elem()
+		}
+		if elem.Kind() == reflect.Slice {
+			r.Many, elem = true, elem.Elem()
+		}
+		if indirectKind(elem) == reflect.Struct {
+			if id, err := resolveIdentity(elem); err == nil {
+				r.Key = id.Name
+			}
+		}
+		jt.Relations[f.Name] = r
+	}
+	return jt
+}
+
+// UseContext -
+func (j *JSONAPI) UseContext(c *Context) {
+	j.Context = c
+}
+
+// Clone - returns a JSON:API serializer for another request
+func (j *JSONAPI) Clone() Serializer {
+	return &JSONAPI{}
+}
+
+func (j *JSONAPI) resourceType() jsonapiType {
+	name, _ := j.Get(NAME).(string)
+	t, _ := j.Get(DATATYPE).(reflect.Type)
+	return newJSONAPIType(name, t)
+}
+
+// params returns the include and sparse fieldset parameters of the request
+func (j *JSONAPI) params(jt jsonapiType) (map[string]bool, map[string]map[string]bool, error) {
+	values := j.GetRequest().URL.Query()
+	include := map[string]bool{}
+	for _, name := range splitList(values[INCLUDEPARAM]) {
+		if _, ok := jt.Relations[name]; !ok {
+			return nil, nil, fmt.Errorf("Unknown relationship %q", name)
+		}
+		include[name] = true
+	}
+	fieldsets := map[string]map[string]bool{}
+	for key, raws := range values {
+		if !strings.HasPrefix(key, FIELDSPARAM+"[") || !strings.HasSuffix(key, "]") {
+			continue
+		}
+		fieldset := map[string]bool{}
+		for _, name := range splitList(raws) {
+			fieldset[name] = true
+		}
+		fieldsets[key[len(FIELDSPARAM)+1:len(key)-1]] = fieldset
+	}
+	return include, fieldsets, nil
+}
+
+type jsonapiTypeMismatch struct {
+	error
+}
+
+// Decode - reads a request document with a resource object, or an array of them for insertMany, into the resource type.
+// A type, or an id other than the one addressed, answers 409. Requests without a body have their include parameter checked.
+func (j *JSONAPI) Decode() error {
+	jt := j.resourceType()
+	r := j.GetRequest()
+	if r.Method != "POST" && r.Method != "PUT" && r.Method != "PATCH" {
+		if _, _, err := j.params(jt); err != nil {
+			j.SetResponseStatus(http.StatusBadRequest)
+			j.SetResponseBody(err.Error())
+			return err
+		}
+		return nil
+	}
+	t := j.Get(DATATYPE).(reflect.Type)
+	err := decodeBody(j.Context, func(b []byte, v interface{}) error {
+		var document struct {
+			Data json.RawMessage `json:"data"`
+		}
+		if err := json.Unmarshal(b, &document); err != nil {
+			return err
+		}
+		if len(document.Data) == 0 || string(document.Data) == "null" {
+			return errors.New("The request document has no data")
+		}
+		var inputs []jsonapiInput
+		list := reflect.ValueOf(v).Elem()
+		if list.Kind() == reflect.Slice {
+			if err := json.Unmarshal(document.Data, &inputs); err != nil {
+				return err
+			}
+		} else {
+			var input jsonapiInput
+			if err := json.Unmarshal(document.Data, &input); err != nil {
+				return err
+			}
+			inputs = []jsonapiInput{input}
+		}
+		for _, input := range inputs {
+			doc := reflect.New(t)
+			if err := j.unmarshalInput(jt, input, doc.Interface()); err != nil {
+				return err
+			}
+			if list.Kind() != reflect.Slice {
+				list.Set(doc.Elem())
+				return nil
+			}
+			list.Set(reflect.Append(list, doc.Elem()))
+		}
+		return nil
+	})
+	if _, ok := err.(jsonapiTypeMismatch); ok {
+		j.SetResponseStatus(http.StatusConflict)
+	}
+	return err
+}
+
+// unmarshalInput rebuilds the plain JSON document of a resource object and decodes it into v
+func (j *JSONAPI) unmarshalInput(jt jsonapiType, input jsonapiInput, v interface{}) error {
+	if input.Type != jt.Name {
+		return jsonapiTypeMismatch{fmt.Errorf("The type %q does not match the %q endpoint", input.Type, jt.Name)}
+	}
+	doc := map[string]interface{}{}
+	for name, raw := range input.Attributes {
+		doc[name] = raw
+	}
+	if len(input.ID) > 0 && jt.Key != "" {
+		var id string
+		if err := json.Unmarshal(input.ID, &id); err != nil {
+			return errors.New("The id must be a string")
+		}
+		if action := j.Get(ACTION); action == UPDATE || action == UPSERT {
+			if addressed, err := j.GetID(); err == nil && addressed != id {
+				return jsonapiTypeMismatch{fmt.Errorf("The id %q does not match the addressed %q", id, addressed)}
+			}
+		}
+		key, _ := lookupField(reflect.TypeOf(v).Elem(), jt.Key)
+		doc[jt.Key] = jsonapiID("", key.Type, id)
+	}
+	for name, rel := range input.Relationships {
+		relation, ok := jt.Relations[name]
+		if !ok {
+			continue
+		}
+		b, _ := json.Marshal(rel.Data)
+		var ids []jsonapiIdentifier
+		if relation.Many {
+			if err := json.Unmarshal(b, &ids); err != nil {
+				return fmt.Errorf("The relationship %q must hold an array of resource identifiers", name)
+			}
+		} else if rel.Data != nil {
+			var id jsonapiIdentifier
+			if err := json.Unmarshal(b, &id); err != nil {
+				return fmt.Errorf("The relationship %q must hold a resource identifier", name)
+			}
+			ids = []jsonapiIdentifier{id}
+		}
+		linked := make([]interface{}, len(ids))
+		for i, id := range ids {
+			if id.Type != relation.Type {
+				return jsonapiTypeMismatch{fmt.Errorf("The relationship %q holds %q resources, not %q", name, relation.Type, id.Type)}
+			}
+			linked[i] = jsonapiID(relation.Key, relation.elem(), id.ID)
+		}
+		switch {
+		case relation.Many:
+			doc[name] = linked
+		case len(linked) == 1:
+			doc[name] = linked[0]
+		default:
+			doc[name] = nil
+		}
+	}
+	b, err := json.Marshal(doc)
+	if err != nil {
+		return err
+	}
+	return json.Unmarshal(b, v)
+}
+
+// elem returns the type of the related documents or ids
+func (r jsonapiRelation) elem() reflect.Type {
+	t := r.field.Type
+	for t.Kind() == reflect.Ptr {
+		t = t.Elem()
+	}
+	if r.Many {
+		t = t.Elem()
+	}
+	return t
+}
+
+// jsonapiID returns the JSON value of an id for a document of type t, an object holding it under key when
+// the document is a struct with an id field, and a number when the id field or t is numeric
+func jsonapiID(key string, t reflect.Type, id string) interface{} {
+	for t.Kind() == reflect.Ptr {
+		t = t.Elem()
+	}
+	if t.Kind() == reflect.Struct && key != "" {
+		f, _ := lookupField(t, key)
+		return map[string]interface{}{key: jsonapiID("", f.Type, id)}
+	}
+	switch indirectKind(t) {
+	case reflect.Int, reflect.Int8, reflect.Int16, reflect.Int32, reflect.Int64,
+		reflect.Uint, reflect.Uint8, reflect.Uint16, reflect.Uint32, reflect.Uint64, reflect.Float32, reflect.Float64:
+		return json.RawMessage(id)
+	}
+	return id
+}
+
+// rawID returns the id of a plain JSON document
+func rawID(raw json.RawMessage) string {
+	var id string
+	if err := json.Unmarshal(raw, &id); err == nil {
+		return id
+	}
+	if s := string(raw); s != "null" {
+		return s
+	}
+	return ""
+}
+
+// pointerPath converts field paths such as items[0].sku to JSON pointer segments
+var pointerPath = strings.NewReplacer("[", "/", "]", "", ".", "/")
+
+// jsonPointer returns the JSON pointer of a field path in a request document, paths of schema errors are pointers
+// already
+func jsonPointer(path string) string {
+	if strings.HasPrefix(path, "/") {
+		return path
+	}
+	return "/data/attributes/" + strings.TrimPrefix(pointerPath.Replace(path), "/")
+}
+
+// jsonapiEncoder renders the documents of a response, collecting included resources
+type jsonapiEncoder struct {
+	include   map[string]bool
+	fieldsets map[string]map[string]bool
+	base      string
+	included  []*jsonapiResource
+	seen      map[jsonapiIdentifier]bool
+}
+
+// resource converts a plain JSON document to a resource object
+func (e *jsonapiEncoder) resource(jt jsonapiType, doc map[string]json.RawMessage, primary bool) *jsonapiResource {
+	r := &jsonapiResource{Type: jt.Name, ID: rawID(doc[jt.Key])}
+	fieldset, sparse := e.fieldsets[jt.Name]
+	for name, raw := range doc {
+		if name == jt.Key || (sparse && !fieldset[name]) {
+			continue
+		}
+		relation, ok := jt.Relations[name]
+		if !ok {
+			if r.Attributes == nil {
+				r.Attributes = map[string]json.RawMessage{}
+			}
+			r.Attributes[name] = raw
+			continue
+		}
+		if r.Relationships == nil {
+			r.Relationships = map[string]jsonapiRelationship{}
+		}
+		r.Relationships[name] = e.relationship(relation, raw, primary && e.include[name])
+	}
+	if primary && r.ID != "" {
+		r.Links = map[string]string{"self": e.base + "/" + r.ID}
+	}
+	return r
+}
+
+// relationship returns the resource linkage of a relationship field, including the related documents when asked to
+func (e *jsonapiEncoder) relationship(relation jsonapiRelation, raw json.RawMessage, include bool) jsonapiRelationship {
+	var items []json.RawMessage
+	if relation.Many {
+		json.Unmarshal(raw, &items)
+	} else if string(raw) != "null" {
+		items = []json.RawMessage{raw}
+	}
+	related := jsonapiType{Name: relation.Type, Key: relation.Key, Relations: map[string]jsonapiRelation{}}
+	if relation.Key != "" {
+		related = newJSONAPIType(relation.Type, relation.elem())
+	}
+	ids := make([]jsonapiIdentifier, 0, len(items))
+	for _, item := range items {
+		id := jsonapiIdentifier{Type: relation.Type, ID: rawID(item)}
+		var doc map[string]json.RawMessage
+		if relation.Key != "" && json.Unmarshal(item, &doc) == nil {
+			id.ID = rawID(doc[relation.Key])
+			if include && !e.seen[id] {
+				e.seen[id] = true
+				e.included = append(e.included, e.resource(related, doc, false))
+			}
+		}
+		ids = append(ids, id)
+	}
+	if relation.Many {
+		return jsonapiRelationship{Data: ids}
+	}
+	if len(ids) == 0 {
+		return jsonapiRelationship{Data: nil}
+	}
+	return jsonapiRelationship{Data: ids[0]}
+}
+
+// Encode - renders documents as resource objects, findMany results as an array of them and error messages
+// as error objects
+func (j *JSONAPI) Encode(v interface{}) ([]byte, error) {
+	status := j.GetResponse().Status
+	switch body := v.(type) {
+	case string:
+		return json.Marshal(map[string]interface{}{"errors": []jsonapiError{{
+			Status: fmt.Sprint(status),
+			Title:  http.StatusText(status),
+			Detail: body,
+		}}})
+	case Violations:
+		fes := body.Errors()
+		errs := make([]jsonapiError, len(fes))
+		for i, fe := range fes {
+			errs[i] = jsonapiError{
+				Status: fmt.Sprint(status),
+				Title:  http.StatusText(status),
+				Detail: fe.Message,
+				Source: &jsonapiSource{Pointer: jsonPointer(fe.Field)},
+			}
+		}
+		return json.Marshal(map[string]interface{}{"errors": errs})
+	case []ItemResult:
+		return json.Marshal(map[string]interface{}{"meta": map[string]interface{}{"results": body}})
+	}
+	jt := j.resourceType()
+	include, fieldsets, _ := j.params(jt)
+	r := j.GetRequest()
+	e := &jsonapiEncoder{include: include, fieldsets: fieldsets, base: j.collectionPath(), seen: map[jsonapiIdentifier]bool{}}
+	document := jsonapiDocument{Links: map[string]string{"self": r.URL.RequestURI()}}
+	if envelope, ok := v.(Envelope); ok {
+		v = envelope.Data
+		if envelope.Page.Next != "" {
+			document.Links["next"] = j.pageURL(envelope.Page.Next)
+		}
+		if envelope.Page.Prev != "" {
+			document.Links["prev"] = j.pageURL(envelope.Page.Prev)
+		}
+		if envelope.Page.Total != nil {
+			document.Meta = map[string]interface{}{"total": *envelope.Page.Total}
+		}
+	}
+	if v == nil {
+		return marshalLinks(document)
+	}
+	b, err := json.Marshal(v)
+	if err != nil {
+		return nil, err
+	}
+	rv, _ := indirectValue(reflect.ValueOf(v))
+	if rv.Kind() == reflect.Slice || rv.Kind() == reflect.Array {
+		var docs []map[string]json.RawMessage
+		if err = json.Unmarshal(b, &docs); err != nil {
+			return nil, err
+		}
+		data := make([]*jsonapiResource, len(docs))
+		for i, doc := range docs {
+			data[i] = e.resource(jt, doc, true)
+		}
+		document.Data = data
+	} else {
+		var doc map[string]json.RawMessage
+		if err = json.Unmarshal(b, &doc); err != nil {
+			return nil, err
+		}
+		document.Data = e.resource(jt, doc, true)
+	}
+	document.Included = e.included
+	return marshalLinks(document)
+}
+
+// marshalLinks encodes a document without escaping the & of the links it holds
+func marshalLinks(document interface{}) ([]byte, error) {
+	var b bytes.Buffer
+	encoder := json.NewEncoder(&b)
+	encoder.SetEscapeHTML(false)
+	err := encoder.Encode(document)
+	return bytes.TrimSuffix(b.Bytes(), []byte("\n")), err
+}
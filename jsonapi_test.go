@@ -0,0 +1,109 @@
+package rest
+
+import (
+	"net/http"
+	"reflect"
+	"strings"
+	"testing"
+)
+
+type FakeAuthor struct {
+	ID   int64  `json:"id"`
+	Name string `json:"name"`
+}
+
+type FakeArticle struct {
+	ID     string      `json:"id"`
+	Title  string      `json:"title"`
+	Author *FakeAuthor `json:"author" jsonapi:"people"`
+	Tags   []string    `json:"tags" jsonapi:"tags"`
+}
+
+func TestJSONAPI(t *testing.T) {
+	resource := NewResource("articles").
+		UseType(reflect.TypeOf(FakeArticle{})).
+		UseStorage(NewMemory(reflect.TypeOf(FakeArticle{}))).
+		UseValidator(&FakeNoopValidator{}).
+		AddSerializer("application/vnd.api+json", &JSONAPI{}).
+		UsePagination(NewPagination(1, 10).UseEnvelope(true).UseSecret([]byte("secret")))
+	service := NewFakeService(FakeScenario{})
+	tests := []struct {
+		action   string
+		verb     string
+		url      string
+		body     string
+		status   int
+		expected string
+	}{
+		{INSERTONE, "POST", "/articles", `{"data": {"type": "articles", "id": "1", "attributes": {"title": "Rails is Omakase"},
+			"relationships": {"author": {"data": {"type": "people", "id": "9"}}, "tags": {"data": [{"type": "tags", "id": "go"}]}}}}`, http.StatusCreated,
+			`{"data":{"type":"articles","id":"1","attributes":{"title":"Rails is Omakase"},"relationships":{"author":{"data":{"type":"people","id":"9"}},"tags":{"data":[{"type":"tags","id":"go"}]}},"links":{"self":"/articles/1"}},"links":{"self":"/articles"}}`},
+		{INSERTONE, "POST", "/articles", `{"data": {"type": "articles", "id": "2", "attributes": {"title": "JSON:API paints my bikeshed!"}}}`, http.StatusCreated, ""},
+		{FINDONE, "GET", "/articles/1?include=author&fields[articles]=title,author", "", http.StatusOK,
+			`{"data":{"type":"articles","id":"1","attributes":{"title":"Rails is Omakase"},"relationships":{"author":{"data":{"type":"people","id":"9"}}},"links":{"self":"/articles/1"}},` +
+				`"included":[{"type":"people","id":"9","attributes":{"name":""}}],"links":{"self":"/articles/1?include=author&fields[articles]=title,author"}}`},
+		{FINDMANY, "GET", "/articles?fields[articles]=title", "", http.StatusOK,
+			`{"data":[{"type":"articles","id":"1","attributes":{"title":"Rails is Omakase"},"links":{"self":"/articles/1"}}],` +
+				`"links":{"next":"/articles?cursor=eyJzIjpbImlkIl0sInYiOlsiMSJdfQ.htPW-Q2L1CQQ-Rofu0IzQEPmUByOK_-LVn3l3xVGuEk&fields%5Barticles%5D=title","self":"/articles?fields[articles]=title"},"meta":{"total":2}}`},
+		{FINDONE, "GET", "/articles/3", "", http.StatusNotFound,
+			`{"errors":[{"status":"404","title":"Not Found","detail":"Document \"3\" was not found"}]}`},
+		{FINDONE, "GET", "/articles/1?include=comments", "", http.StatusBadRequest,
+			`{"errors":[{"status":"400","title":"Bad Request","detail":"Unknown relationship \"comments\""}]}`},
+		{INSERTONE, "POST", "/articles", `{"data": {"type": "people", "attributes": {"name": "Dan"}}}`, http.StatusConflict,
+			`{"errors":[{"status":"409","title":"Conflict","detail":"The type \"people\" does not match the \"articles\" endpoint"}]}`},
+		{UPDATE, "PATCH", "/articles/1", `{"data": {"type": "articles", "id": "2", "attributes": {"title": "Moved"}}}`, http.StatusConflict, ""},
+		{UPDATE, "PATCH", "/articles/2", `{"data": {"type": "articles", "id": "2", "attributes": {"title": "Updated"}, "relationships": {"author": {"data": null}}}}`, http.StatusNoContent, ""},
+		{FINDONE, "GET", "/articles/2", "", http.StatusOK,
+			`{"data":{"type":"articles","id":"2","attributes":{"title":"Updated"},"relationships":{"author":{"data":null},"tags":{"data":[]}},"links":{"self":"/articles/2"}},"links":{"self":"/articles/2"}}`},
+		{INSERTONE, "POST", "/articles", `{"title": "Plain JSON"}`, http.StatusBadRequest, ""},
+	}
+	for i, test := range tests {
+		w := serve(service.process(resource, test.action), test.verb, "http://foo.bar"+test.url, test.body)
+		if w.Code != test.status {
+			t.Errorf("#%d Error, expected %d, got %d: %s", i, test.status, w.Code, w.Body.String())
+		}
+		if test.expected != "" && w.Body.String() != test.expected {
+			t.Errorf("#%d Error, expected %s, got %s", i, test.expected, w.Body.String())
+		}
+	}
+}
+
+type FakeViolations []string
+
+func (v FakeViolations) Error() string {
+	return strings.Join(v, "; ")
+}
+
+func (v FakeViolations) Errors() []FieldError {
+	errs := make([]FieldError, len(v))
+	for i, field := range v {
+		errs[i] = FieldError{Field: field, Message: "is taken"}
+	}
+	return errs
+}
+
+func TestJSONAPIViolations(t *testing.T) {
+	tests := []struct {
+		err      error
+		expected string
+	}{
+		{FakeViolations{"title", "author.name"},
+			`{"errors":[{"status":"422","title":"Unprocessable Entity","detail":"is taken","source":{"pointer":"/data/attributes/title"}},` +
+				`{"status":"422","title":"Unprocessable Entity","detail":"is taken","source":{"pointer":"/data/attributes/author/name"}}]}`},
+		{SchemaErrors{{Pointer: "/data/attributes/title", Keyword: "/properties/title/minLength", Message: "is too short"}},
+			`{"errors":[{"status":"422","title":"Unprocessable Entity","detail":"is too short","source":{"pointer":"/data/attributes/title"}}]}`},
+	}
+	service := NewFakeService(FakeScenario{})
+	for i, test := range tests {
+		err := test.err
+		resource := NewResource("articles").
+			UseType(reflect.TypeOf(FakeArticle{})).
+			UseStorage(NewMemory(reflect.TypeOf(FakeArticle{}))).
+			UseValidator(Check(func(c *Context) error { return err })).
+			AddSerializer("application/vnd.api+json", &JSONAPI{})
+		w := serve(service.InsertOne(resource), "POST", "http://foo.bar/articles", `{"data": {"type": "articles", "attributes": {"title": "Go"}}}`)
+		if w.Code != http.StatusUnprocessableEntity || w.Body.String() != test.expected {
+			t.Errorf("#%d Error, expected 422 %s, got %d %s", i, test.expected, w.Code, w.Body.String())
+		}
+	}
+}
@@ -21,6 +21,7 @@ type Log struct {
 	StackTrace string    `json:"stack_trace"`
 	Hostname   string    `json:"hostname"`
 	File       string    `json:"file"`
+	Tenant     string    `json:"tenant,omitempty"`
 }
 
 type LoggingSink interface {
@@ -39,6 +40,9 @@ func (lc *LoggingClient) CreateLog(e error) (l *Log) {
 	l = &Log{}
 	l.CreatedAt = time.Now().UTC()
 	l.Details = e.Error()
+	if te, ok := e.(*TenantError); ok {
+		l.Tenant = te.Tenant
+	}
 	l.StackTrace = string(debug.Stack())
 	l.Hostname, _ = os.Hostname()
 	_, file, line, _ := runtime.Caller(2)
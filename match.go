@@ -0,0 +1,253 @@
+package rest
+
+import (
+	"reflect"
+	"regexp"
+	"strings"
+	"time"
+)
+
+// matcher evaluates a Query against documents held in memory
+type matcher struct {
+	t       reflect.Type
+	filters []compiledFilter
+}
+
+type compiledFilter struct {
+	Filter
+	index   []int
+	pattern *regexp.Regexp
+}
+
+func newMatcher(t reflect.Type, q *Query) *matcher {
+	if q == nil {
+		q = &Query{}
+	}
+	m := &matcher{t: t}
+	for _, f := range q.Filters {
+		cf := compiledFilter{Filter: f}
+		if sf, ok := lookupField(t, f.Field); ok {
+			cf.index = sf.Index
+		}
+		if f.Operator == LIKE {
+			cf.pattern = likePattern(f.Value)
+		}
+		m.filters = append(m.filters, cf)
+	}
+	return m
+}
+
+// likePattern translates a SQL LIKE pattern into an anchored regular expression
+func likePattern(v interface{}) *regexp.Regexp {
+	s := reflect.ValueOf(v).String()
+	var b []string
+	for _, r := range s {
+		switch r {
+		case '%':
+			b = append(b, ".*")
+		case '_':
+			b = append(b, ".")
+		default:
+			b = append(b, regexp.QuoteMeta(string(r)))
+		}
+	}
+	return regexp.MustCompile("^(?s:" + strings.Join(b, "") + ")$")
+}
+
+// Match reports whether a document satisfies every filter
+func (m *matcher) Match(doc reflect.Value) bool {
+	doc = reflect.Indirect(doc)
+	for _, f := range m.filters {
+		if f.index == nil {
+			return false
+		}
+		v, ok := indirectValue(fieldValue(doc, f.index))
+		if !ok {
+			if f.Operator != NE {
+				return false
+			}
+			continue
+		}
+		if !f.match(v) {
+			return false
+		}
+	}
+	return true
+}
+
+func (f compiledFilter) match(v reflect.Value) bool {
+	switch f.Operator {
+	case EQ:
+		return compare(v, f.Value) == 0
+	case NE:
+		return compare(v, f.Value) != 0
+	case GT:
+		return compare(v, f.Value) > 0
+	case GTE:
+		return compare(v, f.Value) >= 0
+	case LT:
+		return compare(v, f.Value) < 0
+	case LTE:
+		return compare(v, f.Value) <= 0
+	case IN:
+		for _, value := range f.Values {
+			if compare(v, value) == 0 {
+				return true
+			}
+		}
+		return false
+	case LIKE:
+		return f.pattern.MatchString(v.String())
+	}
+	return false
+}
+
+// indirectValue dereferences pointers, ok is false for nil pointers
+func indirectValue(v reflect.Value) (reflect.Value, bool) {
+	for v.Kind() == reflect.Ptr {
+		if v.IsNil() {
+			return v, false
+		}
+		v = v.Elem()
+	}
+	return v, true
+}
+
+// compare orders a field value against an operand of the same underlying type, it returns -1, 0 or 1
+func compare(v reflect.Value, operand interface{}) int {
+	o := reflect.ValueOf(operand)
+	if t, ok := v.Interface().(time.Time); ok {
+		ot := o.Interface().(time.Time)
+		switch {
+		case t.Before(ot):
+			return -1
+		case t.After(ot):
+			return 1
+		}
+		return 0
+	}
+	switch v.Kind() {
+	case reflect.String:
+		return strings.Compare(v.String(), o.String())
+	case reflect.Bool:
+		a, b := v.Bool(), o.Bool()
+		switch {
+		case a == b:
+			return 0
+		case !a:
+			return -1
+		}
+		return 1
+	case reflect.Int, reflect.Int8, reflect.Int16, reflect.Int32, reflect.Int64:
+		a, b := v.Int(), o.Int()
+		switch {
+		case a < b:
+			return -1
+		case a > b:
+			return 1
+		}
+		return 0
+	case reflect.Uint, reflect.Uint8, reflect.Uint16, reflect.Uint32, reflect.Uint64:
+		a, b := v.Uint(), o.Uint()
+		switch {
+		case a < b:
+			return -1
+		case a > b:
+			return 1
+		}
+		return 0
+	case reflect.Float32, reflect.Float64:
+		a, b := v.Float(), o.Float()
+		switch {
+		case a < b:
+			return -1
+		case a > b:
+			return 1
+		}
+		return 0
+	}
+	if reflect.DeepEqual(v.Interface(), operand) {
+		return 0
+	}
+	return -1
+}
+
+// sortKeys returns the query sort with the id appended as a tie breaker so that orderings are total
+func sortKeys(q *Query, id string) []Sort {
+	keys := []Sort{}
+	if q != nil {
+		keys = append(keys, q.Sort...)
+	}
+	for _, s := range keys {
+		if s.Field == id {
+			return keys
+		}
+	}
+	return append(keys, Sort{Field: id})
+}
+
+// keyValues returns the values of the sort keys of a document
+func keyValues(t reflect.Type, doc reflect.Value, keys []Sort) []interface{} {
+	doc = reflect.Indirect(doc)
+	values := make([]interface{}, len(keys))
+	for i, k := range keys {
+		f, _ := lookupField(t, k.Field)
+		values[i] = fieldValue(doc, f.Index).Interface()
+	}
+	return values
+}
+
+// compareKeys orders two documents, or a document against cursor values, by the sort keys
+func compareKeys(t reflect.Type, doc reflect.Value, values []interface{}, keys []Sort) int {
+	doc = reflect.Indirect(doc)
+	for i, k := range keys {
+		f, _ := lookupField(t, k.Field)
+		a, aok := indirectValue(fieldValue(doc, f.Index))
+		b, bok := indirectValue(reflect.ValueOf(values[i]))
+		c := 0
+		switch {
+		case !aok && !bok:
+		case !aok:
+			c = -1
+		case !bok:
+			c = 1
+		default:
+			c = compare(a, b.Interface())
+		}
+		if k.Descending {
+			c = -c
+		}
+		if c != 0 {
+			return c
+		}
+	}
+	return 0
+}
+
+// docSorter sorts documents by a list of sort keys
+type docSorter struct {
+	t    reflect.Type
+	docs []reflect.Value
+	keys []Sort
+}
+
+func (s docSorter) Len() int      { return len(s.docs) }
+func (s docSorter) Swap(i, j int) { s.docs[i], s.docs[j] = s.docs[j], s.docs[i] }
+func (s docSorter) Less(i, j int) bool {
+	return compareKeys(s.t, s.docs[i], keyValues(s.t, s.docs[j], s.keys), s.keys) < 0
+}
+
+// project returns the requested fields of a document, or the document itself when no fields were requested
+func project(t reflect.Type, doc reflect.Value, fields []string) interface{} {
+	if len(fields) == 0 {
+		return doc.Interface()
+	}
+	doc = reflect.Indirect(doc)
+	m := make(map[string]interface{}, len(fields))
+	for _, name := range fields {
+		if f, ok := lookupField(t, name); ok {
+			m[name] = fieldValue(doc, f.Index).Interface()
+		}
+	}
+	return m
+}
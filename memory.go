@@ -0,0 +1,629 @@
+package rest
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"io/ioutil"
+	"net/http"
+	"os"
+	"path/filepath"
+	"reflect"
+	"sort"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+)
+
+// Memory - a thread safe in-memory Storage, documents are keyed by the id field of the resource type
+type Memory struct {
+	*Context
+	store *memoryStore
+}
+
+// memoryStore holds the documents shared by every transaction of a Memory storage
+type memoryStore struct {
+	sync.RWMutex
+	t        reflect.Type
+	id       identity
+	docs     map[string]reflect.Value
+	sequence int64
+	indexes  map[string]index
+	journal  journal
+}
+
+// index maps the keys of a field's values to the ids of the documents holding them
+type index map[string]map[string]bool
+
+// change is a write applied to a memoryStore, either storing Doc under ID or removing ID
+type change struct {
+	ID     string
+	Doc    reflect.Value
+	Remove bool
+}
+
+// journal persists changes before a memoryStore applies them
+type journal interface {
+	write(s *memoryStore, changes []change) error
+}
+
+// NewMemory - creates an empty in-memory storage for documents of type t, it panics when t has no id field.
+// Fields tagged `rest:"index"` are indexed to speed up eq and in filters.
+func NewMemory(t reflect.Type) *Memory {
+	s, err := newMemoryStore(t)
+	if err != nil {
+		panic(err)
+	}
+	return &Memory{store: s}
+}
+
+func newMemoryStore(t reflect.Type) (*memoryStore, error) {
+	for t.Kind() == reflect.Ptr {
+		t = t.Elem()
+	}
+	id, err := resolveIdentity(t)
+	if err != nil {
+		return nil, err
+	}
+	s := &memoryStore{t: t, id: id, docs: make(map[string]reflect.Value), indexes: make(map[string]index)}
+	for _, f := range typeFields(t) {
+		if strings.Split(f.Tag.Get("rest"), ",")[0] == "index" {
+			s.indexes[f.Name] = make(index)
+		}
+	}
+	return s, nil
+}
+
+// UseContext -
+func (m *Memory) UseContext(c *Context) {
+	m.Context = c
+}
+
+// Clone - returns a Memory sharing the documents of m
+func (m *Memory) Clone() Storage {
+	return &Memory{store: m.store}
+}
+
+// fail sets an error response and returns the error
+func (m *Memory) fail(status int, err error) error {
+	m.SetResponseStatus(status)
+	m.SetResponseBody(err.Error())
+	return err
+}
+
+func notFound(id string) error {
+	return fmt.Errorf("Document %q was not found", id)
+}
+
+func conflict(id string) error {
+	return fmt.Errorf("Document %q already exists", id)
+}
+
+var errEmptyBody = errors.New("The request body is empty")
+
+// requestDocument returns the decoded request body as an addressable value of the resource type
+func (m *Memory) requestDocument() (reflect.Value, error) {
+	v := reflect.ValueOf(m.Get(REQUESTBODY))
+	if v.Kind() != reflect.Ptr || v.IsNil() || v.Elem().Type() != m.store.t {
+		return v, m.fail(http.StatusBadRequest, errEmptyBody)
+	}
+	return v.Elem(), nil
+}
+
+// requestID returns the id of the document the transaction addresses
+func (m *Memory) requestID() (string, error) {
+	id, err := m.GetID()
+	if err != nil {
+		return id, m.fail(http.StatusNotFound, err)
+	}
+	// Normalise the id so that e.g. "007" and "7" address the same document.
+	v, err := parseValue(id, m.store.id.Type)
+	if err != nil {
+		return id, m.fail(http.StatusNotFound, notFound(id))
+	}
+	return fmt.Sprint(v), nil
+}
+
+// clone copies a document so that callers can not modify stored documents
+func (s *memoryStore) clone(v reflect.Value) reflect.Value {
+	c := reflect.New(s.t).Elem()
+	c.Set(v)
+	return c
+}
+
+// assign gives a document without an id a new one, the caller must hold the write lock
+func (s *memoryStore) assign(doc reflect.Value) (string, error) {
+	id := s.id.value(doc)
+	if id != "" {
+		if n, err := strconv.ParseInt(id, 10, 64); err == nil && n > s.sequence {
+			s.sequence = n
+		}
+		return id, nil
+	}
+	for {
+		s.sequence++
+		id = s.id.generate(s.sequence)
+		if _, ok := s.docs[id]; !ok {
+			break
+		}
+	}
+	return id, s.id.set(doc, id)
+}
+
+// apply journals and then applies changes, the caller must hold the write lock
+func (s *memoryStore) apply(changes ...change) error {
+	if s.journal != nil {
+		if err := s.journal.write(s, changes); err != nil {
+			return err
+		}
+	}
+	for _, c := range changes {
+		if c.Remove {
+			s.remove(c.ID)
+		} else {
+			s.put(c.ID, c.Doc)
+		}
+	}
+	return nil
+}
+
+// put stores a copy of a document, the caller must hold the write lock
+func (s *memoryStore) put(id string, doc reflect.Value) {
+	s.remove(id)
+	doc = s.clone(doc)
+	s.docs[id] = doc
+	s.reindex(id, doc, true)
+}
+
+// remove deletes a document, the caller must hold the write lock
+func (s *memoryStore) remove(id string) {
+	if doc, ok := s.docs[id]; ok {
+		s.reindex(id, doc, false)
+		delete(s.docs, id)
+	}
+}
+
+// reindex adds or removes a document from the indexes of its fields
+func (s *memoryStore) reindex(id string, doc reflect.Value, add bool) {
+	for name, idx := range s.indexes {
+		f, _ := lookupField(s.t, name)
+		key, ok := indexKey(fieldValue(doc, f.Index))
+		if !ok {
+			continue
+		}
+		switch {
+		case add && idx[key] == nil:
+			idx[key] = map[string]bool{id: true}
+		case add:
+			idx[key][id] = true
+		default:
+			delete(idx[key], id)
+			if len(idx[key]) == 0 {
+				delete(idx, key)
+			}
+		}
+	}
+}
+
+// indexKey returns the key a value is indexed under, ok is false for nil pointers
+func indexKey(v reflect.Value) (string, bool) {
+	v, ok := indirectValue(v)
+	if !ok || !v.IsValid() {
+		return "", false
+	}
+	if t, ok := v.Interface().(time.Time); ok {
+		return t.UTC().Format(time.RFC3339Nano), true
+	}
+	return fmt.Sprint(v.Interface()), true
+}
+
+// candidates returns the ids of the documents that an eq or in filter on an indexed field can match,
+// ok is false when no filter of q uses an index
+func (s *memoryStore) candidates(q *Query) (ids map[string]bool, ok bool) {
+	if q == nil {
+		return nil, false
+	}
+	for _, f := range q.Filters {
+		idx, indexed := s.indexes[f.Field]
+		if !indexed || (f.Operator != EQ && f.Operator != IN) {
+			continue
+		}
+		values := f.Values
+		if f.Operator == EQ {
+			values = []interface{}{f.Value}
+		}
+		found := make(map[string]bool)
+		for _, value := range values {
+			key, _ := indexKey(reflect.ValueOf(value))
+			for id := range idx[key] {
+				found[id] = true
+			}
+		}
+		if !ok || len(found) < len(ids) {
+			ids, ok = found, true
+		}
+	}
+	return ids, ok
+}
+
+// find returns a copy of a document when it exists and matches the query filters
+func (s *memoryStore) find(id string, q *Query) (reflect.Value, bool) {
+	s.RLock()
+	defer s.RUnlock()
+	doc, ok := s.docs[id]
+	if !ok || !newMatcher(s.t, q).Match(doc) {
+		return doc, false
+	}
+	return s.clone(doc), true
+}
+
+// query returns copies of the documents matching q sorted by its sort keys with the id as a tie breaker
+func (s *memoryStore) query(q *Query) ([]reflect.Value, []Sort) {
+	m := newMatcher(s.t, q)
+	s.RLock()
+	docs := make([]reflect.Value, 0, len(s.docs))
+	if ids, ok := s.candidates(q); ok {
+		for id := range ids {
+			if doc := s.docs[id]; m.Match(doc) {
+				docs = append(docs, s.clone(doc))
+			}
+		}
+	} else {
+		for _, doc := range s.docs {
+			if m.Match(doc) {
+				docs = append(docs, s.clone(doc))
+			}
+		}
+	}
+	s.RUnlock()
+	keys := sortKeys(q, s.id.Name)
+	sort.Sort(docSorter{t: s.t, docs: docs, keys: keys})
+	return docs, keys
+}
+
+// window returns the bounds of the page of sorted docs selected by the cursor, offset and limit of q
+func (s *memoryStore) window(docs []reflect.Value, q *Query) (start, end int) {
+	end = len(docs)
+	if q == nil {
+		return start, end
+	}
+	c := q.Cursor
+	if c != nil && c.Previous {
+		end = sort.Search(len(docs), func(i int) bool { return compareKeys(s.t, docs[i], c.Values, c.Sort) >= 0 })
+		end -= q.Offset
+		if end < 0 {
+			end = 0
+		}
+		if q.Limit > 0 && end-q.Limit > 0 {
+			start = end - q.Limit
+		}
+		return start, end
+	}
+	if c != nil {
+		start = sort.Search(len(docs), func(i int) bool { return compareKeys(s.t, docs[i], c.Values, c.Sort) > 0 })
+	}
+	start += q.Offset
+	if start > end {
+		start = end
+	}
+	if q.Limit > 0 && start+q.Limit < end {
+		end = start + q.Limit
+	}
+	return start, end
+}
+
+func (s *memoryStore) items(docs []reflect.Value, q *Query) interface{} {
+	if q != nil && len(q.Fields) > 0 {
+		items := make([]map[string]interface{}, len(docs))
+		for i, doc := range docs {
+			items[i] = project(s.t, doc, q.Fields).(map[string]interface{})
+		}
+		return items
+	}
+	items := reflect.MakeSlice(reflect.SliceOf(s.t), len(docs), len(docs))
+	for i, doc := range docs {
+		items.Index(i).Set(doc)
+	}
+	return items.Interface()
+}
+
+// InsertOne - stores the request body, generating an id when it has none
+func (m *Memory) InsertOne() error {
+	doc, err := m.requestDocument()
+	if err != nil {
+		return err
+	}
+	s := m.store
+	s.Lock()
+	status := http.StatusBadRequest
+	id, err := s.assign(doc)
+	if _, exists := s.docs[id]; err == nil && exists {
+		status, err = http.StatusConflict, conflict(id)
+	}
+	if err == nil {
+		status, err = http.StatusInternalServerError, s.apply(change{ID: id, Doc: doc})
+	}
+	s.Unlock()
+	if err != nil {
+		return m.fail(status, err)
+	}
+	m.SetResponseStatus(http.StatusCreated)
+	m.SetResponseBody(doc.Addr().Interface())
+	return nil
+}
+
+// InsertMany - stores every document of the request body or, when any id already exists, none of them
+func (m *Memory) InsertMany() error {
+	v := reflect.ValueOf(m.Get(REQUESTBODY))
+	if v.Kind() != reflect.Ptr || v.IsNil() || v.Elem().Kind() != reflect.Slice {
+		return m.fail(http.StatusBadRequest, errEmptyBody)
+	}
+	list := v.Elem()
+	s := m.store
+	s.Lock()
+	defer s.Unlock()
+	changes := make([]change, list.Len())
+	seen := make(map[string]bool, list.Len())
+	for i := 0; i < list.Len(); i++ {
+		id, err := s.assign(list.Index(i))
+		if err != nil {
+			return m.fail(http.StatusBadRequest, err)
+		}
+		if _, ok := s.docs[id]; ok || seen[id] {
+			return m.fail(http.StatusConflict, conflict(id))
+		}
+		seen[id] = true
+		changes[i] = change{ID: id, Doc: list.Index(i)}
+	}
+	if err := s.apply(changes...); err != nil {
+		return m.fail(http.StatusInternalServerError, err)
+	}
+	m.SetResponseStatus(http.StatusCreated)
+	m.SetResponseBody(list.Interface())
+	return nil
+}
+
+// InsertBatch - stores the documents of a batched insertMany, ids that already exist are reported as conflicts
+func (m *Memory) InsertBatch(docs interface{}) ([]ItemResult, error) {
+	list := reflect.ValueOf(docs)
+	results := make([]ItemResult, list.Len())
+	s := m.store
+	s.Lock()
+	defer s.Unlock()
+	changes := make([]change, 0, list.Len())
+	seen := make(map[string]bool, list.Len())
+	for i := 0; i < list.Len(); i++ {
+		id, err := s.assign(list.Index(i))
+		_, exists := s.docs[id]
+		switch {
+		case err != nil:
+			results[i] = ItemResult{Status: http.StatusBadRequest, Error: err.Error()}
+		case exists || seen[id]:
+			results[i] = ItemResult{Status: http.StatusConflict, ID: id, Error: conflict(id).Error()}
+		default:
+			seen[id] = true
+			changes = append(changes, change{ID: id, Doc: list.Index(i)})
+			results[i] = ItemResult{Status: http.StatusCreated, ID: id}
+		}
+	}
+	return results, s.apply(changes...)
+}
+
+// FindOne - returns the document addressed by the request id
+func (m *Memory) FindOne() error {
+	id, err := m.requestID()
+	if err != nil {
+		return err
+	}
+	doc, ok := m.store.find(id, m.GetQuery())
+	if !ok {
+		return m.fail(http.StatusNotFound, notFound(id))
+	}
+	m.SetResponseStatus(http.StatusOK)
+	if q := m.GetQuery(); q != nil && len(q.Fields) > 0 {
+		m.SetResponseBody(project(m.store.t, doc, q.Fields))
+		return nil
+	}
+	m.SetResponseBody(doc.Addr().Interface())
+	return nil
+}
+
+// FindMany - returns the documents matching the request query
+func (m *Memory) FindMany() error {
+	q := m.GetQuery()
+	docs, _ := m.store.query(q)
+	start, end := m.store.window(docs, q)
+	m.SetResponseStatus(http.StatusOK)
+	m.SetResponseBody(m.store.items(docs[start:end], q))
+	return nil
+}
+
+// FindStream - returns an Iterator over the documents matching the request query
+func (m *Memory) FindStream() (Iterator, error) {
+	q := m.GetQuery()
+	docs, _ := m.store.query(q)
+	start, end := m.store.window(docs, q)
+	m.SetResponseStatus(http.StatusOK)
+	return NewSliceIterator(m.store.items(docs[start:end], q)), nil
+}
+
+// FindPage - returns a page of the documents matching the request query
+func (m *Memory) FindPage() (*Page, error) {
+	q := m.GetQuery()
+	docs, keys := m.store.query(q)
+	start, end := m.store.window(docs, q)
+	total := int64(len(docs))
+	page := &Page{Items: m.store.items(docs[start:end], q), Sort: keys, Total: &total}
+	if start > 0 && end > start {
+		page.Prev = keyValues(m.store.t, docs[start], keys)
+	}
+	if end < len(docs) && end > start {
+		page.Next = keyValues(m.store.t, docs[end-1], keys)
+	}
+	m.SetResponseStatus(http.StatusOK)
+	return page, nil
+}
+
+// Update - replaces the document addressed by the request id
+func (m *Memory) Update() error {
+	id, err := m.requestID()
+	if err != nil {
+		return err
+	}
+	doc, err := m.requestDocument()
+	if err != nil {
+		return err
+	}
+	if err = m.store.id.set(doc, id); err != nil {
+		return m.fail(http.StatusBadRequest, err)
+	}
+	s := m.store
+	matcher := newMatcher(s.t, m.GetQuery())
+	s.Lock()
+	current, ok := s.docs[id]
+	if ok && matcher.Match(current) {
+		err = s.apply(change{ID: id, Doc: doc})
+	} else {
+		ok = false
+	}
+	s.Unlock()
+	if !ok {
+		return m.fail(http.StatusNotFound, notFound(id))
+	}
+	if err != nil {
+		return m.fail(http.StatusInternalServerError, err)
+	}
+	m.SetResponseStatus(http.StatusNoContent)
+	m.SetResponseBody(nil)
+	return nil
+}
+
+// Upsert - replaces the document addressed by the request id, creating it when it does not exist
+func (m *Memory) Upsert() error {
+	id, err := m.requestID()
+	if err != nil {
+		return err
+	}
+	doc, err := m.requestDocument()
+	if err != nil {
+		return err
+	}
+	if err = m.store.id.set(doc, id); err != nil {
+		return m.fail(http.StatusBadRequest, err)
+	}
+	s := m.store
+	matcher := newMatcher(s.t, m.GetQuery())
+	status := http.StatusOK
+	s.Lock()
+	current, exists := s.docs[id]
+	if exists && !matcher.Match(current) {
+		s.Unlock()
+		return m.fail(http.StatusNotFound, notFound(id))
+	}
+	if !exists {
+		status = http.StatusCreated
+		s.assign(doc)
+	}
+	err = s.apply(change{ID: id, Doc: doc})
+	s.Unlock()
+	if err != nil {
+		return m.fail(http.StatusInternalServerError, err)
+	}
+	m.SetResponseStatus(status)
+	m.SetResponseBody(doc.Addr().Interface())
+	return nil
+}
+
+// Remove - deletes the document addressed by the request id
+func (m *Memory) Remove() error {
+	id, err := m.requestID()
+	if err != nil {
+		return err
+	}
+	s := m.store
+	matcher := newMatcher(s.t, m.GetQuery())
+	s.Lock()
+	current, ok := s.docs[id]
+	if ok && matcher.Match(current) {
+		err = s.apply(change{ID: id, Remove: true})
+	} else {
+		ok = false
+	}
+	s.Unlock()
+	if !ok {
+		return m.fail(http.StatusNotFound, notFound(id))
+	}
+	if err != nil {
+		return m.fail(http.StatusInternalServerError, err)
+	}
+	m.SetResponseStatus(http.StatusNoContent)
+	m.SetResponseBody(nil)
+	return nil
+}
+
+// Len - returns the number of stored documents
+func (m *Memory) Len() int {
+	m.store.RLock()
+	defer m.store.RUnlock()
+	return len(m.store.docs)
+}
+
+// Backup - writes a consistent snapshot of every document to w as a JSON array sorted by id
+func (m *Memory) Backup(w io.Writer) error {
+	docs, _ := m.store.query(nil)
+	b, err := json.MarshalIndent(m.store.items(docs, nil), "", "  ")
+	if err != nil {
+		return err
+	}
+	_, err = w.Write(b)
+	return err
+}
+
+// Save - writes a snapshot of every document to a JSON file, replacing it atomically
+func (m *Memory) Save(path string) error {
+	tmp, err := ioutil.TempFile(filepath.Dir(path), filepath.Base(path))
+	if err != nil {
+		return err
+	}
+	if err = m.Backup(tmp); err == nil {
+		err = tmp.Sync()
+	}
+	if cerr := tmp.Close(); err == nil {
+		err = cerr
+	}
+	if err != nil {
+		os.Remove(tmp.Name())
+		return err
+	}
+	return os.Rename(tmp.Name(), path)
+}
+
+// Load - replaces every document with the contents of a snapshot written by Save
+func (m *Memory) Load(path string) error {
+	b, err := ioutil.ReadFile(path)
+	if err != nil {
+		return err
+	}
+	s := m.store
+	list := reflect.New(reflect.SliceOf(s.t))
+	if err = json.Unmarshal(b, list.Interface()); err != nil {
+		return err
+	}
+	s.Lock()
+	defer s.Unlock()
+	changes := make([]change, 0, len(s.docs)+list.Elem().Len())
+	for id := range s.docs {
+		changes = append(changes, change{ID: id, Remove: true})
+	}
+	for i := 0; i < list.Elem().Len(); i++ {
+		doc := list.Elem().Index(i)
+		id, err := s.assign(doc)
+		if err != nil {
+			return err
+		}
+		changes = append(changes, change{ID: id, Doc: doc})
+	}
+	return s.apply(changes...)
+}
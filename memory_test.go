@@ -0,0 +1,231 @@
+package rest
+
+import (
+	"encoding/json"
+	"io/ioutil"
+	"net/http"
+	"net/http/httptest"
+	"net/url"
+	"os"
+	"path/filepath"
+	"reflect"
+	"strconv"
+	"sync"
+	"testing"
+	"time"
+)
+
+type FakeTodo struct {
+	ID       string    `json:"id" rest:"id"`
+	Title    string    `json:"title"`
+	Priority int       `json:"priority" rest:"index"`
+	Due      time.Time `json:"due"`
+}
+
+type FakeNoopValidator struct {
+	*Context
+}
+
+func (v *FakeNoopValidator) UseContext(c *Context) {
+	v.Context = c
+}
+
+func (v *FakeNoopValidator) Validate() error {
+	return nil
+}
+
+func NewFakeTodoResource(storage Storage) *Resource {
+	return NewResource("todo").
+		UseType(reflect.TypeOf(FakeTodo{})).
+		UseStorage(storage).
+		UseValidator(&FakeNoopValidator{}).
+		UseSerializer(&JSON{})
+}
+
+func serve(handler func(http.ResponseWriter, *http.Request), verb, url, body string) *httptest.ResponseRecorder {
+	w := httptest.NewRecorder()
+	handler(w, NewTestRequest(verb, url, body))
+	return w
+}
+
+func TestMemory(t *testing.T) {
+	service := NewFakeService(FakeScenario{})
+	storage := NewMemory(reflect.TypeOf(FakeTodo{}))
+	resource := NewFakeTodoResource(storage)
+	url := "http://foo.bar/todos"
+	w := serve(service.InsertOne(resource), "POST", url, `{"title": "Milk", "priority": 2}`)
+	if w.Code != http.StatusCreated {
+		t.Fatalf("Error, expected %d, got %d: %s", http.StatusCreated, w.Code, w.Body.String())
+	}
+	var created FakeTodo
+	json.Unmarshal(w.Body.Bytes(), &created)
+	if created.ID == "" {
+		t.Fatalf("Error, expected a generated id, got %s", w.Body.String())
+	}
+	tests := []struct {
+		handler  func(http.ResponseWriter, *http.Request)
+		verb     string
+		url      string
+		body     string
+		expected int
+	}{
+		{service.InsertOne(resource), "POST", url, `{"id": "` + created.ID + `", "title": "Eggs"}`, http.StatusConflict},
+		{service.InsertMany(resource), "POST", url, `[{"id": "b", "title": "Bread", "priority": 1}, {"id": "c", "title": "Cheese", "priority": 3}]`, http.StatusCreated},
+		{service.InsertMany(resource), "POST", url, `[{"id": "d", "title": "Dates"}, {"id": "b", "title": "Bread"}]`, http.StatusConflict},
+		{service.FindOne(resource), "GET", url + "/" + created.ID, "", http.StatusOK},
+		{service.FindOne(resource), "GET", url + "/d", "", http.StatusNotFound},
+		{service.Update(resource), "PUT", url + "/b", `{"title": "Rye bread", "priority": 1}`, http.StatusNoContent},
+		{service.Update(resource), "PUT", url + "/z", `{"title": "Zucchini"}`, http.StatusNotFound},
+		{service.Upsert(resource), "PUT", url + "/e", `{"title": "Eggs"}`, http.StatusCreated},
+		{service.Upsert(resource), "PUT", url + "/e", `{"title": "Free range eggs"}`, http.StatusOK},
+		{service.Remove(resource), "DELETE", url + "/e", "", http.StatusNoContent},
+		{service.Remove(resource), "DELETE", url + "/e", "", http.StatusNotFound},
+	}
+	for i, test := range tests {
+		w := serve(test.handler, test.verb, test.url, test.body)
+		if w.Code != test.expected {
+			t.Errorf("#%d Error, expected %d, got %d for %s %s", i, test.expected, w.Code, test.verb, test.url)
+		}
+	}
+	if storage.Len() != 3 {
+		t.Errorf("Error, expected 3 documents, got %d", storage.Len())
+	}
+	w = serve(service.FindMany(resource), "GET", url+"?priority[gte]=2&sort=-priority", "")
+	var found []FakeTodo
+	json.Unmarshal(w.Body.Bytes(), &found)
+	if len(found) != 2 || found[0].Title != "Cheese" || found[1].Title != "Milk" {
+		t.Errorf("Error, unexpected findMany result %s", w.Body.String())
+	}
+	w = serve(service.FindMany(resource), "GET", url+"?title[like]=%25bread&fields=title", "")
+	if w.Body.String() != `[{"title":"Rye bread"}]` {
+		t.Errorf("Error, unexpected projection %s", w.Body.String())
+	}
+}
+
+func TestMemoryConcurrentModels(t *testing.T) {
+	storage := NewMemory(reflect.TypeOf(FakeTodo{}))
+	resource := NewFakeTodoResource(storage)
+	serve(NewFakeService(FakeScenario{}).InsertMany(resource), "POST", "http://foo.bar/todos", `[{"id": "1"}, {"id": "2"}, {"id": "3"}, {"id": "4"}]`)
+	var wg sync.WaitGroup
+	found := make([]string, 16)
+	for i := range found {
+		wg.Add(1)
+		go func(i int) {
+			defer wg.Done()
+			model := &Model{Context: NewContext()}
+			model.Set(ID, strconv.Itoa(i%4+1))
+			model.Set(RESPONSE, Response{})
+			model.UseStorage(resource.Storage)
+			if model.FindOne() == nil {
+				found[i] = model.GetResponse().Body.(*FakeTodo).ID
+			}
+		}(i)
+	}
+	wg.Wait()
+	for i, id := range found {
+		if id != strconv.Itoa(i%4+1) {
+			t.Errorf("#%d Error, expected the document %d, got %q", i, i%4+1, id)
+		}
+	}
+}
+
+func TestMemoryPages(t *testing.T) {
+	service := NewFakeService(FakeScenario{})
+	storage := NewMemory(reflect.TypeOf(FakeTodo{}))
+	resource := NewFakeTodoResource(storage).UsePagination(NewPagination(2, 10).UseEnvelope(true))
+	serve(service.InsertMany(resource), "POST", "http://foo.bar/todos", `[{"id": "a", "priority": 1}, {"id": "b", "priority": 2}, {"id": "c", "priority": 2}, {"id": "d", "priority": 3}, {"id": "e", "priority": 5}]`)
+	var ids []string
+	var envelope struct {
+		Data []FakeTodo `json:"data"`
+		Page PageInfo   `json:"page"`
+	}
+	url := "http://foo.bar/todos?sort=-priority"
+	for page := 0; page < 5; page++ {
+		w := serve(service.FindMany(resource), "GET", url, "")
+		envelope.Page = PageInfo{}
+		json.Unmarshal(w.Body.Bytes(), &envelope)
+		for _, todo := range envelope.Data {
+			ids = append(ids, todo.ID)
+		}
+		if envelope.Page.Next == "" {
+			break
+		}
+		url = "http://foo.bar/todos?sort=-priority&cursor=" + envelope.Page.Next
+	}
+	if !reflect.DeepEqual(ids, []string{"e", "d", "b", "c", "a"}) {
+		t.Errorf("Error, unexpected page order %v", ids)
+	}
+	w := serve(service.FindMany(resource), "GET", "http://foo.bar/todos?sort=-priority&cursor="+envelope.Page.Prev, "")
+	json.Unmarshal(w.Body.Bytes(), &envelope)
+	if len(envelope.Data) != 2 || envelope.Data[0].ID != "b" || envelope.Data[1].ID != "c" {
+		t.Errorf("Error, unexpected previous page %s", w.Body.String())
+	}
+}
+
+func TestMemoryIndex(t *testing.T) {
+	service := NewFakeService(FakeScenario{})
+	storage := NewMemory(reflect.TypeOf(FakeTodo{}))
+	resource := NewFakeTodoResource(storage)
+	serve(service.InsertMany(resource), "POST", "http://foo.bar/todos", `[{"id": "a", "priority": 1}, {"id": "b", "priority": 2}, {"id": "c", "priority": 2}]`)
+	serve(service.Update(resource), "PUT", "http://foo.bar/todos/c", `{"priority": 3}`)
+	tests := []struct {
+		query    string
+		expected []string
+	}{
+		{"priority=2", []string{"b"}},
+		{"priority[in]=1,3", []string{"a", "c"}},
+		{"priority[in]=1,3&id[ne]=a", []string{"c"}},
+		{"priority=4", []string{}},
+	}
+	for i, test := range tests {
+		values, _ := url.ParseQuery(test.query)
+		q, _ := ParseQuery(values, storage.store.t)
+		ids, ok := storage.store.candidates(q)
+		if !ok || len(ids) < len(test.expected) {
+			t.Errorf("#%d Error, expected the index to select %v, got %v", i, test.expected, ids)
+		}
+		w := serve(service.FindMany(resource), "GET", "http://foo.bar/todos?"+test.query, "")
+		var found []FakeTodo
+		json.Unmarshal(w.Body.Bytes(), &found)
+		got := []string{}
+		for _, todo := range found {
+			got = append(got, todo.ID)
+		}
+		if !reflect.DeepEqual(got, test.expected) {
+			t.Errorf("#%d Error, expected %v, got %v", i, test.expected, got)
+		}
+	}
+}
+
+func TestMemorySnapshot(t *testing.T) {
+	dir, err := ioutil.TempDir("", "rest")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.RemoveAll(dir)
+	service := NewFakeService(FakeScenario{})
+	storage := NewMemory(reflect.TypeOf(FakeTodo{}))
+	serve(service.InsertMany(NewFakeTodoResource(storage)), "POST", "http://foo.bar/todos", `[{"title": "Milk"}, {"title": "Eggs", "due": "2017-01-02T15:04:05Z"}]`)
+	path := filepath.Join(dir, "todos.json")
+	if err = storage.Save(path); err != nil {
+		t.Fatalf("Error, unexpected error %s", err)
+	}
+	loaded := NewMemory(reflect.TypeOf(FakeTodo{}))
+	if err = loaded.Load(path); err != nil {
+		t.Fatalf("Error, unexpected error %s", err)
+	}
+	a, _ := storage.store.query(nil)
+	b, _ := loaded.store.query(nil)
+	if !reflect.DeepEqual(storage.store.items(a, nil), loaded.store.items(b, nil)) {
+		t.Errorf("Error, the loaded snapshot differs from the saved documents")
+	}
+}
+
+func TestMemoryWithoutID(t *testing.T) {
+	defer func() {
+		if recover() == nil {
+			t.Errorf("Error, expected NewMemory to panic for a type without an id field")
+		}
+	}()
+	NewMemory(reflect.TypeOf(FakeFields{}))
+}
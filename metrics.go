@@ -40,6 +40,13 @@ func (sm *ServiceMetrics) UseTags(tags []string) *ServiceMetrics {
 	return sm
 }
 
+// WithTags - returns a copy recording metrics with additional tags
+func (sm *ServiceMetrics) WithTags(tags ...string) Metrics {
+	m := *sm
+	m.Tags = append(append([]string{}, sm.Tags...), tags...)
+	return &m
+}
+
 // Incr - record an increment by count
 func (sm *ServiceMetrics) Incr(stat string, count int64) error {
 	err := sm.Client.Incr(stat, sm.Tags, float64(count))
@@ -4,6 +4,7 @@ import (
 	"errors"
 	"net/http"
 	"reflect"
+	"strings"
 )
 
 // Serializer - could be used for JSON marshalling and unmarshalling
@@ -31,6 +32,26 @@ type Storage interface {
 	UseContext(*Context)
 }
 
+// StorageCloner - optional Storage extension returning a copy that shares the stored documents. Storage holding the
+// context of a transaction implements it so that every model gets its own copy and concurrent requests do not share it.
+type StorageCloner interface {
+	Clone() Storage
+}
+
+// SerializerCloner - optional Serializer extension returning a copy with the same options. Serializers holding the
+// context of a request implement it so that every model gets its own copy, types embedding one of them should
+// implement it too.
+type SerializerCloner interface {
+	Clone() Serializer
+}
+
+// ValidatorCloner - optional Validator extension returning a copy with the same rules. Validators holding the
+// context of a request implement it so that every model gets its own copy, types embedding one of them should
+// implement it too.
+type ValidatorCloner interface {
+	Clone() Validator
+}
+
 // Response - holds the data to be sent to the client
 type Response struct {
 	Body    interface{}
@@ -45,6 +66,8 @@ type Model struct {
 	Storage
 	Validator
 	Serializer
+	Encoder    Serializer
+	Authorizer Authorizer
 }
 
 const (
@@ -78,7 +101,7 @@ func (model *Model) Execute(action string) error {
 	case action == FINDONE:
 		return model.FindOne()
 	case action == FINDMANY:
-		return model.FindMany()
+		return model.findMany()
 	case action == REMOVE:
 		return model.Remove()
 	}
@@ -87,44 +110,114 @@ func (model *Model) Execute(action string) error {
 
 // UseStorage -
 func (model *Model) UseStorage(s Storage) {
+	if c, ok := s.(StorageCloner); ok {
+		s = c.Clone()
+	}
 	s.UseContext(&model.Context)
 	model.Storage = s
 }
 
 // UseSerializer -
 func (model *Model) UseSerializer(s Serializer) {
+	s = cloneSerializer(s)
 	s.UseContext(&model.Context)
 	model.Serializer = s
 }
 
+// UseEncoder - sets the serializer encoding the response, it can differ from the one decoding the request
+func (model *Model) UseEncoder(s Serializer) {
+	s = cloneSerializer(s)
+	s.UseContext(&model.Context)
+	model.Encoder = s
+}
+
+// cloneSerializer returns a copy of s for one model when it implements SerializerCloner. A Clone promoted from an
+// embedded serializer returns another type, which would drop the methods of s, so s is kept as is then.
+func cloneSerializer(s Serializer) Serializer {
+	if c, ok := s.(SerializerCloner); ok {
+		if clone := c.Clone(); reflect.TypeOf(clone) == reflect.TypeOf(s) {
+			return clone
+		}
+	}
+	return s
+}
+
+// cloneValidator returns a copy of v for one model when it implements ValidatorCloner, keeping v when the Clone is
+// promoted from an embedded validator
+func cloneValidator(v Validator) Validator {
+	if c, ok := v.(ValidatorCloner); ok {
+		if clone := c.Clone(); reflect.TypeOf(clone) == reflect.TypeOf(v) {
+			return clone
+		}
+	}
+	return v
+}
+
 // UseValidator -
 func (model *Model) UseValidator(s Validator) {
+	s = cloneValidator(s)
 	s.UseContext(&model.Context)
 	model.Validator = s
 }
 
 // Resource -
 type Resource struct {
-	Name       string
-	Type       reflect.Type
-	Headers    map[string][]string
-	Storage    Storage
-	Validator  Validator
-	Serializer Serializer
+	Name          string
+	Type          reflect.Type
+	Headers       map[string][]string
+	Storage       Storage
+	Validator     Validator
+	Serializer    Serializer
+	Serializers   map[string]Serializer
+	Pagination    *Pagination
+	Streaming     bool
+	BatchSize     int
+	DecodeOptions *DecodeOptions
+	Links         map[string]string
+	Hooks         map[string][]Hook
+	Authenticator Authenticator
+	Authorizer    Authorizer
+	TenantStorage func(tenant string) (Storage, error)
+	TenantField   string
+	RateLimits    map[string][]*RateLimit
 }
 
 // NewModel -
 func (r *Resource) NewModel(req *http.Request, action string) *Model {
 	model := Model{}
 	model.Name = r.Name
+	model.Authorizer = r.Authorizer
 	model.Context = NewContext()
 	model.Context.Set("action", action)
 	model.Context.Set("request", req)
 	model.Context.Set("response", Response{Headers: r.Headers})
 	model.Context.Set("type", r.Type)
+	model.Context.Set(NAME, r.Name)
+	if r.Pagination != nil {
+		model.Context.Set(PAGINATION, r.Pagination)
+	}
+	if r.Streaming {
+		model.Context.Set(STREAMING, true)
+	}
+	if r.BatchSize > 0 {
+		model.Context.Set(BATCHSIZE, r.BatchSize)
+	}
+	if len(r.Links) > 0 {
+		model.Context.Set(LINKS, r.Links)
+	}
+	if r.TenantField != "" {
+		model.Context.Set(TENANTFIELD, r.TenantField)
+	}
+	if r.DecodeOptions != nil {
+		model.Context.Set(DECODEOPTIONS, r.DecodeOptions)
+	}
+	if len(r.Serializers) > 0 {
+		model.Context.Set(SERIALIZERS, r.Serializers)
+	}
 	model.UseStorage(r.Storage)
 	model.UseValidator(r.Validator)
 	model.UseSerializer(r.Serializer)
+	model.UseEncoder(r.Serializer)
 	return &model
 }
 
@@ -158,6 +251,56 @@ func (r *Resource) UseSerializer(s Serializer) *Resource {
 	return r
 }
 
+// AddSerializer - registers a serializer for a media type such as "application/xml", request bodies are decoded
+// by the serializer matching their Content-Type and responses encoded by the best match of the Accept header.
+// The first serializer added becomes the default when none was set with UseSerializer.
+func (r *Resource) AddSerializer(mediaType string, s Serializer) *Resource {
+	if r.Serializers == nil {
+		r.Serializers = make(map[string]Serializer)
+	}
+	r.Serializers[strings.ToLower(mediaType)] = s
+	if r.Serializer == nil {
+		r.Serializer = s
+	}
+	return r
+}
+
+// UsePagination - enable cursor pagination of findMany for storage that implements Paginated
+func (r *Resource) UsePagination(p *Pagination) *Resource {
+	r.Pagination = p
+	return r
+}
+
+// UseStreaming - stream findMany results from storage that implements Streaming, serializers
+// that implement StreamEncoder write documents as they are read and the others once all are read
+func (r *Resource) UseStreaming(streaming bool) *Resource {
+	r.Streaming = streaming
+	return r
+}
+
+// UseBatchSize - ingest insertMany records one at a time and store them n at a time, for storage that implements
+// BulkStorage and serializers that implement RecordDecoder. The response reports the outcome of every record.
+func (r *Resource) UseBatchSize(n int) *Resource {
+	r.BatchSize = n
+	return r
+}
+
+// UseDecodeOptions - decode JSON request bodies strictly, see DecodeOptions
+func (r *Resource) UseDecodeOptions(o *DecodeOptions) *Resource {
+	r.DecodeOptions = o
+	return r
+}
+
+// AddLink - declares a link to a related resource, the {field} placeholders of the template such as
+// "/people/{author}" are replaced with the values of the document's fields. HAL adds the link to every document.
+func (r *Resource) AddLink(rel, template string) *Resource {
+	if r.Links == nil {
+		r.Links = make(map[string]string)
+	}
+	r.Links[rel] = template
+	return r
+}
+
 // NewResource -
 func NewResource(name string) *Resource {
 	r := &Resource{Name: name}
@@ -0,0 +1,366 @@
+package rest
+
+import (
+	"encoding/binary"
+	"math"
+	"reflect"
+	"time"
+)
+
+// MsgPack - a Serializer for application/msgpack, field names follow the `json` struct tags
+// and times use the MessagePack timestamp extension
+type MsgPack struct {
+	*Context
+}
+
+// UseContext -
+func (m *MsgPack) UseContext(c *Context) {
+	m.Context = c
+}
+
+// Clone - returns a MessagePack serializer for another request
+func (m *MsgPack) Clone() Serializer {
+	return &MsgPack{}
+}
+
+// Decode -
+func (m *MsgPack) Decode() error {
+	return decodeBody(m.Context, UnmarshalMsgPack)
+}
+
+// Encode -
+func (m *MsgPack) Encode(v interface{}) ([]byte, error) {
+	return MarshalMsgPack(v)
+}
+
+// MarshalMsgPack - returns the MessagePack encoding of v
+func MarshalMsgPack(v interface{}) ([]byte, error) {
+	w := &msgpackWriter{}
+	err := encodeValue(w, reflect.ValueOf(v))
+	return w.b, err
+}
+
+// UnmarshalMsgPack - decodes MessagePack data into the value pointed to by v
+func UnmarshalMsgPack(data []byte, v interface{}) error {
+	rv, err := unmarshalInto(v)
+	if err != nil {
+		return err
+	}
+	r := &msgpackReader{b: data}
+	if err = r.readValue(rv); err != nil {
+		return err
+	}
+	if r.off != len(r.b) {
+		return errTrailing
+	}
+	return nil
+}
+
+// msgpackTimestamp - the extension type of timestamps
+const msgpackTimestamp = -1
+
+type msgpackWriter struct {
+	b []byte
+}
+
+func (w *msgpackWriter) put(c byte, n uint64, size int) {
+	w.b = append(w.b, c)
+	for i := size - 1; i >= 0; i-- {
+		w.b = append(w.b, byte(n>>(8*uint(i))))
+	}
+}
+
+func (w *msgpackWriter) writeNil() {
+	w.b = append(w.b, 0xc0)
+}
+
+func (w *msgpackWriter) writeBool(b bool) {
+	if b {
+		w.b = append(w.b, 0xc3)
+		return
+	}
+	w.b = append(w.b, 0xc2)
+}
+
+func (w *msgpackWriter) writeInt(n int64) {
+	switch {
+	case n >= 0:
+		w.writeUint(uint64(n))
+	case n >= -32:
+		w.b = append(w.b, byte(n))
+	case n >= math.MinInt8:
+		w.put(0xd0, uint64(n), 1)
+	case n >= math.MinInt16:
+		w.put(0xd1, uint64(n), 2)
+	case n >= math.MinInt32:
+		w.put(0xd2, uint64(n), 4)
+	default:
+		w.put(0xd3, uint64(n), 8)
+	}
+}
+
+func (w *msgpackWriter) writeUint(n uint64) {
+	switch {
+	case n <= 0x7f:
+		w.b = append(w.b, byte(n))
+	case n <= math.MaxUint8:
+		w.put(0xcc, n, 1)
+	case n <= math.MaxUint16:
+		w.put(0xcd, n, 2)
+	case n <= math.MaxUint32:
+		w.put(0xce, n, 4)
+	default:
+		w.put(0xcf, n, 8)
+	}
+}
+
+func (w *msgpackWriter) writeFloat(f float64, bits int) {
+	if bits == 32 {
+		w.put(0xca, uint64(math.Float32bits(float32(f))), 4)
+		return
+	}
+	w.put(0xcb, math.Float64bits(f), 8)
+}
+
+func (w *msgpackWriter) writeString(s string) {
+	n := uint64(len(s))
+	switch {
+	case n < 32:
+		w.b = append(w.b, 0xa0|byte(n))
+	case n <= math.MaxUint8:
+		w.put(0xd9, n, 1)
+	case n <= math.MaxUint16:
+		w.put(0xda, n, 2)
+	default:
+		w.put(0xdb, n, 4)
+	}
+	w.b = append(w.b, s...)
+}
+
+func (w *msgpackWriter) writeBytes(b []byte) {
+	n := uint64(len(b))
+	switch {
+	case n <= math.MaxUint8:
+		w.put(0xc4, n, 1)
+	case n <= math.MaxUint16:
+		w.put(0xc5, n, 2)
+	default:
+		w.put(0xc6, n, 4)
+	}
+	w.b = append(w.b, b...)
+}
+
+// writeTime uses the 96 bit timestamp format which holds any time.Time to the nanosecond
+func (w *msgpackWriter) writeTime(t time.Time) {
+	w.b = append(w.b, 0xc7, 12, byte(0xff&msgpackTimestamp))
+	w.b = append(w.b, 0, 0, 0, 0, 0, 0, 0, 0, 0, 0, 0, 0)
+	binary.BigEndian.PutUint32(w.b[len(w.b)-12:], uint32(t.Nanosecond()))
+	binary.BigEndian.PutUint64(w.b[len(w.b)-8:], uint64(t.Unix()))
+}
+
+func (w *msgpackWriter) writeArrayHeader(n int) {
+	switch {
+	case n < 16:
+		w.b = append(w.b, 0x90|byte(n))
+	case n <= math.MaxUint16:
+		w.put(0xdc, uint64(n), 2)
+	default:
+		w.put(0xdd, uint64(n), 4)
+	}
+}
+
+func (w *msgpackWriter) writeMapHeader(n int) {
+	switch {
+	case n < 16:
+		w.b = append(w.b, 0x80|byte(n))
+	case n <= math.MaxUint16:
+		w.put(0xde, uint64(n), 2)
+	default:
+		w.put(0xdf, uint64(n), 4)
+	}
+}
+
+type msgpackReader struct {
+	b     []byte
+	off   int
+	depth int
+}
+
+func (r *msgpackReader) more(i, n int) bool {
+	return i < n
+}
+
+func (r *msgpackReader) next(n int) ([]byte, error) {
+	if n < 0 || len(r.b)-r.off < n {
+		return nil, errTruncated
+	}
+	b := r.b[r.off : r.off+n]
+	r.off += n
+	return b, nil
+}
+
+// uint reads a big endian unsigned integer of size bytes
+func (r *msgpackReader) uint(size int) (uint64, error) {
+	b, err := r.next(size)
+	var n uint64
+	for _, c := range b {
+		n = n<<8 | uint64(c)
+	}
+	return n, err
+}
+
+// length reads a length of size bytes, checking that at least min bytes per item remain
+func (r *msgpackReader) length(size, min int) (int, error) {
+	n, err := r.uint(size)
+	if err == nil && n*uint64(min) > uint64(len(r.b)-r.off) {
+		err = errTruncated
+	}
+	return int(n), err
+}
+
+func (r *msgpackReader) readValue(v reflect.Value) error {
+	if r.off >= len(r.b) {
+		return errTruncated
+	}
+	c := r.b[r.off]
+	if c == 0xc0 {
+		r.off++
+		return setNil(v)
+	}
+	if v.Kind() == reflect.Ptr {
+		if v.IsNil() {
+			v.Set(reflect.New(v.Type().Elem()))
+		}
+		return r.readValue(v.Elem())
+	}
+	r.off++
+	switch {
+	case c <= 0x7f:
+		return setUint(v, uint64(c))
+	case c >= 0xe0:
+		return setInt(v, int64(int8(c)))
+	case c&0xf0 == 0x80:
+		return r.readMap(v, int(c&0x0f))
+	case c&0xf0 == 0x90:
+		return r.readArray(v, int(c&0x0f))
+	case c&0xe0 == 0xa0:
+		return r.readString(v, int(c&0x1f))
+	}
+	switch c {
+	case 0xc2, 0xc3:
+		return setBool(v, c == 0xc3)
+	case 0xc4, 0xc5, 0xc6:
+		n, err := r.length(1<<(c-0xc4), 1)
+		if err != nil {
+			return err
+		}
+		b, _ := r.next(n)
+		return setBytes(v, b)
+	case 0xc7, 0xc8, 0xc9:
+		n, err := r.length(1<<(c-0xc7), 1)
+		if err != nil {
+			return err
+		}
+		return r.readExt(v, n)
+	case 0xca:
+		n, err := r.uint(4)
+		if err != nil {
+			return err
+		}
+		return setFloat(v, float64(math.Float32frombits(uint32(n))))
+	case 0xcb:
+		n, err := r.uint(8)
+		if err != nil {
+			return err
+		}
+		return setFloat(v, math.Float64frombits(n))
+	case 0xcc, 0xcd, 0xce, 0xcf:
+		n, err := r.uint(1 << (c - 0xcc))
+		if err != nil {
+			return err
+		}
+		return setUint(v, n)
+	case 0xd0, 0xd1, 0xd2, 0xd3:
+		size := 1 << (c - 0xd0)
+		n, err := r.uint(size)
+		if err != nil {
+			return err
+		}
+		// Sign extend the value read into the low bytes.
+		shift := uint(64 - 8*size)
+		return setInt(v, int64(n<<shift)>>shift)
+	case 0xd4, 0xd5, 0xd6, 0xd7, 0xd8:
+		return r.readExt(v, 1<<(c-0xd4))
+	case 0xd9, 0xda, 0xdb:
+		n, err := r.length(1<<(c-0xd9), 1)
+		if err != nil {
+			return err
+		}
+		return r.readString(v, n)
+	case 0xdc, 0xdd:
+		n, err := r.length(2<<(c-0xdc), 1)
+		if err != nil {
+			return err
+		}
+		return r.readArray(v, n)
+	case 0xde, 0xdf:
+		n, err := r.length(2<<(c-0xde), 2)
+		if err != nil {
+			return err
+		}
+		return r.readMap(v, n)
+	}
+	return typeError("the MessagePack type 0xc1", v)
+}
+
+func (r *msgpackReader) readString(v reflect.Value, n int) error {
+	b, err := r.next(n)
+	if err != nil {
+		return err
+	}
+	return setString(v, string(b))
+}
+
+// readExt reads the type and n data bytes of an extension, only timestamps are supported
+func (r *msgpackReader) readExt(v reflect.Value, n int) error {
+	typ, err := r.next(1)
+	if err != nil {
+		return err
+	}
+	data, err := r.next(n)
+	if err != nil {
+		return err
+	}
+	if int8(typ[0]) != msgpackTimestamp {
+		return typeError("a MessagePack extension", v)
+	}
+	var t time.Time
+	switch n {
+	case 4:
+		t = time.Unix(int64(binary.BigEndian.Uint32(data)), 0)
+	case 8:
+		n := binary.BigEndian.Uint64(data)
+		t = time.Unix(int64(n&0x3ffffffff), int64(n>>34))
+	case 12:
+		t = time.Unix(int64(binary.BigEndian.Uint64(data[4:])), int64(binary.BigEndian.Uint32(data)))
+	default:
+		return typeError("a malformed timestamp", v)
+	}
+	return setTime(v, t.UTC())
+}
+
+func (r *msgpackReader) readArray(v reflect.Value, n int) error {
+	if r.depth++; r.depth > maxDepth {
+		return errTooDeep
+	}
+	defer func() { r.depth-- }()
+	return readArray(r, v, n)
+}
+
+func (r *msgpackReader) readMap(v reflect.Value, n int) error {
+	if r.depth++; r.depth > maxDepth {
+		return errTooDeep
+	}
+	defer func() { r.depth-- }()
+	return readMap(r, v, n)
+}
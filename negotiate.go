@@ -0,0 +1,119 @@
+package rest
+
+import (
+	"fmt"
+	"mime"
+	"net/http"
+	"sort"
+	"strconv"
+	"strings"
+)
+
+// mediaRange is one entry of an Accept header
+type mediaRange struct {
+	MediaType string
+	Q         float64
+}
+
+// parseAccept returns the media ranges of an Accept header, skipping malformed entries
+func parseAccept(header string) []mediaRange {
+	var ranges []mediaRange
+	for _, part := range strings.Split(header, ",") {
+		mediaType, params, err := mime.ParseMediaType(strings.TrimSpace(part))
+		if err != nil || !strings.Contains(mediaType, "/") {
+			continue
+		}
+		q := 1.0
+		if v, ok := params["q"]; ok {
+			if q, err = strconv.ParseFloat(v, 64); err != nil || q < 0 || q > 1 {
+				continue
+			}
+		}
+		ranges = append(ranges, mediaRange{MediaType: mediaType, Q: q})
+	}
+	return ranges
+}
+
+// quality returns the q-value the most specific matching range gives a media type, 0 when nothing matches
+func quality(ranges []mediaRange, mediaType string) float64 {
+	q, specificity := 0.0, -1
+	major := strings.SplitN(mediaType, "/", 2)[0]
+	for _, r := range ranges {
+		s := -1
+		switch {
+		case r.MediaType == mediaType:
+			s = 2
+		case r.MediaType == major+"/*":
+			s = 1
+		case r.MediaType == "*/*":
+			s = 0
+		}
+		if s > specificity {
+			q, specificity = r.Q, s
+		}
+	}
+	return q
+}
+
+// mediaTypes returns the registered media types, the one of the default serializer first and the rest sorted
+func mediaTypes(serializers map[string]Serializer, def Serializer) []string {
+	types := make([]string, 0, len(serializers))
+	for mediaType := range serializers {
+		types = append(types, mediaType)
+	}
+	sort.Strings(types)
+	for i, mediaType := range types {
+		if serializers[mediaType] == def {
+			copy(types[1:i+1], types[:i])
+			types[0] = mediaType
+			break
+		}
+	}
+	return types
+}
+
+// Negotiate - chooses the serializer decoding the request body by its Content-Type and the serializer
+// encoding the response by the Accept header, answering 415 or 406 when the resource supports neither
+func (model *Model) Negotiate() error {
+	serializers, _ := model.Get(SERIALIZERS).(map[string]Serializer)
+	if len(serializers) == 0 {
+		return nil
+	}
+	r := model.GetRequest()
+	types := mediaTypes(serializers, model.Serializer)
+	model.AddResponseHeader("Vary", "Accept")
+	model.SetResponseHeader("Content-Type", types[0])
+	model.UseEncoder(serializers[types[0]])
+	if accept := r.Header.Get("Accept"); accept != "" {
+		ranges := parseAccept(accept)
+		best, q := "", 0.0
+		for _, mediaType := range types {
+			if mq := quality(ranges, mediaType); mq > q {
+				best, q = mediaType, mq
+			}
+		}
+		if best == "" {
+			err := fmt.Errorf("None of the media types %q are available, use one of %s", accept, strings.Join(types, ", "))
+			model.SetResponseStatus(http.StatusNotAcceptable)
+			model.SetResponseBody(err.Error())
+			return err
+		}
+		model.SetResponseHeader("Content-Type", best)
+		model.UseEncoder(serializers[best])
+	}
+	if r.Method != "POST" && r.Method != "PUT" && r.Method != "PATCH" {
+		return nil
+	}
+	if contentType := r.Header.Get("Content-Type"); contentType != "" {
+		mediaType, _, err := mime.ParseMediaType(contentType)
+		decoder, ok := serializers[mediaType]
+		if err != nil || !ok {
+			err = fmt.Errorf("The media type %q is not supported, use one of %s", contentType, strings.Join(types, ", "))
+			model.SetResponseStatus(http.StatusUnsupportedMediaType)
+			model.SetResponseBody(err.Error())
+			return err
+		}
+		model.UseSerializer(decoder)
+	}
+	return nil
+}
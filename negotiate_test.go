@@ -0,0 +1,149 @@
+package rest
+
+import (
+	"fmt"
+	"net/http"
+	"net/http/httptest"
+	"reflect"
+	"strings"
+	"sync"
+	"testing"
+)
+
+// FakeText - encodes responses with fmt and can not decode request bodies
+type FakeText struct {
+	*Context
+}
+
+func (f *FakeText) UseContext(c *Context) {
+	f.Context = c
+}
+
+func (f *FakeText) Decode() error {
+	return nil
+}
+
+func (f *FakeText) Encode(v interface{}) ([]byte, error) {
+	return []byte(fmt.Sprint(v)), nil
+}
+
+func TestParseAccept(t *testing.T) {
+	ranges := parseAccept("text/*;q=0.3, text/plain;q=0.7, bogus, application/json, */*;q=0.1, image/png;q=2")
+	expected := []mediaRange{{"text/*", 0.3}, {"text/plain", 0.7}, {"application/json", 1}, {"*/*", 0.1}}
+	if !reflect.DeepEqual(ranges, expected) {
+		t.Errorf("Error, expected %v, got %v", expected, ranges)
+	}
+	tests := []struct {
+		mediaType string
+		expected  float64
+	}{
+		{"text/plain", 0.7},
+		{"text/html", 0.3},
+		{"application/json", 1},
+		{"application/xml", 0.1},
+	}
+	for _, test := range tests {
+		if q := quality(ranges, test.mediaType); q != test.expected {
+			t.Errorf("Error, expected %s to have q=%v, got %v", test.mediaType, test.expected, q)
+		}
+	}
+}
+
+func TestNegotiate(t *testing.T) {
+	service := NewFakeService(FakeScenario{})
+	resource := NewFakeTodoResource(NewMemory(reflect.TypeOf(FakeTodo{}))).
+		AddSerializer("application/json", &JSON{}).
+		AddSerializer("text/plain", &FakeText{})
+	resource.Serializer = resource.Serializers["application/json"]
+	tests := []struct {
+		verb        string
+		accept      string
+		contentType string
+		expected    int
+		mediaType   string
+	}{
+		{"GET", "", "", http.StatusOK, "application/json"},
+		{"GET", "text/plain", "", http.StatusOK, "text/plain"},
+		{"GET", "text/*;q=0.9, application/json;q=0.5", "", http.StatusOK, "text/plain"},
+		{"GET", "text/plain;q=0, */*", "", http.StatusOK, "application/json"},
+		{"GET", "*/*", "", http.StatusOK, "application/json"},
+		{"GET", "application/xml", "", http.StatusNotAcceptable, "application/json"},
+		{"GET", "", "application/xml", http.StatusOK, "application/json"},
+		{"POST", "", "application/json; charset=utf-8", http.StatusCreated, "application/json"},
+		{"POST", "text/plain", "application/json", http.StatusCreated, "text/plain"},
+		{"POST", "", "application/xml", http.StatusUnsupportedMediaType, "application/json"},
+	}
+	for i, test := range tests {
+		handler := service.FindMany(resource)
+		if test.verb == "POST" {
+			handler = service.InsertOne(resource)
+		}
+		r := NewTestRequest(test.verb, "http://foo.bar/todos", `{"title": "Milk"}`)
+		if test.accept != "" {
+			r.Header.Set("Accept", test.accept)
+		}
+		if test.contentType != "" {
+			r.Header.Set("Content-Type", test.contentType)
+		}
+		w := httptest.NewRecorder()
+		handler(w, r)
+		if w.Code != test.expected {
+			t.Errorf("#%d Error, expected %d, got %d: %s", i, test.expected, w.Code, w.Body.String())
+		}
+		if w.Header().Get("Content-Type") != test.mediaType {
+			t.Errorf("#%d Error, expected the Content-Type %s, got %s", i, test.mediaType, w.Header().Get("Content-Type"))
+		}
+		if w.Header().Get("Vary") != "Accept" {
+			t.Errorf("#%d Error, expected Vary: Accept, got %q", i, w.Header().Get("Vary"))
+		}
+	}
+}
+
+// FakeStatelessValidator - passes every request without keeping its context
+type FakeStatelessValidator struct{}
+
+func (v FakeStatelessValidator) UseContext(c *Context) {}
+
+func (v FakeStatelessValidator) Validate() error {
+	return nil
+}
+
+func TestSerializersConcurrentRequests(t *testing.T) {
+	service := NewFakeService(FakeScenario{})
+	resource := NewResource("todo").
+		UseType(reflect.TypeOf(FakeTodo{})).
+		UseStorage(NewMemory(reflect.TypeOf(FakeTodo{}))).
+		UseValidator(FakeStatelessValidator{}).
+		AddSerializer("application/json", &JSON{}).
+		AddSerializer("application/xml", &XML{Root: "todo"})
+	resource.Serializer = resource.Serializers["application/json"]
+	codes := make([]int, 50)
+	bodies := make([]string, 50)
+	var wg sync.WaitGroup
+	for i := range codes {
+		wg.Add(1)
+		go func(i int) {
+			defer wg.Done()
+			mediaType, body := "application/json", fmt.Sprintf(`{"title": "Todo %d"}`, i)
+			if i%2 == 1 {
+				mediaType, body = "application/xml", fmt.Sprintf(`<todo><Title>Todo %d</Title></todo>`, i)
+			}
+			r := NewTestRequest("POST", "http://foo.bar/todos", body)
+			r.Header.Set("Content-Type", mediaType)
+			r.Header.Set("Accept", mediaType)
+			w := httptest.NewRecorder()
+			service.InsertOne(resource)(w, r)
+			codes[i], bodies[i] = w.Code, w.Body.String()
+		}(i)
+	}
+	wg.Wait()
+	for i := range codes {
+		title := fmt.Sprintf(`"title":"Todo %d"`, i)
+		if i%2 == 1 {
+			title = fmt.Sprintf(`<Title>Todo %d</Title>`, i)
+		}
+		if codes[i] != http.StatusCreated || !strings.Contains(bodies[i], title) {
+			t.Errorf("#%d Error, expected %d with %s, got %d %s", i, http.StatusCreated, title, codes[i], bodies[i])
+		}
+	}
+}
@@ -0,0 +1,287 @@
+package rest
+
+import (
+	"crypto/hmac"
+	"crypto/rand"
+	"crypto/sha256"
+	"encoding/base64"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"reflect"
+	"strings"
+	"sync"
+)
+
+// CURSORPARAM - the query parameter holding an opaque page cursor
+const CURSORPARAM = "cursor"
+
+// Pagination - page size limits and response format of a resource's findMany
+type Pagination struct {
+	// DefaultLimit is used when the request does not set a limit
+	DefaultLimit int
+	// MaxLimit caps the limit a request may ask for
+	MaxLimit int
+	// Secret signs cursors. A random secret is generated when it is empty, cursors are then only accepted by the
+	// process that issued them, so set it when the service runs more than one instance or restarts.
+	Secret []byte
+	// Envelope wraps results as {"data": [...], "page": {"next", "prev", "total"}}
+	Envelope  bool
+	once      sync.Once
+	secretErr error
+}
+
+// NewPagination - creates a Pagination with the given default and maximum page sizes
+func NewPagination(defaultLimit, maxLimit int) *Pagination {
+	return &Pagination{DefaultLimit: defaultLimit, MaxLimit: maxLimit}
+}
+
+// UseSecret -
+func (p *Pagination) UseSecret(secret []byte) *Pagination {
+	p.Secret = secret
+	return p
+}
+
+// UseEnvelope -
+func (p *Pagination) UseEnvelope(envelope bool) *Pagination {
+	p.Envelope = envelope
+	return p
+}
+
+// Cursor - a decoded page boundary, Values are the sort key values of the boundary document
+type Cursor struct {
+	Sort   []Sort
+	Values []interface{}
+	// Previous is set when the client is paging backwards, storage should return the documents before Values
+	Previous bool
+}
+
+// Page - a page of findMany results and the cursor state needed to reach its neighbours
+type Page struct {
+	Items interface{}
+	// Sort - the keys Next and Prev hold values for, it must start with Query.Sort and may add tie breakers
+	Sort []Sort
+	// Next - sort key values of the last item, nil when no documents follow
+	Next []interface{}
+	// Prev - sort key values of the first item, nil when no documents precede
+	Prev []interface{}
+	// Total - the number of documents matching the filters, nil when unknown
+	Total *int64
+}
+
+// Paginated - optional Storage extension for adapters that support cursor pagination.
+// FindPage reads Query.Cursor and Query.Limit from the context and sets the response status.
+type Paginated interface {
+	FindPage() (*Page, error)
+}
+
+// PageInfo - the page section of an Envelope
+type PageInfo struct {
+	Next  string `json:"next,omitempty" xml:"next,omitempty"`
+	Prev  string `json:"prev,omitempty" xml:"prev,omitempty"`
+	Total *int64 `json:"total,omitempty" xml:"total,omitempty"`
+}
+
+// Envelope - a findMany response body wrapping the results with their page cursors
+type Envelope struct {
+	Data interface{} `json:"data"`
+	Page PageInfo    `json:"page"`
+}
+
+type cursorPayload struct {
+	Sort     []string          `json:"s"`
+	Values   []json.RawMessage `json:"v"`
+	Previous bool              `json:"p,omitempty"`
+}
+
+func (p *Pagination) secret() ([]byte, error) {
+	p.once.Do(func() {
+		if len(p.Secret) == 0 {
+			secret := make([]byte, 32)
+			if _, p.secretErr = rand.Read(secret); p.secretErr == nil {
+				p.Secret = secret
+			}
+		}
+	})
+	return p.Secret, p.secretErr
+}
+
+func (p *Pagination) sign(payload string) (string, error) {
+	secret, err := p.secret()
+	if err != nil {
+		return "", err
+	}
+	mac := hmac.New(sha256.New, secret)
+	mac.Write([]byte(payload))
+	return base64.RawURLEncoding.EncodeToString(mac.Sum(nil)), nil
+}
+
+// EncodeCursor - serializes and signs a cursor
+func (p *Pagination) EncodeCursor(c *Cursor) (string, error) {
+	payload := cursorPayload{Previous: c.Previous}
+	for _, s := range c.Sort {
+		key := s.Field
+		if s.Descending {
+			key = "-" + key
+		}
+		payload.Sort = append(payload.Sort, key)
+	}
+	for _, v := range c.Values {
+		b, err := json.Marshal(v)
+		if err != nil {
+			return "", err
+		}
+		payload.Values = append(payload.Values, b)
+	}
+	b, err := json.Marshal(payload)
+	if err != nil {
+		return "", err
+	}
+	encoded := base64.RawURLEncoding.EncodeToString(b)
+	signature, err := p.sign(encoded)
+	if err != nil {
+		return "", err
+	}
+	return encoded + "." + signature, nil
+}
+
+// DecodeCursor - verifies a cursor and converts its values to the types of the sort fields of t
+func (p *Pagination) DecodeCursor(token string, t reflect.Type) (*Cursor, error) {
+	invalid := errors.New("Invalid cursor")
+	parts := strings.Split(token, ".")
+	if len(parts) != 2 {
+		return nil, invalid
+	}
+	signature, err := p.sign(parts[0])
+	if err != nil {
+		return nil, err
+	}
+	if !hmac.Equal([]byte(signature), []byte(parts[1])) {
+		return nil, invalid
+	}
+	b, err := base64.RawURLEncoding.DecodeString(parts[0])
+	if err != nil {
+		return nil, invalid
+	}
+	var payload cursorPayload
+	if err = json.Unmarshal(b, &payload); err != nil || len(payload.Sort) != len(payload.Values) {
+		return nil, invalid
+	}
+	c := &Cursor{Previous: payload.Previous}
+	for i, key := range payload.Sort {
+		s := Sort{Field: key}
+		if strings.HasPrefix(key, "-") {
+			s = Sort{Field: key[1:], Descending: true}
+		}
+		f, ok := lookupField(t, s.Field)
+		if !ok {
+			return nil, invalid
+		}
+		v := reflect.New(f.Type)
+		if err = json.Unmarshal(payload.Values[i], v.Interface()); err != nil {
+			return nil, invalid
+		}
+		c.Sort = append(c.Sort, s)
+		c.Values = append(c.Values, v.Elem().Interface())
+	}
+	return c, nil
+}
+
+// paginate applies the page size limits and decodes the request cursor
+func (p *Pagination) paginate(q *Query, values map[string][]string, t reflect.Type) error {
+	if q.Limit == 0 {
+		q.Limit = p.DefaultLimit
+	}
+	if p.MaxLimit > 0 && q.Limit > p.MaxLimit {
+		q.Limit = p.MaxLimit
+	}
+	token := ""
+	if len(values[CURSORPARAM]) > 0 {
+		token = values[CURSORPARAM][0]
+	}
+	if token == "" {
+		return nil
+	}
+	c, err := p.DecodeCursor(token, t)
+	if err != nil {
+		return err
+	}
+	// A cursor is only meaningful for the ordering it was created with.
+	if len(c.Sort) < len(q.Sort) {
+		return errors.New("The cursor does not match the sort order")
+	}
+	for i, s := range q.Sort {
+		if c.Sort[i] != s {
+			return errors.New("The cursor does not match the sort order")
+		}
+	}
+	q.Cursor = c
+	return nil
+}
+
+// findPage executes a paginated findMany and renders the page as an envelope or Link headers
+func (model *Model) findPage(storage Paginated, p *Pagination) error {
+	page, err := storage.FindPage()
+	if err != nil {
+		return err
+	}
+	sort := page.Sort
+	if sort == nil {
+		if q := model.GetQuery(); q != nil {
+			sort = q.Sort
+		}
+	}
+	info := PageInfo{Total: page.Total}
+	if page.Next != nil {
+		if info.Next, err = p.EncodeCursor(&Cursor{Sort: sort, Values: page.Next}); err != nil {
+			return err
+		}
+	}
+	if page.Prev != nil {
+		if info.Prev, err = p.EncodeCursor(&Cursor{Sort: sort, Values: page.Prev, Previous: true}); err != nil {
+			return err
+		}
+	}
+	var links []string
+	if info.Next != "" {
+		links = append(links, fmt.Sprintf(`<%s>; rel="next"`, model.pageURL(info.Next)))
+	}
+	if info.Prev != "" {
+		links = append(links, fmt.Sprintf(`<%s>; rel="prev"`, model.pageURL(info.Prev)))
+	}
+	if len(links) > 0 {
+		model.AddResponseHeader("Link", strings.Join(links, ", "))
+	}
+	if p.Envelope {
+		model.SetResponseBody(Envelope{Data: page.Items, Page: info})
+		return nil
+	}
+	if info.Total != nil {
+		model.AddResponseHeader("X-Total-Count", fmt.Sprint(*info.Total))
+	}
+	model.SetResponseBody(page.Items)
+	return nil
+}
+
+// pageURL returns the request URL with the cursor replaced
+func (c *Context) pageURL(cursor string) string {
+	u := *c.GetRequest().URL
+	values := u.Query()
+	values.Set(CURSORPARAM, cursor)
+	values.Del(OFFSETPARAM)
+	u.RawQuery = values.Encode()
+	return u.RequestURI()
+}
+
+// findMany uses cursor pagination when both the resource and its storage support it
+func (model *Model) findMany() error {
+	p, ok := model.Get(PAGINATION).(*Pagination)
+	storage, paginated := model.Storage.(Paginated)
+	if ok && paginated {
+		return model.findPage(storage, p)
+	}
+	if streamed, err := model.findStream(); streamed {
+		return err
+	}
+	return model.FindMany()
+}
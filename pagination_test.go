@@ -0,0 +1,128 @@
+package rest
+
+import (
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"reflect"
+	"strings"
+	"testing"
+)
+
+type FakePagedStorage struct {
+	FakeStorage
+	query        *Query
+	unknownTotal bool
+}
+
+func (fs *FakePagedStorage) FindPage() (*Page, error) {
+	fs.query = fs.GetQuery()
+	if err := fs.FakeAction(http.StatusOK, http.StatusInternalServerError); err != nil {
+		return nil, err
+	}
+	items := []FakeFields{{Name: "Otieno Kamau", Age: 21}, {Name: "Bernie Burst", Age: 81}}
+	sort := []Sort{{Field: "age"}, {Field: "name"}}
+	page := &Page{Items: items, Sort: sort, Next: []interface{}{81, "Bernie Burst"}, Prev: []interface{}{21, "Otieno Kamau"}}
+	if !fs.unknownTotal {
+		total := int64(10)
+		page.Total = &total
+	}
+	return page, nil
+}
+
+func NewFakePagedResource(storage *FakePagedStorage, p *Pagination) *Resource {
+	return NewFakeResource(FakeScenario{}).UseStorage(storage).UsePagination(p)
+}
+
+func TestCursorRoundTrip(t *testing.T) {
+	p := NewPagination(10, 100)
+	token, err := p.EncodeCursor(&Cursor{Sort: []Sort{{Field: "age", Descending: true}}, Values: []interface{}{21}})
+	if err != nil {
+		t.Fatalf("Error, unexpected error %s", err)
+	}
+	c, err := p.DecodeCursor(token, reflect.TypeOf(FakeFields{}))
+	if err != nil {
+		t.Fatalf("Error, unexpected error %s", err)
+	}
+	if c.Values[0] != 21 || !c.Sort[0].Descending {
+		t.Errorf("Error, expected typed value 21 sorted descending, got %v", c)
+	}
+	if _, err = p.DecodeCursor(token+"x", reflect.TypeOf(FakeFields{})); err == nil {
+		t.Errorf("Error, expected a tampered cursor to be rejected")
+	}
+	if _, err = NewPagination(10, 100).DecodeCursor(token, reflect.TypeOf(FakeFields{})); err == nil {
+		t.Errorf("Error, expected a cursor signed with another secret to be rejected")
+	}
+}
+
+func TestFindPage(t *testing.T) {
+	storage := &FakePagedStorage{}
+	p := NewPagination(10, 50)
+	service := NewFakeService(FakeScenario{})
+	handler := service.FindMany(NewFakePagedResource(storage, p))
+	w := httptest.NewRecorder()
+	handler(w, NewTestRequest("GET", "http://foo.bar/test?sort=age&limit=500", ""))
+	if w.Code != http.StatusOK {
+		t.Fatalf("Error, expected %d, got %d", http.StatusOK, w.Code)
+	}
+	if storage.query.Limit != 50 {
+		t.Errorf("Error, expected the limit to be capped at 50, got %d", storage.query.Limit)
+	}
+	link := w.Header().Get("Link")
+	if !strings.Contains(link, `rel="next"`) || !strings.Contains(link, `rel="prev"`) {
+		t.Fatalf("Error, expected next and prev links, got %q", link)
+	}
+	if w.Header().Get("X-Total-Count") != "10" {
+		t.Errorf("Error, expected X-Total-Count 10, got %q", w.Header().Get("X-Total-Count"))
+	}
+	next := link[1:strings.Index(link, ">")]
+	w = httptest.NewRecorder()
+	handler(w, NewTestRequest("GET", "http://foo.bar"+next, ""))
+	if w.Code != http.StatusOK {
+		t.Fatalf("Error, expected %d following the next link, got %d", http.StatusOK, w.Code)
+	}
+	c := storage.query.Cursor
+	if c == nil || c.Previous || !reflect.DeepEqual(c.Values, []interface{}{81, "Bernie Burst"}) {
+		t.Errorf("Error, unexpected cursor %v", c)
+	}
+	if storage.query.Limit != 50 {
+		t.Errorf("Error, expected the next link to keep the limit, got %d", storage.query.Limit)
+	}
+	w = httptest.NewRecorder()
+	handler(w, NewTestRequest("GET", "http://foo.bar"+strings.Replace(next, "sort=age", "sort=name", 1), ""))
+	if w.Code != http.StatusBadRequest {
+		t.Errorf("Error, expected %d for a cursor with another sort order, got %d", http.StatusBadRequest, w.Code)
+	}
+	w = httptest.NewRecorder()
+	handler(w, NewTestRequest("GET", "http://foo.bar/test?cursor=bogus", ""))
+	if w.Code != http.StatusBadRequest {
+		t.Errorf("Error, expected %d for a bogus cursor, got %d", http.StatusBadRequest, w.Code)
+	}
+	w = httptest.NewRecorder()
+	handler(w, NewTestRequest("GET", "http://foo.bar/test", ""))
+	if storage.query.Limit != 10 {
+		t.Errorf("Error, expected the default limit 10, got %d", storage.query.Limit)
+	}
+	storage.unknownTotal = true
+	w = httptest.NewRecorder()
+	handler(w, NewTestRequest("GET", "http://foo.bar/test", ""))
+	if _, ok := w.Header()["X-Total-Count"]; ok {
+		t.Errorf("Error, expected no X-Total-Count when the total is unknown, got %q", w.Header().Get("X-Total-Count"))
+	}
+}
+
+func TestFindPageEnvelope(t *testing.T) {
+	handler := NewFakeService(FakeScenario{}).FindMany(NewFakePagedResource(&FakePagedStorage{}, NewPagination(10, 50).UseEnvelope(true)))
+	w := httptest.NewRecorder()
+	handler(w, NewTestRequest("GET", "http://foo.bar/test", ""))
+	var envelope struct {
+		Data []FakeFields `json:"data"`
+		Page PageInfo     `json:"page"`
+	}
+	if err := json.Unmarshal(w.Body.Bytes(), &envelope); err != nil {
+		t.Fatalf("Error, unexpected error %s decoding %s", err, w.Body.String())
+	}
+	if len(envelope.Data) != 2 || envelope.Page.Next == "" || envelope.Page.Prev == "" || *envelope.Page.Total != 10 {
+		t.Errorf("Error, unexpected envelope %s", w.Body.String())
+	}
+}
@@ -0,0 +1,418 @@
+package rest
+
+import (
+	"fmt"
+	"net/http"
+	"net/url"
+	"reflect"
+	"regexp"
+	"sort"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+)
+
+const (
+	// EQ - field equals value
+	EQ = "eq"
+	// NE - field does not equal value
+	NE = "ne"
+	// GT - field is greater than value
+	GT = "gt"
+	// GTE - field is greater than or equal to value
+	GTE = "gte"
+	// LT - field is less than value
+	LT = "lt"
+	// LTE - field is less than or equal to value
+	LTE = "lte"
+	// IN - field equals one of a comma separated list of values
+	IN = "in"
+	// LIKE - field matches a pattern where % matches any run of characters and _ any single character
+	LIKE = "like"
+)
+
+const (
+	// SORTPARAM - the query parameter holding comma separated sort keys, prefix a key with - to sort descending
+	SORTPARAM = "sort"
+	// LIMITPARAM - the query parameter holding the maximum number of documents to return
+	LIMITPARAM = "limit"
+	// OFFSETPARAM - the query parameter holding the number of documents to skip
+	OFFSETPARAM = "offset"
+	// FIELDSPARAM - the query parameter holding the comma separated fields to return
+	FIELDSPARAM = "fields"
+)
+
+// Filter - a single condition on a field, e.g. ?age[gt]=18
+type Filter struct {
+	Field    string
+	Operator string
+	// Value holds the operand converted to the field's type, for IN it holds the first element of Values
+	Value  interface{}
+	Values []interface{}
+}
+
+// Sort - a sort key, e.g. ?sort=-age
+type Sort struct {
+	Field      string
+	Descending bool
+}
+
+// Query - the parsed and validated query string of a findMany request
+type Query struct {
+	Filters []Filter
+	Sort    []Sort
+	Limit   int
+	Offset  int
+	Fields  []string
+	// Cursor is set when the request pages with a cursor from a previous response
+	Cursor *Cursor
+}
+
+// field - a struct field addressed by its JSON name
+type field struct {
+	Name      string
+	Index     []int
+	Type      reflect.Type
+	Tag       reflect.StructTag
+	OmitEmpty bool
+}
+
+var fieldCache = struct {
+	sync.RWMutex
+	m map[reflect.Type][]field
+}{m: make(map[reflect.Type][]field)}
+
+// typeFields returns the exported fields of a struct type keyed the way encoding/json would name them
+func typeFields(t reflect.Type) []field {
+	for t.Kind() == reflect.Ptr {
+		t = t.Elem()
+	}
+	if t.Kind() != reflect.Struct {
+		return nil
+	}
+	fieldCache.RLock()
+	fields, ok := fieldCache.m[t]
+	fieldCache.RUnlock()
+	if ok {
+		return fields
+	}
+	fields = collectFields(t, nil)
+	fieldCache.Lock()
+	fieldCache.m[t] = fields
+	fieldCache.Unlock()
+	return fields
+}
+
+func collectFields(t reflect.Type, index []int) (fields []field) {
+	for i := 0; i < t.NumField(); i++ {
+		sf := t.Field(i)
+		tag := sf.Tag.Get("json")
+		if tag == "-" {
+			continue
+		}
+		idx := make([]int, len(index)+1)
+		copy(idx, index)
+		idx[len(index)] = i
+		name, opts := tag, ""
+		if j := strings.Index(tag, ","); j >= 0 {
+			name, opts = tag[:j], tag[j+1:]
+		}
+		ft := sf.Type
+		if sf.Anonymous && name == "" {
+			if ft.Kind() == reflect.Ptr {
+				ft = ft.Elem()
+			}
+			if ft.Kind() == reflect.Struct {
+				fields = append(fields, collectFields(ft, idx)...)
+				continue
+			}
+		}
+		if sf.PkgPath != "" {
+			continue
+		}
+		if name == "" {
+			name = sf.Name
+		}
+		omit := false
+		for _, o := range strings.Split(opts, ",") {
+			if o == "omitempty" {
+				omit = true
+			}
+		}
+		fields = append(fields, field{Name: name, Index: idx, Type: sf.Type, Tag: sf.Tag, OmitEmpty: omit})
+	}
+	return fields
+}
+
+// lookupField finds a field by its JSON name
+func lookupField(t reflect.Type, name string) (field, bool) {
+	for _, f := range typeFields(t) {
+		if f.Name == name {
+			return f, true
+		}
+	}
+	return field{}, false
+}
+
+// fieldValue returns the field at index, or the zero value of its type when it is reached through a nil embedded pointer
+func fieldValue(v reflect.Value, index []int) reflect.Value {
+	for i, x := range index {
+		if i > 0 && v.Kind() == reflect.Ptr {
+			if v.IsNil() {
+				return reflect.Zero(v.Type().Elem().FieldByIndex(index[i:]).Type)
+			}
+			v = v.Elem()
+		}
+		v = v.Field(x)
+	}
+	return v
+}
+
+// settableField returns the field at index, allocating nil embedded pointers on the way
+func settableField(v reflect.Value, index []int) reflect.Value {
+	for i, x := range index {
+		if i > 0 && v.Kind() == reflect.Ptr {
+			if v.IsNil() {
+				v.Set(reflect.New(v.Type().Elem()))
+			}
+			v = v.Elem()
+		}
+		v = v.Field(x)
+	}
+	return v
+}
+
+var timeType = reflect.TypeOf(time.Time{})
+
+// parseValue converts a query string value into the Go type of a field
+func parseValue(raw string, t reflect.Type) (interface{}, error) {
+	for t.Kind() == reflect.Ptr {
+		t = t.Elem()
+	}
+	if t == timeType {
+		v, err := time.Parse(time.RFC3339, raw)
+		if err != nil {
+			return nil, fmt.Errorf("%q is not an RFC 3339 time", raw)
+		}
+		return v, nil
+	}
+	switch t.Kind() {
+	case reflect.String:
+		return reflect.ValueOf(raw).Convert(t).Interface(), nil
+	case reflect.Bool:
+		v, err := strconv.ParseBool(raw)
+		if err != nil {
+			return nil, fmt.Errorf("%q is not a boolean", raw)
+		}
+		return reflect.ValueOf(v).Convert(t).Interface(), nil
+	case reflect.Int, reflect.Int8, reflect.Int16, reflect.Int32, reflect.Int64:
+		v, err := strconv.ParseInt(raw, 10, t.Bits())
+		if err != nil {
+			return nil, fmt.Errorf("%q is not an integer", raw)
+		}
+		return reflect.ValueOf(v).Convert(t).Interface(), nil
+	case reflect.Uint, reflect.Uint8, reflect.Uint16, reflect.Uint32, reflect.Uint64:
+		v, err := strconv.ParseUint(raw, 10, t.Bits())
+		if err != nil {
+			return nil, fmt.Errorf("%q is not an unsigned integer", raw)
+		}
+		return reflect.ValueOf(v).Convert(t).Interface(), nil
+	case reflect.Float32, reflect.Float64:
+		v, err := strconv.ParseFloat(raw, t.Bits())
+		if err != nil {
+			return nil, fmt.Errorf("%q is not a number", raw)
+		}
+		return reflect.ValueOf(v).Convert(t).Interface(), nil
+	}
+	return nil, fmt.Errorf("filtering on %s fields is not supported", t.Kind())
+}
+
+// ordered reports whether values of t can be compared with gt, gte, lt and lte
+func ordered(t reflect.Type) bool {
+	for t.Kind() == reflect.Ptr {
+		t = t.Elem()
+	}
+	switch t.Kind() {
+	case reflect.String, reflect.Int, reflect.Int8, reflect.Int16, reflect.Int32, reflect.Int64,
+		reflect.Uint, reflect.Uint8, reflect.Uint16, reflect.Uint32, reflect.Uint64,
+		reflect.Float32, reflect.Float64:
+		return true
+	}
+	return t == timeType
+}
+
+var filterKey = regexp.MustCompile(`^([^\[\]]+)(?:\[([a-z]+)\])?$`)
+
+// reservedParams - query parameters that are not treated as filters
+var reservedParams = map[string]bool{
+	SORTPARAM:    true,
+	LIMITPARAM:   true,
+	OFFSETPARAM:  true,
+	FIELDSPARAM:  true,
+	CURSORPARAM:  true,
+	INCLUDEPARAM: true,
+}
+
+// ParseQuery builds a Query from url values, validating field names and values against the fields of t
+func ParseQuery(values url.Values, t reflect.Type) (*Query, error) {
+	q := &Query{}
+	var err error
+	if q.Limit, err = parseCount(values, LIMITPARAM); err != nil {
+		return nil, err
+	}
+	if q.Offset, err = parseCount(values, OFFSETPARAM); err != nil {
+		return nil, err
+	}
+	for _, key := range splitList(values[SORTPARAM]) {
+		s := Sort{Field: key}
+		if strings.HasPrefix(key, "-") {
+			s = Sort{Field: key[1:], Descending: true}
+		}
+		f, ok := lookupField(t, s.Field)
+		if !ok {
+			return nil, fmt.Errorf("Unknown sort field %q", s.Field)
+		}
+		if !ordered(f.Type) {
+			return nil, fmt.Errorf("Field %q can not be sorted", s.Field)
+		}
+		q.Sort = append(q.Sort, s)
+	}
+	for _, name := range splitList(values[FIELDSPARAM]) {
+		if _, ok := lookupField(t, name); !ok {
+			return nil, fmt.Errorf("Unknown field %q", name)
+		}
+		q.Fields = append(q.Fields, name)
+	}
+	for key, raws := range values {
+		// Sparse fieldsets such as fields[todos] are read by the JSONAPI serializer.
+		if reservedParams[key] || strings.HasPrefix(key, FIELDSPARAM+"[") {
+			continue
+		}
+		m := filterKey.FindStringSubmatch(key)
+		if m == nil {
+			return nil, fmt.Errorf("Malformed query parameter %q", key)
+		}
+		f, ok := lookupField(t, m[1])
+		if !ok {
+			return nil, fmt.Errorf("Unknown filter field %q", m[1])
+		}
+		op := m[2]
+		if op == "" {
+			op = EQ
+		}
+		for _, raw := range raws {
+			filter, err := newFilter(f, op, raw)
+			if err != nil {
+				return nil, err
+			}
+			q.Filters = append(q.Filters, filter)
+		}
+	}
+	// Map iteration order is random, keep the filters in a stable order for storage adapters.
+	sort.Stable(byField(q.Filters))
+	return q, nil
+}
+
+func newFilter(f field, op, raw string) (Filter, error) {
+	filter := Filter{Field: f.Name, Operator: op}
+	switch op {
+	case EQ, NE:
+	case GT, GTE, LT, LTE:
+		if !ordered(f.Type) {
+			return filter, fmt.Errorf("Operator %q is not supported on field %q", op, f.Name)
+		}
+	case LIKE:
+		if indirectKind(f.Type) != reflect.String {
+			return filter, fmt.Errorf("Operator %q is only supported on text fields", op)
+		}
+	case IN:
+		for _, item := range strings.Split(raw, ",") {
+			v, err := parseValue(item, f.Type)
+			if err != nil {
+				return filter, fmt.Errorf("Invalid value for %q: %s", f.Name, err.Error())
+			}
+			filter.Values = append(filter.Values, v)
+		}
+		filter.Value = filter.Values[0]
+		return filter, nil
+	default:
+		return filter, fmt.Errorf("Unknown operator %q", op)
+	}
+	v, err := parseValue(raw, f.Type)
+	if err != nil {
+		return filter, fmt.Errorf("Invalid value for %q: %s", f.Name, err.Error())
+	}
+	filter.Value = v
+	filter.Values = []interface{}{v}
+	return filter, nil
+}
+
+func indirectKind(t reflect.Type) reflect.Kind {
+	for t.Kind() == reflect.Ptr {
+		t = t.Elem()
+	}
+	return t.Kind()
+}
+
+// byField sorts filters by field name
+type byField []Filter
+
+func (f byField) Len() int           { return len(f) }
+func (f byField) Less(i, j int) bool { return f[i].Field < f[j].Field }
+func (f byField) Swap(i, j int)      { f[i], f[j] = f[j], f[i] }
+
+func parseCount(values url.Values, key string) (int, error) {
+	raw := values.Get(key)
+	if raw == "" {
+		return 0, nil
+	}
+	n, err := strconv.Atoi(raw)
+	if err != nil || n < 0 {
+		return 0, fmt.Errorf("%s must be a non-negative integer", key)
+	}
+	return n, nil
+}
+
+func splitList(raws []string) (items []string) {
+	for _, raw := range raws {
+		for _, item := range strings.Split(raw, ",") {
+			if item = strings.TrimSpace(item); item != "" {
+				items = append(items, item)
+			}
+		}
+	}
+	return items
+}
+
+// QueryChecker - optional Storage extension rejecting findMany queries it can not run, they are answered with 400
+type QueryChecker interface {
+	CheckQuery(q *Query) error
+}
+
+// ParseQuery - parse the request query string of a findMany transaction into the context
+func (model *Model) ParseQuery() error {
+	if model.Get(ACTION) != FINDMANY {
+		return nil
+	}
+	// Resources without a type have no fields to filter, sort or select on
+	t, ok := model.Get(DATATYPE).(reflect.Type)
+	if !ok || t == nil {
+		return nil
+	}
+	values := model.GetRequest().URL.Query()
+	q, err := ParseQuery(values, t)
+	if p, ok := model.Get(PAGINATION).(*Pagination); ok && err == nil {
+		err = p.paginate(q, values, t)
+	}
+	if c, ok := model.Storage.(QueryChecker); ok && err == nil {
+		err = c.CheckQuery(q)
+	}
+	if err != nil {
+		model.SetResponseStatus(http.StatusBadRequest)
+		model.SetResponseBody(err.Error())
+		return err
+	}
+	model.Set(QUERY, q)
+	return nil
+}
@@ -0,0 +1,90 @@
+package rest
+
+import (
+	"net/http"
+	"net/http/httptest"
+	"net/url"
+	"reflect"
+	"testing"
+)
+
+func TestParseQuery(t *testing.T) {
+	tests := []struct {
+		query string
+		valid bool
+	}{
+		{"", true},
+		{"name=Otieno", true},
+		{"age[gt]=18&age[lte]=65", true},
+		{"age[in]=18,21,30", true},
+		{"name[like]=Oti%25", true},
+		{"sort=-age,name&limit=10&offset=20", true},
+		{"fields=name", true},
+		{"height=10", false},
+		{"age[gt]=old", false},
+		{"age[like]=1%25", false},
+		{"age[between]=1", false},
+		{"sort=height", false},
+		{"fields=height", false},
+		{"limit=-1", false},
+		{"offset=ten", false},
+		{"age[gt=1", false},
+	}
+	for i, test := range tests {
+		values, _ := url.ParseQuery(test.query)
+		_, err := ParseQuery(values, reflect.TypeOf(FakeFields{}))
+		if (err == nil) != test.valid {
+			t.Errorf("#%d Error, expected valid=%t, got error %v for query: %s", i, test.valid, err, test.query)
+		}
+	}
+}
+
+func TestParseQueryValues(t *testing.T) {
+	values, _ := url.ParseQuery("age[in]=18,21&name=Otieno&sort=-age&limit=5&fields=name,age")
+	q, err := ParseQuery(values, reflect.TypeOf(FakeFields{}))
+	if err != nil {
+		t.Fatalf("Error, unexpected error %s", err)
+	}
+	if len(q.Filters) != 2 || q.Filters[0].Field != "age" || q.Filters[0].Operator != IN {
+		t.Fatalf("Error, unexpected filters %v", q.Filters)
+	}
+	if !reflect.DeepEqual(q.Filters[0].Values, []interface{}{18, 21}) {
+		t.Errorf("Error, expected typed values [18 21], got %v", q.Filters[0].Values)
+	}
+	if q.Filters[1].Value != "Otieno" || q.Filters[1].Operator != EQ {
+		t.Errorf("Error, unexpected filter %v", q.Filters[1])
+	}
+	if len(q.Sort) != 1 || q.Sort[0].Field != "age" || !q.Sort[0].Descending {
+		t.Errorf("Error, unexpected sort %v", q.Sort)
+	}
+	if q.Limit != 5 || len(q.Fields) != 2 {
+		t.Errorf("Error, unexpected limit %d or fields %v", q.Limit, q.Fields)
+	}
+}
+
+func TestFindManyQuery(t *testing.T) {
+	tests := []struct {
+		url      string
+		expected int
+	}{
+		{"http://foo.bar/test?name=Otieno&sort=age", http.StatusOK},
+		{"http://foo.bar/test?height[gt]=2", http.StatusBadRequest},
+		{"http://foo.bar/test?age[gt]=old", http.StatusBadRequest},
+	}
+	for i, test := range tests {
+		scenario := FakeScenario{url: test.url}
+		handler := NewFakeService(scenario).FindMany(NewFakeResource(scenario))
+		w := httptest.NewRecorder()
+		handler(w, NewTestRequest("GET", test.url, ""))
+		if w.Code != test.expected {
+			t.Errorf("#%d Error, expected %d, got %d using URL: %s", i, test.expected, w.Code, test.url)
+		}
+	}
+	// Resources without a type are listed without a query
+	resource := NewFakeResource(FakeScenario{}).UseType(nil)
+	w := httptest.NewRecorder()
+	NewFakeService(FakeScenario{}).FindMany(resource)(w, NewTestRequest("GET", "http://foo.bar/test?name=Otieno", ""))
+	if w.Code != http.StatusOK {
+		t.Errorf("Error, expected %d without a resource type, got %d", http.StatusOK, w.Code)
+	}
+}
@@ -0,0 +1,361 @@
+package rest
+
+import (
+	"crypto/sha256"
+	"encoding/binary"
+	"encoding/hex"
+	"errors"
+	"fmt"
+	"math"
+	"net"
+	"net/http"
+	"strconv"
+	"sync"
+	"time"
+)
+
+// LimitStore - holds the state of rate limits, stores backed by e.g. Redis share it between instances
+type LimitStore interface {
+	// Update - atomically replaces the state of key, nil when there is none, with what fn returns for it and keeps
+	// it for ttl
+	Update(key string, ttl time.Duration, fn func(state []byte) ([]byte, error)) error
+}
+
+// MemoryLimitStore - a LimitStore holding the state of rate limits in memory
+type MemoryLimitStore struct {
+	sync.Mutex
+	entries map[string]limitEntry
+	updates int
+}
+
+type limitEntry struct {
+	state   []byte
+	expires time.Time
+}
+
+// NewMemoryLimitStore -
+func NewMemoryLimitStore() *MemoryLimitStore {
+	return &MemoryLimitStore{entries: make(map[string]limitEntry)}
+}
+
+// Update -
+func (m *MemoryLimitStore) Update(key string, ttl time.Duration, fn func(state []byte) ([]byte, error)) error {
+	now := time.Now()
+	m.Lock()
+	defer m.Unlock()
+	// Drop expired entries from time to time so that the store does not grow with every client ever seen
+	if m.updates++; m.updates%1024 == 0 {
+		for k, e := range m.entries {
+			if now.After(e.expires) {
+				delete(m.entries, k)
+			}
+		}
+	}
+	var state []byte
+	if e, ok := m.entries[key]; ok && !now.After(e.expires) {
+		state = e.state
+	}
+	state, err := fn(state)
+	if err != nil {
+		return err
+	}
+	m.entries[key] = limitEntry{state: state, expires: now.Add(ttl)}
+	return nil
+}
+
+// RateLimitStatus - the state of a rate limit after a request was counted
+type RateLimitStatus struct {
+	Allowed   bool
+	Limit     int
+	Remaining int
+	// Reset - how long until the limit is fully available again
+	Reset time.Duration
+	// RetryAfter - how long until a refused request would be allowed
+	RetryAfter time.Duration
+	// Policy - the limit and window of the RateLimit-Policy header, e.g. 100;w=60
+	Policy string
+}
+
+// Limiter - a rate limiting algorithm counting a request of the client key against the state held by store
+type Limiter interface {
+	Allow(store LimitStore, key string, now time.Time) (RateLimitStatus, error)
+}
+
+var errLimitState = errors.New("The rate limit state is corrupt")
+
+// TokenBucket - a Limiter allowing Limit requests per Period with bursts of up to Burst, Limit when it is not set
+type TokenBucket struct {
+	Limit  int
+	Period time.Duration
+	Burst  int
+}
+
+// Allow -
+func (b *TokenBucket) Allow(store LimitStore, key string, now time.Time) (status RateLimitStatus, err error) {
+	capacity := float64(b.Burst)
+	if b.Burst <= 0 {
+		capacity = float64(b.Limit)
+	}
+	// rate is the number of tokens added per second
+	rate := float64(b.Limit) / b.Period.Seconds()
+	refill := seconds(capacity / rate)
+	err = store.Update(key, refill, func(state []byte) ([]byte, error) {
+		tokens, last := capacity, now
+		if state != nil {
+			if len(state) != 16 {
+				return nil, errLimitState
+			}
+			tokens = math.Float64frombits(binary.BigEndian.Uint64(state))
+			last = time.Unix(0, int64(binary.BigEndian.Uint64(state[8:])))
+		}
+		if elapsed := now.Sub(last).Seconds(); elapsed > 0 {
+			tokens = math.Min(capacity, tokens+elapsed*rate)
+		}
+		status = RateLimitStatus{Limit: int(capacity), Policy: fmt.Sprintf("%d;w=%d", b.Limit, int(math.Ceil(b.Period.Seconds())))}
+		if tokens >= 1 {
+			tokens--
+			status.Allowed = true
+		} else {
+			status.RetryAfter = seconds((1 - tokens) / rate)
+		}
+		status.Remaining = int(tokens)
+		status.Reset = seconds((capacity - tokens) / rate)
+		state = make([]byte, 16)
+		binary.BigEndian.PutUint64(state, math.Float64bits(tokens))
+		binary.BigEndian.PutUint64(state[8:], uint64(now.UnixNano()))
+		return state, nil
+	})
+	return status, err
+}
+
+// SlidingWindow - a Limiter allowing Limit requests in any Window, estimated from the counts of the current and the
+// previous fixed windows
+type SlidingWindow struct {
+	Limit  int
+	Window time.Duration
+}
+
+// Allow -
+func (s *SlidingWindow) Allow(store LimitStore, key string, now time.Time) (status RateLimitStatus, err error) {
+	start := now.Truncate(s.Window)
+	limit := float64(s.Limit)
+	err = store.Update(key, 2*s.Window, func(state []byte) ([]byte, error) {
+		var previous, current float64
+		if state != nil {
+			if len(state) != 24 {
+				return nil, errLimitState
+			}
+			window := time.Unix(0, int64(binary.BigEndian.Uint64(state)))
+			switch {
+			case window.Equal(start):
+				previous = math.Float64frombits(binary.BigEndian.Uint64(state[8:]))
+				current = math.Float64frombits(binary.BigEndian.Uint64(state[16:]))
+			case window.Equal(start.Add(-s.Window)):
+				previous = math.Float64frombits(binary.BigEndian.Uint64(state[16:]))
+			}
+		}
+		elapsed := now.Sub(start)
+		// weight is the share of the previous window still inside the sliding window
+		weight := 1 - elapsed.Seconds()/s.Window.Seconds()
+		count := previous*weight + current
+		status = RateLimitStatus{Limit: s.Limit, Policy: fmt.Sprintf("%d;w=%d", s.Limit, int(math.Ceil(s.Window.Seconds())))}
+		if count+1 <= limit {
+			current++
+			count++
+			status.Allowed = true
+		} else {
+			status.RetryAfter = s.retryAfter(previous, current, elapsed)
+		}
+		status.Remaining = int(math.Max(0, math.Floor(limit-count)))
+		// The window is fully available once the requests of the current window slid out of it
+		status.Reset = s.Window - elapsed
+		if current > 0 {
+			status.Reset += s.Window
+		}
+		state = make([]byte, 24)
+		binary.BigEndian.PutUint64(state, uint64(start.UnixNano()))
+		binary.BigEndian.PutUint64(state[8:], math.Float64bits(previous))
+		binary.BigEndian.PutUint64(state[16:], math.Float64bits(current))
+		return state, nil
+	})
+	return status, err
+}
+
+// retryAfter returns how long until one more request fits in the sliding window
+func (s *SlidingWindow) retryAfter(previous, current float64, elapsed time.Duration) time.Duration {
+	budget := float64(s.Limit) - 1
+	if current <= budget {
+		// Wait for enough of the previous window to slide out, previous*(1-t/window)+current <= budget
+		t := s.Window.Seconds() * (1 - (budget-current)/previous)
+		return seconds(t) - elapsed
+	}
+	// Wait for the next window and for enough of this one to slide out of it
+	t := s.Window.Seconds() * (1 - budget/current)
+	return s.Window - elapsed + seconds(t)
+}
+
+func seconds(s float64) time.Duration {
+	return time.Duration(s * float64(time.Second))
+}
+
+// LimitKey - returns the client key a request is counted against, the empty string when it does not apply
+type LimitKey func(c *Context) string
+
+// KeyByPrincipal - counts requests against the authenticated caller
+func KeyByPrincipal(c *Context) string {
+	if p := c.GetPrincipal(); p != nil {
+		return "principal:" + p.Subject
+	}
+	return ""
+}
+
+// KeyByIP - counts requests against the address of the client
+func KeyByIP(c *Context) string {
+	addr := c.GetRequest().RemoteAddr
+	if host, _, err := net.SplitHostPort(addr); err == nil {
+		addr = host
+	}
+	if addr == "" {
+		return ""
+	}
+	return "ip:" + addr
+}
+
+// KeyByTenant - counts requests against the tenant
+func KeyByTenant(c *Context) string {
+	if tenant := c.GetTenant(); tenant != "" {
+		return "tenant:" + tenant
+	}
+	return ""
+}
+
+// KeyByAPIKey - counts requests against the API key sent in a header, the key is hashed so that stores do not hold it
+func KeyByAPIKey(header string) LimitKey {
+	return func(c *Context) string {
+		key := c.GetRequest().Header.Get(header)
+		if key == "" {
+			return ""
+		}
+		sum := sha256.Sum256([]byte(key))
+		return "apikey:" + hex.EncodeToString(sum[:16])
+	}
+}
+
+// RateLimit - counts requests against the first client key of Keys that applies, requests counted by a RateLimit
+// share its budget across resources and actions
+type RateLimit struct {
+	Name    string
+	Limiter Limiter
+	Keys    []LimitKey
+	Store   LimitStore
+	// clock returns the current time
+	clock func() time.Time
+}
+
+// NewRateLimit - a rate limit counting its state in memory
+func NewRateLimit(name string, limiter Limiter, keys ...LimitKey) *RateLimit {
+	return &RateLimit{Name: name, Limiter: limiter, Keys: keys, Store: NewMemoryLimitStore(), clock: time.Now}
+}
+
+// UseStore - holds the state of the rate limit in store, e.g. to share it between instances
+func (l *RateLimit) UseStore(store LimitStore) *RateLimit {
+	l.Store = store
+	return l
+}
+
+// take counts a request, it reports false when none of the keys applies
+func (l *RateLimit) take(c *Context) (RateLimitStatus, bool, error) {
+	for _, key := range l.Keys {
+		if k := key(c); k != "" {
+			now := time.Now()
+			if l.clock != nil {
+				now = l.clock()
+			}
+			status, err := l.Limiter.Allow(l.Store, l.Name+"|"+k, now)
+			return status, err == nil, err
+		}
+	}
+	return RateLimitStatus{}, false, nil
+}
+
+// AddRateLimit - counts the requests of every resource against l, for the actions given or all of them
+func (s *Service) AddRateLimit(l *RateLimit, actions ...string) {
+	if s.RateLimits == nil {
+		s.RateLimits = make(map[string][]*RateLimit)
+	}
+	for _, action := range limitActions(actions) {
+		s.RateLimits[action] = append(s.RateLimits[action], l)
+	}
+}
+
+// AddRateLimit - counts the requests of the resource against l, for the actions given or all of them
+func (r *Resource) AddRateLimit(l *RateLimit, actions ...string) *Resource {
+	if r.RateLimits == nil {
+		r.RateLimits = make(map[string][]*RateLimit)
+	}
+	for _, action := range limitActions(actions) {
+		r.RateLimits[action] = append(r.RateLimits[action], l)
+	}
+	return r
+}
+
+func limitActions(actions []string) []string {
+	if len(actions) == 0 {
+		return []string{INSERTONE, INSERTMANY, UPDATE, UPSERT, FINDONE, FINDMANY, REMOVE}
+	}
+	return actions
+}
+
+var errRateLimited = errors.New("Too many requests")
+
+// limit counts the request against the rate limits of the service, the resource and the tenant, answering 429 when
+// it exceeds one of them. Requests failing authentication are counted without a principal. Limits whose store fails
+// let requests through.
+func (s *Service) limit(resource *Resource, model *Model) error {
+	action, _ := model.Get(ACTION).(string)
+	limits := append(append([]*RateLimit{}, s.RateLimits[action]...), resource.RateLimits[action]...)
+	if s.Tenancy != nil {
+		if config := s.Tenancy.Tenants[model.GetTenant()]; config != nil {
+			limits = append(limits, config.RateLimits...)
+		}
+	}
+	var tightest *RateLimitStatus
+	for _, l := range limits {
+		status, ok, err := l.take(&model.Context)
+		if err != nil {
+			s.Logger.Error(err)
+		}
+		if !ok {
+			continue
+		}
+		if !status.Allowed {
+			setRateLimitHeaders(model, status)
+			model.SetResponseHeader("Retry-After", strconv.Itoa(ceilSeconds(status.RetryAfter)))
+			model.SetResponseStatus(http.StatusTooManyRequests)
+			model.SetResponseBody(errRateLimited.Error())
+			return errRateLimited
+		}
+		if tightest == nil || status.Remaining < tightest.Remaining {
+			tightest = &status
+		}
+	}
+	if tightest != nil {
+		setRateLimitHeaders(model, *tightest)
+	}
+	return nil
+}
+
+func setRateLimitHeaders(model *Model, status RateLimitStatus) {
+	model.SetResponseHeader("RateLimit-Limit", strconv.Itoa(status.Limit))
+	model.SetResponseHeader("RateLimit-Remaining", strconv.Itoa(status.Remaining))
+	model.SetResponseHeader("RateLimit-Reset", strconv.Itoa(ceilSeconds(status.Reset)))
+	model.SetResponseHeader("RateLimit-Policy", status.Policy)
+}
+
+// ceilSeconds rounds a duration up to whole seconds, at least one
+func ceilSeconds(d time.Duration) int {
+	if s := int(math.Ceil(d.Seconds())); s > 0 {
+		return s
+	}
+	return 1
+}
@@ -0,0 +1,170 @@
+package rest
+
+import (
+	"errors"
+	"net/http"
+	"net/http/httptest"
+	"reflect"
+	"testing"
+	"time"
+)
+
+func TestTokenBucket(t *testing.T) {
+	start := time.Unix(1500000000, 0)
+	tests := []struct {
+		at         time.Duration
+		allowed    bool
+		remaining  int
+		retryAfter time.Duration
+		reset      time.Duration
+	}{
+		{0, true, 1, 0, 500 * time.Millisecond},
+		{0, true, 0, 0, time.Second},
+		{0, false, 0, 500 * time.Millisecond, time.Second},
+		{250 * time.Millisecond, false, 0, 250 * time.Millisecond, 750 * time.Millisecond},
+		{500 * time.Millisecond, true, 0, 0, time.Second},
+		{10 * time.Second, true, 1, 0, 500 * time.Millisecond},
+	}
+	store, limiter := NewMemoryLimitStore(), &TokenBucket{Limit: 2, Period: time.Second}
+	for i, test := range tests {
+		status, err := limiter.Allow(store, "k", start.Add(test.at))
+		if err != nil || status.Allowed != test.allowed || status.Remaining != test.remaining || status.RetryAfter != test.retryAfter || status.Reset != test.reset {
+			t.Errorf("#%d Error, expected %v %d %s %s, got %+v %v", i, test.allowed, test.remaining, test.retryAfter, test.reset, status, err)
+		}
+	}
+}
+
+func TestSlidingWindow(t *testing.T) {
+	start := time.Unix(1500000000, 0)
+	tests := []struct {
+		at         time.Duration
+		allowed    bool
+		remaining  int
+		retryAfter time.Duration
+	}{
+		{0, true, 2, 0},
+		{time.Second, true, 1, 0},
+		{2 * time.Second, true, 0, 0},
+		{3 * time.Second, false, 0, 10333333333},
+		{12 * time.Second, false, 0, 1333333333},
+		{13500 * time.Millisecond, true, 0, 0},
+		{35 * time.Second, true, 2, 0},
+	}
+	store, limiter := NewMemoryLimitStore(), &SlidingWindow{Limit: 3, Window: 10 * time.Second}
+	for i, test := range tests {
+		status, err := limiter.Allow(store, "k", start.Add(test.at))
+		if err != nil || status.Allowed != test.allowed || status.Remaining != test.remaining || status.RetryAfter != test.retryAfter {
+			t.Errorf("#%d Error, expected %v %d %s, got %+v %v", i, test.allowed, test.remaining, test.retryAfter, status, err)
+		}
+	}
+}
+
+type FakeFailingLimitStore struct{}
+
+func (s FakeFailingLimitStore) Update(key string, ttl time.Duration, fn func(state []byte) ([]byte, error)) error {
+	return errors.New("The limit store is down")
+}
+
+func TestRateLimits(t *testing.T) {
+	now := time.Unix(1500000000, 0)
+	clock := func() time.Time { return now }
+	writes := NewRateLimit("writes", &TokenBucket{Limit: 2, Period: time.Minute}, KeyByAPIKey("X-API-Key"), KeyByIP)
+	writes.clock = clock
+	trial := NewRateLimit("trial", &SlidingWindow{Limit: 1, Window: time.Hour}, KeyByTenant)
+	trial.clock = clock
+	service := NewFakeService(FakeScenario{})
+	tenancy := NewTenancy(TenantFromHeader("X-Tenant-ID"))
+	tenancy.Authorize = func(principal *Principal, tenant string) bool { return true }
+	service.UseTenancy(tenancy.Configure("trial", &TenantConfig{RateLimits: []*RateLimit{trial}}))
+	service.AddRateLimit(NewRateLimit("down", &TokenBucket{Limit: 1, Period: time.Hour}, KeyByIP).UseStore(FakeFailingLimitStore{}))
+	resource := NewFakeTodoResource(NewMemory(reflect.TypeOf(FakeTodo{}))).AddRateLimit(writes, INSERTONE, UPDATE)
+	tests := []struct {
+		handler func(http.ResponseWriter, *http.Request)
+		verb    string
+		addr    string
+		key     string
+		tenant  string
+		status  int
+		headers map[string]string
+	}{
+		{service.InsertOne(resource), "POST", "192.0.2.1:1234", "", "", http.StatusCreated, map[string]string{"RateLimit-Limit": "2", "RateLimit-Remaining": "1", "RateLimit-Reset": "30", "RateLimit-Policy": "2;w=60"}},
+		{service.InsertOne(resource), "POST", "192.0.2.1:4321", "", "", http.StatusCreated, map[string]string{"RateLimit-Remaining": "0", "RateLimit-Reset": "60"}},
+		{service.InsertOne(resource), "POST", "192.0.2.1:1234", "", "", http.StatusTooManyRequests, map[string]string{"RateLimit-Remaining": "0", "Retry-After": "30"}},
+		{service.InsertOne(resource), "POST", "192.0.2.2:1234", "", "", http.StatusCreated, map[string]string{"RateLimit-Remaining": "1"}},
+		{service.InsertOne(resource), "POST", "192.0.2.1:1234", "k1", "", http.StatusCreated, map[string]string{"RateLimit-Remaining": "1"}},
+		{service.FindMany(resource), "GET", "192.0.2.1:1234", "", "", http.StatusOK, map[string]string{"RateLimit-Limit": "", "Retry-After": ""}},
+		{service.FindMany(resource), "GET", "192.0.2.1:1234", "", "trial", http.StatusOK, map[string]string{"RateLimit-Limit": "1", "RateLimit-Policy": "1;w=3600"}},
+		{service.FindMany(resource), "GET", "192.0.2.3:1234", "", "trial", http.StatusTooManyRequests, map[string]string{"Retry-After": "4800"}},
+		{service.FindMany(resource), "GET", "192.0.2.3:1234", "", "acme", http.StatusOK, map[string]string{"RateLimit-Limit": ""}},
+	}
+	for i, test := range tests {
+		r := NewTestRequest(test.verb, "http://foo.bar/todos", `{"title": "Milk"}`)
+		r.RemoteAddr = test.addr
+		r.Header.Set("X-API-Key", test.key)
+		r.Header.Set("X-Tenant-ID", test.tenant)
+		w := httptest.NewRecorder()
+		test.handler(w, r)
+		if w.Code != test.status {
+			t.Errorf("#%d Error, expected %d, got %d %s", i, test.status, w.Code, w.Body.String())
+		}
+		for name, value := range test.headers {
+			if w.Header().Get(name) != value {
+				t.Errorf("#%d Error, expected %s %q, got %q", i, name, value, w.Header().Get(name))
+			}
+		}
+		if w.Code == http.StatusTooManyRequests && w.Body.String() != `"Too many requests"` {
+			t.Errorf("#%d Error, unexpected body %s", i, w.Body.String())
+		}
+	}
+}
+
+func TestRateLimitsFailedAuthentication(t *testing.T) {
+	service := NewFakeService(FakeScenario{})
+	service.AddRateLimit(NewRateLimit("logins", &TokenBucket{Limit: 2, Period: time.Hour}, KeyByPrincipal, KeyByIP))
+	resource := NewFakeTodoResource(NewMemory(reflect.TypeOf(FakeTodo{}))).
+		UseAuthenticator(&APIKey{Header: "X-API-Key", Keys: map[string]string{"k1": "wanjiru"}})
+	tests := []struct {
+		addr   string
+		key    string
+		status int
+	}{
+		{"192.0.2.1:1234", "guess1", http.StatusUnauthorized},
+		{"192.0.2.1:1234", "guess2", http.StatusUnauthorized},
+		{"192.0.2.1:1234", "guess3", http.StatusTooManyRequests},
+		{"192.0.2.1:1234", "", http.StatusTooManyRequests},
+		{"192.0.2.2:1234", "guess4", http.StatusUnauthorized},
+		{"192.0.2.1:1234", "k1", http.StatusOK},
+	}
+	for i, test := range tests {
+		r := NewTestRequest("GET", "http://foo.bar/todos", "")
+		r.RemoteAddr = test.addr
+		r.Header.Set("X-API-Key", test.key)
+		w := httptest.NewRecorder()
+		service.FindMany(resource)(w, r)
+		if w.Code != test.status {
+			t.Errorf("#%d Error, expected %d, got %d %s", i, test.status, w.Code, w.Body.String())
+		}
+	}
+}
+
+func TestMemoryLimitStore(t *testing.T) {
+	store := NewMemoryLimitStore()
+	var seen [][]byte
+	update := func(ttl time.Duration) {
+		store.Update("k", ttl, func(state []byte) ([]byte, error) {
+			seen = append(seen, state)
+			return []byte{byte(len(seen))}, nil
+		})
+	}
+	update(time.Minute)
+	update(-time.Second)
+	update(time.Minute)
+	if expected := [][]byte{nil, {1}, nil}; !reflect.DeepEqual(seen, expected) {
+		t.Errorf("Error, expected the states %v, got %v", expected, seen)
+	}
+	if err := store.Update("k", time.Minute, func(state []byte) ([]byte, error) {
+		return nil, errLimitState
+	}); err != errLimitState {
+		t.Errorf("Error, expected %v, got %v", errLimitState, err)
+	}
+}
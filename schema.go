@@ -0,0 +1,960 @@
+package rest
+
+import (
+	"bytes"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"io/ioutil"
+	"math/big"
+	"net"
+	"net/http"
+	"net/mail"
+	"net/url"
+	"os"
+	"path/filepath"
+	"regexp"
+	"sort"
+	"strings"
+	"time"
+	"unicode/utf8"
+)
+
+// Schema - a compiled JSON Schema (draft 2020-12). The applicator, validation and format vocabularies are
+// supported, $ref resolves JSON Pointers, $anchor and $id within the loaded documents and other local files.
+// pattern and patternProperties use Go regular expressions. $dynamicRef, unevaluatedProperties and
+// unevaluatedItems are not supported and rejected when the schema is loaded.
+type Schema struct {
+	always            *bool
+	ref               *Schema
+	types             []string
+	enum              []interface{}
+	constant          interface{}
+	hasConst          bool
+	multipleOf        *schemaNumber
+	maximum           *schemaNumber
+	exclusiveMaximum  *schemaNumber
+	minimum           *schemaNumber
+	exclusiveMinimum  *schemaNumber
+	maxLength         *int
+	minLength         *int
+	pattern           *regexp.Regexp
+	format            string
+	maxItems          *int
+	minItems          *int
+	uniqueItems       bool
+	maxContains       *int
+	minContains       *int
+	maxProperties     *int
+	minProperties     *int
+	required          []string
+	dependentRequired map[string][]string
+	allOf             []*Schema
+	anyOf             []*Schema
+	oneOf             []*Schema
+	not               *Schema
+	ifSchema          *Schema
+	thenSchema        *Schema
+	elseSchema        *Schema
+	properties        map[string]*Schema
+	patternProperties []patternSchema
+	additional        *Schema
+	propertyNames     *Schema
+	dependentSchemas  map[string]*Schema
+	prefixItems       []*Schema
+	items             *Schema
+	contains          *Schema
+}
+
+// schemaNumber - a numeric keyword, kept exact so that e.g. multipleOf 0.01 works
+type schemaNumber struct {
+	rat  *big.Rat
+	text string
+}
+
+type patternSchema struct {
+	pattern *regexp.Regexp
+	schema  *Schema
+}
+
+// BodyValidator - a Validator checking the raw request body before it is decoded into the resource type
+type BodyValidator interface {
+	ValidateBody() error
+}
+
+// SchemaValidator - a Validator checking JSON request bodies against the JSON Schema of the action before they
+// are decoded, answering 400 when the body is not JSON and 422 with SchemaErrors when it breaks the schema.
+// insertMany bodies are checked item by item against the insertOne schema when the action has none.
+type SchemaValidator struct {
+	*Context
+	// Schemas - the schema of the request body of each action
+	Schemas map[string]*Schema
+	// AssertFormats - reject strings not matching their format, draft 2020-12 treats format as an annotation
+	AssertFormats bool
+}
+
+// NewSchemaValidator -
+func NewSchemaValidator() *SchemaValidator {
+	return &SchemaValidator{Schemas: map[string]*Schema{}}
+}
+
+// UseSchema - sets the schema of the request body of an action
+func (v *SchemaValidator) UseSchema(action string, s *Schema) *SchemaValidator {
+	v.Schemas[action] = s
+	return v
+}
+
+// UseContext -
+func (v *SchemaValidator) UseContext(c *Context) {
+	v.Context = c
+}
+
+// Clone - returns a SchemaValidator with the same schemas for another request
+func (v *SchemaValidator) Clone() Validator {
+	c := *v
+	c.Context = nil
+	return &c
+}
+
+// schema returns the schema of the current action
+func (v *SchemaValidator) schema() *Schema {
+	action, _ := v.Get(ACTION).(string)
+	if s, ok := v.Schemas[action]; ok {
+		return s
+	}
+	if s, ok := v.Schemas[INSERTONE]; ok && action == INSERTMANY {
+		return &Schema{types: []string{"array"}, items: s}
+	}
+	return nil
+}
+
+// ValidateBody - reads the request body, checks it and puts it back for the Serializer to decode
+func (v *SchemaValidator) ValidateBody() error {
+	r := v.GetRequest()
+	s := v.schema()
+	if s == nil || (r.Method != "POST" && r.Method != "PUT" && r.Method != "PATCH") {
+		return nil
+	}
+	var body io.Reader = bytes.NewReader(nil)
+	if r.Body != nil {
+		body = r.Body
+	}
+	options, _ := v.Get(DECODEOPTIONS).(*DecodeOptions)
+	if options != nil && options.MaxBodySize > 0 {
+		body = io.LimitReader(body, options.MaxBodySize+1)
+	}
+	b, err := ioutil.ReadAll(body)
+	if err != nil {
+		v.SetResponseStatus(http.StatusBadRequest)
+		v.SetResponseBody(err.Error())
+		return err
+	}
+	if options != nil && options.MaxBodySize > 0 && int64(len(b)) > options.MaxBodySize {
+		err = &BodyTooLargeError{Limit: options.MaxBodySize}
+		v.SetResponseStatus(http.StatusRequestEntityTooLarge)
+		v.SetResponseBody(err)
+		return err
+	}
+	r.Body = ioutil.NopCloser(bytes.NewReader(b))
+	doc, err := decodeNumbers(b)
+	if len(bytes.TrimSpace(b)) == 0 {
+		err = errEmptyBody
+	}
+	if err != nil {
+		v.SetResponseStatus(http.StatusBadRequest)
+		v.SetResponseBody(err.Error())
+		return err
+	}
+	if errs := s.Validate(doc, v.AssertFormats); len(errs) > 0 {
+		v.SetResponseStatus(http.StatusUnprocessableEntity)
+		v.SetResponseBody(errs)
+		return errs
+	}
+	return nil
+}
+
+// Validate - the body was checked by ValidateBody before it was decoded
+func (v *SchemaValidator) Validate() error {
+	return nil
+}
+
+// SchemaError - a schema keyword the request body breaks, Pointer is the JSON Pointer of the offending value,
+// Keyword the location of the keyword in the schema and Param its value, such as the limit of minimum
+type SchemaError struct {
+	Pointer string `json:"pointer" xml:"pointer"`
+	Keyword string `json:"keyword" xml:"keyword"`
+	Param   string `json:"param,omitempty" xml:"param,omitempty"`
+	Message string `json:"message" xml:"message"`
+}
+
+// SchemaErrors - every keyword the request body breaks
+type SchemaErrors []SchemaError
+
+// Errors - the keywords broken as FieldErrors, Field is the JSON pointer of the offending value
+func (e SchemaErrors) Errors() []FieldError {
+	errs := make([]FieldError, len(e))
+	for i, se := range e {
+		keyword := se.Keyword[strings.LastIndex(se.Keyword, "/")+1:]
+		errs[i] = FieldError{Field: se.Pointer, Rule: keyword, Param: se.Param, Message: se.Message, Code: keyword}
+	}
+	return errs
+}
+
+func (e SchemaErrors) Error() string {
+	msgs := make([]string, len(e))
+	for i, se := range e {
+		msgs[i] = se.Pointer + ": " + se.Message
+	}
+	return strings.Join(msgs, "; ")
+}
+
+// schemaLoader compiles the schemas of a set of documents
+type schemaLoader struct {
+	docs     map[string]interface{}
+	ids      map[string]schemaNode
+	compiled map[string]*Schema
+}
+
+// schemaNode - a raw schema and the base URI its references resolve against
+type schemaNode struct {
+	raw  interface{}
+	base string
+}
+
+func newSchemaLoader() *schemaLoader {
+	return &schemaLoader{docs: map[string]interface{}{}, ids: map[string]schemaNode{}, compiled: map[string]*Schema{}}
+}
+
+// LoadSchema - reads a JSON Schema from a file, references to other files resolve relative to it
+func LoadSchema(path string) (*Schema, error) {
+	abs, err := filepath.Abs(path)
+	if err != nil {
+		return nil, err
+	}
+	return newSchemaLoader().resolve(fileURL(abs))
+}
+
+// ParseSchema - compiles a JSON Schema, references to files resolve relative to the working directory
+func ParseSchema(b []byte) (*Schema, error) {
+	doc, err := decodeNumbers(b)
+	if err != nil {
+		return nil, err
+	}
+	wd, err := os.Getwd()
+	if err != nil {
+		return nil, err
+	}
+	l := newSchemaLoader()
+	base := fileURL(filepath.Join(wd, "schema.json"))
+	l.add(base, doc)
+	return l.resolve(base)
+}
+
+func fileURL(path string) string {
+	return (&url.URL{Scheme: "file", Path: filepath.ToSlash(path)}).String()
+}
+
+// decodeNumbers parses a JSON document keeping numbers as json.Number
+func decodeNumbers(b []byte) (interface{}, error) {
+	decoder := json.NewDecoder(bytes.NewReader(b))
+	decoder.UseNumber()
+	var v interface{}
+	if err := decoder.Decode(&v); err != nil {
+		return nil, err
+	}
+	if decoder.More() {
+		return nil, errors.New("unexpected data after the document")
+	}
+	return v, nil
+}
+
+// resolveURI resolves a reference against a base URI
+func resolveURI(base, ref string) (string, error) {
+	b, err := url.Parse(base)
+	if err != nil {
+		return "", err
+	}
+	r, err := url.Parse(ref)
+	if err != nil {
+		return "", err
+	}
+	return b.ResolveReference(r).String(), nil
+}
+
+// splitFragment returns a URI without its fragment, and the fragment
+func splitFragment(uri string) (string, string) {
+	i := strings.Index(uri, "#")
+	if i < 0 {
+		return uri, ""
+	}
+	fragment := uri[i+1:]
+	if u, err := url.Parse(uri); err == nil {
+		fragment = u.Fragment
+	}
+	return uri[:i], fragment
+}
+
+// add registers a document and the $id and $anchor of its subschemas
+func (l *schemaLoader) add(docURL string, doc interface{}) {
+	l.docs[docURL] = doc
+	l.scan(doc, docURL)
+}
+
+func (l *schemaLoader) scan(node interface{}, base string) {
+	switch n := node.(type) {
+	case map[string]interface{}:
+		if id, ok := n["$id"].(string); ok {
+			if uri, err := resolveURI(base, id); err == nil {
+				base, _ = splitFragment(uri)
+				l.ids[base] = schemaNode{n, base}
+			}
+		}
+		if anchor, ok := n["$anchor"].(string); ok {
+			l.ids[base+"#"+anchor] = schemaNode{n, base}
+		}
+		for key, child := range n {
+			// Instances are not schemas.
+			if key != "enum" && key != "const" && key != "default" && key != "examples" {
+				l.scan(child, base)
+			}
+		}
+	case []interface{}:
+		for _, child := range n {
+			l.scan(child, base)
+		}
+	}
+}
+
+// resolve returns the compiled schema a URI addresses, loading local files as needed
+func (l *schemaLoader) resolve(uri string) (*Schema, error) {
+	docURL, fragment := splitFragment(uri)
+	if fragment == "" {
+		uri = docURL
+	}
+	if s, ok := l.compiled[uri]; ok {
+		return s, nil
+	}
+	if n, ok := l.ids[uri]; ok {
+		return l.compile(n.raw, n.base, uri)
+	}
+	node, base := interface{}(nil), docURL
+	if n, ok := l.ids[docURL]; ok {
+		node = n.raw
+	} else if doc, ok := l.docs[docURL]; ok {
+		node = doc
+	} else {
+		u, err := url.Parse(docURL)
+		if err != nil {
+			return nil, err
+		}
+		if u.Scheme != "file" {
+			return nil, fmt.Errorf("Can not load the schema %s, only local files are supported", docURL)
+		}
+		b, err := ioutil.ReadFile(filepath.FromSlash(u.Path))
+		if err != nil {
+			return nil, err
+		}
+		if node, err = decodeNumbers(b); err != nil {
+			return nil, fmt.Errorf("%s: %s", docURL, err)
+		}
+		l.add(docURL, node)
+		if n, ok := l.ids[uri]; ok && fragment != "" {
+			return l.compile(n.raw, n.base, uri)
+		}
+	}
+	if fragment != "" {
+		if !strings.HasPrefix(fragment, "/") {
+			return nil, fmt.Errorf("The anchor %s is not defined", uri)
+		}
+		for _, segment := range strings.Split(fragment[1:], "/") {
+			segment = strings.Replace(strings.Replace(segment, "~1", "/", -1), "~0", "~", -1)
+			// Subschemas with an $id change the base of the references below them.
+			if n, ok := node.(map[string]interface{}); ok {
+				if id, ok := n["$id"].(string); ok {
+					if resolved, err := resolveURI(base, id); err == nil {
+						base, _ = splitFragment(resolved)
+					}
+				}
+			}
+			next, err := pointerStep(node, segment)
+			if err != nil {
+				return nil, fmt.Errorf("The reference %s does not exist", uri)
+			}
+			node = next
+		}
+	}
+	return l.compile(node, base, uri)
+}
+
+// pointerStep returns the child of a JSON value named by a JSON Pointer segment
+func pointerStep(node interface{}, segment string) (interface{}, error) {
+	switch n := node.(type) {
+	case map[string]interface{}:
+		if child, ok := n[segment]; ok {
+			return child, nil
+		}
+	case []interface{}:
+		var i int
+		if _, err := fmt.Sscanf(segment, "%d", &i); err == nil && i >= 0 && i < len(n) {
+			return n[i], nil
+		}
+	}
+	return nil, errors.New("not found")
+}
+
+// escapePointer escapes a JSON Pointer segment
+func escapePointer(segment string) string {
+	return strings.Replace(strings.Replace(segment, "~", "~0", -1), "/", "~1", -1)
+}
+
+// childURI returns the URI of a subschema
+func childURI(uri string, segments ...string) string {
+	if !strings.Contains(uri, "#") {
+		uri += "#"
+	}
+	for _, segment := range segments {
+		uri += "/" + escapePointer(segment)
+	}
+	return uri
+}
+
+// unsupportedKeywords - keywords of draft 2020-12 this implementation would otherwise silently ignore
+var unsupportedKeywords = []string{"$dynamicRef", "$recursiveRef", "unevaluatedProperties", "unevaluatedItems"}
+
+// compile converts a raw schema, uri identifies it so that recursive references terminate
+func (l *schemaLoader) compile(raw interface{}, base, uri string) (*Schema, error) {
+	if s, ok := l.compiled[uri]; ok {
+		return s, nil
+	}
+	s := &Schema{}
+	l.compiled[uri] = s
+	if b, ok := raw.(bool); ok {
+		s.always = &b
+		return s, nil
+	}
+	n, ok := raw.(map[string]interface{})
+	if !ok {
+		return nil, fmt.Errorf("%s is not a schema", uri)
+	}
+	if id, ok := n["$id"].(string); ok {
+		resolved, err := resolveURI(base, id)
+		if err != nil {
+			return nil, err
+		}
+		base, _ = splitFragment(resolved)
+	}
+	for _, keyword := range unsupportedKeywords {
+		if _, ok := n[keyword]; ok {
+			return nil, fmt.Errorf("%s: the %s keyword is not supported", uri, keyword)
+		}
+	}
+	c := schemaCompiler{l: l, n: n, base: base, uri: uri}
+	if ref, ok := n["$ref"].(string); ok {
+		resolved, err := resolveURI(base, ref)
+		if err != nil {
+			return nil, err
+		}
+		if s.ref, err = l.resolve(resolved); err != nil {
+			return nil, err
+		}
+	}
+	switch t := n["type"].(type) {
+	case string:
+		s.types = []string{t}
+	case []interface{}:
+		for _, name := range t {
+			if name, ok := name.(string); ok {
+				s.types = append(s.types, name)
+			}
+		}
+	}
+	if enum, ok := n["enum"].([]interface{}); ok {
+		s.enum = enum
+	}
+	s.constant, s.hasConst = n["const"]
+	s.format, _ = n["format"].(string)
+	s.uniqueItems, _ = n["uniqueItems"].(bool)
+	s.multipleOf = c.number("multipleOf")
+	s.maximum = c.number("maximum")
+	s.exclusiveMaximum = c.number("exclusiveMaximum")
+	s.minimum = c.number("minimum")
+	s.exclusiveMinimum = c.number("exclusiveMinimum")
+	s.maxLength = c.count("maxLength")
+	s.minLength = c.count("minLength")
+	s.maxItems = c.count("maxItems")
+	s.minItems = c.count("minItems")
+	s.maxContains = c.count("maxContains")
+	s.minContains = c.count("minContains")
+	s.maxProperties = c.count("maxProperties")
+	s.minProperties = c.count("minProperties")
+	s.pattern = c.regexp("pattern", n["pattern"])
+	if required, ok := n["required"].([]interface{}); ok {
+		for _, name := range required {
+			if name, ok := name.(string); ok {
+				s.required = append(s.required, name)
+			}
+		}
+	}
+	if deps, ok := n["dependentRequired"].(map[string]interface{}); ok {
+		s.dependentRequired = map[string][]string{}
+		for name, list := range deps {
+			items, _ := list.([]interface{})
+			for _, item := range items {
+				if item, ok := item.(string); ok {
+					s.dependentRequired[name] = append(s.dependentRequired[name], item)
+				}
+			}
+		}
+	}
+	s.allOf = c.list("allOf")
+	s.anyOf = c.list("anyOf")
+	s.oneOf = c.list("oneOf")
+	s.prefixItems = c.list("prefixItems")
+	s.not = c.schema("not")
+	s.ifSchema = c.schema("if")
+	s.thenSchema = c.schema("then")
+	s.elseSchema = c.schema("else")
+	s.additional = c.schema("additionalProperties")
+	s.propertyNames = c.schema("propertyNames")
+	s.items = c.schema("items")
+	s.contains = c.schema("contains")
+	s.properties = c.schemas("properties")
+	s.dependentSchemas = c.schemas("dependentSchemas")
+	if patterns := c.schemas("patternProperties"); patterns != nil {
+		keys := make([]string, 0, len(patterns))
+		for key := range patterns {
+			keys = append(keys, key)
+		}
+		sort.Strings(keys)
+		for _, key := range keys {
+			s.patternProperties = append(s.patternProperties, patternSchema{c.regexp("patternProperties", key), patterns[key]})
+		}
+	}
+	if c.err != nil {
+		return nil, c.err
+	}
+	return s, nil
+}
+
+// schemaCompiler reads the keywords of one raw schema, keeping the first error
+type schemaCompiler struct {
+	l    *schemaLoader
+	n    map[string]interface{}
+	base string
+	uri  string
+	err  error
+}
+
+func (c *schemaCompiler) fail(keyword string, err error) {
+	if c.err == nil {
+		c.err = fmt.Errorf("%s: %s", childURI(c.uri, keyword), err)
+	}
+}
+
+func (c *schemaCompiler) number(keyword string) *schemaNumber {
+	raw, ok := c.n[keyword].(json.Number)
+	if !ok {
+		return nil
+	}
+	r, ok := new(big.Rat).SetString(raw.String())
+	if !ok {
+		c.fail(keyword, errors.New("not a number"))
+		return nil
+	}
+	return &schemaNumber{rat: r, text: raw.String()}
+}
+
+func (c *schemaCompiler) count(keyword string) *int {
+	raw, ok := c.n[keyword].(json.Number)
+	if !ok {
+		return nil
+	}
+	i, err := raw.Int64()
+	if err != nil || i < 0 {
+		c.fail(keyword, errors.New("not a non negative integer"))
+		return nil
+	}
+	n := int(i)
+	return &n
+}
+
+func (c *schemaCompiler) regexp(keyword string, raw interface{}) *regexp.Regexp {
+	pattern, ok := raw.(string)
+	if !ok {
+		return nil
+	}
+	re, err := cachedPattern(pattern)
+	if err != nil {
+		c.fail(keyword, err)
+	}
+	return re
+}
+
+func (c *schemaCompiler) schema(keyword string) *Schema {
+	raw, ok := c.n[keyword]
+	if !ok {
+		return nil
+	}
+	s, err := c.l.compile(raw, c.base, childURI(c.uri, keyword))
+	if err != nil && c.err == nil {
+		c.err = err
+	}
+	return s
+}
+
+func (c *schemaCompiler) list(keyword string) []*Schema {
+	raws, _ := c.n[keyword].([]interface{})
+	var schemas []*Schema
+	for i, raw := range raws {
+		s, err := c.l.compile(raw, c.base, childURI(c.uri, keyword, fmt.Sprint(i)))
+		if err != nil && c.err == nil {
+			c.err = err
+		}
+		schemas = append(schemas, s)
+	}
+	return schemas
+}
+
+func (c *schemaCompiler) schemas(keyword string) map[string]*Schema {
+	raws, ok := c.n[keyword].(map[string]interface{})
+	if !ok {
+		return nil
+	}
+	schemas := make(map[string]*Schema, len(raws))
+	for name, raw := range raws {
+		s, err := c.l.compile(raw, c.base, childURI(c.uri, keyword, name))
+		if err != nil && c.err == nil {
+			c.err = err
+		}
+		schemas[name] = s
+	}
+	return schemas
+}
+
+// schemaState collects the errors of one validation
+type schemaState struct {
+	formats bool
+	errs    SchemaErrors
+}
+
+// fail records a broken keyword, the argument of the message, if any, is its parameter
+func (st *schemaState) fail(pointer, keyword, msg string, args ...interface{}) {
+	se := SchemaError{Pointer: pointer, Keyword: keyword, Message: fmt.Sprintf(msg, args...)}
+	if len(args) > 0 {
+		se.Param = fmt.Sprint(args[0])
+	}
+	st.errs = append(st.errs, se)
+}
+
+// Validate - checks a JSON document decoded with json.Number numbers, formats are annotations unless assertFormats is set
+func (s *Schema) Validate(v interface{}, assertFormats bool) SchemaErrors {
+	st := &schemaState{formats: assertFormats}
+	s.validate(st, v, "", "")
+	return st.errs
+}
+
+// valid reports whether a value matches a subschema without collecting its errors
+func (s *Schema) valid(st *schemaState, v interface{}) bool {
+	sub := &schemaState{formats: st.formats}
+	s.validate(sub, v, "", "")
+	return len(sub.errs) == 0
+}
+
+// jsonType returns the JSON Schema type of a decoded value
+func jsonType(v interface{}) string {
+	switch v := v.(type) {
+	case nil:
+		return "null"
+	case bool:
+		return "boolean"
+	case string:
+		return "string"
+	case []interface{}:
+		return "array"
+	case map[string]interface{}:
+		return "object"
+	case json.Number:
+		if r, ok := new(big.Rat).SetString(v.String()); ok && r.IsInt() {
+			return "integer"
+		}
+		return "number"
+	}
+	return ""
+}
+
+// jsonEqual compares decoded JSON values, numbers by value
+func jsonEqual(a, b interface{}) bool {
+	switch a := a.(type) {
+	case json.Number:
+		b, ok := b.(json.Number)
+		if !ok {
+			return false
+		}
+		x, okx := new(big.Rat).SetString(a.String())
+		y, oky := new(big.Rat).SetString(b.String())
+		return okx && oky && x.Cmp(y) == 0
+	case []interface{}:
+		b, ok := b.([]interface{})
+		if !ok || len(a) != len(b) {
+			return false
+		}
+		for i := range a {
+			if !jsonEqual(a[i], b[i]) {
+				return false
+			}
+		}
+		return true
+	case map[string]interface{}:
+		b, ok := b.(map[string]interface{})
+		if !ok || len(a) != len(b) {
+			return false
+		}
+		for k, v := range a {
+			if w, ok := b[k]; !ok || !jsonEqual(v, w) {
+				return false
+			}
+		}
+		return true
+	}
+	return a == b
+}
+
+// checkFormat reports whether a string matches a format, unknown formats match anything
+func checkFormat(format, s string) bool {
+	var err error
+	switch format {
+	case "email":
+		var a *mail.Address
+		if a, err = mail.ParseAddress(s); err == nil && a.Address != s {
+			return false
+		}
+	case "uri":
+		var u *url.URL
+		if u, err = url.Parse(s); err == nil && !u.IsAbs() {
+			return false
+		}
+	case "uuid":
+		return uuidPattern.MatchString(s)
+	case "date-time":
+		_, err = time.Parse(time.RFC3339Nano, s)
+	case "date":
+		_, err = time.Parse("2006-01-02", s)
+	case "time":
+		_, err = time.Parse("15:04:05Z07:00", s)
+	case "ipv4":
+		ip := net.ParseIP(s)
+		return ip != nil && ip.To4() != nil && !strings.Contains(s, ":")
+	case "ipv6":
+		return net.ParseIP(s) != nil && strings.Contains(s, ":")
+	}
+	return err == nil
+}
+
+func (s *Schema) validate(st *schemaState, v interface{}, pointer, keyword string) {
+	if s.always != nil {
+		if !*s.always {
+			st.fail(pointer, keyword, "is not allowed")
+		}
+		return
+	}
+	if s.ref != nil {
+		s.ref.validate(st, v, pointer, keyword+"/$ref")
+	}
+	if len(s.types) > 0 {
+		t, ok := jsonType(v), false
+		for _, allowed := range s.types {
+			ok = ok || allowed == t || (allowed == "number" && t == "integer")
+		}
+		if !ok {
+			st.fail(pointer, keyword+"/type", "must be of type %s", strings.Join(s.types, " or "))
+			return
+		}
+	}
+	if s.enum != nil {
+		ok := false
+		for _, allowed := range s.enum {
+			ok = ok || jsonEqual(v, allowed)
+		}
+		if !ok {
+			st.fail(pointer, keyword+"/enum", "must be one of the allowed values")
+		}
+	}
+	if s.hasConst && !jsonEqual(v, s.constant) {
+		st.fail(pointer, keyword+"/const", "must equal the constant value")
+	}
+	switch v := v.(type) {
+	case json.Number:
+		s.validateNumber(st, v, pointer, keyword)
+	case string:
+		n := utf8.RuneCountInString(v)
+		if s.minLength != nil && n < *s.minLength {
+			st.fail(pointer, keyword+"/minLength", "must be at least %d characters long", *s.minLength)
+		}
+		if s.maxLength != nil && n > *s.maxLength {
+			st.fail(pointer, keyword+"/maxLength", "must be at most %d characters long", *s.maxLength)
+		}
+		if s.pattern != nil && !s.pattern.MatchString(v) {
+			st.fail(pointer, keyword+"/pattern", "must match %s", s.pattern)
+		}
+		if st.formats && s.format != "" && !checkFormat(s.format, v) {
+			st.fail(pointer, keyword+"/format", "must be a valid %s", s.format)
+		}
+	case []interface{}:
+		s.validateArray(st, v, pointer, keyword)
+	case map[string]interface{}:
+		s.validateObject(st, v, pointer, keyword)
+	}
+	for i, sub := range s.allOf {
+		sub.validate(st, v, pointer, fmt.Sprintf("%s/allOf/%d", keyword, i))
+	}
+	if len(s.anyOf) > 0 {
+		ok := false
+		for _, sub := range s.anyOf {
+			ok = ok || sub.valid(st, v)
+		}
+		if !ok {
+			st.fail(pointer, keyword+"/anyOf", "must match at least one schema")
+		}
+	}
+	if len(s.oneOf) > 0 {
+		matches := 0
+		for _, sub := range s.oneOf {
+			if sub.valid(st, v) {
+				matches++
+			}
+		}
+		if matches != 1 {
+			st.fail(pointer, keyword+"/oneOf", "must match exactly one schema, it matches %d", matches)
+		}
+	}
+	if s.not != nil && s.not.valid(st, v) {
+		st.fail(pointer, keyword+"/not", "must not match the schema")
+	}
+	if s.ifSchema != nil {
+		if s.ifSchema.valid(st, v) {
+			if s.thenSchema != nil {
+				s.thenSchema.validate(st, v, pointer, keyword+"/then")
+			}
+		} else if s.elseSchema != nil {
+			s.elseSchema.validate(st, v, pointer, keyword+"/else")
+		}
+	}
+}
+
+func (s *Schema) validateNumber(st *schemaState, v json.Number, pointer, keyword string) {
+	x, ok := new(big.Rat).SetString(v.String())
+	if !ok {
+		return
+	}
+	if s.multipleOf != nil && s.multipleOf.rat.Sign() != 0 && !new(big.Rat).Quo(x, s.multipleOf.rat).IsInt() {
+		st.fail(pointer, keyword+"/multipleOf", "must be a multiple of %s", s.multipleOf.text)
+	}
+	if s.minimum != nil && x.Cmp(s.minimum.rat) < 0 {
+		st.fail(pointer, keyword+"/minimum", "must be at least %s", s.minimum.text)
+	}
+	if s.exclusiveMinimum != nil && x.Cmp(s.exclusiveMinimum.rat) <= 0 {
+		st.fail(pointer, keyword+"/exclusiveMinimum", "must be greater than %s", s.exclusiveMinimum.text)
+	}
+	if s.maximum != nil && x.Cmp(s.maximum.rat) > 0 {
+		st.fail(pointer, keyword+"/maximum", "must be at most %s", s.maximum.text)
+	}
+	if s.exclusiveMaximum != nil && x.Cmp(s.exclusiveMaximum.rat) >= 0 {
+		st.fail(pointer, keyword+"/exclusiveMaximum", "must be less than %s", s.exclusiveMaximum.text)
+	}
+}
+
+func (s *Schema) validateArray(st *schemaState, v []interface{}, pointer, keyword string) {
+	if s.minItems != nil && len(v) < *s.minItems {
+		st.fail(pointer, keyword+"/minItems", "must have at least %d items", *s.minItems)
+	}
+	if s.maxItems != nil && len(v) > *s.maxItems {
+		st.fail(pointer, keyword+"/maxItems", "must have at most %d items", *s.maxItems)
+	}
+	if s.uniqueItems {
+	unique:
+		for i := range v {
+			for j := 0; j < i; j++ {
+				if jsonEqual(v[i], v[j]) {
+					st.fail(fmt.Sprintf("%s/%d", pointer, i), keyword+"/uniqueItems", "must not repeat item %d", j)
+					break unique
+				}
+			}
+		}
+	}
+	for i, item := range v {
+		at := fmt.Sprintf("%s/%d", pointer, i)
+		if i < len(s.prefixItems) {
+			s.prefixItems[i].validate(st, item, at, fmt.Sprintf("%s/prefixItems/%d", keyword, i))
+		} else if s.items != nil {
+			s.items.validate(st, item, at, keyword+"/items")
+		}
+	}
+	if s.contains == nil {
+		return
+	}
+	matches := 0
+	for _, item := range v {
+		if s.contains.valid(st, item) {
+			matches++
+		}
+	}
+	min := 1
+	if s.minContains != nil {
+		min = *s.minContains
+	}
+	if matches < min {
+		st.fail(pointer, keyword+"/contains", "must contain at least %d matching items", min)
+	}
+	if s.maxContains != nil && matches > *s.maxContains {
+		st.fail(pointer, keyword+"/maxContains", "must contain at most %d matching items", *s.maxContains)
+	}
+}
+
+func (s *Schema) validateObject(st *schemaState, v map[string]interface{}, pointer, keyword string) {
+	if s.minProperties != nil && len(v) < *s.minProperties {
+		st.fail(pointer, keyword+"/minProperties", "must have at least %d properties", *s.minProperties)
+	}
+	if s.maxProperties != nil && len(v) > *s.maxProperties {
+		st.fail(pointer, keyword+"/maxProperties", "must have at most %d properties", *s.maxProperties)
+	}
+	for _, name := range s.required {
+		if _, ok := v[name]; !ok {
+			st.fail(pointer+"/"+escapePointer(name), keyword+"/required", "is required")
+		}
+	}
+	// Visit properties in order so that errors are reported in a stable order.
+	names := make([]string, 0, len(v))
+	for name := range v {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+	for _, name := range names {
+		at := pointer + "/" + escapePointer(name)
+		for _, dependency := range s.dependentRequired[name] {
+			if _, ok := v[dependency]; !ok {
+				st.fail(pointer+"/"+escapePointer(dependency), keyword+"/dependentRequired", "is required when %s is present", name)
+			}
+		}
+		if sub, ok := s.dependentSchemas[name]; ok {
+			sub.validate(st, v, pointer, keyword+"/dependentSchemas/"+escapePointer(name))
+		}
+		if s.propertyNames != nil {
+			s.propertyNames.validate(st, name, at, keyword+"/propertyNames")
+		}
+		matched := false
+		if sub, ok := s.properties[name]; ok {
+			matched = true
+			sub.validate(st, v[name], at, keyword+"/properties/"+escapePointer(name))
+		}
+		for _, p := range s.patternProperties {
+			if p.pattern.MatchString(name) {
+				matched = true
+				p.schema.validate(st, v[name], at, keyword+"/patternProperties/"+escapePointer(p.pattern.String()))
+			}
+		}
+		if !matched && s.additional != nil {
+			s.additional.validate(st, v[name], at, keyword+"/additionalProperties")
+		}
+	}
+}
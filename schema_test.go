@@ -0,0 +1,236 @@
+package rest
+
+import (
+	"encoding/json"
+	"io/ioutil"
+	"net/http"
+	"os"
+	"path/filepath"
+	"reflect"
+	"sync"
+	"testing"
+	"time"
+)
+
+func writeSchemas(t *testing.T, files map[string]string) string {
+	dir, err := ioutil.TempDir("", "rest")
+	if err != nil {
+		t.Fatal(err)
+	}
+	for name, schema := range files {
+		path := filepath.Join(dir, name)
+		if err = os.MkdirAll(filepath.Dir(path), 0755); err != nil {
+			t.Fatal(err)
+		}
+		if err = ioutil.WriteFile(path, []byte(schema), 0644); err != nil {
+			t.Fatal(err)
+		}
+	}
+	return dir
+}
+
+func TestSchemaValidator(t *testing.T) {
+	dir := writeSchemas(t, map[string]string{
+		"order.json": `{
+			"$schema": "https://json-schema.org/draft/2020-12/schema",
+			"type": "object",
+			"required": ["items"],
+			"properties": {
+				"id": {"type": "string"},
+				"items": {"type": "array", "minItems": 1, "items": {"$ref": "common/item.json"}},
+				"note": {"type": "string", "maxLength": 10}
+			},
+			"additionalProperties": false
+		}`,
+		"common/item.json": `{
+			"type": "object",
+			"required": ["sku", "quantity"],
+			"properties": {
+				"sku": {"$ref": "defs.json#/$defs/sku"},
+				"quantity": {"type": "integer", "minimum": 1}
+			}
+		}`,
+		"common/defs.json": `{"$defs": {"sku": {"type": "string", "pattern": "^[A-Z]{2}-[0-9]+$"}}}`,
+	})
+	defer os.RemoveAll(dir)
+	order, err := LoadSchema(filepath.Join(dir, "order.json"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	tests := []struct {
+		action   string
+		body     string
+		status   int
+		expected []SchemaError
+	}{
+		{INSERTONE, `{"items": [{"sku": "AB-1", "quantity": 2}]}`, http.StatusCreated, nil},
+		{INSERTONE, `{"items": [{"sku": "ab-1", "quantity": 0}, {"sku": "AB-2"}], "note": "Leave at the door", "gift": true}`,
+			http.StatusUnprocessableEntity, []SchemaError{
+				{"/gift", "/additionalProperties", "", "is not allowed"},
+				{"/items/0/quantity", "/properties/items/items/$ref/properties/quantity/minimum", "1", "must be at least 1"},
+				{"/items/0/sku", "/properties/items/items/$ref/properties/sku/$ref/pattern", "^[A-Z]{2}-[0-9]+$", "must match ^[A-Z]{2}-[0-9]+$"},
+				{"/items/1/quantity", "/properties/items/items/$ref/required", "", "is required"},
+				{"/note", "/properties/note/maxLength", "10", "must be at most 10 characters long"},
+			}},
+		{INSERTONE, `{"items": "AB-1"}`, http.StatusUnprocessableEntity, []SchemaError{
+			{"/items", "/properties/items/type", "array", "must be of type array"},
+		}},
+		{INSERTONE, `{"items": [`, http.StatusBadRequest, nil},
+		{INSERTONE, ``, http.StatusBadRequest, nil},
+		{INSERTMANY, `[{"items": [{"sku": "AB-1", "quantity": 1}]}, {"items": []}]`, http.StatusUnprocessableEntity, []SchemaError{
+			{"/1/items", "/items/properties/items/minItems", "1", "must have at least 1 items"},
+		}},
+		{INSERTMANY, `[{"items": [{"sku": "AB-1", "quantity": 1}]}]`, http.StatusCreated, nil},
+	}
+	service := NewFakeService(FakeScenario{})
+	for i, test := range tests {
+		resource := NewResource("orders").
+			UseType(reflect.TypeOf(FakeOrder{})).
+			UseStorage(NewMemory(reflect.TypeOf(FakeOrder{}))).
+			UseValidator(NewSchemaValidator().UseSchema(INSERTONE, order)).
+			UseSerializer(&JSON{})
+		w := serve(service.process(resource, test.action), "POST", "http://foo.bar/orders", test.body)
+		if w.Code != test.status {
+			t.Errorf("#%d Error, expected %d, got %d: %s", i, test.status, w.Code, w.Body.String())
+			continue
+		}
+		if test.expected == nil {
+			continue
+		}
+		var errs []SchemaError
+		json.Unmarshal(w.Body.Bytes(), &errs)
+		if !reflect.DeepEqual(errs, test.expected) {
+			t.Errorf("#%d Error, expected %+v, got %+v", i, test.expected, errs)
+		}
+	}
+}
+
+func TestSchema(t *testing.T) {
+	tests := []struct {
+		schema string
+		doc    string
+		errors int
+	}{
+		{`{"type": "integer"}`, `1.0`, 0},
+		{`{"type": "integer"}`, `1.5`, 1},
+		{`{"type": ["string", "null"]}`, `null`, 0},
+		{`{"multipleOf": 0.01}`, `19.99`, 0},
+		{`{"multipleOf": 0.01}`, `19.999`, 1},
+		{`{"exclusiveMinimum": 0, "maximum": 10}`, `0`, 1},
+		{`{"minLength": 2}`, `"é"`, 1},
+		{`{"enum": [1, "a"]}`, `1.0`, 0},
+		{`{"const": {"a": [1]}}`, `{"a": [1]}`, 0},
+		{`{"uniqueItems": true}`, `[1, 1.0]`, 1},
+		{`{"prefixItems": [{"type": "string"}], "items": {"type": "integer"}}`, `["a", 1, 2]`, 0},
+		{`{"prefixItems": [{"type": "string"}], "items": false}`, `["a", 1]`, 1},
+		{`{"contains": {"type": "string"}, "maxContains": 1}`, `[1, "a", "b"]`, 1},
+		{`{"contains": {"type": "string"}, "minContains": 0}`, `[1]`, 0},
+		{`{"oneOf": [{"type": "integer"}, {"minimum": 0}]}`, `1`, 1},
+		{`{"anyOf": [{"type": "integer"}, {"minimum": 0}]}`, `-1.5`, 1},
+		{`{"not": {"type": "string"}}`, `"a"`, 1},
+		{`{"if": {"required": ["card"]}, "then": {"required": ["cvv"]}, "else": {"required": ["iban"]}}`, `{"card": "4242"}`, 1},
+		{`{"dependentRequired": {"card": ["cvv"]}, "propertyNames": {"maxLength": 4}}`, `{"card": "4242", "iban": "x"}`, 1},
+		{`{"patternProperties": {"^x-": {"type": "string"}}, "additionalProperties": false}`, `{"x-a": "a", "y": 1}`, 1},
+		{`{"minProperties": 1}`, `{}`, 1},
+		{`{"$defs": {"node": {"type": "object", "properties": {"next": {"$ref": "#/$defs/node"}}, "required": ["v"]}}, "$ref": "#/$defs/node"}`,
+			`{"v": 1, "next": {"v": 2, "next": {}}}`, 1},
+		{`{"$defs": {"id": {"$anchor": "id", "type": "string"}}, "properties": {"id": {"$ref": "#id"}}}`, `{"id": 1}`, 1},
+		{`{"$id": "https://example.com/order", "$defs": {"a": {"$id": "item", "type": "integer"}}, "items": {"$ref": "item"}}`, `[1, "a"]`, 1},
+		{`{"format": "email"}`, `"nope"`, 0},
+		{`false`, `1`, 1},
+	}
+	for i, test := range tests {
+		s, err := ParseSchema([]byte(test.schema))
+		if err != nil {
+			t.Errorf("#%d Error, unexpected error %s", i, err)
+			continue
+		}
+		doc, _ := decodeNumbers([]byte(test.doc))
+		if errs := s.Validate(doc, false); len(errs) != test.errors {
+			t.Errorf("#%d Error, expected %d errors, got %+v", i, test.errors, errs)
+		}
+	}
+}
+
+func TestSchemaFormats(t *testing.T) {
+	tests := []struct {
+		format string
+		value  string
+		valid  bool
+	}{
+		{"email", "otieno@example.com", true},
+		{"email", "Otieno <otieno@example.com>", false},
+		{"uri", "https://example.com/a", true},
+		{"uri", "/a", false},
+		{"uuid", "8e7a4bb8-d3a4-4ad5-a5a6-9d1ef1ed4d3b", true},
+		{"date-time", "2017-03-01T10:00:00Z", true},
+		{"date", "2017-02-30", false},
+		{"ipv4", "10.0.0.1", true},
+		{"ipv6", "10.0.0.1", false},
+		{"hostname", "anything", true},
+	}
+	for i, test := range tests {
+		s, _ := ParseSchema([]byte(`{"format": "` + test.format + `"}`))
+		if valid := len(s.Validate(test.value, true)) == 0; valid != test.valid {
+			t.Errorf("#%d Error, expected %s to be valid %v", i, test.value, test.valid)
+		}
+	}
+}
+
+func TestLoadSchemaErrors(t *testing.T) {
+	dir := writeSchemas(t, map[string]string{
+		"missing.json":     `{"properties": {"a": {"$ref": "nowhere.json"}}}`,
+		"pointer.json":     `{"$ref": "#/$defs/nowhere"}`,
+		"remote.json":      `{"$ref": "https://example.com/schema.json"}`,
+		"unsupported.json": `{"type": "object", "unevaluatedProperties": false}`,
+		"pattern.json":     `{"pattern": "(["}`,
+		"invalid.json":     `{"type": `,
+	})
+	defer os.RemoveAll(dir)
+	for _, name := range []string{"missing.json", "pointer.json", "remote.json", "unsupported.json", "pattern.json", "invalid.json", "absent.json"} {
+		if _, err := LoadSchema(filepath.Join(dir, name)); err == nil {
+			t.Errorf("Error, expected %s to fail to load", name)
+		}
+	}
+}
+
+func TestSchemaValidatorConcurrentRequests(t *testing.T) {
+	named, err := ParseSchema([]byte(`{"type": "object", "properties": {"name": {"type": "string", "maxLength": 5}}}`))
+	if err != nil {
+		t.Fatal(err)
+	}
+	resource := NewResource("orders").
+		UseType(reflect.TypeOf(FakeOrder{})).
+		UseStorage(NewMemory(reflect.TypeOf(FakeOrder{}))).
+		UseValidator(NewSchemaValidator().UseSchema(INSERTONE, named)).
+		UseSerializer(&JSON{}).
+		AddHook(BEFOREDECODE, func(model *Model) error {
+			// Keep requests checking their bodies at the same time
+			time.Sleep(5 * time.Millisecond)
+			return nil
+		})
+	service := NewFakeService(FakeScenario{})
+	codes := make([]int, 50)
+	var wg sync.WaitGroup
+	for i := range codes {
+		wg.Add(1)
+		go func(i int) {
+			defer wg.Done()
+			body := `{"name": "Oti"}`
+			if i%2 == 1 {
+				body = `{"name": "Otieno Kamau"}`
+			}
+			codes[i] = serve(service.InsertOne(resource), "POST", "http://foo.bar/orders", body).Code
+		}(i)
+	}
+	wg.Wait()
+	for i, code := range codes {
+		expected := http.StatusCreated
+		if i%2 == 1 {
+			expected = http.StatusUnprocessableEntity
+		}
+		if code != expected {
+			t.Errorf("#%d Error, expected %d, got %d", i, expected, code)
+		}
+	}
+}
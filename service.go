@@ -4,9 +4,15 @@ import "net/http"
 
 // Service holds application scope broker, logger and metrics adapters
 type Service struct {
-	Broker  Broker
-	Logger  Logger
-	Metrics Metrics
+	Broker        Broker
+	Logger        Logger
+	Metrics       Metrics
+	Compression   *Compression
+	Catalog       *Catalog
+	Hooks         map[string][]Hook
+	Authenticator Authenticator
+	Tenancy       *Tenancy
+	RateLimits    map[string][]*RateLimit
 }
 
 // UseBroker - set the desired broker
@@ -24,6 +30,16 @@ func (s *Service) UseMetrics(m Metrics) {
 	s.Metrics = m
 }
 
+// UseCompression - compress responses and decompress request bodies
+func (s *Service) UseCompression(c *Compression) {
+	s.Compression = c
+}
+
+// UseCatalog - translate the messages of error responses to the language the client prefers
+func (s *Service) UseCatalog(c *Catalog) {
+	s.Catalog = c
+}
+
 // Broker is an event stream adapter to notify other microservices of state changes
 type Broker interface {
 	Publish(event string, v interface{}) error
@@ -45,6 +61,7 @@ type Metrics interface {
 type Event struct {
 	Request  *http.Request
 	Response *Response
+	Tenant   string
 }
 
 // NewService -
@@ -0,0 +1,919 @@
+package rest
+
+import (
+	"context"
+	"database/sql"
+	"fmt"
+	"net/http"
+	"reflect"
+	"strings"
+)
+
+// Dialect - the flavour of SQL spoken by a database
+type Dialect interface {
+	// Placeholder returns the parameter marker for the nth (1 based) argument
+	Placeholder(n int) string
+	// Quote quotes a table or column name
+	Quote(identifier string) string
+	// Upsert returns the clause appended to an INSERT to update the row when key already exists and condition, a
+	// boolean expression on the stored row that may hold ? placeholders, is empty or holds. The condition may be
+	// repeated in the clause, its arguments are bound at each occurrence.
+	Upsert(key string, columns []string, condition string) string
+	// Limit returns the LIMIT and OFFSET clause, a zero limit means no limit
+	Limit(limit, offset int) string
+	// Returning reports whether INSERT ... RETURNING reads generated ids instead of LastInsertId
+	Returning() bool
+	// IsConflict reports whether an error is a unique or primary key constraint violation
+	IsConflict(err error) bool
+}
+
+type postgres struct{}
+type mysql struct{}
+type sqlite struct{}
+
+var (
+	// PostgreSQL - the dialect of PostgreSQL 9.5 and newer
+	PostgreSQL Dialect = postgres{}
+	// MySQL - the dialect of MySQL and MariaDB
+	MySQL Dialect = mysql{}
+	// SQLite - the dialect of SQLite 3.24 and newer
+	SQLite Dialect = sqlite{}
+)
+
+func (postgres) Placeholder(n int) string { return fmt.Sprintf("$%d", n) }
+func (mysql) Placeholder(n int) string    { return "?" }
+func (sqlite) Placeholder(n int) string   { return "?" }
+
+func (postgres) Quote(s string) string { return `"` + strings.Replace(s, `"`, `""`, -1) + `"` }
+func (mysql) Quote(s string) string    { return "`" + strings.Replace(s, "`", "``", -1) + "`" }
+func (sqlite) Quote(s string) string   { return `"` + strings.Replace(s, `"`, `""`, -1) + `"` }
+
+func (d postgres) Upsert(key string, columns []string, condition string) string {
+	return onConflict(d, key, columns, condition, "EXCLUDED")
+}
+
+func (d sqlite) Upsert(key string, columns []string, condition string) string {
+	return onConflict(d, key, columns, condition, "excluded")
+}
+
+func onConflict(d Dialect, key string, columns []string, condition, excluded string) string {
+	var sets []string
+	for _, c := range columns {
+		if c != key {
+			sets = append(sets, d.Quote(c)+" = "+excluded+"."+d.Quote(c))
+		}
+	}
+	if len(sets) == 0 {
+		return " ON CONFLICT (" + d.Quote(key) + ") DO NOTHING"
+	}
+	clause := " ON CONFLICT (" + d.Quote(key) + ") DO UPDATE SET " + strings.Join(sets, ", ")
+	if condition != "" {
+		clause += " WHERE " + condition
+	}
+	return clause
+}
+
+// Upsert - MySQL has no conditional ON DUPLICATE KEY UPDATE, each column keeps its value unless the condition holds.
+// Columns are assigned in order, so the columns the condition reads must come last.
+func (d mysql) Upsert(key string, columns []string, condition string) string {
+	var sets []string
+	for _, c := range columns {
+		value := "VALUES(" + d.Quote(c) + ")"
+		if condition != "" {
+			value = "IF(" + condition + ", " + value + ", " + d.Quote(c) + ")"
+		}
+		sets = append(sets, d.Quote(c)+" = "+value)
+	}
+	return " ON DUPLICATE KEY UPDATE " + strings.Join(sets, ", ")
+}
+
+func (postgres) Limit(limit, offset int) string {
+	return limitClause(limit, offset, "")
+}
+
+func (mysql) Limit(limit, offset int) string {
+	return limitClause(limit, offset, "18446744073709551615")
+}
+
+func (sqlite) Limit(limit, offset int) string {
+	return limitClause(limit, offset, "-1")
+}
+
+// limitClause builds LIMIT and OFFSET, unlimited is the LIMIT a dialect needs to allow a bare OFFSET
+func limitClause(limit, offset int, unlimited string) string {
+	clause := ""
+	switch {
+	case limit > 0:
+		clause = fmt.Sprintf(" LIMIT %d", limit)
+	case offset > 0 && unlimited != "":
+		clause = " LIMIT " + unlimited
+	}
+	if offset > 0 {
+		clause += fmt.Sprintf(" OFFSET %d", offset)
+	}
+	return clause
+}
+
+func (postgres) Returning() bool { return true }
+func (mysql) Returning() bool    { return false }
+func (sqlite) Returning() bool   { return false }
+
+// sqlState is implemented by the errors of drivers that expose SQLSTATE codes
+type sqlState interface {
+	SQLState() string
+}
+
+func (postgres) IsConflict(err error) bool {
+	if e, ok := err.(sqlState); ok {
+		return e.SQLState() == "23505"
+	}
+	return strings.Contains(err.Error(), "duplicate key value violates unique constraint") || strings.Contains(err.Error(), "23505")
+}
+
+func (mysql) IsConflict(err error) bool {
+	return strings.Contains(err.Error(), "Error 1062") || strings.Contains(err.Error(), "Duplicate entry")
+}
+
+func (sqlite) IsConflict(err error) bool {
+	return strings.Contains(err.Error(), "UNIQUE constraint failed") || strings.Contains(err.Error(), "PRIMARY KEY must be unique")
+}
+
+// column - a struct field mapped to a table column with a `db` tag
+type column struct {
+	Name  string
+	Field string
+	Index []int
+	Type  reflect.Type
+}
+
+// tableColumns returns the fields of t tagged with `db`, Field holds the JSON name used in queries
+func tableColumns(t reflect.Type) []column {
+	var columns []column
+	var walk func(t reflect.Type, index []int)
+	walk = func(t reflect.Type, index []int) {
+		for i := 0; i < t.NumField(); i++ {
+			sf := t.Field(i)
+			idx := append(append([]int{}, index...), i)
+			name := strings.Split(sf.Tag.Get("db"), ",")[0]
+			if name == "-" {
+				continue
+			}
+			if name == "" {
+				ft := sf.Type
+				if ft.Kind() == reflect.Ptr {
+					ft = ft.Elem()
+				}
+				if sf.Anonymous && ft.Kind() == reflect.Struct && ft != timeType {
+					walk(ft, idx)
+				}
+				continue
+			}
+			columns = append(columns, column{Name: name, Index: idx, Type: sf.Type})
+		}
+	}
+	walk(t, nil)
+	for i, c := range columns {
+		for _, f := range typeFields(t) {
+			if reflect.DeepEqual(f.Index, c.Index) {
+				columns[i].Field = f.Name
+			}
+		}
+	}
+	return columns
+}
+
+// SQL - a database/sql Storage mapping the resource type to a table with `db` struct tags
+type SQL struct {
+	*Context
+	DB      *sql.DB
+	Dialect Dialect
+	Table   string
+	t       reflect.Type
+	id      identity
+	key     column
+	columns []column
+}
+
+// NewSQL - creates a Storage for documents of type t in table, it panics when t has no id column
+func NewSQL(db *sql.DB, dialect Dialect, table string, t reflect.Type) *SQL {
+	for t.Kind() == reflect.Ptr {
+		t = t.Elem()
+	}
+	id, err := resolveIdentity(t)
+	if err != nil {
+		panic(err)
+	}
+	s := &SQL{DB: db, Dialect: dialect, Table: table, t: t, id: id, columns: tableColumns(t)}
+	for _, c := range s.columns {
+		if reflect.DeepEqual(c.Index, id.Index) {
+			s.key = c
+		}
+	}
+	if s.key.Name == "" {
+		panic(fmt.Errorf("%s has no db tag on its id field", t))
+	}
+	return s
+}
+
+// UseContext -
+func (s *SQL) UseContext(c *Context) {
+	s.Context = c
+}
+
+// Clone - returns a SQL storage for the same table
+func (s *SQL) Clone() Storage {
+	c := *s
+	c.Context = nil
+	return &c
+}
+
+func (s *SQL) fail(status int, err error) error {
+	s.SetResponseStatus(status)
+	s.SetResponseBody(err.Error())
+	return err
+}
+
+// failQuery maps a database error to a conflict or an internal server error
+func (s *SQL) failQuery(err error, id string) error {
+	if s.Dialect.IsConflict(err) {
+		return s.fail(http.StatusConflict, conflict(id))
+	}
+	s.SetResponseStatus(http.StatusInternalServerError)
+	s.SetResponseBody(http.StatusText(http.StatusInternalServerError))
+	return err
+}
+
+// placeholders - a Dialect leaving ? placeholders as they are, for clauses added to another statement later
+type placeholders struct {
+	Dialect
+}
+
+func (placeholders) Placeholder(n int) string { return "?" }
+
+// statement accumulates SQL text and its arguments, numbering placeholders as they are added
+type statement struct {
+	dialect Dialect
+	text    []string
+	args    []interface{}
+}
+
+func (st *statement) add(text string, args ...interface{}) *statement {
+	parts := strings.SplitN(text, "?", len(args)+1)
+	text = parts[0]
+	for i, arg := range args {
+		st.args = append(st.args, arg)
+		text += st.dialect.Placeholder(len(st.args)) + parts[i+1]
+	}
+	st.text = append(st.text, text)
+	return st
+}
+
+func (st *statement) String() string {
+	return strings.Join(st.text, "")
+}
+
+func (s *SQL) newStatement(text string, args ...interface{}) *statement {
+	return (&statement{dialect: s.Dialect}).add(text, args...)
+}
+
+func (s *SQL) columnNames(skipKey bool) []string {
+	var names []string
+	for _, c := range s.columns {
+		if skipKey && c.Name == s.key.Name {
+			continue
+		}
+		names = append(names, c.Name)
+	}
+	return names
+}
+
+func (s *SQL) quoted(names []string) string {
+	q := make([]string, len(names))
+	for i, n := range names {
+		q[i] = s.Dialect.Quote(n)
+	}
+	return strings.Join(q, ", ")
+}
+
+func (s *SQL) columnFor(jsonName string) (column, bool) {
+	for _, c := range s.columns {
+		if c.Field == jsonName {
+			return c, true
+		}
+	}
+	return column{}, false
+}
+
+// where appends the query filters, filters on fields without a column match nothing
+func (s *SQL) where(st *statement, q *Query) {
+	s.filter(st, q, "")
+}
+
+// filter appends the query filters with their columns qualified by table when it is set
+func (s *SQL) filter(st *statement, q *Query, table string) {
+	if q == nil {
+		return
+	}
+	for _, f := range q.Filters {
+		c, ok := s.columnFor(f.Field)
+		if !ok {
+			st.add(" AND 1 = 0")
+			continue
+		}
+		col := s.Dialect.Quote(c.Name)
+		if table != "" {
+			col = s.Dialect.Quote(table) + "." + col
+		}
+		switch f.Operator {
+		case EQ:
+			st.add(" AND "+col+" = ?", f.Value)
+		case NE:
+			st.add(" AND "+col+" <> ?", f.Value)
+		case GT:
+			st.add(" AND "+col+" > ?", f.Value)
+		case GTE:
+			st.add(" AND "+col+" >= ?", f.Value)
+		case LT:
+			st.add(" AND "+col+" < ?", f.Value)
+		case LTE:
+			st.add(" AND "+col+" <= ?", f.Value)
+		case LIKE:
+			st.add(" AND "+col+" LIKE ?", f.Value)
+		case IN:
+			marks := strings.TrimSuffix(strings.Repeat("?, ", len(f.Values)), ", ")
+			st.add(" AND "+col+" IN ("+marks+")", f.Values...)
+		}
+	}
+}
+
+// CheckQuery - rejects sort keys, the cursor's included, on fields without a column
+func (s *SQL) CheckQuery(q *Query) error {
+	keys := q.Sort
+	if q.Cursor != nil {
+		keys = append(append([]Sort{}, keys...), q.Cursor.Sort...)
+	}
+	for _, k := range keys {
+		if _, ok := s.columnFor(k.Field); !ok {
+			return fmt.Errorf("Field %q can not be sorted", k.Field)
+		}
+	}
+	return nil
+}
+
+// orderBy appends the ORDER BY clause, reversed when paging backwards
+func (s *SQL) orderBy(st *statement, keys []Sort, reverse bool) {
+	var terms []string
+	for _, k := range keys {
+		c, _ := s.columnFor(k.Field)
+		dir := " ASC"
+		if k.Descending != reverse {
+			dir = " DESC"
+		}
+		terms = append(terms, s.Dialect.Quote(c.Name)+dir)
+	}
+	if len(terms) > 0 {
+		st.add(" ORDER BY " + strings.Join(terms, ", "))
+	}
+}
+
+// after appends the keyset condition selecting rows after, or before when reverse is set, the cursor values
+func (s *SQL) after(st *statement, c *Cursor, reverse bool) {
+	st.add(" AND (")
+	for i := range c.Sort {
+		if i > 0 {
+			st.add(" OR ")
+		}
+		st.add("(")
+		for j := 0; j <= i; j++ {
+			col, _ := s.columnFor(c.Sort[j].Field)
+			op := " = ?"
+			if j == i {
+				op = " > ?"
+				if c.Sort[j].Descending != reverse {
+					op = " < ?"
+				}
+			}
+			if j > 0 {
+				st.add(" AND ")
+			}
+			st.add(s.Dialect.Quote(col.Name)+op, c.Values[j])
+		}
+		st.add(")")
+	}
+	st.add(")")
+}
+
+// args returns the column values of a document in column order
+func (s *SQL) args(doc reflect.Value, names []string) []interface{} {
+	var args []interface{}
+	for _, name := range names {
+		for _, c := range s.columns {
+			if c.Name == name {
+				args = append(args, fieldValue(doc, c.Index).Interface())
+			}
+		}
+	}
+	return args
+}
+
+// scan reads a row into a new document
+func (s *SQL) scan(rows interface {
+	Scan(...interface{}) error
+}) (reflect.Value, error) {
+	doc := reflect.New(s.t).Elem()
+	dest := make([]interface{}, len(s.columns))
+	for i, c := range s.columns {
+		dest[i] = settableField(doc, c.Index).Addr().Interface()
+	}
+	return doc, rows.Scan(dest...)
+}
+
+func (s *SQL) selectFrom() string {
+	return "SELECT " + s.quoted(s.columnNames(false)) + " FROM " + s.Dialect.Quote(s.Table) + " WHERE 1 = 1"
+}
+
+// query runs a SELECT and scans every row
+func (s *SQL) query(st *statement) ([]reflect.Value, error) {
+	rows, err := s.DB.QueryContext(s.GetRequest().Context(), st.String(), st.args...)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+	var docs []reflect.Value
+	for rows.Next() {
+		doc, err := s.scan(rows)
+		if err != nil {
+			return nil, err
+		}
+		docs = append(docs, doc)
+	}
+	return docs, rows.Err()
+}
+
+func (s *SQL) requestDocument() (reflect.Value, error) {
+	v := reflect.ValueOf(s.Get(REQUESTBODY))
+	if v.Kind() != reflect.Ptr || v.IsNil() || v.Elem().Type() != s.t {
+		return v, s.fail(http.StatusBadRequest, errEmptyBody)
+	}
+	return v.Elem(), nil
+}
+
+func (s *SQL) requestID() (interface{}, string, error) {
+	id, err := s.GetID()
+	if err != nil {
+		return nil, id, s.fail(http.StatusNotFound, err)
+	}
+	v, err := parseValue(id, s.id.Type)
+	if err != nil {
+		return nil, id, s.fail(http.StatusNotFound, notFound(id))
+	}
+	return v, id, nil
+}
+
+// execer is satisfied by *sql.DB and *sql.Tx
+type execer interface {
+	ExecContext(ctx context.Context, query string, args ...interface{}) (sql.Result, error)
+	QueryRowContext(ctx context.Context, query string, args ...interface{}) *sql.Row
+}
+
+// insert writes one document, generating its id unless the database does
+func (s *SQL) insert(db execer, doc reflect.Value) (string, error) {
+	ctx := s.GetRequest().Context()
+	id := s.id.value(doc)
+	names := s.columnNames(false)
+	generated := id == "" && s.id.Generator == SEQUENCE
+	if id == "" && !generated {
+		id = s.id.generate(0)
+		if err := s.id.set(doc, id); err != nil {
+			return id, err
+		}
+	}
+	if generated {
+		names = s.columnNames(true)
+	}
+	marks := strings.TrimSuffix(strings.Repeat("?, ", len(names)), ", ")
+	st := s.newStatement("INSERT INTO "+s.Dialect.Quote(s.Table)+" ("+s.quoted(names)+") VALUES ("+marks+")", s.args(doc, names)...)
+	if !generated {
+		_, err := db.ExecContext(ctx, st.String(), st.args...)
+		return id, err
+	}
+	key := settableField(doc, s.key.Index)
+	if s.Dialect.Returning() {
+		st.add(" RETURNING " + s.Dialect.Quote(s.key.Name))
+		err := db.QueryRowContext(ctx, st.String(), st.args...).Scan(key.Addr().Interface())
+		return s.id.value(doc), err
+	}
+	result, err := db.ExecContext(ctx, st.String(), st.args...)
+	if err != nil {
+		return id, err
+	}
+	n, err := result.LastInsertId()
+	if err != nil {
+		return id, err
+	}
+	id = fmt.Sprint(n)
+	return id, s.id.set(doc, id)
+}
+
+// InsertOne - inserts the request body as a row
+func (s *SQL) InsertOne() error {
+	doc, err := s.requestDocument()
+	if err != nil {
+		return err
+	}
+	id, err := s.insert(s.DB, doc)
+	if err != nil {
+		return s.failQuery(err, id)
+	}
+	s.SetResponseStatus(http.StatusCreated)
+	s.SetResponseBody(doc.Addr().Interface())
+	return nil
+}
+
+// InsertMany - inserts every document of the request body in one transaction
+func (s *SQL) InsertMany() error {
+	v := reflect.ValueOf(s.Get(REQUESTBODY))
+	if v.Kind() != reflect.Ptr || v.IsNil() || v.Elem().Kind() != reflect.Slice {
+		return s.fail(http.StatusBadRequest, errEmptyBody)
+	}
+	list := v.Elem()
+	tx, err := s.DB.BeginTx(s.GetRequest().Context(), nil)
+	if err != nil {
+		return s.failQuery(err, "")
+	}
+	for i := 0; i < list.Len(); i++ {
+		id, err := s.insert(tx, list.Index(i))
+		if err != nil {
+			tx.Rollback()
+			return s.failQuery(err, id)
+		}
+	}
+	if err = tx.Commit(); err != nil {
+		return s.failQuery(err, "")
+	}
+	s.SetResponseStatus(http.StatusCreated)
+	s.SetResponseBody(list.Interface())
+	return nil
+}
+
+// InsertBatch - inserts a batch in one transaction, when that fails the documents are inserted one at a time
+// so that the failing ones can be reported
+func (s *SQL) InsertBatch(docs interface{}) ([]ItemResult, error) {
+	list := reflect.ValueOf(docs)
+	results := make([]ItemResult, list.Len())
+	tx, err := s.DB.BeginTx(s.GetRequest().Context(), nil)
+	if err != nil {
+		return nil, err
+	}
+	// Insert copies so that ids generated by a rolled back transaction are not reused.
+	attempt := reflect.MakeSlice(list.Type(), list.Len(), list.Len())
+	reflect.Copy(attempt, list)
+	for i := 0; i < attempt.Len() && err == nil; i++ {
+		results[i].ID, err = s.insert(tx, attempt.Index(i))
+		results[i].Status = http.StatusCreated
+	}
+	if err != nil {
+		tx.Rollback()
+	} else if err = tx.Commit(); err == nil {
+		reflect.Copy(list, attempt)
+		return results, nil
+	}
+	for i := range results {
+		id, err := s.insert(s.DB, list.Index(i))
+		switch {
+		case err == nil:
+			results[i] = ItemResult{Status: http.StatusCreated, ID: id}
+		case s.Dialect.IsConflict(err):
+			results[i] = ItemResult{Status: http.StatusConflict, ID: id, Error: conflict(id).Error()}
+		default:
+			results[i] = ItemResult{Status: http.StatusInternalServerError, ID: id, Error: http.StatusText(http.StatusInternalServerError)}
+		}
+	}
+	return results, nil
+}
+
+// FindOne - selects the row addressed by the request id
+func (s *SQL) FindOne() error {
+	key, id, err := s.requestID()
+	if err != nil {
+		return err
+	}
+	st := s.newStatement(s.selectFrom()+" AND "+s.Dialect.Quote(s.key.Name)+" = ?", key)
+	q := s.GetQuery()
+	s.where(st, q)
+	st.add(s.Dialect.Limit(1, 0))
+	docs, err := s.query(st)
+	if err != nil {
+		return s.failQuery(err, id)
+	}
+	if len(docs) == 0 {
+		return s.fail(http.StatusNotFound, notFound(id))
+	}
+	s.SetResponseStatus(http.StatusOK)
+	if q != nil && len(q.Fields) > 0 {
+		s.SetResponseBody(project(s.t, docs[0], q.Fields))
+		return nil
+	}
+	s.SetResponseBody(docs[0].Addr().Interface())
+	return nil
+}
+
+// items converts rows to the response body, applying the requested projection
+func (s *SQL) items(docs []reflect.Value, q *Query) interface{} {
+	if q != nil && len(q.Fields) > 0 {
+		items := make([]map[string]interface{}, len(docs))
+		for i, doc := range docs {
+			items[i] = project(s.t, doc, q.Fields).(map[string]interface{})
+		}
+		return items
+	}
+	items := reflect.MakeSlice(reflect.SliceOf(s.t), len(docs), len(docs))
+	for i, doc := range docs {
+		items.Index(i).Set(doc)
+	}
+	return items.Interface()
+}
+
+// FindMany - selects the rows matching the request query
+func (s *SQL) FindMany() error {
+	q := s.GetQuery()
+	if q == nil {
+		q = &Query{}
+	}
+	st := s.newStatement(s.selectFrom())
+	s.where(st, q)
+	s.orderBy(st, sortKeys(q, s.key.Field), false)
+	st.add(s.Dialect.Limit(q.Limit, q.Offset))
+	docs, err := s.query(st)
+	if err != nil {
+		return s.failQuery(err, "")
+	}
+	s.SetResponseStatus(http.StatusOK)
+	s.SetResponseBody(s.items(docs, q))
+	return nil
+}
+
+// FindStream - selects the rows matching the request query, scanning each row as the Iterator reaches it
+func (s *SQL) FindStream() (Iterator, error) {
+	q := s.GetQuery()
+	if q == nil {
+		q = &Query{}
+	}
+	st := s.newStatement(s.selectFrom())
+	s.where(st, q)
+	s.orderBy(st, sortKeys(q, s.key.Field), false)
+	st.add(s.Dialect.Limit(q.Limit, q.Offset))
+	rows, err := s.DB.QueryContext(s.GetRequest().Context(), st.String(), st.args...)
+	if err != nil {
+		return nil, s.failQuery(err, "")
+	}
+	s.SetResponseStatus(http.StatusOK)
+	return &rowsIterator{s: s, rows: rows, fields: q.Fields}, nil
+}
+
+// rowsIterator scans rows into documents one at a time
+type rowsIterator struct {
+	s      *SQL
+	rows   *sql.Rows
+	fields []string
+	value  interface{}
+	err    error
+}
+
+func (it *rowsIterator) Next() bool {
+	if it.err != nil || !it.rows.Next() {
+		return false
+	}
+	doc, err := it.s.scan(it.rows)
+	if err != nil {
+		it.err = err
+		return false
+	}
+	it.value = project(it.s.t, doc, it.fields)
+	return true
+}
+
+func (it *rowsIterator) Value() interface{} {
+	return it.value
+}
+
+func (it *rowsIterator) Err() error {
+	if it.err != nil {
+		return it.err
+	}
+	return it.rows.Err()
+}
+
+func (it *rowsIterator) Close() error {
+	return it.rows.Close()
+}
+
+// FindPage - selects a page of the rows matching the request query using keyset pagination
+func (s *SQL) FindPage() (*Page, error) {
+	q := s.GetQuery()
+	if q == nil {
+		q = &Query{}
+	}
+	keys := sortKeys(q, s.key.Field)
+	c := q.Cursor
+	reverse := c != nil && c.Previous
+	st := s.newStatement(s.selectFrom())
+	s.where(st, q)
+	if c != nil {
+		s.after(st, c, reverse)
+	}
+	s.orderBy(st, keys, reverse)
+	limit := q.Limit
+	if limit > 0 {
+		// Fetch one extra row to learn whether another page follows.
+		limit++
+	}
+	st.add(s.Dialect.Limit(limit, q.Offset))
+	docs, err := s.query(st)
+	if err != nil {
+		return nil, s.failQuery(err, "")
+	}
+	more := q.Limit > 0 && len(docs) > q.Limit
+	if more {
+		docs = docs[:q.Limit]
+	}
+	if reverse {
+		for i, j := 0, len(docs)-1; i < j; i, j = i+1, j-1 {
+			docs[i], docs[j] = docs[j], docs[i]
+		}
+	}
+	count := s.newStatement("SELECT COUNT(*) FROM " + s.Dialect.Quote(s.Table) + " WHERE 1 = 1")
+	s.where(count, q)
+	var total int64
+	if err = s.DB.QueryRowContext(s.GetRequest().Context(), count.String(), count.args...).Scan(&total); err != nil {
+		return nil, s.failQuery(err, "")
+	}
+	page := &Page{Items: s.items(docs, q), Sort: keys, Total: &total}
+	hasPrev, hasNext := c != nil || q.Offset > 0, more
+	if reverse {
+		hasPrev, hasNext = more, true
+	}
+	if len(docs) > 0 && hasPrev {
+		page.Prev = keyValues(s.t, docs[0], keys)
+	}
+	if len(docs) > 0 && hasNext {
+		page.Next = keyValues(s.t, docs[len(docs)-1], keys)
+	}
+	s.SetResponseStatus(http.StatusOK)
+	return page, nil
+}
+
+// Update - replaces the row addressed by the request id
+func (s *SQL) Update() error {
+	key, id, err := s.requestID()
+	if err != nil {
+		return err
+	}
+	doc, err := s.requestDocument()
+	if err != nil {
+		return err
+	}
+	if err = s.id.set(doc, id); err != nil {
+		return s.fail(http.StatusBadRequest, err)
+	}
+	names := s.columnNames(true)
+	sets := make([]string, len(names))
+	for i, n := range names {
+		sets[i] = s.Dialect.Quote(n) + " = ?"
+	}
+	st := s.newStatement("UPDATE "+s.Dialect.Quote(s.Table)+" SET "+strings.Join(sets, ", "), s.args(doc, names)...)
+	st.add(" WHERE "+s.Dialect.Quote(s.key.Name)+" = ?", key)
+	s.where(st, s.GetQuery())
+	result, err := s.DB.ExecContext(s.GetRequest().Context(), st.String(), st.args...)
+	if err != nil {
+		return s.failQuery(err, id)
+	}
+	found, err := s.found(result, key)
+	if err != nil {
+		return s.failQuery(err, id)
+	}
+	if !found {
+		return s.fail(http.StatusNotFound, notFound(id))
+	}
+	s.SetResponseStatus(http.StatusNoContent)
+	s.SetResponseBody(nil)
+	return nil
+}
+
+// found reports whether a write addressed a row matching the request query. MySQL does not count the rows an UPDATE
+// leaves unchanged, so when none were affected the row is looked up.
+func (s *SQL) found(result sql.Result, key interface{}) (bool, error) {
+	if n, err := result.RowsAffected(); err == nil && n > 0 {
+		return true, nil
+	}
+	st := s.newStatement("SELECT COUNT(*) FROM "+s.Dialect.Quote(s.Table)+" WHERE "+s.Dialect.Quote(s.key.Name)+" = ?", key)
+	s.where(st, s.GetQuery())
+	var n int
+	err := s.DB.QueryRowContext(s.GetRequest().Context(), st.String(), st.args...).Scan(&n)
+	return n > 0, err
+}
+
+// Upsert - inserts the request body or replaces the row addressed by the request id
+func (s *SQL) Upsert() error {
+	key, id, err := s.requestID()
+	if err != nil {
+		return err
+	}
+	doc, err := s.requestDocument()
+	if err != nil {
+		return err
+	}
+	if err = s.id.set(doc, id); err != nil {
+		return s.fail(http.StatusBadRequest, err)
+	}
+	ctx := s.GetRequest().Context()
+	tx, err := s.DB.BeginTx(ctx, nil)
+	if err != nil {
+		return s.failQuery(err, id)
+	}
+	defer tx.Rollback()
+	exists := s.newStatement("SELECT COUNT(*) FROM "+s.Dialect.Quote(s.Table)+" WHERE "+s.Dialect.Quote(s.key.Name)+" = ?", key)
+	var total int
+	if err = tx.QueryRowContext(ctx, exists.String(), exists.args...).Scan(&total); err != nil {
+		return s.failQuery(err, id)
+	}
+	// Rows excluded by the query filters, e.g. documents of another owner, are left as they are by the conflict
+	// update itself, the filtered columns are listed last for MySQL
+	condition := &statement{dialect: placeholders{s.Dialect}}
+	s.filter(condition, s.GetQuery(), s.Table)
+	names := s.upsertColumns(s.GetQuery())
+	marks := strings.TrimSuffix(strings.Repeat("?, ", len(names)), ", ")
+	st := s.newStatement("INSERT INTO "+s.Dialect.Quote(s.Table)+" ("+s.quoted(names)+") VALUES ("+marks+")", s.args(doc, names)...)
+	clause := s.Dialect.Upsert(s.key.Name, names, strings.TrimPrefix(condition.String(), " AND "))
+	var args []interface{}
+	for len(condition.args) > 0 && len(args) < strings.Count(clause, "?") {
+		args = append(args, condition.args...)
+	}
+	st.add(clause, args...)
+	result, err := tx.ExecContext(ctx, st.String(), st.args...)
+	if err != nil {
+		return s.failQuery(err, id)
+	}
+	if err = tx.Commit(); err != nil {
+		return s.failQuery(err, id)
+	}
+	found, err := s.found(result, key)
+	if err != nil {
+		return s.failQuery(err, id)
+	}
+	if !found {
+		return s.fail(http.StatusNotFound, notFound(id))
+	}
+	status := http.StatusOK
+	if total == 0 {
+		status = http.StatusCreated
+	}
+	s.SetResponseStatus(status)
+	s.SetResponseBody(doc.Addr().Interface())
+	return nil
+}
+
+// upsertColumns returns the columns of an upsert, those the query filters read last
+func (s *SQL) upsertColumns(q *Query) []string {
+	filtered := make(map[string]bool)
+	if q != nil {
+		for _, f := range q.Filters {
+			if c, ok := s.columnFor(f.Field); ok {
+				filtered[c.Name] = true
+			}
+		}
+	}
+	var names, last []string
+	for _, name := range s.columnNames(false) {
+		if filtered[name] {
+			last = append(last, name)
+		} else {
+			names = append(names, name)
+		}
+	}
+	return append(names, last...)
+}
+
+// Remove - deletes the row addressed by the request id
+func (s *SQL) Remove() error {
+	key, id, err := s.requestID()
+	if err != nil {
+		return err
+	}
+	st := s.newStatement("DELETE FROM "+s.Dialect.Quote(s.Table)+" WHERE "+s.Dialect.Quote(s.key.Name)+" = ?", key)
+	s.where(st, s.GetQuery())
+	result, err := s.DB.ExecContext(s.GetRequest().Context(), st.String(), st.args...)
+	if err != nil {
+		return s.failQuery(err, id)
+	}
+	found, err := s.found(result, key)
+	if err != nil {
+		return s.failQuery(err, id)
+	}
+	if !found {
+		return s.fail(http.StatusNotFound, notFound(id))
+	}
+	s.SetResponseStatus(http.StatusNoContent)
+	s.SetResponseBody(nil)
+	return nil
+}
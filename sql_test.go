@@ -0,0 +1,267 @@
+package rest
+
+import (
+	"database/sql"
+	"database/sql/driver"
+	"errors"
+	"io"
+	"net/http"
+	"reflect"
+	"strings"
+	"testing"
+)
+
+// FakeSQLResponse - the canned outcome of a statement run through the fake driver
+type FakeSQLResponse struct {
+	rows     [][]driver.Value
+	err      error
+	affected int64
+	lastID   int64
+}
+
+// FakeSQLDriver records every statement and answers with respond
+type FakeSQLDriver struct {
+	queries []string
+	respond func(query string) FakeSQLResponse
+}
+
+var fakeSQLDriver = &FakeSQLDriver{}
+
+func init() {
+	sql.Register("restfake", fakeSQLDriver)
+}
+
+func (d *FakeSQLDriver) Open(name string) (driver.Conn, error) { return d, nil }
+func (d *FakeSQLDriver) Close() error                          { return nil }
+func (d *FakeSQLDriver) Begin() (driver.Tx, error)             { return d, nil }
+func (d *FakeSQLDriver) Commit() error                         { return nil }
+func (d *FakeSQLDriver) Rollback() error                       { return nil }
+
+func (d *FakeSQLDriver) Prepare(query string) (driver.Stmt, error) {
+	return &FakeSQLStmt{driver: d, query: query}, nil
+}
+
+type FakeSQLStmt struct {
+	driver *FakeSQLDriver
+	query  string
+}
+
+func (s *FakeSQLStmt) Close() error  { return nil }
+func (s *FakeSQLStmt) NumInput() int { return -1 }
+
+func (s *FakeSQLStmt) run() FakeSQLResponse {
+	s.driver.queries = append(s.driver.queries, s.query)
+	return s.driver.respond(s.query)
+}
+
+func (s *FakeSQLStmt) Exec(args []driver.Value) (driver.Result, error) {
+	r := s.run()
+	if r.err != nil {
+		return nil, r.err
+	}
+	return FakeSQLResult(r), nil
+}
+
+func (s *FakeSQLStmt) Query(args []driver.Value) (driver.Rows, error) {
+	r := s.run()
+	if r.err != nil {
+		return nil, r.err
+	}
+	return &FakeSQLRows{rows: r.rows}, nil
+}
+
+type FakeSQLResult FakeSQLResponse
+
+func (r FakeSQLResult) LastInsertId() (int64, error) { return r.lastID, nil }
+func (r FakeSQLResult) RowsAffected() (int64, error) { return r.affected, nil }
+
+type FakeSQLRows struct {
+	rows [][]driver.Value
+}
+
+func (r *FakeSQLRows) Columns() []string {
+	if len(r.rows) == 0 {
+		return []string{"id", "title", "priority"}
+	}
+	return make([]string, len(r.rows[0]))
+}
+
+func (r *FakeSQLRows) Close() error { return nil }
+
+func (r *FakeSQLRows) Next(dest []driver.Value) error {
+	if len(r.rows) == 0 {
+		return io.EOF
+	}
+	copy(dest, r.rows[0])
+	r.rows = r.rows[1:]
+	return nil
+}
+
+type FakeRow struct {
+	ID       int64  `json:"id" db:"id"`
+	Title    string `json:"title" db:"title"`
+	Priority int    `json:"priority" db:"priority"`
+	Note     string `json:"note"`
+}
+
+func TestSQL(t *testing.T) {
+	db, _ := sql.Open("restfake", "")
+	row := []driver.Value{int64(7), "Milk", int64(2)}
+	count := func(n int64) FakeSQLResponse { return FakeSQLResponse{rows: [][]driver.Value{{n}}} }
+	tests := []struct {
+		dialect  Dialect
+		verb     string
+		url      string
+		body     string
+		action   string
+		response FakeSQLResponse
+		expected int
+		query    string
+	}{
+		{PostgreSQL, "POST", "/todos", `{"title": "Milk", "priority": 2}`, INSERTONE, FakeSQLResponse{rows: [][]driver.Value{{int64(7)}}}, http.StatusCreated,
+			`INSERT INTO "todos" ("title", "priority") VALUES ($1, $2) RETURNING "id"`},
+		{SQLite, "POST", "/todos", `{"title": "Milk", "priority": 2}`, INSERTONE, FakeSQLResponse{lastID: 7}, http.StatusCreated,
+			`INSERT INTO "todos" ("title", "priority") VALUES (?, ?)`},
+		{MySQL, "POST", "/todos", `{"id": 7, "title": "Milk"}`, INSERTONE, FakeSQLResponse{err: errors.New("Error 1062: Duplicate entry '7' for key 'PRIMARY'")}, http.StatusConflict,
+			"INSERT INTO `todos` (`id`, `title`, `priority`) VALUES (?, ?, ?)"},
+		{PostgreSQL, "POST", "/todos", `{"id": 7, "title": "Milk"}`, INSERTONE, FakeSQLResponse{err: errors.New("connection refused")}, http.StatusInternalServerError,
+			`INSERT INTO "todos" ("id", "title", "priority") VALUES ($1, $2, $3)`},
+		{PostgreSQL, "GET", "/todos/7", "", FINDONE, FakeSQLResponse{rows: [][]driver.Value{row}}, http.StatusOK,
+			`SELECT "id", "title", "priority" FROM "todos" WHERE 1 = 1 AND "id" = $1 LIMIT 1`},
+		{PostgreSQL, "GET", "/todos/8", "", FINDONE, FakeSQLResponse{}, http.StatusNotFound,
+			`SELECT "id", "title", "priority" FROM "todos" WHERE 1 = 1 AND "id" = $1 LIMIT 1`},
+		{PostgreSQL, "GET", "/todos/eight", "", FINDONE, FakeSQLResponse{}, http.StatusNotFound, ""},
+		{MySQL, "GET", "/todos?priority[gt]=1&title[in]=Milk,Eggs&sort=-priority&limit=5&offset=10", "", FINDMANY, FakeSQLResponse{rows: [][]driver.Value{row}}, http.StatusOK,
+			"SELECT `id`, `title`, `priority` FROM `todos` WHERE 1 = 1 AND `priority` > ? AND `title` IN (?, ?) ORDER BY `priority` DESC, `id` ASC LIMIT 5 OFFSET 10"},
+		{SQLite, "GET", "/todos?title[like]=M%25&offset=10", "", FINDMANY, FakeSQLResponse{}, http.StatusOK,
+			`SELECT "id", "title", "priority" FROM "todos" WHERE 1 = 1 AND "title" LIKE ? ORDER BY "id" ASC LIMIT -1 OFFSET 10`},
+		{SQLite, "PUT", "/todos/7", `{"title": "Milk"}`, UPDATE, FakeSQLResponse{affected: 1}, http.StatusNoContent,
+			`UPDATE "todos" SET "title" = ?, "priority" = ? WHERE "id" = ?`},
+		{SQLite, "PUT", "/todos/7", `{"title": "Milk"}`, UPDATE, count(0), http.StatusNotFound,
+			`SELECT COUNT(*) FROM "todos" WHERE "id" = ?`},
+		{MySQL, "PUT", "/todos/7", `{"title": "Milk"}`, UPDATE, count(1), http.StatusNoContent,
+			"SELECT COUNT(*) FROM `todos` WHERE `id` = ?"},
+		{PostgreSQL, "PUT", "/todos/7", `{"title": "Milk"}`, UPSERT, FakeSQLResponse{rows: [][]driver.Value{{int64(0)}}, affected: 1}, http.StatusCreated,
+			`INSERT INTO "todos" ("id", "title", "priority") VALUES ($1, $2, $3) ON CONFLICT ("id") DO UPDATE SET "title" = EXCLUDED."title", "priority" = EXCLUDED."priority"`},
+		{MySQL, "PUT", "/todos/7", `{"title": "Milk"}`, UPSERT, count(1), http.StatusOK,
+			"INSERT INTO `todos` (`id`, `title`, `priority`) VALUES (?, ?, ?) ON DUPLICATE KEY UPDATE `id` = VALUES(`id`), `title` = VALUES(`title`), `priority` = VALUES(`priority`)"},
+		{PostgreSQL, "DELETE", "/todos/7", "", REMOVE, FakeSQLResponse{affected: 1}, http.StatusNoContent,
+			`DELETE FROM "todos" WHERE "id" = $1`},
+		{PostgreSQL, "DELETE", "/todos/7", "", REMOVE, count(0), http.StatusNotFound,
+			`DELETE FROM "todos" WHERE "id" = $1`},
+		{PostgreSQL, "GET", "/todos?sort=note", "", FINDMANY, FakeSQLResponse{}, http.StatusBadRequest, ""},
+	}
+	for i, test := range tests {
+		fakeSQLDriver.queries = nil
+		response := test.response
+		fakeSQLDriver.respond = func(query string) FakeSQLResponse {
+			return response
+		}
+		storage := NewSQL(db, test.dialect, "todos", reflect.TypeOf(FakeRow{}))
+		resource := NewResource("todo").
+			UseType(reflect.TypeOf(FakeRow{})).
+			UseStorage(storage).
+			UseValidator(&FakeNoopValidator{}).
+			UseSerializer(&JSON{})
+		service := NewFakeService(FakeScenario{})
+		w := serve(service.process(resource, test.action), test.verb, "http://foo.bar"+test.url, test.body)
+		if w.Code != test.expected {
+			t.Errorf("#%d Error, expected %d, got %d: %s", i, test.expected, w.Code, w.Body.String())
+		}
+		found := test.query == ""
+		for _, q := range fakeSQLDriver.queries {
+			if q == test.query {
+				found = true
+			}
+		}
+		if !found {
+			t.Errorf("#%d Error, expected the statement %s, got %s", i, test.query, strings.Join(fakeSQLDriver.queries, "; "))
+		}
+	}
+}
+
+func TestSQLUpsertScoped(t *testing.T) {
+	db, _ := sql.Open("restfake", "")
+	tests := []struct {
+		dialect  Dialect
+		total    int64
+		affected int64
+		visible  int64
+		expected int
+		query    string
+	}{
+		{PostgreSQL, 1, 0, 0, http.StatusNotFound,
+			`INSERT INTO "todos" ("id", "title", "priority") VALUES ($1, $2, $3) ON CONFLICT ("id") DO UPDATE SET "title" = EXCLUDED."title", "priority" = EXCLUDED."priority" WHERE "todos"."priority" = $4`},
+		{PostgreSQL, 0, 1, 1, http.StatusCreated, ""},
+		{SQLite, 1, 1, 1, http.StatusOK,
+			`INSERT INTO "todos" ("id", "title", "priority") VALUES (?, ?, ?) ON CONFLICT ("id") DO UPDATE SET "title" = excluded."title", "priority" = excluded."priority" WHERE "todos"."priority" = ?`},
+		{MySQL, 1, 0, 1, http.StatusOK,
+			"INSERT INTO `todos` (`id`, `title`, `priority`) VALUES (?, ?, ?) ON DUPLICATE KEY UPDATE `id` = IF(`todos`.`priority` = ?, VALUES(`id`), `id`), " +
+				"`title` = IF(`todos`.`priority` = ?, VALUES(`title`), `title`), `priority` = IF(`todos`.`priority` = ?, VALUES(`priority`), `priority`)"},
+		{MySQL, 1, 0, 0, http.StatusNotFound, ""},
+	}
+	for i, test := range tests {
+		fakeSQLDriver.queries = nil
+		test := test
+		fakeSQLDriver.respond = func(query string) FakeSQLResponse {
+			switch {
+			case strings.HasPrefix(query, "INSERT"):
+				return FakeSQLResponse{affected: test.affected}
+			case strings.Contains(query, "priority"):
+				return FakeSQLResponse{rows: [][]driver.Value{{test.visible}}}
+			}
+			return FakeSQLResponse{rows: [][]driver.Value{{test.total}}}
+		}
+		resource := NewResource("todo").
+			UseType(reflect.TypeOf(FakeRow{})).
+			UseStorage(NewSQL(db, test.dialect, "todos", reflect.TypeOf(FakeRow{}))).
+			UseValidator(&FakeNoopValidator{}).
+			UseSerializer(&JSON{}).
+			AddHook(BEFOREEXECUTE, func(model *Model) error {
+				model.Set(QUERY, &Query{Filters: []Filter{{Field: "priority", Operator: EQ, Value: 2}}})
+				return nil
+			})
+		w := serve(NewFakeService(FakeScenario{}).Upsert(resource), "PUT", "http://foo.bar/todos/7", `{"title": "Milk", "priority": 2}`)
+		if w.Code != test.expected {
+			t.Errorf("#%d Error, expected %d, got %d: %s", i, test.expected, w.Code, w.Body.String())
+		}
+		if test.query != "" && (len(fakeSQLDriver.queries) < 2 || fakeSQLDriver.queries[1] != test.query) {
+			t.Errorf("#%d Error, expected the statement %s, got %s", i, test.query, strings.Join(fakeSQLDriver.queries, "; "))
+		}
+	}
+}
+
+func TestSQLPage(t *testing.T) {
+	db, _ := sql.Open("restfake", "")
+	fakeSQLDriver.queries = nil
+	fakeSQLDriver.respond = func(query string) FakeSQLResponse {
+		if strings.HasPrefix(query, "SELECT COUNT(*)") {
+			return FakeSQLResponse{rows: [][]driver.Value{{int64(3)}}}
+		}
+		return FakeSQLResponse{rows: [][]driver.Value{{int64(2), "Eggs", int64(2)}, {int64(3), "Milk", int64(2)}, {int64(4), "Tea", int64(1)}}}
+	}
+	storage := NewSQL(db, PostgreSQL, "todos", reflect.TypeOf(FakeRow{}))
+	p := NewPagination(2, 10)
+	resource := NewResource("todo").
+		UseType(reflect.TypeOf(FakeRow{})).
+		UseStorage(storage).
+		UseValidator(&FakeNoopValidator{}).
+		UseSerializer(&JSON{}).
+		UsePagination(p)
+	cursor, _ := p.EncodeCursor(&Cursor{Sort: []Sort{{Field: "priority", Descending: true}, {Field: "id"}}, Values: []interface{}{2, int64(1)}})
+	w := serve(NewFakeService(FakeScenario{}).FindMany(resource), "GET", "http://foo.bar/todos?sort=-priority&cursor="+cursor, "")
+	if w.Code != http.StatusOK {
+		t.Fatalf("Error, expected %d, got %d: %s", http.StatusOK, w.Code, w.Body.String())
+	}
+	expected := `SELECT "id", "title", "priority" FROM "todos" WHERE 1 = 1 AND (("priority" < $1) OR ("priority" = $2 AND "id" > $3)) ORDER BY "priority" DESC, "id" ASC LIMIT 3`
+	if fakeSQLDriver.queries[0] != expected {
+		t.Errorf("Error, expected the statement %s, got %s", expected, fakeSQLDriver.queries[0])
+	}
+	link := w.Header().Get("Link")
+	if !strings.Contains(link, `rel="next"`) || !strings.Contains(link, `rel="prev"`) {
+		t.Errorf("Error, expected next and prev links, got %q", link)
+	}
+	if w.Body.String() != `[{"id":2,"title":"Eggs","priority":2,"note":""},{"id":3,"title":"Milk","priority":2,"note":""}]` {
+		t.Errorf("Error, unexpected page %s", w.Body.String())
+	}
+}
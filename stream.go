@@ -0,0 +1,450 @@
+package rest
+
+import (
+	"bytes"
+	"encoding/csv"
+	"encoding/json"
+	"fmt"
+	"io"
+	"net/http"
+	"reflect"
+	"strconv"
+	"time"
+)
+
+// Iterator - yields the documents of a streamed findMany response one at a time
+type Iterator interface {
+	Next() bool
+	Value() interface{}
+	Err() error
+	Close() error
+}
+
+// Streaming - optional Storage extension returning findMany results as an Iterator instead of a slice.
+// FindStream reads the query from the context and sets the response status.
+type Streaming interface {
+	FindStream() (Iterator, error)
+}
+
+// StreamEncoder - optional Serializer extension writing documents as they are produced
+type StreamEncoder interface {
+	EncodeStream(w io.Writer) (RecordWriter, error)
+}
+
+// RecordWriter - writes the documents of one streamed response, Close completes the output
+type RecordWriter interface {
+	WriteRecord(v interface{}) error
+	Close() error
+}
+
+// streamFlushInterval - how often a streamed response is flushed to the client
+const streamFlushInterval = 100 * time.Millisecond
+
+// sliceIterator iterates over the items of a slice
+type sliceIterator struct {
+	items reflect.Value
+	i     int
+}
+
+// NewSliceIterator - returns an Iterator over the items of a slice
+func NewSliceIterator(items interface{}) Iterator {
+	return &sliceIterator{items: reflect.ValueOf(items), i: -1}
+}
+
+func (it *sliceIterator) Next() bool {
+	it.i++
+	return it.items.IsValid() && it.i < it.items.Len()
+}
+
+func (it *sliceIterator) Value() interface{} {
+	return it.items.Index(it.i).Interface()
+}
+
+func (it *sliceIterator) Err() error {
+	return nil
+}
+
+func (it *sliceIterator) Close() error {
+	return nil
+}
+
+// findStream sets the response body of findMany to an Iterator when the resource streams and the storage supports it
+func (model *Model) findStream() (bool, error) {
+	storage, ok := model.Storage.(Streaming)
+	if streaming, _ := model.Get(STREAMING).(bool); !streaming || !ok {
+		return false, nil
+	}
+	it, err := storage.FindStream()
+	if err != nil {
+		return true, err
+	}
+	c := &closeOnce{Iterator: it}
+	model.Set(ITERATOR, c)
+	model.SetResponseBody(c)
+	return true, nil
+}
+
+// closeOnce closes an Iterator the first time Close is called, so that it can be closed once the response is written
+// whether it was streamed, drained or replaced
+type closeOnce struct {
+	Iterator
+	closed bool
+	err    error
+}
+
+func (c *closeOnce) Close() error {
+	if !c.closed {
+		c.closed, c.err = true, c.Iterator.Close()
+	}
+	return c.err
+}
+
+// stream writes the documents of an Iterator as they are produced, flushing periodically and stopping when the client goes away
+func stream(w http.ResponseWriter, r *http.Request, it Iterator, encoder StreamEncoder) error {
+	defer it.Close()
+	rw, err := encoder.EncodeStream(w)
+	if err != nil {
+		return err
+	}
+	flusher, _ := w.(http.Flusher)
+	done := r.Context().Done()
+	flushed := time.Now()
+	for it.Next() {
+		select {
+		case <-done:
+			return r.Context().Err()
+		default:
+		}
+		if err = rw.WriteRecord(it.Value()); err != nil {
+			return err
+		}
+		if flusher != nil && time.Since(flushed) >= streamFlushInterval {
+			flusher.Flush()
+			flushed = time.Now()
+		}
+	}
+	// Leave the output incomplete on errors so that clients can tell it was cut short.
+	if err = it.Err(); err != nil {
+		return err
+	}
+	err = rw.Close()
+	if flusher != nil {
+		flusher.Flush()
+	}
+	return err
+}
+
+// drain collects the documents of an Iterator for serializers that can not stream
+func drain(it Iterator) ([]interface{}, error) {
+	defer it.Close()
+	items := []interface{}{}
+	for it.Next() {
+		items = append(items, it.Value())
+	}
+	return items, it.Err()
+}
+
+// jsonStream writes a JSON array one element at a time
+type jsonStream struct {
+	w     io.Writer
+	count int
+}
+
+// EncodeStream - streams findMany results as a JSON array
+func (j *JSON) EncodeStream(w io.Writer) (RecordWriter, error) {
+	_, err := io.WriteString(w, "[")
+	return &jsonStream{w: w}, err
+}
+
+func (s *jsonStream) WriteRecord(v interface{}) error {
+	b, err := json.Marshal(v)
+	if err != nil {
+		return err
+	}
+	if s.count > 0 {
+		b = append([]byte{','}, b...)
+	}
+	s.count++
+	_, err = s.w.Write(b)
+	return err
+}
+
+func (s *jsonStream) Close() error {
+	_, err := io.WriteString(s.w, "]")
+	return err
+}
+
+// NDJSON - a Serializer for application/x-ndjson, one JSON document per line
+type NDJSON struct {
+	*Context
+}
+
+// UseContext -
+func (n *NDJSON) UseContext(c *Context) {
+	n.Context = c
+}
+
+// Clone - returns an NDJSON serializer for another request
+func (n *NDJSON) Clone() Serializer {
+	return &NDJSON{}
+}
+
+// Decode - reads one document per line applying the DecodeOptions of the resource, insertMany takes every line and
+// other actions the first
+func (n *NDJSON) Decode() error {
+	r := n.GetRequest()
+	if r.Method != "POST" && r.Method != "PUT" && r.Method != "PATCH" {
+		return nil
+	}
+	t := n.Get(DATATYPE).(reflect.Type)
+	v := reflect.New(t)
+	if n.Get(ACTION) == INSERTMANY {
+		v = reflect.New(reflect.SliceOf(t))
+	}
+	err := errTruncated
+	if r.Body != nil {
+		err = n.decodeLines(r.Body, v.Elem())
+	}
+	n.Set(REQUESTBODY, v.Interface())
+	if err != nil {
+		status := http.StatusBadRequest
+		if _, ok := err.(*BodyTooLargeError); ok {
+			status = http.StatusRequestEntityTooLarge
+		}
+		n.SetResponseStatus(status)
+		n.SetResponseBody(errorBody(err))
+	}
+	return err
+}
+
+// decodeLines decodes every line of body into the slice list, or the first one into a document
+func (n *NDJSON) decodeLines(body io.Reader, list reflect.Value) error {
+	reader, err := n.DecodeStream(body)
+	if err != nil {
+		return err
+	}
+	many := list.Kind() == reflect.Slice
+	for {
+		doc := list
+		if many {
+			doc = reflect.New(list.Type().Elem()).Elem()
+		}
+		err = reader.ReadRecord(doc.Addr().Interface())
+		if e, ok := err.(*RecordError); ok {
+			return e.Err
+		}
+		if err == io.EOF {
+			if many && list.Len() > 0 {
+				return nil
+			}
+			return errEmptyBody
+		}
+		if err != nil {
+			return err
+		}
+		if !many {
+			return nil
+		}
+		list.Set(reflect.Append(list, doc))
+	}
+}
+
+// Encode - writes slices as one line per element
+func (n *NDJSON) Encode(v interface{}) ([]byte, error) {
+	var b bytes.Buffer
+	rw, _ := n.EncodeStream(&b)
+	rv := reflect.Indirect(reflect.ValueOf(v))
+	if rv.Kind() != reflect.Slice && rv.Kind() != reflect.Array {
+		err := rw.WriteRecord(v)
+		return b.Bytes(), err
+	}
+	for i := 0; i < rv.Len(); i++ {
+		if err := rw.WriteRecord(rv.Index(i).Interface()); err != nil {
+			return nil, err
+		}
+	}
+	return b.Bytes(), nil
+}
+
+// EncodeStream -
+func (n *NDJSON) EncodeStream(w io.Writer) (RecordWriter, error) {
+	return &ndjsonStream{encoder: json.NewEncoder(w)}, nil
+}
+
+type ndjsonStream struct {
+	encoder *json.Encoder
+}
+
+func (s *ndjsonStream) WriteRecord(v interface{}) error {
+	return s.encoder.Encode(v)
+}
+
+func (s *ndjsonStream) Close() error {
+	return nil
+}
+
+// CSV - a Serializer for text/csv, the header row holds the `json` names of the fields,
+// or the requested fields of a projection. Nested values are written as JSON.
+type CSV struct {
+	*Context
+}
+
+// UseContext -
+func (c *CSV) UseContext(ctx *Context) {
+	c.Context = ctx
+}
+
+// Clone - returns a CSV serializer for another request
+func (c *CSV) Clone() Serializer {
+	return &CSV{}
+}
+
+// Decode - maps the columns of each row to the fields named in the header row, insertMany takes every row and other actions the first
+func (c *CSV) Decode() error {
+	return decodeBody(c.Context, func(b []byte, v interface{}) error {
+		records, err := csv.NewReader(bytes.NewReader(b)).ReadAll()
+		if err != nil {
+			return err
+		}
+		if len(records) < 2 {
+			return errEmptyBody
+		}
+		header := records[0]
+		list := reflect.ValueOf(v).Elem()
+		many := list.Kind() == reflect.Slice
+		for line, record := range records[1:] {
+			doc := list
+			if many {
+				doc = reflect.New(list.Type().Elem()).Elem()
+			}
+			if len(record) != len(header) {
+				return fmt.Errorf("line %d has %d columns, the header has %d", line+2, len(record), len(header))
+			}
+			for i, name := range header {
+				if err = setFormValue(doc, []string{name}, []string{record[i]}); err != nil {
+					return fmt.Errorf("line %d, %s: %s", line+2, name, err)
+				}
+			}
+			if !many {
+				return nil
+			}
+			list.Set(reflect.Append(list, doc))
+		}
+		return nil
+	})
+}
+
+// Encode - strings are error messages and are written under an error header, Violations as a row per field under
+// a field,rule,param,message,code header
+func (c *CSV) Encode(v interface{}) ([]byte, error) {
+	var b bytes.Buffer
+	switch body := v.(type) {
+	case string:
+		w := csv.NewWriter(&b)
+		w.WriteAll([][]string{{"error"}, {body}})
+		return b.Bytes(), w.Error()
+	case Violations:
+		records := [][]string{{"field", "rule", "param", "message", "code"}}
+		for _, fe := range body.Errors() {
+			records = append(records, []string{fe.Field, fe.Rule, fe.Param, fe.Message, fe.Code})
+		}
+		w := csv.NewWriter(&b)
+		w.WriteAll(records)
+		return b.Bytes(), w.Error()
+	}
+	rw, err := c.EncodeStream(&b)
+	if err != nil {
+		return nil, err
+	}
+	rv := reflect.Indirect(reflect.ValueOf(v))
+	if rv.Kind() == reflect.Slice || rv.Kind() == reflect.Array {
+		for i := 0; i < rv.Len() && err == nil; i++ {
+			err = rw.WriteRecord(rv.Index(i).Interface())
+		}
+	} else if v != nil {
+		err = rw.WriteRecord(v)
+	}
+	if err == nil {
+		err = rw.Close()
+	}
+	return b.Bytes(), err
+}
+
+// EncodeStream - writes the header row followed by a row per document
+func (c *CSV) EncodeStream(w io.Writer) (RecordWriter, error) {
+	t, _ := c.Get(DATATYPE).(reflect.Type)
+	var columns []string
+	if q := c.GetQuery(); q != nil && len(q.Fields) > 0 {
+		columns = q.Fields
+	} else {
+		for _, f := range typeFields(t) {
+			columns = append(columns, f.Name)
+		}
+	}
+	s := &csvStream{w: csv.NewWriter(w), t: t, columns: columns}
+	s.w.Write(columns)
+	s.w.Flush()
+	return s, s.w.Error()
+}
+
+type csvStream struct {
+	w       *csv.Writer
+	t       reflect.Type
+	columns []string
+}
+
+func (s *csvStream) WriteRecord(v interface{}) error {
+	rv, _ := indirectValue(reflect.ValueOf(v))
+	record := make([]string, len(s.columns))
+	for i, name := range s.columns {
+		var cell reflect.Value
+		switch rv.Kind() {
+		case reflect.Map:
+			cell = rv.MapIndex(reflect.ValueOf(name))
+		case reflect.Struct:
+			if f, ok := lookupField(rv.Type(), name); ok {
+				cell = fieldValue(rv, f.Index)
+			}
+		}
+		var err error
+		if record[i], err = csvCell(cell); err != nil {
+			return err
+		}
+	}
+	s.w.Write(record)
+	s.w.Flush()
+	return s.w.Error()
+}
+
+func (s *csvStream) Close() error {
+	s.w.Flush()
+	return s.w.Error()
+}
+
+// csvCell formats a value for a CSV cell, nil values are empty and composite values JSON
+func csvCell(v reflect.Value) (string, error) {
+	if v.Kind() == reflect.Interface {
+		v = v.Elem()
+	}
+	v, ok := indirectValue(v)
+	if !ok || !v.IsValid() {
+		return "", nil
+	}
+	if t, ok := v.Interface().(time.Time); ok {
+		return t.Format(time.RFC3339Nano), nil
+	}
+	switch v.Kind() {
+	case reflect.String:
+		return v.String(), nil
+	case reflect.Bool:
+		return strconv.FormatBool(v.Bool()), nil
+	case reflect.Int, reflect.Int8, reflect.Int16, reflect.Int32, reflect.Int64:
+		return strconv.FormatInt(v.Int(), 10), nil
+	case reflect.Uint, reflect.Uint8, reflect.Uint16, reflect.Uint32, reflect.Uint64:
+		return strconv.FormatUint(v.Uint(), 10), nil
+	case reflect.Float32, reflect.Float64:
+		return strconv.FormatFloat(v.Float(), 'g', -1, v.Type().Bits()), nil
+	}
+	b, err := json.Marshal(v.Interface())
+	return string(b), err
+}
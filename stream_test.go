@@ -0,0 +1,207 @@
+package rest
+
+import (
+	"context"
+	"database/sql"
+	"database/sql/driver"
+	"errors"
+	"net/http"
+	"net/http/httptest"
+	"reflect"
+	"strings"
+	"testing"
+)
+
+func NewFakeStreamResource(serializer Serializer) *Resource {
+	storage := NewMemory(reflect.TypeOf(FakeTodo{}))
+	service := NewFakeService(FakeScenario{})
+	resource := NewFakeTodoResource(storage).UseStreaming(true)
+	serve(service.InsertMany(resource), "POST", "http://foo.bar/todos", `[{"id": "a", "title": "Milk", "priority": 1}, {"id": "b", "title": "Eggs, large", "priority": 2}]`)
+	return resource.UseSerializer(serializer)
+}
+
+func TestStream(t *testing.T) {
+	tests := []struct {
+		serializer Serializer
+		url        string
+		expected   string
+	}{
+		{&JSON{}, "/todos", `[{"id":"a","title":"Milk","priority":1,"due":"0001-01-01T00:00:00Z"},{"id":"b","title":"Eggs, large","priority":2,"due":"0001-01-01T00:00:00Z"}]`},
+		{&JSON{}, "/todos?priority=3", `[]`},
+		{&NDJSON{}, "/todos?fields=id", "{\"id\":\"a\"}\n{\"id\":\"b\"}\n"},
+		{&CSV{}, "/todos", "id,title,priority,due\na,Milk,1,0001-01-01T00:00:00Z\nb,\"Eggs, large\",2,0001-01-01T00:00:00Z\n"},
+		{&CSV{}, "/todos?fields=title,id&sort=-priority", "title,id\n\"Eggs, large\",b\nMilk,a\n"},
+		{&XML{Root: "todo"}, "/todos?fields=id", "<?xml version=\"1.0\" encoding=\"UTF-8\"?>\n<items><todo><id>a</id></todo><todo><id>b</id></todo></items>"},
+	}
+	service := NewFakeService(FakeScenario{})
+	for i, test := range tests {
+		resource := NewFakeStreamResource(test.serializer)
+		w := serve(service.FindMany(resource), "GET", "http://foo.bar"+test.url, "")
+		if w.Code != http.StatusOK || w.Body.String() != test.expected {
+			t.Errorf("#%d Error, expected %d %q, got %d %q", i, http.StatusOK, test.expected, w.Code, w.Body.String())
+		}
+		if _, ok := test.serializer.(StreamEncoder); ok && !w.Flushed {
+			t.Errorf("#%d Error, expected the streamed response to be flushed", i)
+		}
+	}
+}
+
+// FakeIterator yields n numbers and then fails when err is set
+type FakeIterator struct {
+	n, i   int
+	err    error
+	cancel func()
+	closed bool
+}
+
+func (it *FakeIterator) Next() bool {
+	if it.i == 2 && it.cancel != nil {
+		it.cancel()
+	}
+	it.i++
+	return it.i <= it.n
+}
+
+func (it *FakeIterator) Value() interface{} { return it.i }
+func (it *FakeIterator) Err() error         { return it.err }
+func (it *FakeIterator) Close() error       { it.closed = true; return nil }
+
+func TestStreamInterrupted(t *testing.T) {
+	r := httptest.NewRequest("GET", "http://foo.bar/todos", nil)
+	ctx, cancel := context.WithCancel(r.Context())
+	tests := []struct {
+		iterator *FakeIterator
+		request  *http.Request
+		expected string
+	}{
+		{&FakeIterator{n: 3}, r, "[1,2,3]"},
+		{&FakeIterator{n: 3, err: errors.New("The connection was lost")}, r, "[1,2,3"},
+		{&FakeIterator{n: 5, cancel: cancel}, r.WithContext(ctx), "[1,2"},
+	}
+	for i, test := range tests {
+		w := httptest.NewRecorder()
+		err := stream(w, test.request, test.iterator, &JSON{})
+		if w.Body.String() != test.expected {
+			t.Errorf("#%d Error, expected %s, got %s", i, test.expected, w.Body.String())
+		}
+		if (err != nil) != (i > 0) {
+			t.Errorf("#%d Error, unexpected error %v", i, err)
+		}
+		if !test.iterator.closed {
+			t.Errorf("#%d Error, expected the iterator to be closed", i)
+		}
+	}
+}
+
+func TestStreamDecode(t *testing.T) {
+	strict := &DecodeOptions{DisallowUnknownFields: true, MaxBodySize: 64}
+	tests := []struct {
+		serializer Serializer
+		options    *DecodeOptions
+		body       string
+		expected   int
+		message    string
+	}{
+		{&NDJSON{}, nil, "{\"id\": \"a\", \"title\": \"Milk\"}\n\n{\"id\": \"b\", \"title\": \"Eggs\"}\n", http.StatusCreated, ""},
+		{&NDJSON{}, nil, "{\"id\": \"a\"}\n{\"id\": ", http.StatusBadRequest, ""},
+		{&NDJSON{}, nil, "\n", http.StatusBadRequest, "\"The request body is empty\"\n"},
+		{&NDJSON{}, strict, "{\"id\": \"a\", \"title\": \"Milk\"}\n{\"id\": \"b\", \"title\": \"Eggs\"}\n", http.StatusCreated, ""},
+		{&NDJSON{}, strict, "{\"id\": \"a\"}\n{\"id\": \"b\", \"colour\": \"red\"}\n", http.StatusBadRequest,
+			"\"colour: unknown field at byte offset 24\"\n"},
+		{&NDJSON{}, strict, "{\"id\": \"a\"}\n" + strings.Repeat("\n", 64), http.StatusRequestEntityTooLarge, "\"The request body is larger than 64 bytes\"\n"},
+		{&CSV{}, nil, "id,title,priority,unknown\na,Milk,1,x\nb,Eggs,,y\n", http.StatusCreated, ""},
+		{&CSV{}, nil, "id,priority\na,high\n", http.StatusBadRequest, ""},
+		{&CSV{}, nil, "id,title\n", http.StatusBadRequest, ""},
+	}
+	service := NewFakeService(FakeScenario{})
+	for i, test := range tests {
+		storage := NewMemory(reflect.TypeOf(FakeTodo{}))
+		resource := NewFakeTodoResource(storage).UseSerializer(test.serializer)
+		if test.options != nil {
+			resource.UseDecodeOptions(test.options)
+		}
+		w := serve(service.InsertMany(resource), "POST", "http://foo.bar/todos", test.body)
+		if w.Code != test.expected || test.message != "" && w.Body.String() != test.message {
+			t.Errorf("#%d Error, expected %d %s, got %d: %s", i, test.expected, test.message, w.Code, w.Body.String())
+		}
+		if w.Code == http.StatusCreated && storage.Len() != 2 {
+			t.Errorf("#%d Error, expected 2 documents, got %d", i, storage.Len())
+		}
+	}
+}
+
+func TestCSVViolations(t *testing.T) {
+	type FakeCSVNamed struct {
+		ID   string `json:"id"`
+		Name string `json:"name" validate:"required"`
+	}
+	resource := NewResource("named").
+		UseType(reflect.TypeOf(FakeCSVNamed{})).
+		UseStorage(NewMemory(reflect.TypeOf(FakeCSVNamed{}))).
+		UseValidator(&TagValidator{}).
+		UseSerializer(&CSV{})
+	w := serve(NewFakeService(FakeScenario{}).InsertOne(resource), "POST", "http://foo.bar/names", "id,name\na,\n")
+	expected := "field,rule,param,message,code\nname,required,,is required,required\n"
+	if w.Code != http.StatusUnprocessableEntity || w.Body.String() != expected {
+		t.Errorf("Error, expected %d %q, got %d %q", http.StatusUnprocessableEntity, expected, w.Code, w.Body.String())
+	}
+}
+
+func TestSQLStream(t *testing.T) {
+	db, _ := sql.Open("restfake", "")
+	fakeSQLDriver.respond = func(query string) FakeSQLResponse {
+		return FakeSQLResponse{rows: [][]driver.Value{{int64(2), "Eggs", int64(2)}, {int64(3), "Milk", int64(2)}}}
+	}
+	resource := NewResource("todo").
+		UseType(reflect.TypeOf(FakeRow{})).
+		UseStorage(NewSQL(db, SQLite, "todos", reflect.TypeOf(FakeRow{}))).
+		UseValidator(&FakeNoopValidator{}).
+		UseSerializer(&NDJSON{}).
+		UseStreaming(true)
+	w := serve(NewFakeService(FakeScenario{}).FindMany(resource), "GET", "http://foo.bar/todos?fields=title", "")
+	if w.Body.String() != "{\"title\":\"Eggs\"}\n{\"title\":\"Milk\"}\n" {
+		t.Errorf("Error, unexpected stream %q", w.Body.String())
+	}
+}
+
+// FakeStreamingStorage streams its iterator
+type FakeStreamingStorage struct {
+	FakeStorage
+	iterator *FakeIterator
+}
+
+func (s *FakeStreamingStorage) FindStream() (Iterator, error) {
+	s.SetResponseStatus(http.StatusOK)
+	return s.iterator, nil
+}
+
+func TestStreamClosed(t *testing.T) {
+	replace := func(model *Model) error {
+		model.SetResponseBody([]int{})
+		return nil
+	}
+	tests := []struct {
+		scenario FakeScenario
+		hook     Hook
+		status   int
+		expected string
+	}{
+		{FakeScenario{}, nil, http.StatusOK, "[1,2]"},
+		{FakeScenario{}, replace, http.StatusOK, "[]"},
+		{FakeScenario{failBroker: true}, nil, http.StatusInternalServerError, `"Internal Server Error"`},
+	}
+	for i, test := range tests {
+		iterator := &FakeIterator{n: 2}
+		resource := NewFakeResource(test.scenario).UseStorage(&FakeStreamingStorage{iterator: iterator}).UseStreaming(true)
+		if test.hook != nil {
+			resource.AddHook(BEFOREENCODE, test.hook)
+		}
+		w := serve(NewFakeService(test.scenario).FindMany(resource), "GET", "http://foo.bar/test", "")
+		if w.Code != test.status || w.Body.String() != test.expected {
+			t.Errorf("#%d Error, expected %d %s, got %d %s", i, test.status, test.expected, w.Code, w.Body.String())
+		}
+		if !iterator.closed {
+			t.Errorf("#%d Error, expected the iterator to be closed", i)
+		}
+	}
+}
@@ -0,0 +1,291 @@
+package rest
+
+import (
+	"errors"
+	"fmt"
+	"net"
+	"net/http"
+	"regexp"
+	"strings"
+)
+
+// TenantResolver - returns the tenant of a request, the empty string when it does not name one
+type TenantResolver func(c *Context) (string, error)
+
+// TenantConfig - the configuration overrides of a tenant
+type TenantConfig struct {
+	// Actions - the actions enabled for the tenant, e.g. findMany for every resource or todos.remove for one, all
+	// of them when empty
+	Actions []string
+	// RateLimits - the rate limits of the tenant's requests, in addition to those of the service and resources
+	RateLimits []*RateLimit
+}
+
+// enables reports whether the tenant may perform the action on the resource
+func (c *TenantConfig) enables(name, action string) bool {
+	if c == nil || len(c.Actions) == 0 {
+		return true
+	}
+	for _, a := range c.Actions {
+		if a == action || a == name+"."+action {
+			return true
+		}
+	}
+	return false
+}
+
+// Tenancy - resolves the tenant of requests with the first of the Resolvers that finds one
+type Tenancy struct {
+	Resolvers []TenantResolver
+	// Required - answer requests without a tenant with 400
+	Required bool
+	// Tenants - the configuration overrides by tenant
+	Tenants map[string]*TenantConfig
+	// Authorize - reports whether the caller, nil when anonymous, is a member of the tenant it resolved, answering
+	// 403 when it is not. When it is nil only tenants taken from a claim of the caller are accepted and those named
+	// by a header, subdomain, path or another resolver are answered with 403.
+	Authorize func(principal *Principal, tenant string) bool
+}
+
+// NewTenancy -
+func NewTenancy(resolvers ...TenantResolver) *Tenancy {
+	return &Tenancy{Resolvers: resolvers, Tenants: make(map[string]*TenantConfig)}
+}
+
+// Configure - overrides the configuration of a tenant
+func (t *Tenancy) Configure(tenant string, c *TenantConfig) *Tenancy {
+	t.Tenants[tenant] = c
+	return t
+}
+
+// UseTenancy - resolve the tenant of every request, tagging logs, metrics and events with it
+func (s *Service) UseTenancy(t *Tenancy) {
+	s.Tenancy = t
+}
+
+// UseTenantStorage - store the documents of each tenant in the storage fn returns for it, fn is called for every
+// request and should reuse storages
+func (r *Resource) UseTenantStorage(fn func(tenant string) (Storage, error)) *Resource {
+	r.TenantStorage = fn
+	return r
+}
+
+// UseTenantField - scope the documents of the resource to the tenant held by field, inserted documents are stamped
+// with the tenant of the request
+func (r *Resource) UseTenantField(field string) *Resource {
+	r.TenantField = field
+	return r
+}
+
+// GetTenant - returns the tenant of the request or the empty string
+func (c *Context) GetTenant() (tenant string) {
+	tenant, _ = c.data[TENANT].(string)
+	return tenant
+}
+
+// TenantFromHeader - resolves the tenant from a request header, e.g. X-Tenant-ID
+func TenantFromHeader(name string) TenantResolver {
+	return func(c *Context) (string, error) {
+		return c.GetRequest().Header.Get(name), nil
+	}
+}
+
+// TenantFromSubdomain - resolves the tenant from the subdomain of domain the request is sent to, e.g. acme of
+// acme.api.example.com
+func TenantFromSubdomain(domain string) TenantResolver {
+	suffix := "." + strings.ToLower(strings.TrimPrefix(domain, "."))
+	return func(c *Context) (string, error) {
+		host := c.GetRequest().Host
+		if h, _, err := net.SplitHostPort(host); err == nil {
+			host = h
+		}
+		host = strings.ToLower(host)
+		if !strings.HasSuffix(host, suffix) {
+			return "", nil
+		}
+		tenant := strings.TrimSuffix(host, suffix)
+		if strings.Contains(tenant, ".") {
+			return "", fmt.Errorf("The host %q names more than one subdomain of %s", host, domain)
+		}
+		return tenant, nil
+	}
+}
+
+// TenantFromClaim - resolves the tenant from a claim of the authenticated caller, e.g. tid
+func TenantFromClaim(claim string) TenantResolver {
+	return func(c *Context) (string, error) {
+		principal := c.GetPrincipal()
+		if principal == nil {
+			return "", nil
+		}
+		tenant, _ := principal.Claims[claim].(string)
+		if tenant != "" {
+			c.Set(TENANTCLAIM, true)
+		}
+		return tenant, nil
+	}
+}
+
+// TenantMember - authorizes callers whose claim, a string or list of strings such as tid or tenants, holds the
+// tenant
+func TenantMember(claim string) func(principal *Principal, tenant string) bool {
+	return func(principal *Principal, tenant string) bool {
+		if principal == nil {
+			return false
+		}
+		tenants := stringsClaim(principal.Claims[claim])
+		if t, ok := principal.Claims[claim].(string); ok {
+			tenants = append(tenants, t)
+		}
+		for _, t := range tenants {
+			if t == tenant {
+				return true
+			}
+		}
+		return false
+	}
+}
+
+// TenantFromPath - resolves the tenant from the path segment following prefix, e.g. acme of /tenants/acme/todos
+// with the prefix /tenants
+func TenantFromPath(prefix string) TenantResolver {
+	prefix = "/" + strings.Trim(prefix, "/")
+	if prefix != "/" {
+		prefix += "/"
+	}
+	return func(c *Context) (string, error) {
+		path := c.GetRequest().URL.Path
+		if !strings.HasPrefix(path, prefix) {
+			return "", nil
+		}
+		tenant := strings.TrimPrefix(path, prefix)
+		if i := strings.Index(tenant, "/"); i >= 0 {
+			tenant = tenant[:i]
+		}
+		return tenant, nil
+	}
+}
+
+var (
+	tenantPattern = regexp.MustCompile(`^[A-Za-z0-9_-]+$`)
+	errNoTenant   = errors.New("The request has no tenant")
+)
+
+// resolveTenant sets the tenant of the request, checks the caller is a member of it and the actions enabled for it
+// and routes the resource to its storage
+func (s *Service) resolveTenant(resource *Resource, model *Model) error {
+	if s.Tenancy == nil {
+		return nil
+	}
+	tenant := ""
+	for _, resolve := range s.Tenancy.Resolvers {
+		id, err := resolve(&model.Context)
+		if err != nil {
+			model.SetResponseStatus(http.StatusBadRequest)
+			model.SetResponseBody(err.Error())
+			return err
+		}
+		if id != "" {
+			tenant = id
+			break
+		}
+	}
+	if tenant == "" {
+		if s.Tenancy.Required {
+			model.SetResponseStatus(http.StatusBadRequest)
+			model.SetResponseBody(errNoTenant.Error())
+			return errNoTenant
+		}
+		return nil
+	}
+	if !tenantPattern.MatchString(tenant) {
+		err := fmt.Errorf("The tenant %q is invalid", tenant)
+		model.SetResponseStatus(http.StatusBadRequest)
+		model.SetResponseBody(err.Error())
+		return err
+	}
+	if !s.Tenancy.authorize(model, tenant) {
+		err := fmt.Errorf("The caller is not a member of the tenant %q", tenant)
+		model.SetResponseStatus(http.StatusForbidden)
+		model.SetResponseBody(err.Error())
+		return err
+	}
+	model.Set(TENANT, tenant)
+	action, _ := model.Get(ACTION).(string)
+	if !s.Tenancy.Tenants[tenant].enables(resource.Name, action) {
+		err := fmt.Errorf("The action %s of %s is not enabled for the tenant %q", action, resource.Name, tenant)
+		model.SetResponseStatus(http.StatusForbidden)
+		model.SetResponseBody(err.Error())
+		return err
+	}
+	if resource.TenantStorage != nil {
+		storage, err := resource.TenantStorage(tenant)
+		if err != nil {
+			model.SetResponseStatus(http.StatusInternalServerError)
+			model.SetResponseBody(http.StatusText(http.StatusInternalServerError))
+			return err
+		}
+		model.UseStorage(storage)
+	}
+	return nil
+}
+
+// authorize reports whether the caller may act on behalf of the tenant, only tenants taken from its claims are
+// trusted without Authorize
+func (t *Tenancy) authorize(model *Model, tenant string) bool {
+	if t.Authorize == nil {
+		claimed, _ := model.Get(TENANTCLAIM).(bool)
+		return claimed
+	}
+	return t.Authorize(model.GetPrincipal(), tenant)
+}
+
+// scopeTenant restricts the request to the documents of its tenant
+func (model *Model) scopeTenant() error {
+	field, ok := model.Get(TENANTFIELD).(string)
+	if !ok {
+		return nil
+	}
+	tenant := model.GetTenant()
+	if tenant == "" {
+		model.SetResponseStatus(http.StatusBadRequest)
+		model.SetResponseBody(errNoTenant.Error())
+		return errNoTenant
+	}
+	return model.scope(field, tenant)
+}
+
+// TenantError - an error of a request of a tenant
+type TenantError struct {
+	Tenant string
+	Err    error
+}
+
+func (e *TenantError) Error() string {
+	return fmt.Sprintf("tenant %s: %s", e.Tenant, e.Err)
+}
+
+// tenantLogger tags the errors it logs with a tenant
+type tenantLogger struct {
+	Logger
+	tenant string
+}
+
+func (l tenantLogger) Error(e error) {
+	l.Logger.Error(&TenantError{Tenant: l.tenant, Err: e})
+}
+
+// TaggedMetrics - optional Metrics extension returning metrics recorded with additional tags
+type TaggedMetrics interface {
+	WithTags(tags ...string) Metrics
+}
+
+// forTenant returns a copy of the service tagging logs and metrics with a tenant
+func (s *Service) forTenant(tenant string) *Service {
+	t := *s
+	t.Logger = tenantLogger{Logger: s.Logger, tenant: tenant}
+	if m, ok := s.Metrics.(TaggedMetrics); ok {
+		t.Metrics = m.WithTags("tenant:" + tenant)
+	}
+	return &t
+}
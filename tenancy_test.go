@@ -0,0 +1,240 @@
+package rest
+
+import (
+	"errors"
+	"net/http"
+	"net/http/httptest"
+	"reflect"
+	"strings"
+	"testing"
+	"time"
+)
+
+type FakeTenantTodo struct {
+	ID     string `json:"id" rest:"id"`
+	Tenant string `json:"tenant"`
+	Title  string `json:"title"`
+}
+
+type FakeEventBroker struct {
+	events []*Event
+}
+
+func (b *FakeEventBroker) Publish(event string, v interface{}) error {
+	b.events = append(b.events, v.(*Event))
+	return nil
+}
+
+type FakeErrorLogger struct {
+	errs []error
+}
+
+func (l *FakeErrorLogger) Error(e error) {
+	l.errs = append(l.errs, e)
+}
+
+type FakeTagsClient struct {
+	tags [][]string
+}
+
+func (c *FakeTagsClient) Incr(stat string, tags []string, count float64) error {
+	c.tags = append(c.tags, tags)
+	return nil
+}
+
+func (c *FakeTagsClient) Timing(stat string, d time.Duration, tags []string, delta float64) error {
+	return nil
+}
+
+func TestTenancy(t *testing.T) {
+	broker, logger, client := &FakeEventBroker{}, &FakeErrorLogger{}, &FakeTagsClient{}
+	service := NewService()
+	service.UseBroker(broker)
+	service.UseLogger(logger)
+	service.UseMetrics(NewServiceMetrics().UseClient(client).UseLogger(logger).UseTags([]string{"host"}))
+	tenancy := NewTenancy(TenantFromHeader("X-Tenant-ID"))
+	tenancy.Required = true
+	tenancy.Authorize = func(principal *Principal, tenant string) bool { return true }
+	service.UseTenancy(tenancy.Configure("beta", &TenantConfig{Actions: []string{FINDMANY, "todos.insertOne"}}))
+	resource := NewResource("todos").
+		UseType(reflect.TypeOf(FakeTenantTodo{})).
+		UseStorage(NewMemory(reflect.TypeOf(FakeTenantTodo{}))).
+		UseValidator(&FakeNoopValidator{}).
+		UseSerializer(&JSON{}).
+		UseTenantField("tenant")
+	url := "http://foo.bar/todos"
+	tests := []struct {
+		handler  func(http.ResponseWriter, *http.Request)
+		verb     string
+		url      string
+		body     string
+		tenant   string
+		status   int
+		contains string
+		excludes string
+	}{
+		{service.InsertOne(resource), "POST", url, `{"id": "a", "title": "Milk", "tenant": "globex"}`, "acme", http.StatusCreated, `"tenant":"acme"`, ""},
+		{service.InsertMany(resource), "POST", url, `[{"id": "g", "title": "Bread"}]`, "globex", http.StatusCreated, `"tenant":"globex"`, ""},
+		{service.InsertOne(resource), "POST", url, `{"id": "b", "title": "Eggs"}`, "beta", http.StatusCreated, `"tenant":"beta"`, ""},
+		{service.FindMany(resource), "GET", url, "", "acme", http.StatusOK, `"Milk"`, `"Bread"`},
+		{service.FindMany(resource), "GET", url, "", "beta", http.StatusOK, `"Eggs"`, `"Milk"`},
+		{service.FindOne(resource), "GET", url + "/g", "", "acme", http.StatusNotFound, "", ""},
+		{service.Update(resource), "PUT", url + "/g", `{"title": "Rye"}`, "acme", http.StatusNotFound, "", ""},
+		{service.Upsert(resource), "PUT", url + "/g", `{"title": "Rye"}`, "acme", http.StatusNotFound, "", ""},
+		{service.Remove(resource), "DELETE", url + "/g", "", "acme", http.StatusNotFound, "", ""},
+		{service.Remove(resource), "DELETE", url + "/b", "", "beta", http.StatusForbidden, `"The action remove of todos is not enabled for the tenant \"beta\""`, ""},
+		{service.FindMany(resource), "GET", url, "", "", http.StatusBadRequest, `"The request has no tenant"`, ""},
+		{service.FindMany(resource), "GET", url, "", "acme corp", http.StatusBadRequest, `"The tenant \"acme corp\" is invalid"`, ""},
+		{service.Remove(resource), "DELETE", url + "/g", "", "globex", http.StatusNoContent, "", ""},
+	}
+	for i, test := range tests {
+		broker.events, logger.errs, client.tags = nil, nil, nil
+		r := NewTestRequest(test.verb, test.url, test.body)
+		r.Header.Set("X-Tenant-ID", test.tenant)
+		w := httptest.NewRecorder()
+		test.handler(w, r)
+		if w.Code != test.status {
+			t.Errorf("#%d Error, expected %d, got %d %s", i, test.status, w.Code, w.Body.String())
+		}
+		if !strings.Contains(w.Body.String(), test.contains) || test.excludes != "" && strings.Contains(w.Body.String(), test.excludes) {
+			t.Errorf("#%d Error, expected %s without %s, got %s", i, test.contains, test.excludes, w.Body.String())
+		}
+		if test.status < http.StatusBadRequest {
+			if len(broker.events) != 1 || broker.events[0].Tenant != test.tenant {
+				t.Errorf("#%d Error, expected an event of the tenant %s", i, test.tenant)
+			}
+			if len(client.tags) != 1 || !reflect.DeepEqual(client.tags[0], []string{"host", "tenant:" + test.tenant}) {
+				t.Errorf("#%d Error, expected metrics tagged with the tenant %s, got %v", i, test.tenant, client.tags)
+			}
+		}
+		for _, err := range logger.errs {
+			if te, ok := err.(*TenantError); test.status == http.StatusNotFound && (!ok || te.Tenant != test.tenant) {
+				t.Errorf("#%d Error, expected errors tagged with the tenant %s, got %v", i, test.tenant, err)
+			}
+		}
+	}
+}
+
+func TestTenantStorage(t *testing.T) {
+	storages := map[string]Storage{
+		"acme":   NewMemory(reflect.TypeOf(FakeTodo{})),
+		"globex": NewMemory(reflect.TypeOf(FakeTodo{})),
+	}
+	service := NewFakeService(FakeScenario{})
+	tenancy := NewTenancy(TenantFromPath("/tenants"))
+	tenancy.Authorize = func(principal *Principal, tenant string) bool { return true }
+	service.UseTenancy(tenancy)
+	resource := NewFakeTodoResource(NewMemory(reflect.TypeOf(FakeTodo{}))).
+		UseTenantStorage(func(tenant string) (Storage, error) {
+			storage, ok := storages[tenant]
+			if !ok {
+				return nil, errors.New("The tenant has no storage")
+			}
+			return storage, nil
+		})
+	tests := []struct {
+		handler  func(http.ResponseWriter, *http.Request)
+		verb     string
+		url      string
+		body     string
+		status   int
+		contains string
+		excludes string
+	}{
+		{service.InsertOne(resource), "POST", "http://foo.bar/tenants/acme/todos", `{"title": "Milk"}`, http.StatusCreated, "", ""},
+		{service.InsertOne(resource), "POST", "http://foo.bar/tenants/globex/todos", `{"title": "Bread"}`, http.StatusCreated, "", ""},
+		{service.InsertOne(resource), "POST", "http://foo.bar/todos", `{"title": "Eggs"}`, http.StatusCreated, "", ""},
+		{service.FindMany(resource), "GET", "http://foo.bar/tenants/acme/todos", "", http.StatusOK, `"Milk"`, `"Bread"`},
+		{service.FindMany(resource), "GET", "http://foo.bar/tenants/globex/todos", "", http.StatusOK, `"Bread"`, `"Milk"`},
+		{service.FindMany(resource), "GET", "http://foo.bar/todos", "", http.StatusOK, `"Eggs"`, `"Milk"`},
+		{service.FindMany(resource), "GET", "http://foo.bar/tenants/initech/todos", "", http.StatusInternalServerError, "", ""},
+	}
+	for i, test := range tests {
+		w := serve(test.handler, test.verb, test.url, test.body)
+		if w.Code != test.status {
+			t.Errorf("#%d Error, expected %d, got %d %s", i, test.status, w.Code, w.Body.String())
+		}
+		if !strings.Contains(w.Body.String(), test.contains) || test.excludes != "" && strings.Contains(w.Body.String(), test.excludes) {
+			t.Errorf("#%d Error, expected %s without %s, got %s", i, test.contains, test.excludes, w.Body.String())
+		}
+	}
+}
+
+func TestTenantMembership(t *testing.T) {
+	service := NewFakeService(FakeScenario{})
+	tenancy := NewTenancy(TenantFromClaim("tid"), TenantFromHeader("X-Tenant-ID"))
+	service.UseTenancy(tenancy)
+	resource := NewFakeTodoResource(NewMemory(reflect.TypeOf(FakeTodo{}))).
+		UseAuthenticator(Optional(&APIKey{Header: "X-API-Key", Lookup: func(key string) (*Principal, error) {
+			principals := map[string]*Principal{
+				"k1": {Subject: "wanjiru", Claims: map[string]interface{}{"tenants": []interface{}{"acme", "globex"}}},
+				"k2": {Subject: "kamau", Claims: map[string]interface{}{"tenants": "globex"}},
+				"k3": {Subject: "otieno", Claims: map[string]interface{}{"tid": "acme"}},
+			}
+			return principals[key], nil
+		}}))
+	member := TenantMember("tenants")
+	tests := []struct {
+		authorize func(principal *Principal, tenant string) bool
+		key       string
+		tenant    string
+		status    int
+		body      string
+	}{
+		{member, "k1", "acme", http.StatusOK, ""},
+		{member, "k1", "globex", http.StatusOK, ""},
+		{member, "k1", "initech", http.StatusForbidden, `"The caller is not a member of the tenant \"initech\""`},
+		{member, "k2", "acme", http.StatusForbidden, `"The caller is not a member of the tenant \"acme\""`},
+		{member, "k2", "globex", http.StatusOK, ""},
+		{member, "", "acme", http.StatusForbidden, `"The caller is not a member of the tenant \"acme\""`},
+		{member, "", "", http.StatusOK, ""},
+		{nil, "k1", "acme", http.StatusForbidden, `"The caller is not a member of the tenant \"acme\""`},
+		{nil, "", "acme", http.StatusForbidden, `"The caller is not a member of the tenant \"acme\""`},
+		{nil, "k3", "", http.StatusOK, ""},
+		{nil, "k3", "globex", http.StatusOK, ""},
+		{nil, "", "", http.StatusOK, ""},
+	}
+	for i, test := range tests {
+		tenancy.Authorize = test.authorize
+		r := NewTestRequest("GET", "http://foo.bar/todos", "")
+		r.Header.Set("X-API-Key", test.key)
+		r.Header.Set("X-Tenant-ID", test.tenant)
+		w := httptest.NewRecorder()
+		service.FindMany(resource)(w, r)
+		if w.Code != test.status || test.body != "" && w.Body.String() != test.body {
+			t.Errorf("#%d Error, expected %d %s, got %d %s", i, test.status, test.body, w.Code, w.Body.String())
+		}
+	}
+}
+
+func TestTenantResolvers(t *testing.T) {
+	tests := []struct {
+		resolver  TenantResolver
+		url       string
+		principal *Principal
+		expected  string
+		valid     bool
+	}{
+		{TenantFromSubdomain("api.foo.bar"), "http://acme.api.foo.bar:8080/todos", nil, "acme", true},
+		{TenantFromSubdomain(".api.foo.bar"), "http://ACME.api.foo.bar/todos", nil, "acme", true},
+		{TenantFromSubdomain("api.foo.bar"), "http://api.foo.bar/todos", nil, "", true},
+		{TenantFromSubdomain("api.foo.bar"), "http://www.acme.api.foo.bar/todos", nil, "", false},
+		{TenantFromPath("/tenants/"), "http://foo.bar/tenants/acme", nil, "acme", true},
+		{TenantFromPath(""), "http://foo.bar/acme/todos", nil, "acme", true},
+		{TenantFromPath("tenants"), "http://foo.bar/todos", nil, "", true},
+		{TenantFromClaim("tid"), "http://foo.bar/todos", &Principal{Claims: map[string]interface{}{"tid": "acme"}}, "acme", true},
+		{TenantFromClaim("tid"), "http://foo.bar/todos", &Principal{}, "", true},
+		{TenantFromClaim("tid"), "http://foo.bar/todos", nil, "", true},
+	}
+	for i, test := range tests {
+		c := NewContext()
+		c.Set(REQUEST, NewTestRequest("GET", test.url, ""))
+		if test.principal != nil {
+			c.Set(PRINCIPAL, test.principal)
+		}
+		tenant, err := test.resolver(&c)
+		if tenant != test.expected || (err == nil) != test.valid {
+			t.Errorf("#%d Error, expected %q %v, got %q %v", i, test.expected, test.valid, tenant, err)
+		}
+	}
+}
@@ -0,0 +1,413 @@
+package rest
+
+import (
+	"fmt"
+	"net/http"
+	"net/mail"
+	"net/url"
+	"reflect"
+	"regexp"
+	"strconv"
+	"strings"
+	"sync"
+	"unicode/utf8"
+)
+
+// TagValidator - a Validator checking the request body against the `validate` struct tags of the resource type,
+// e.g. `validate:"omitempty,min=3,max=50"`. Rules of a `validate.<action>` tag, e.g. `validate.insertOne:"required"`,
+// are checked before them for that action only, a `validate.<action>:"-"` tag skips the field for that action.
+// Every field breaking a rule is reported at once with 422.
+//
+// Rules: required, omitempty, min=n, max=n and len=n (the value of numbers, the length of strings, slices and maps),
+// email, url, uuid, oneof=a b c, eqfield=f, nefield=f, gtfield=f, gtefield=f, ltfield=f and ltefield=f (compared to
+// the sibling field f), dive (the following rules apply to the items of a slice or map) and regex=pattern, which takes
+// the rest of the tag. Custom rules are added with RegisterRule. Nested structs are validated as well.
+type TagValidator struct {
+	*Context
+}
+
+// FieldError - a rule a field of the request body breaks, Field is its path as in items[0].sku and Code identifies
+// the message, the rule name or for min, max and len the rule and what it measured, e.g. min.string
+type FieldError struct {
+	Field   string `json:"field" xml:"field"`
+	Rule    string `json:"rule" xml:"rule"`
+	Param   string `json:"param,omitempty" xml:"param,omitempty"`
+	Message string `json:"message" xml:"message"`
+	Code    string `json:"code" xml:"code"`
+}
+
+// Violations - an error listing the fields of the request body it concerns, serializers render each FieldError
+// of the errors implementing it on its own
+type Violations interface {
+	error
+	Errors() []FieldError
+}
+
+// ValidationErrors - the rules the request body breaks
+type ValidationErrors []FieldError
+
+// Errors -
+func (e ValidationErrors) Errors() []FieldError {
+	return e
+}
+
+func (e ValidationErrors) Error() string {
+	msgs := make([]string, len(e))
+	for i, fe := range e {
+		msgs[i] = fe.Field + ": " + fe.Message
+	}
+	return strings.Join(msgs, "; ")
+}
+
+// rule - one rule of a validate tag
+type rule struct {
+	Name  string
+	Param string
+}
+
+// parseRules splits a validate tag into its rules, regex takes the rest of the tag since patterns may hold commas
+func parseRules(tag string) []rule {
+	var rules []rule
+	for tag != "" {
+		part := tag
+		if strings.HasPrefix(tag, "regex=") {
+			tag = ""
+		} else if i := strings.Index(tag, ","); i >= 0 {
+			part, tag = tag[:i], tag[i+1:]
+		} else {
+			tag = ""
+		}
+		r := rule{Name: strings.TrimSpace(part)}
+		if i := strings.Index(part, "="); i >= 0 {
+			r.Name, r.Param = strings.TrimSpace(part[:i]), part[i+1:]
+		}
+		if r.Name != "" {
+			rules = append(rules, r)
+		}
+	}
+	return rules
+}
+
+var (
+	uuidPattern = regexp.MustCompile(`^[0-9a-fA-F]{8}-[0-9a-fA-F]{4}-[0-9a-fA-F]{4}-[0-9a-fA-F]{4}-[0-9a-fA-F]{12}$`)
+	// patternCache holds the compiled patterns of regex rules
+	patternCache = struct {
+		sync.RWMutex
+		m map[string]*regexp.Regexp
+	}{m: make(map[string]*regexp.Regexp)}
+)
+
+func cachedPattern(pattern string) (*regexp.Regexp, error) {
+	patternCache.RLock()
+	re, ok := patternCache.m[pattern]
+	patternCache.RUnlock()
+	if ok {
+		return re, nil
+	}
+	re, err := regexp.Compile(pattern)
+	if err != nil {
+		return nil, err
+	}
+	patternCache.Lock()
+	patternCache.m[pattern] = re
+	patternCache.Unlock()
+	return re, nil
+}
+
+// UseContext -
+func (v *TagValidator) UseContext(c *Context) {
+	v.Context = c
+}
+
+// Clone - returns a TagValidator for another request
+func (v *TagValidator) Clone() Validator {
+	return &TagValidator{}
+}
+
+// Validate - answers 422 with ValidationErrors when the request body breaks rules and 500 when a tag is malformed
+func (v *TagValidator) Validate() error {
+	body := v.Get(REQUESTBODY)
+	if body == nil {
+		return nil
+	}
+	action, _ := v.Get(ACTION).(string)
+	c := &tagChecker{ctx: v.Context, action: action, errs: ValidationErrors{}}
+	c.document(reflect.ValueOf(body), "")
+	if c.err != nil {
+		v.SetResponseStatus(http.StatusInternalServerError)
+		v.SetResponseBody(http.StatusText(http.StatusInternalServerError))
+		return c.err
+	}
+	if len(c.errs) > 0 {
+		v.SetResponseStatus(http.StatusUnprocessableEntity)
+		v.SetResponseBody(c.errs)
+		return c.errs
+	}
+	return nil
+}
+
+// tagChecker collects the violations of one request body
+type tagChecker struct {
+	ctx    *Context
+	action string
+	errs   ValidationErrors
+	err    error
+}
+
+// document checks the fields of a struct, or of every struct of a slice such as an insertMany body
+func (c *tagChecker) document(v reflect.Value, path string) {
+	v, ok := indirectValue(v)
+	if !ok {
+		return
+	}
+	switch {
+	case v.Kind() == reflect.Slice || v.Kind() == reflect.Array:
+		for i := 0; i < v.Len(); i++ {
+			c.document(v.Index(i), fmt.Sprintf("%s[%d]", path, i))
+		}
+		return
+	case v.Kind() == reflect.Map && v.Type().Key().Kind() == reflect.String:
+		for _, key := range v.MapKeys() {
+			c.document(v.MapIndex(key), joinPath(path, key.String()))
+		}
+		return
+	case v.Kind() != reflect.Struct || v.Type() == timeType:
+		return
+	}
+	for _, f := range typeFields(v.Type()) {
+		rules, skip := fieldRules(f, c.action)
+		if skip {
+			continue
+		}
+		c.field(v, fieldValue(v, f.Index), joinPath(path, f.Name), rules)
+	}
+}
+
+// fieldRules returns the rules of a field for an action, those of its validate.<action> tag first, skip is set when
+// that tag is "-"
+func fieldRules(f field, action string) (rules []rule, skip bool) {
+	tag := f.Tag.Get("validate")
+	if actionTag, ok := f.Tag.Lookup("validate." + action); ok {
+		if actionTag == "-" {
+			return nil, true
+		}
+		tag = strings.Trim(actionTag+","+tag, ",")
+	}
+	return parseRules(tag), false
+}
+
+// field checks the rules of a field in order, stopping at the first one it breaks
+func (c *tagChecker) field(parent, v reflect.Value, path string, rules []rule) {
+	for i, r := range rules {
+		switch r.Name {
+		case "omitempty":
+			if isEmpty(v) {
+				return
+			}
+			continue
+		case "dive":
+			items, ok := indirectValue(v)
+			if !ok {
+				return
+			}
+			switch items.Kind() {
+			case reflect.Slice, reflect.Array:
+				for j := 0; j < items.Len(); j++ {
+					c.field(parent, items.Index(j), fmt.Sprintf("%s[%d]", path, j), rules[i+1:])
+				}
+			case reflect.Map:
+				for _, key := range items.MapKeys() {
+					c.field(parent, items.MapIndex(key), joinPath(path, fmt.Sprint(key.Interface())), rules[i+1:])
+				}
+			default:
+				c.err = fmt.Errorf("The dive rule of %s needs a slice or map", path)
+			}
+			return
+		}
+		code, msg, err := c.check(parent, v, r)
+		if err != nil {
+			c.err = fmt.Errorf("%s: %s", path, err)
+			return
+		}
+		if msg != "" {
+			c.errs = append(c.errs, FieldError{Field: path, Rule: r.Name, Param: r.Param, Message: msg, Code: code})
+			return
+		}
+	}
+	c.document(v, path)
+}
+
+// check applies a custom rule registered with RegisterRule or a built-in one
+func (c *tagChecker) check(parent, v reflect.Value, r rule) (string, string, error) {
+	fn, ok := lookupRule(r.Name)
+	if !ok {
+		return checkRule(parent, v, r)
+	}
+	v, ok = indirectValue(v)
+	if !ok || (v.Kind() == reflect.Interface && v.IsNil()) {
+		return "", "", nil
+	}
+	msg, err := fn(c.ctx, v.Interface(), r.Param)
+	return r.Name, msg, err
+}
+
+// isEmpty reports whether a value is zero, or an empty slice or map
+func isEmpty(v reflect.Value) bool {
+	switch v.Kind() {
+	case reflect.Slice, reflect.Map:
+		return v.Len() == 0
+	case reflect.Interface:
+		return v.IsNil()
+	}
+	return isZero(v)
+}
+
+// length returns the length of strings, in characters, slices and maps
+func length(v reflect.Value) (int, bool) {
+	switch v.Kind() {
+	case reflect.String:
+		return utf8.RuneCountInString(v.String()), true
+	case reflect.Slice, reflect.Array, reflect.Map:
+		return v.Len(), true
+	}
+	return 0, false
+}
+
+// number returns the value of numbers as a float64
+func number(v reflect.Value) (float64, bool) {
+	switch v.Kind() {
+	case reflect.Int, reflect.Int8, reflect.Int16, reflect.Int32, reflect.Int64:
+		return float64(v.Int()), true
+	case reflect.Uint, reflect.Uint8, reflect.Uint16, reflect.Uint32, reflect.Uint64:
+		return float64(v.Uint()), true
+	case reflect.Float32, reflect.Float64:
+		return v.Float(), true
+	}
+	return 0, false
+}
+
+// sizeKinds - what the min, max and len rules measure, in the order of sizeMessages
+var sizeKinds = [3]string{"string", "items", "number"}
+
+// sizeMessages - the messages of the min, max and len rules for lengths of strings and items, and for numbers
+var sizeMessages = map[string][3]string{
+	"min": {"must be at least %s characters long", "must have at least %s items", "must be at least %s"},
+	"max": {"must be at most %s characters long", "must have at most %s items", "must be at most %s"},
+	"len": {"must be exactly %s characters long", "must have exactly %s items", "must be %s"},
+}
+
+// fieldComparisons - the outcomes of compare each cross field rule accepts, and its message
+var fieldComparisons = map[string]struct {
+	accept []int
+	msg    string
+}{
+	"eqfield":  {[]int{0}, "must equal %s"},
+	"nefield":  {[]int{-1, 1}, "must not equal %s"},
+	"gtfield":  {[]int{1}, "must be greater than %s"},
+	"gtefield": {[]int{0, 1}, "must be greater than or equal to %s"},
+	"ltfield":  {[]int{-1}, "must be less than %s"},
+	"ltefield": {[]int{-1, 0}, "must be less than or equal to %s"},
+}
+
+// checkRule returns the code and message of a broken rule, or an error when the rule does not apply to the value
+func checkRule(parent, v reflect.Value, r rule) (string, string, error) {
+	if r.Name == "required" {
+		if isEmpty(v) {
+			return r.Name, "is required", nil
+		}
+		return "", "", nil
+	}
+	v, ok := indirectValue(v)
+	if !ok {
+		// Absent optional values break no rules.
+		return "", "", nil
+	}
+	if v.Kind() == reflect.Interface {
+		if v.IsNil() {
+			return "", "", nil
+		}
+		v = v.Elem()
+	}
+	switch r.Name {
+	case "min", "max", "len":
+		n, err := strconv.ParseFloat(r.Param, 64)
+		if err != nil {
+			return "", "", fmt.Errorf("The %s rule needs a number", r.Name)
+		}
+		var size float64
+		kind := 0
+		if l, ok := length(v); ok {
+			size = float64(l)
+			if v.Kind() != reflect.String {
+				kind = 1
+			}
+		} else if size, ok = number(v); ok {
+			kind = 2
+		} else {
+			return "", "", fmt.Errorf("The %s rule does not apply to %s", r.Name, v.Type())
+		}
+		if (r.Name == "min" && size < n) || (r.Name == "max" && size > n) || (r.Name == "len" && size != n) {
+			return r.Name + "." + sizeKinds[kind], fmt.Sprintf(sizeMessages[r.Name][kind], r.Param), nil
+		}
+		return "", "", nil
+	case "email", "url", "uuid", "regex":
+		if v.Kind() != reflect.String {
+			return "", "", fmt.Errorf("The %s rule needs a string", r.Name)
+		}
+		s := v.String()
+		switch r.Name {
+		case "email":
+			if a, err := mail.ParseAddress(s); err != nil || a.Address != s {
+				return r.Name, "must be an email address", nil
+			}
+		case "url":
+			if u, err := url.Parse(s); err != nil || u.Scheme == "" || u.Host == "" {
+				return r.Name, "must be a URL", nil
+			}
+		case "uuid":
+			if !uuidPattern.MatchString(s) {
+				return r.Name, "must be a UUID", nil
+			}
+		case "regex":
+			re, err := cachedPattern(r.Param)
+			if err != nil {
+				return "", "", err
+			}
+			if !re.MatchString(s) {
+				return r.Name, "must match " + r.Param, nil
+			}
+		}
+		return "", "", nil
+	case "oneof":
+		s := fmt.Sprint(v.Interface())
+		options := strings.Fields(r.Param)
+		for _, option := range options {
+			if s == option {
+				return "", "", nil
+			}
+		}
+		return r.Name, "must be one of " + strings.Join(options, ", "), nil
+	}
+	comparison, ok := fieldComparisons[r.Name]
+	if !ok {
+		return "", "", fmt.Errorf("Unknown validation rule %q", r.Name)
+	}
+	f, ok := lookupField(parent.Type(), r.Param)
+	if !ok {
+		return "", "", fmt.Errorf("The %s rule names the unknown field %q", r.Name, r.Param)
+	}
+	other, ok := indirectValue(fieldValue(parent, f.Index))
+	if !ok {
+		return "", "", nil
+	}
+	if other.Type() != v.Type() {
+		return "", "", fmt.Errorf("The %s rule compares %s to %s %s", r.Name, v.Type(), r.Param, other.Type())
+	}
+	result := compare(v, other.Interface())
+	for _, accepted := range comparison.accept {
+		if result == accepted {
+			return "", "", nil
+		}
+	}
+	return r.Name, fmt.Sprintf(comparison.msg, r.Param), nil
+}
@@ -0,0 +1,151 @@
+package rest
+
+import (
+	"encoding/json"
+	"net/http"
+	"reflect"
+	"sync"
+	"testing"
+	"time"
+)
+
+type FakeLine struct {
+	SKU      string `json:"sku" validate:"required,regex=^[A-Z]{2,3}-[0-9]+$"`
+	Quantity int    `json:"quantity" validate:"min=1,max=100"`
+}
+
+type FakeSignup struct {
+	ID       string            `json:"id" validate:"omitempty,uuid"`
+	Email    string            `json:"email" validate.insertOne:"required" validate:"omitempty,email"`
+	Name     string            `json:"name" validate:"min=2,max=5"`
+	Website  string            `json:"website" validate:"omitempty,url"`
+	Plan     string            `json:"plan" validate:"oneof=free pro"`
+	Password string            `json:"password" validate.update:"-" validate:"len=8"`
+	Confirm  string            `json:"confirm" validate.update:"-" validate:"eqfield=password"`
+	From     int               `json:"from"`
+	To       int               `json:"to" validate:"gtefield=from"`
+	Tags     []string          `json:"tags" validate:"max=2,dive,min=2"`
+	Lines    []FakeLine        `json:"lines" validate:"required"`
+	Address  *FakeAddress      `json:"address"`
+	Labels   map[string]string `json:"labels" validate:"dive,oneof=red blue"`
+}
+
+func TestTagValidator(t *testing.T) {
+	valid := `{"email": "otieno@example.com", "name": "Oti", "plan": "pro", "password": "12345678", "confirm": "12345678", "from": 1, "to": 1,
+		"tags": ["go"], "lines": [{"sku": "AB-1", "quantity": 1}], "labels": {"team": "red"}}`
+	tests := []struct {
+		action   string
+		body     string
+		status   int
+		expected []FieldError
+	}{
+		{INSERTONE, valid, http.StatusCreated, nil},
+		{INSERTONE, `{"id": "nope", "email": "otieno", "name": "Otieno Kamau", "website": "example.com", "plan": "gold", "password": "1234", "confirm": "4321",
+			"from": 2, "to": 1, "tags": ["go", "g"], "lines": [{"sku": "AB-1", "quantity": 1}, {"sku": "ab-1", "quantity": 0}], "labels": {"team": "green"}}`,
+			http.StatusUnprocessableEntity, []FieldError{
+				{"id", "uuid", "", "must be a UUID", "uuid"},
+				{"email", "email", "", "must be an email address", "email"},
+				{"name", "max", "5", "must be at most 5 characters long", "max.string"},
+				{"website", "url", "", "must be a URL", "url"},
+				{"plan", "oneof", "free pro", "must be one of free, pro", "oneof"},
+				{"password", "len", "8", "must be exactly 8 characters long", "len.string"},
+				{"confirm", "eqfield", "password", "must equal password", "eqfield"},
+				{"to", "gtefield", "from", "must be greater than or equal to from", "gtefield"},
+				{"tags[1]", "min", "2", "must be at least 2 characters long", "min.string"},
+				{"lines[1].sku", "regex", "^[A-Z]{2,3}-[0-9]+$", "must match ^[A-Z]{2,3}-[0-9]+$", "regex"},
+				{"lines[1].quantity", "min", "1", "must be at least 1", "min.number"},
+				{"labels.team", "oneof", "red blue", "must be one of red, blue", "oneof"},
+			}},
+		{INSERTONE, `{"name": "Oti", "plan": "free", "password": "12345678", "confirm": "12345678", "tags": ["go", "js", "py"]}`,
+			http.StatusUnprocessableEntity, []FieldError{
+				{"email", "required", "", "is required", "required"},
+				{"tags", "max", "2", "must have at most 2 items", "max.items"},
+				{"lines", "required", "", "is required", "required"},
+			}},
+		{UPDATE, `{"name": "Oti", "plan": "free", "lines": [{"sku": "AB-1", "quantity": 1}]}`, http.StatusNoContent, nil},
+	}
+	service := NewFakeService(FakeScenario{})
+	for i, test := range tests {
+		storage := NewMemory(reflect.TypeOf(FakeSignup{}))
+		resource := NewResource("signup").
+			UseType(reflect.TypeOf(FakeSignup{})).
+			UseStorage(storage).
+			UseValidator(&TagValidator{}).
+			UseSerializer(&JSON{})
+		url := "http://foo.bar/signups"
+		if test.action == UPDATE {
+			serve(service.InsertOne(resource), "POST", url, `{"id": "8e7a4bb8-d3a4-4ad5-a5a6-9d1ef1ed4d3b", "email": "a@b.co", "name": "Oti", "plan": "free", "password": "12345678", "confirm": "12345678", "lines": [{"sku": "AB-1", "quantity": 1}]}`)
+			url += "/8e7a4bb8-d3a4-4ad5-a5a6-9d1ef1ed4d3b"
+		}
+		w := serve(service.process(resource, test.action), map[string]string{INSERTONE: "POST", UPDATE: "PUT"}[test.action], url, test.body)
+		if w.Code != test.status {
+			t.Errorf("#%d Error, expected %d, got %d: %s", i, test.status, w.Code, w.Body.String())
+			continue
+		}
+		if test.expected == nil {
+			continue
+		}
+		var errs []FieldError
+		json.Unmarshal(w.Body.Bytes(), &errs)
+		if !reflect.DeepEqual(errs, test.expected) {
+			t.Errorf("#%d Error, expected %+v, got %+v", i, test.expected, errs)
+		}
+	}
+}
+
+func TestTagValidatorMalformed(t *testing.T) {
+	type FakeMalformed struct {
+		ID   string `json:"id"`
+		Name string `json:"name" validate:"between=1"`
+	}
+	resource := NewResource("malformed").
+		UseType(reflect.TypeOf(FakeMalformed{})).
+		UseStorage(NewMemory(reflect.TypeOf(FakeMalformed{}))).
+		UseValidator(&TagValidator{}).
+		UseSerializer(&JSON{})
+	w := serve(NewFakeService(FakeScenario{}).InsertMany(resource), "POST", "http://foo.bar/malformed", `[{"name": "x"}]`)
+	if w.Code != http.StatusInternalServerError {
+		t.Errorf("Error, expected %d, got %d", http.StatusInternalServerError, w.Code)
+	}
+}
+
+func TestTagValidatorConcurrentRequests(t *testing.T) {
+	type FakeNamed struct {
+		ID   string `json:"id"`
+		Name string `json:"name" validate:"required,max=5"`
+	}
+	resource := NewResource("named").
+		UseType(reflect.TypeOf(FakeNamed{})).
+		UseStorage(NewMemory(reflect.TypeOf(FakeNamed{}))).
+		UseValidator(&TagValidator{}).
+		UseSerializer(&JSON{}).
+		AddHook(BEFOREVALIDATE, func(model *Model) error {
+			// Keep requests validating at the same time
+			time.Sleep(5 * time.Millisecond)
+			return nil
+		})
+	service := NewFakeService(FakeScenario{})
+	codes := make([]int, 50)
+	var wg sync.WaitGroup
+	for i := range codes {
+		wg.Add(1)
+		go func(i int) {
+			defer wg.Done()
+			body := `{"name": "Oti"}`
+			if i%2 == 1 {
+				body = `{"name": "Otieno Kamau"}`
+			}
+			codes[i] = serve(service.InsertOne(resource), "POST", "http://foo.bar/named", body).Code
+		}(i)
+	}
+	wg.Wait()
+	for i, code := range codes {
+		expected := http.StatusCreated
+		if i%2 == 1 {
+			expected = http.StatusUnprocessableEntity
+		}
+		if code != expected {
+			t.Errorf("#%d Error, expected %d, got %d", i, expected, code)
+		}
+	}
+}
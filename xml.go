@@ -0,0 +1,198 @@
+package rest
+
+import (
+	"bytes"
+	"encoding/xml"
+	"errors"
+	"net/http"
+	"reflect"
+	"sort"
+)
+
+// XML - a Serializer for application/xml, field names follow the `xml` struct tags as with encoding/xml
+type XML struct {
+	*Context
+	// Root names the element of a single document, it defaults to the name encoding/xml gives the type
+	Root string
+	// Collection names the element wrapping the documents of findMany and insertMany, it defaults to "items"
+	Collection string
+}
+
+// UseContext -
+func (x *XML) UseContext(c *Context) {
+	x.Context = c
+}
+
+// Clone - returns an XML serializer with the same element names for another request
+func (x *XML) Clone() Serializer {
+	c := *x
+	c.Context = nil
+	return &c
+}
+
+// Decode -
+func (x *XML) Decode() (err error) {
+	r := x.Context.GetRequest()
+	if r.Method != "POST" && r.Method != "PUT" && r.Method != "PATCH" {
+		return nil
+	}
+	t := x.Context.Get(DATATYPE).(reflect.Type)
+	decoder := xml.NewDecoder(r.Body)
+	var v interface{}
+	if x.Context.Get(ACTION) == INSERTMANY {
+		v, err = decodeXMLList(decoder, t)
+	} else {
+		v = reflect.New(t).Interface()
+		err = decoder.Decode(v)
+	}
+	x.Context.Set(REQUESTBODY, v)
+	if err != nil {
+		x.Context.SetResponseStatus(http.StatusBadRequest)
+		x.Context.SetResponseBody(err.Error())
+	}
+	return err
+}
+
+var errNoCollection = errors.New("The request body has no collection element")
+
+// decodeXMLList decodes every child element of the root element into a slice of t
+func decodeXMLList(decoder *xml.Decoder, t reflect.Type) (interface{}, error) {
+	list := reflect.New(reflect.SliceOf(t))
+	for {
+		token, err := decoder.Token()
+		if err != nil {
+			return list.Interface(), errNoCollection
+		}
+		if _, ok := token.(xml.StartElement); ok {
+			break
+		}
+	}
+	for {
+		token, err := decoder.Token()
+		if err != nil {
+			return list.Interface(), err
+		}
+		switch e := token.(type) {
+		case xml.StartElement:
+			item := reflect.New(t)
+			if err = decoder.DecodeElement(item.Interface(), &e); err != nil {
+				return list.Interface(), err
+			}
+			list.Elem().Set(reflect.Append(list.Elem(), item.Elem()))
+		case xml.EndElement:
+			return list.Interface(), nil
+		}
+	}
+}
+
+// Encode - strings are error messages and encode as <error>, Violations as <errors> holding an <error> for each
+// field, slices are wrapped in the collection element
+func (x *XML) Encode(v interface{}) ([]byte, error) {
+	if v == nil {
+		return nil, nil
+	}
+	var b bytes.Buffer
+	b.WriteString(xml.Header)
+	e := xml.NewEncoder(&b)
+	var err error
+	switch body := v.(type) {
+	case string:
+		err = e.EncodeElement(body, xmlStart("error"))
+	case Violations:
+		err = encodeXMLErrors(e, body.Errors())
+	case Envelope:
+		err = x.encodeList(e, reflect.ValueOf(body.Data), body.Page)
+	default:
+		rv := reflect.Indirect(reflect.ValueOf(v))
+		if rv.Kind() == reflect.Slice || rv.Kind() == reflect.Array {
+			err = x.encodeList(e, rv, nil)
+		} else {
+			err = x.encodeItem(e, rv)
+		}
+	}
+	if err == nil {
+		err = e.Flush()
+	}
+	return b.Bytes(), err
+}
+
+// xmlError - a FieldError encoded as <error field="name" rule="required">is required</error>
+type xmlError struct {
+	Field   string `xml:"field,attr,omitempty"`
+	Rule    string `xml:"rule,attr,omitempty"`
+	Param   string `xml:"param,attr,omitempty"`
+	Code    string `xml:"code,attr,omitempty"`
+	Message string `xml:",chardata"`
+}
+
+func encodeXMLErrors(e *xml.Encoder, errs []FieldError) error {
+	start := xmlStart("errors")
+	if err := e.EncodeToken(start); err != nil {
+		return err
+	}
+	for _, fe := range errs {
+		x := xmlError{Field: fe.Field, Rule: fe.Rule, Param: fe.Param, Code: fe.Code, Message: fe.Message}
+		if err := e.EncodeElement(x, xmlStart("error")); err != nil {
+			return err
+		}
+	}
+	return e.EncodeToken(start.End())
+}
+
+func xmlStart(name string) xml.StartElement {
+	return xml.StartElement{Name: xml.Name{Local: name}}
+}
+
+func (x *XML) encodeList(e *xml.Encoder, list reflect.Value, page interface{}) error {
+	collection := x.Collection
+	if collection == "" {
+		collection = "items"
+	}
+	start := xmlStart(collection)
+	if err := e.EncodeToken(start); err != nil {
+		return err
+	}
+	for i := 0; list.IsValid() && i < list.Len(); i++ {
+		if err := x.encodeItem(e, list.Index(i)); err != nil {
+			return err
+		}
+	}
+	if page != nil {
+		if err := e.EncodeElement(page, xmlStart("page")); err != nil {
+			return err
+		}
+	}
+	return e.EncodeToken(start.End())
+}
+
+// encodeItem encodes a document, maps of projected fields become an element per key
+func (x *XML) encodeItem(e *xml.Encoder, v reflect.Value) error {
+	if v.Kind() == reflect.Interface {
+		v = v.Elem()
+	}
+	if v.Kind() != reflect.Map {
+		if x.Root == "" {
+			return e.Encode(v.Interface())
+		}
+		return e.EncodeElement(v.Interface(), xmlStart(x.Root))
+	}
+	root := x.Root
+	if root == "" {
+		root = "item"
+	}
+	start := xmlStart(root)
+	if err := e.EncodeToken(start); err != nil {
+		return err
+	}
+	keys := make([]string, 0, v.Len())
+	for _, k := range v.MapKeys() {
+		keys = append(keys, k.String())
+	}
+	sort.Strings(keys)
+	for _, k := range keys {
+		if err := e.EncodeElement(v.MapIndex(reflect.ValueOf(k)).Interface(), xmlStart(k)); err != nil {
+			return err
+		}
+	}
+	return e.EncodeToken(start.End())
+}
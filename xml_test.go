@@ -0,0 +1,113 @@
+package rest
+
+import (
+	"net/http"
+	"net/http/httptest"
+	"reflect"
+	"testing"
+	"time"
+)
+
+func NewFakeXMLResource(s FakeScenario) *Resource {
+	return NewResource("tester").
+		UseType(reflect.TypeOf(FakeFields{})).
+		UseStorage(&FakeStorage{fail: s.failDatabase}).
+		UseValidator(&FakeValidator{}).
+		UseSerializer(&XML{Root: "tester", Collection: "testers"})
+}
+
+func TestXMLScenarios(t *testing.T) {
+	validBody := `<tester><Name>Otieno Kamau</Name><Age>21</Age></tester>`
+	invalidXML := "<tester><Name>"
+	invalidBody := `<tester><Name>Otieno Kamau</Name><Age>12</Age></tester>`
+	manyBody := `<testers><tester><Name>Otieno Kamau</Name><Age>21</Age></tester><tester><Name>Bernie Burst</Name><Age>81</Age></tester></testers>`
+	tests := []struct {
+		action   string
+		verb     string
+		url      string
+		scenario FakeScenario
+		expected int
+	}{
+		{INSERTONE, "POST", "http://foo.bar/test", FakeScenario{body: validBody}, http.StatusCreated},
+		{INSERTONE, "POST", "http://foo.bar/test", FakeScenario{body: validBody, failDatabase: true}, http.StatusInternalServerError},
+		{INSERTONE, "POST", "http://foo.bar/test", FakeScenario{body: validBody, failBroker: true}, http.StatusInternalServerError},
+		{INSERTONE, "POST", "http://foo.bar/test", FakeScenario{body: validBody, failMetrics: true}, http.StatusInternalServerError},
+		{INSERTONE, "POST", "http://foo.bar/test", FakeScenario{body: invalidXML}, http.StatusBadRequest},
+		{INSERTONE, "POST", "http://foo.bar/test", FakeScenario{body: invalidBody}, http.StatusBadRequest},
+		{INSERTMANY, "POST", "http://foo.bar/test", FakeScenario{body: manyBody}, http.StatusCreated},
+		{INSERTMANY, "POST", "http://foo.bar/test", FakeScenario{body: manyBody, failDatabase: true}, http.StatusInternalServerError},
+		{INSERTMANY, "POST", "http://foo.bar/test", FakeScenario{body: ""}, http.StatusBadRequest},
+		{UPDATE, "PUT", "http://foo.bar/test/1", FakeScenario{body: validBody}, http.StatusNoContent},
+		{UPDATE, "PUT", "http://foo.bar/test/1", FakeScenario{body: invalidXML}, http.StatusBadRequest},
+		{UPSERT, "PUT", "http://foo.bar/test/1", FakeScenario{body: validBody}, http.StatusOK},
+		{UPSERT, "PUT", "http://foo.bar/test/1", FakeScenario{body: validBody, failDatabase: true}, http.StatusInternalServerError},
+		{REMOVE, "DELETE", "http://foo.bar/test/1", FakeScenario{}, http.StatusNoContent},
+		{FINDONE, "GET", "http://foo.bar/test/1", FakeScenario{}, http.StatusOK},
+		{FINDONE, "GET", "http://foo.bar/test/bad-id-format", FakeScenario{}, http.StatusBadRequest},
+		{FINDMANY, "GET", "http://foo.bar/test", FakeScenario{}, http.StatusOK},
+		{FINDMANY, "GET", "http://foo.bar/test", FakeScenario{failDatabase: true}, http.StatusInternalServerError},
+	}
+	for i, test := range tests {
+		service := NewFakeService(test.scenario)
+		h := service.process(NewFakeXMLResource(test.scenario), test.action)
+		w := httptest.NewRecorder()
+		h(w, NewTestRequest(test.verb, test.url, test.scenario.body))
+		if w.Code != test.expected {
+			t.Errorf("#%d Error, expected %d, got %d for %s %s", i, test.expected, w.Code, test.action, test.scenario.body)
+		}
+	}
+}
+
+func TestXMLEncode(t *testing.T) {
+	total := int64(2)
+	due := time.Date(2017, 1, 2, 15, 4, 5, 0, time.UTC)
+	tests := []struct {
+		serializer *XML
+		body       interface{}
+		expected   string
+	}{
+		{&XML{}, "The data is invalid", `<error>The data is invalid</error>`},
+		{&XML{}, &FakeFields{Name: "Otieno Kamau", Age: 21}, `<FakeFields><Name>Otieno Kamau</Name><Age>21</Age></FakeFields>`},
+		{&XML{Root: "tester"}, &FakeFields{Name: "Otieno Kamau", Age: 21}, `<tester><Name>Otieno Kamau</Name><Age>21</Age></tester>`},
+		{&XML{Root: "tester", Collection: "testers"}, []FakeFields{{Name: "A", Age: 1}, {Name: "B", Age: 2}},
+			`<testers><tester><Name>A</Name><Age>1</Age></tester><tester><Name>B</Name><Age>2</Age></tester></testers>`},
+		{&XML{}, []FakeFields{}, `<items></items>`},
+		{&XML{Root: "todo"}, []map[string]interface{}{{"title": "Milk", "due": due}},
+			`<items><todo><due>2017-01-02T15:04:05Z</due><title>Milk</title></todo></items>`},
+		{&XML{Root: "tester"}, Envelope{Data: []FakeFields{{Name: "A", Age: 1}}, Page: PageInfo{Next: "abc", Total: &total}},
+			`<items><tester><Name>A</Name><Age>1</Age></tester><page><next>abc</next><total>2</total></page></items>`},
+		{&XML{Root: "tester", Collection: "testers"}, ValidationErrors{{Field: "name", Rule: "required", Message: "is required", Code: "required"}, {Field: "age", Rule: "min", Param: "18", Message: "must be at least 18 & over", Code: "min.number"}},
+			`<errors><error field="name" rule="required" code="required">is required</error><error field="age" rule="min" param="18" code="min.number">must be at least 18 &amp; over</error></errors>`},
+		{&XML{Root: "tester"}, SchemaErrors{{Pointer: "/name", Keyword: "/properties/name/maxLength", Param: "5", Message: "must be at most 5 characters long"}},
+			`<errors><error field="/name" rule="maxLength" param="5" code="maxLength">must be at most 5 characters long</error></errors>`},
+	}
+	for i, test := range tests {
+		b, err := test.serializer.Encode(test.body)
+		if err != nil {
+			t.Errorf("#%d Error, unexpected error %s", i, err)
+		}
+		if expected := `<?xml version="1.0" encoding="UTF-8"?>` + "\n" + test.expected; string(b) != expected {
+			t.Errorf("#%d Error, expected %s, got %s", i, expected, b)
+		}
+	}
+	if b, _ := (&XML{}).Encode(nil); len(b) != 0 {
+		t.Errorf("Error, expected an empty body for nil, got %s", b)
+	}
+}
+
+func TestXMLViolations(t *testing.T) {
+	type FakeXMLNamed struct {
+		ID   string `json:"id" xml:"id"`
+		Name string `json:"name" xml:"name" validate:"required"`
+	}
+	resource := NewResource("named").
+		UseType(reflect.TypeOf(FakeXMLNamed{})).
+		UseStorage(NewMemory(reflect.TypeOf(FakeXMLNamed{}))).
+		UseValidator(&TagValidator{}).
+		UseSerializer(&XML{Root: "named", Collection: "names"})
+	w := serve(NewFakeService(FakeScenario{}).InsertOne(resource), "POST", "http://foo.bar/names", `<named></named>`)
+	expected := `<?xml version="1.0" encoding="UTF-8"?>` + "\n" + `<errors><error field="name" rule="required" code="required">is required</error></errors>`
+	if w.Code != http.StatusUnprocessableEntity || w.Body.String() != expected {
+		t.Errorf("Error, expected %d %s, got %d %s", http.StatusUnprocessableEntity, expected, w.Code, w.Body.String())
+	}
+}